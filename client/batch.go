@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image-proc/imageproc"
+	pb "image-proc/proto"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batch entry statuses
+const (
+	batchSucceeded = "succeeded"
+	batchFailed    = "failed"
+)
+
+// batchImageExts are the files picked up when walking a directory
+var batchImageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// batchManifest records the outcome of every file in a batch so that a
+// later run with -resume only redoes what did not succeed
+type batchManifest struct {
+	Source     string        `json:"source"`
+	Output     string        `json:"output"`
+	Filters    []string      `json:"filters"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Succeeded  int           `json:"succeeded"`
+	Failed     int           `json:"failed"`
+	Skipped    int           `json:"skipped"`
+	Entries    []*batchEntry `json:"entries,omitempty"`
+}
+
+// batchEntry is one source file; Path is relative to the batch root
+type batchEntry struct {
+	Path          string `json:"path"`
+	Status        string `json:"status"`
+	ImageID       string `json:"image_id,omitempty"`
+	JobID         string `json:"job_id,omitempty"`
+	ResultImageID string `json:"result_image_id,omitempty"`
+	Output        string `json:"output,omitempty"`
+	Bytes         int64  `json:"bytes,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// batch is one run of the batch command
+type batch struct {
+	a        *app
+	root     string
+	out      string
+	filters  []string
+	priority pb.Priority
+	cleanup  bool
+
+	manifestPath string
+	mu           sync.Mutex // guards manifest and dirty
+	manifest     *batchManifest
+	dirty        bool
+
+	total, done, ok, failed, skipped, inFlight atomic.Int64
+}
+
+func runBatch(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("batch")
+	filters := fs.String("filters", strings.Join(a.cfg.Filters, ","), "comma-separated filters applied to every image")
+	priority := fs.String("priority", "normal", "queue priority: low, normal or high")
+	concurrency := fs.Int("concurrency", 4, "images processed at the same time")
+	out := fs.String("out", "processed", "directory the results are written to, mirroring the source tree")
+	manifestPath := fs.String("manifest", "", "manifest path (default <out>/manifest.json)")
+	resume := fs.Bool("resume", false, "skip files the manifest records as succeeded")
+	cleanup := fs.Bool("cleanup", false, "delete the uploaded and processed images from the server after download")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 1, "one directory or glob pattern"); err != nil {
+		return err
+	}
+	if *concurrency < 1 {
+		return usagef("batch: -concurrency must be at least 1")
+	}
+	p, err := parsePriority("batch", *priority)
+	if err != nil {
+		return err
+	}
+
+	root, files, err := batchFiles(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b := &batch{
+		a:            a,
+		root:         root,
+		out:          *out,
+		filters:      splitFilters(*filters),
+		priority:     p,
+		cleanup:      *cleanup,
+		manifestPath: *manifestPath,
+	}
+	if b.manifestPath == "" {
+		b.manifestPath = filepath.Join(b.out, "manifest.json")
+	}
+
+	previous := map[string]*batchEntry{}
+	if *resume {
+		m, err := loadManifest(b.manifestPath)
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(m.Filters, b.filters) {
+			return usagef("batch: manifest was written for filters %s, not %s",
+				strings.Join(m.Filters, ","), strings.Join(b.filters, ","))
+		}
+		for _, e := range m.Entries {
+			previous[e.Path] = e
+		}
+	}
+	b.manifest = &batchManifest{Source: fs.Arg(0), Output: b.out, Filters: b.filters, StartedAt: time.Now().UTC()}
+	return b.run(ctx, files, previous, *concurrency)
+}
+
+// batchFiles expands a directory or glob pattern into files relative to
+// the returned root, in lexical order
+func batchFiles(source string) (string, []string, error) {
+	var root string
+	var paths []string
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		root = source
+		err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && batchImageExts[strings.ToLower(filepath.Ext(path))] {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			return "", nil, usagef("batch: %v", err)
+		}
+		// the root is the deepest directory without glob characters
+		root = filepath.Dir(source)
+		for strings.ContainsAny(root, "*?[") {
+			root = filepath.Dir(root)
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() {
+				paths = append(paths, m)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return "", nil, fmt.Errorf("batch: no images found in %s", source)
+	}
+
+	rel := make([]string, len(paths))
+	for i, p := range paths {
+		r, err := filepath.Rel(root, p)
+		if err != nil {
+			return "", nil, err
+		}
+		rel[i] = r
+	}
+	slices.Sort(rel)
+	return root, rel, nil
+}
+
+func loadManifest(path string) (*batchManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("resume: %w", err)
+	}
+	var m batchManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("resume: %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// run processes files with the given concurrency and writes the manifest
+func (b *batch) run(ctx context.Context, files []string, previous map[string]*batchEntry, concurrency int) error {
+	if err := os.MkdirAll(b.out, 0755); err != nil {
+		return err
+	}
+	b.total.Store(int64(len(files)))
+
+	// files that already succeeded and whose output is still there are
+	// carried over into the new manifest unchanged
+	var todo []string
+	for _, path := range files {
+		if e, ok := previous[path]; ok && e.Status == batchSucceeded && fileExists(e.Output) {
+			b.record(e)
+			b.skipped.Add(1)
+			continue
+		}
+		todo = append(todo, path)
+	}
+
+	stopReport := b.report(os.Stderr)
+	stopSave := b.autosave()
+
+	tasks := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range tasks {
+				b.record(b.processFile(ctx, path))
+			}
+		}()
+	}
+feed:
+	for _, path := range todo {
+		select {
+		case tasks <- path:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	stopSave()
+	stopReport()
+
+	b.mu.Lock()
+	now := time.Now().UTC()
+	b.manifest.FinishedAt = &now
+	b.mu.Unlock()
+	if err := b.save(); err != nil {
+		return err
+	}
+	if err := b.a.out.batchSummary(b.manifestSummary()); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("batch interrupted, rerun with -resume: %w", err)
+	}
+	if n := b.failed.Load(); n > 0 {
+		return fmt.Errorf("%d of %d images failed, see %s", n, len(files), b.manifestPath)
+	}
+	return nil
+}
+
+// processFile uploads, processes and downloads one file
+func (b *batch) processFile(ctx context.Context, path string) *batchEntry {
+	b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	e := &batchEntry{Path: path}
+	if err := b.processEntry(ctx, e); err != nil {
+		e.Status, e.Error = batchFailed, err.Error()
+		b.failed.Add(1)
+		b.a.log.Warnw("batch image failed", "path", path, "error", err)
+		return e
+	}
+	e.Status = batchSucceeded
+	b.ok.Add(1)
+	return e
+}
+
+func (b *batch) processEntry(ctx context.Context, e *batchEntry) error {
+	id, err := b.a.client.UploadFile(ctx, filepath.Join(b.root, e.Path), nil)
+	if err != nil {
+		return err
+	}
+	e.ImageID = id
+
+	updates, err := b.a.client.Process(ctx, id, b.filters, imageproc.WithPriority(b.priority))
+	if err != nil {
+		return err
+	}
+	last, err := imageproc.Wait(updates)
+	e.JobID = last.JobID
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if last.State != pb.JobState_JOB_STATE_SUCCEEDED {
+		return fmt.Errorf("job %s: %s", stateName(last.State), last.Status)
+	}
+	e.ResultImageID = last.ResultImageID
+
+	info, err := b.a.client.GetImage(ctx, e.ResultImageID)
+	if err != nil {
+		return err
+	}
+	e.Output = outputPath(b.out, e.Path, info.GetFormat())
+	e.Bytes, err = b.download(ctx, e.ResultImageID, e.Output)
+	if err != nil {
+		return err
+	}
+
+	if b.cleanup {
+		for _, id := range []string{e.ImageID, e.ResultImageID} {
+			if err := b.a.client.DeleteImage(ctx, id); err != nil && !errors.Is(err, imageproc.ErrNotFound) {
+				b.a.log.Warnw("batch cleanup failed", "image_id", id, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// outputPath mirrors rel under out, fixing the extension when the server
+// re-encoded the image in another format
+func outputPath(out, rel, format string) string {
+	path := filepath.Join(out, rel)
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case format == "png" && ext != ".png":
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + ".png"
+	case format == "jpeg" && ext != ".jpg" && ext != ".jpeg":
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + ".jpg"
+	}
+	return path
+}
+
+// download writes an image to path through a temporary file
+func (b *batch) download(ctx context.Context, id, path string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	n, err := b.a.client.Download(ctx, id, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return n, nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// record adds a finished entry to the manifest
+func (b *batch) record(e *batchEntry) {
+	b.done.Add(1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.manifest.Entries = append(b.manifest.Entries, e)
+	b.dirty = true
+}
+
+// snapshot copies the manifest with its counters filled in. Succeeded and
+// Failed count entries, so they include files carried over by -resume.
+func (b *batch) snapshot() batchManifest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := *b.manifest
+	m.Entries = slices.Clone(b.manifest.Entries)
+	m.Succeeded, m.Failed = 0, 0
+	for _, e := range m.Entries {
+		if e.Status == batchSucceeded {
+			m.Succeeded++
+		} else {
+			m.Failed++
+		}
+	}
+	m.Skipped = int(b.skipped.Load())
+	return m
+}
+
+// manifestSummary returns the manifest's counters without its entries
+func (b *batch) manifestSummary() batchManifest {
+	m := b.snapshot()
+	m.Entries = nil
+	return m
+}
+
+// save writes the manifest atomically, entries sorted by path
+func (b *batch) save() error {
+	b.mu.Lock()
+	b.dirty = false
+	b.mu.Unlock()
+	m := b.snapshot()
+
+	slices.SortFunc(m.Entries, func(x, y *batchEntry) int { return strings.Compare(x.Path, y.Path) })
+	data, err := json.MarshalIndent(&m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := b.manifestPath + ".part"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.manifestPath)
+}
+
+// manifestInterval bounds how often the manifest is rewritten; a crash
+// loses at most this much bookkeeping, which -resume simply redoes
+const manifestInterval = 2 * time.Second
+
+// autosave rewrites the manifest periodically while the batch runs
+func (b *batch) autosave() (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(manifestInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				b.mu.Lock()
+				dirty := b.dirty
+				b.mu.Unlock()
+				if dirty {
+					if err := b.save(); err != nil {
+						b.a.log.Warnw("failed to save batch manifest", "error", err)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// report prints aggregate progress to w: redrawn in place on a terminal,
+// otherwise a line every few seconds
+func (b *batch) report(w *os.File) (stop func()) {
+	interval, format := 10*time.Second, "%s\n"
+	if info, err := w.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		interval, format = 250*time.Millisecond, "\r\033[K%s"
+	}
+	start := time.Now()
+	line := func() string {
+		done := b.done.Load()
+		rate := float64(done-b.skipped.Load()) / time.Since(start).Seconds()
+		return fmt.Sprintf("batch: %d/%d done (%d ok, %d failed, %d skipped), %d in flight, %.1f images/s",
+			done, b.total.Load(), b.ok.Load(), b.failed.Load(), b.skipped.Load(), b.inFlight.Load(), rate)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				fmt.Fprintf(w, format, line())
+			case <-done:
+				fmt.Fprintf(w, format, line())
+				if format != "%s\n" {
+					fmt.Fprintln(w)
+				}
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image-proc/config"
+	"image-proc/imageproc"
+	pb "image-proc/proto"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeServer names every upload "img-<content>" and processes it into
+// "out-<content>", whose bytes are "processed <content>". Jobs for the
+// images in fail end FAILED.
+type fakeServer struct {
+	pb.UnimplementedImageProcessorServer
+
+	mu      sync.Mutex
+	fail    map[string]bool
+	uploads []string
+	filters [][]string
+}
+
+func (f *fakeServer) Upload(stream pb.ImageProcessor_UploadServer) error {
+	var content []byte
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		content = append(content, req.Chunk...)
+	}
+	f.mu.Lock()
+	f.uploads = append(f.uploads, string(content))
+	f.mu.Unlock()
+	return stream.SendAndClose(&pb.UploadResponse{ImageId: "img-" + string(content)})
+}
+
+func (f *fakeServer) Process(req *pb.ProcessingRequest, stream pb.ImageProcessor_ProcessServer) error {
+	f.mu.Lock()
+	f.filters = append(f.filters, req.Filters)
+	failed := f.fail[req.ImageId]
+	f.mu.Unlock()
+	jobID := "job-" + strings.TrimPrefix(req.ImageId, "img-")
+	if failed {
+		return stream.Send(&pb.ProgressUpdate{JobId: jobID, State: pb.JobState_JOB_STATE_FAILED, Status: "filter crashed"})
+	}
+	return stream.Send(&pb.ProgressUpdate{
+		JobId:         jobID,
+		State:         pb.JobState_JOB_STATE_SUCCEEDED,
+		Percent:       100,
+		ResultImageId: "out-" + strings.TrimPrefix(req.ImageId, "img-"),
+	})
+}
+
+func (f *fakeServer) GetImage(_ context.Context, req *pb.GetImageRequest) (*pb.ImageInfo, error) {
+	return &pb.ImageInfo{ImageId: req.ImageId, Format: "png"}, nil
+}
+
+func (f *fakeServer) Download(req *pb.DownloadRequest, stream pb.ImageProcessor_DownloadServer) error {
+	content, ok := strings.CutPrefix(req.ImageId, "out-")
+	if !ok {
+		return status.Errorf(codes.NotFound, "image %s not found", req.ImageId)
+	}
+	return stream.Send(&pb.DownloadChunk{Chunk: []byte("processed " + content)})
+}
+
+// uploaded returns the contents uploaded since the last call, sorted
+func (f *fakeServer) uploaded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	got := f.uploads
+	f.uploads = nil
+	slices.Sort(got)
+	return got
+}
+
+// newTestApp returns an app talking to f in memory
+func newTestApp(t *testing.T, f *fakeServer) *app {
+	t.Helper()
+	gs := grpc.NewServer()
+	pb.RegisterImageProcessorServer(gs, f)
+	lis := bufconn.Listen(1 << 20)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &app{
+		cfg:    config.DefaultClient(),
+		client: imageproc.New(conn),
+		log:    zap.NewNop().Sugar(),
+		out:    newPrinter(&bytes.Buffer{}, "json"),
+	}
+}
+
+// writeSource creates a batch source tree holding files, each containing
+// its own name without the extension
+func writeSource(t *testing.T, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readManifest(t *testing.T, path string) *batchManifest {
+	t.Helper()
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestBatchResume(t *testing.T) {
+	f := &fakeServer{fail: map[string]bool{"img-b": true}}
+	a := newTestApp(t, f)
+	src := writeSource(t, "a.png", "sub/b.png", "c.jpg", "notes.txt")
+	out := filepath.Join(t.TempDir(), "out")
+	manifestPath := filepath.Join(out, "manifest.json")
+	args := []string{"-filters", "invert,blur", "-out", out, "-concurrency", "2", src}
+
+	err := runBatch(context.Background(), a, args)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 images failed") {
+		t.Fatalf("first run = %v, want one of three images failed", err)
+	}
+	if got := f.uploaded(); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("first run uploaded %q, want every image", got)
+	}
+	m := readManifest(t, manifestPath)
+	if m.Succeeded != 2 || m.Failed != 1 || m.Skipped != 0 || m.FinishedAt == nil || len(m.Entries) != 3 {
+		t.Fatalf("first manifest %+v, want 2 succeeded and 1 failed", m)
+	}
+	first := map[string]*batchEntry{}
+	for _, e := range m.Entries {
+		first[e.Path] = e
+	}
+	// the jpeg came back as png, so its output is renamed to match
+	for path, output := range map[string]string{"a.png": "a.png", "c.jpg": "c.png"} {
+		e := first[path]
+		if e == nil || e.Status != batchSucceeded || e.Output != filepath.Join(out, output) {
+			t.Errorf("entry for %s = %+v, want it written to %s", path, e, output)
+			continue
+		}
+		if data, err := os.ReadFile(e.Output); err != nil || !strings.HasPrefix(string(data), "processed ") {
+			t.Errorf("output %s = %q, %v", e.Output, data, err)
+		}
+	}
+	if e := first[filepath.Join("sub", "b.png")]; e == nil || e.Status != batchFailed || !strings.Contains(e.Error, "filter crashed") || e.JobID != "job-b" {
+		t.Errorf("entry for sub/b.png = %+v, want the failed job recorded", e)
+	}
+
+	// c's output goes missing before the rerun, so it is redone along
+	// with b while a is carried over
+	if err := os.Remove(filepath.Join(out, "c.png")); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.fail = nil
+	f.mu.Unlock()
+	if err := runBatch(context.Background(), a, append([]string{"-resume"}, args...)); err != nil {
+		t.Fatalf("resumed run = %v", err)
+	}
+	if got := f.uploaded(); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("resumed run uploaded %q, want only b and c", got)
+	}
+	m = readManifest(t, manifestPath)
+	if m.Succeeded != 3 || m.Failed != 0 || m.Skipped != 1 || len(m.Entries) != 3 {
+		t.Errorf("resumed manifest %+v, want 3 succeeded with 1 skipped", m)
+	}
+	for _, e := range m.Entries {
+		if e.Status != batchSucceeded || !fileExists(e.Output) {
+			t.Errorf("entry %+v, want it succeeded with its output present", e)
+		}
+		if e.Path == "a.png" && *e != *first["a.png"] {
+			t.Errorf("carried over entry %+v, want it unchanged from %+v", e, first["a.png"])
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, filters := range f.filters {
+		if !slices.Equal(filters, []string{"invert", "blur"}) {
+			t.Errorf("processed with filters %q, want invert,blur", filters)
+		}
+	}
+}
+
+func TestBatchResumeRefused(t *testing.T) {
+	f := &fakeServer{}
+	a := newTestApp(t, f)
+	src := writeSource(t, "a.png")
+	out := t.TempDir()
+
+	// nothing to resume from
+	err := runBatch(context.Background(), a, []string{"-resume", "-out", out, src})
+	if err == nil || !strings.Contains(err.Error(), "resume") {
+		t.Errorf("resume without a manifest = %v, want it refused", err)
+	}
+
+	// a manifest for other filters
+	if err := runBatch(context.Background(), a, []string{"-filters", "invert", "-out", out, src}); err != nil {
+		t.Fatal(err)
+	}
+	f.uploaded()
+	var usage usageError
+	err = runBatch(context.Background(), a, []string{"-resume", "-filters", "blur", "-out", out, src})
+	if !errors.As(err, &usage) || !strings.Contains(err.Error(), "invert") {
+		t.Errorf("resume with other filters = %v, want a usage error naming the manifest's", err)
+	}
+
+	// a manifest that is not JSON
+	manifestPath := filepath.Join(out, "manifest.json")
+	if err := os.WriteFile(manifestPath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = runBatch(context.Background(), a, []string{"-resume", "-filters", "invert", "-out", out, src})
+	var syntax *json.SyntaxError
+	if !errors.As(err, &syntax) || !strings.Contains(err.Error(), manifestPath) {
+		t.Errorf("resume from a corrupt manifest = %v, want it refused", err)
+	}
+	if got := f.uploaded(); len(got) != 0 {
+		t.Errorf("refused resumes uploaded %q", got)
+	}
+}
@@ -0,0 +1,709 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image-proc/config"
+	"image-proc/imageproc"
+	pb "image-proc/proto"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// app is the state shared by every subcommand
+type app struct {
+	cfg    *config.Client
+	client *imageproc.Client
+	log    *zap.SugaredLogger
+	out    *printer
+}
+
+// command is one client subcommand
+type command struct {
+	name    string
+	args    string // argument synopsis shown in usage
+	summary string
+	offline bool // does not need a server connection
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+// usageError marks bad arguments so they exit with exitUsage
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// parsePriority maps a -priority flag value to its enum
+func parsePriority(cmd, name string) (pb.Priority, error) {
+	p, ok := pb.Priority_value["PRIORITY_"+strings.ToUpper(name)]
+	if !ok || p == 0 {
+		return 0, usagef("%s: unknown priority %q, want low, normal or high", cmd, name)
+	}
+	return pb.Priority(p), nil
+}
+
+// splitFilters splits a -filters value, dropping empty names so an empty
+// flag asks for no filters rather than one named ""
+func splitFilters(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func usagef(format string, args ...interface{}) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "version", summary: "print the server version", run: runVersion},
+		{name: "upload", args: "<file>...", summary: "upload images and print their IDs", run: runUpload},
+		{name: "download", args: "[-o path] <image-id>", summary: "download an image (to stdout with -o -)", run: runDownload},
+		{name: "process", args: "[-filters a,b] <image-id>...", summary: "process images and stream progress", run: runProcess},
+		{name: "tune", args: "[-params p:v,...] <image-id>", summary: "send tune parameters and print previews", run: runTune},
+		{name: "batch", args: "[-filters a,b] [-out dir] [-resume] <dir|glob>", summary: "process every image under a directory or glob", run: runBatch},
+		{name: "ls", args: "[-owner name]", summary: "list stored images", run: runList},
+		{name: "info", args: "<image-id>", summary: "show image metadata", run: runInfo},
+		{name: "rm", args: "<image-id>...", summary: "delete images", run: runRemove},
+		{name: "sign", args: "download <image-id> | upload [-max-bytes n] | render <image-id> [-query q]", summary: "issue a signed URL for the gateway", run: runSign},
+		{name: "jobs", args: "ls [-state s] | get|watch|deliveries <job-id>", summary: "list, inspect or follow jobs", run: runJobs},
+		{name: "deadletters", args: "ls [-owner p] | redrive <job-id>", summary: "list or re-run jobs that failed for good", run: runDeadLetters},
+		{name: "completion", args: "bash|zsh", summary: "print a shell completion script", offline: true, run: runCompletion},
+		{name: "run", summary: "run the legacy version/upload/process/tune script (default)", run: runLegacy},
+		{name: "help", summary: "show this help", offline: true, run: runHelp},
+	}
+}
+
+// findCommand looks up a subcommand by name
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// printUsage lists the subcommands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: client [global flags] <command> [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-11s %-46s %s\n", c.name, c.args, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "run 'client -h' for the global flags")
+}
+
+// newFlagSet returns a flag set for a subcommand that reports errors
+// instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("client "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// parseFlags parses args and wraps failures as usage errors
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return usageError{msg: err.Error()}
+	}
+	return nil
+}
+
+// exactArgs checks the number of positional arguments
+func exactArgs(fs *flag.FlagSet, n int, what string) error {
+	if fs.NArg() != n {
+		return usagef("%s: expected %s", strings.TrimPrefix(fs.Name(), "client "), what)
+	}
+	return nil
+}
+
+func runHelp(ctx context.Context, a *app, args []string) error {
+	printUsage(os.Stdout)
+	return nil
+}
+
+func runVersion(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("version")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	version, err := a.client.Version(ctx)
+	if err != nil {
+		return err
+	}
+	return a.out.version(version)
+}
+
+func runUpload(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("upload")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("upload: expected at least one file")
+	}
+	for _, path := range fs.Args() {
+		id, err := a.client.UploadFile(ctx, path, nil)
+		if err != nil {
+			return err
+		}
+		if err := a.out.uploaded(path, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runDownload(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("download")
+	output := fs.String("o", "", "output path, - for stdout (default <image-id>.jpg)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 1, "one image ID"); err != nil {
+		return err
+	}
+	id := fs.Arg(0)
+
+	if *output == "-" {
+		_, err := a.client.Download(ctx, id, os.Stdout)
+		return err
+	}
+	path := *output
+	if path == "" {
+		path = id + ".jpg"
+	}
+	// download to a temporary name so a failed transfer leaves nothing behind
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := a.client.Download(ctx, id, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return a.out.downloaded(id, path, n)
+}
+
+func runProcess(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("process")
+	filters := fs.String("filters", strings.Join(a.cfg.Filters, ","), "comma-separated filters")
+	priority := fs.String("priority", "normal", "queue priority: low, normal or high")
+	callback := fs.String("callback-url", "", "URL the server POSTs the outcome to when the job finishes")
+	detach := fs.Bool("detach", false, "return once the job is queued; requires -callback-url")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("process: expected at least one image ID")
+	}
+	if *detach && *callback == "" {
+		return usagef("process: -detach requires -callback-url")
+	}
+	p, err := parsePriority("process", *priority)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		if *callback != "" {
+			return usagef("process: -callback-url takes a single image ID")
+		}
+		return processBatch(ctx, a, fs.Args(), splitFilters(*filters), p)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	updates, err := a.client.Process(ctx, fs.Arg(0), splitFilters(*filters),
+		imageproc.WithPriority(p), imageproc.WithCallbackURL(*callback))
+	if err != nil {
+		return err
+	}
+	if *detach {
+		// the server keeps running a job with a callback after we hang up
+		first, ok := <-updates
+		if !ok {
+			return ctx.Err()
+		}
+		if first.Err != nil {
+			return first.Err
+		}
+		return a.out.progress(first)
+	}
+	return followJob(a, updates)
+}
+
+// processBatch runs several images in one ProcessBatch call and fails if
+// any of them did
+func processBatch(ctx context.Context, a *app, imageIDs, filters []string, priority pb.Priority) error {
+	events, err := a.client.ProcessBatch(ctx, imageIDs, filters, imageproc.WithPriority(priority))
+	if err != nil {
+		return err
+	}
+	var summary *pb.BatchSummary
+	var printErr error
+	for ev := range events {
+		if ev.Err != nil {
+			return ev.Err
+		}
+		if ev.Summary != nil {
+			summary = ev.Summary
+		}
+		if printErr == nil {
+			printErr = a.out.batchEvent(ev)
+		}
+	}
+	if printErr != nil {
+		return printErr
+	}
+	if summary == nil {
+		return ctx.Err()
+	}
+	if n := summary.GetFailed() + summary.GetCancelled(); n > 0 {
+		return fmt.Errorf("%d of %d images did not succeed", n, summary.GetTotal())
+	}
+	return nil
+}
+
+func runJobs(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return usagef("jobs: expected ls, get, watch or deliveries")
+	}
+	switch args[0] {
+	case "ls":
+		return runJobsList(ctx, a, args[1:])
+	case "get":
+		return runJobsGet(ctx, a, args[1:])
+	case "watch":
+		return runJobsWatch(ctx, a, args[1:])
+	case "deliveries":
+		return runJobsDeliveries(ctx, a, args[1:])
+	}
+	return usagef("jobs: unknown subcommand %q, want ls, get, watch or deliveries", args[0])
+}
+
+func runJobsList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("jobs ls")
+	owner := fs.String("owner", "", "principal whose jobs to list; only your own may be listed")
+	state := fs.String("state", "", "only list jobs in this state, e.g. running or failed")
+	limit := fs.Int("limit", 50, "maximum number of jobs to list, 0 for all")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 0, "no arguments"); err != nil {
+		return err
+	}
+	req := &pb.ListJobsRequest{Owner: *owner}
+	if *state != "" {
+		v, ok := pb.JobState_value["JOB_STATE_"+strings.ToUpper(*state)]
+		if !ok {
+			return usagef("jobs ls: unknown state %q", *state)
+		}
+		req.State = pb.JobState(v)
+	}
+
+	var jobs []*pb.Job
+	for {
+		if *limit > 0 {
+			req.PageSize = int32(min(*limit-len(jobs), 500))
+		}
+		page, next, err := a.client.ListJobs(ctx, req)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, page...)
+		if next == "" || (*limit > 0 && len(jobs) >= *limit) {
+			break
+		}
+		req.PageToken = next
+	}
+	return a.out.jobs(jobs)
+}
+
+func runJobsGet(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("jobs get")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 1, "one job ID"); err != nil {
+		return err
+	}
+	job, err := a.client.GetJob(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return a.out.job(job)
+}
+
+func runJobsWatch(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("jobs watch")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 1, "one job ID"); err != nil {
+		return err
+	}
+	updates, err := a.client.WatchJob(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return followJob(a, updates)
+}
+
+func runDeadLetters(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return usagef("deadletters: expected ls or redrive")
+	}
+	switch args[0] {
+	case "ls":
+		return runDeadLettersList(ctx, a, args[1:])
+	case "redrive":
+		return runDeadLettersRedrive(ctx, a, args[1:])
+	}
+	return usagef("deadletters: unknown subcommand %q, want ls or redrive", args[0])
+}
+
+func runDeadLettersList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("deadletters ls")
+	owner := fs.String("owner", "", "principal whose dead letters to list; only your own may be listed")
+	limit := fs.Int("limit", 50, "maximum number of jobs to list, 0 for all")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 0, "no arguments"); err != nil {
+		return err
+	}
+	req := &pb.ListDeadLettersRequest{Owner: *owner}
+	var letters []*pb.DeadLetter
+	for {
+		if *limit > 0 {
+			req.PageSize = int32(min(*limit-len(letters), 500))
+		}
+		page, next, err := a.client.ListDeadLetters(ctx, req)
+		if err != nil {
+			return err
+		}
+		letters = append(letters, page...)
+		if next == "" || (*limit > 0 && len(letters) >= *limit) {
+			break
+		}
+		req.PageToken = next
+	}
+	return a.out.deadLetters(letters)
+}
+
+func runDeadLettersRedrive(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("deadletters redrive")
+	watch := fs.Bool("watch", false, "follow the job until it finishes")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 1, "one job ID"); err != nil {
+		return err
+	}
+	job, err := a.client.RedriveJob(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !*watch {
+		return a.out.job(job)
+	}
+	updates, err := a.client.WatchJob(ctx, job.GetJobId())
+	if err != nil {
+		return err
+	}
+	return followJob(a, updates)
+}
+
+func runJobsDeliveries(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("jobs deliveries")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 1, "one job ID"); err != nil {
+		return err
+	}
+	deliveries, err := a.client.ListWebhookDeliveries(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return a.out.deliveries(deliveries)
+}
+
+// followJob prints every progress update and turns a failed or cancelled
+// final state into an error
+func followJob(a *app, updates <-chan imageproc.Progress) error {
+	last, err := drainProgress(updates, a.out.progress)
+	if err != nil {
+		return err
+	}
+	if last.State == pb.JobState_JOB_STATE_FAILED || last.State == pb.JobState_JOB_STATE_CANCELLED {
+		return fmt.Errorf("job %s %s: %s", last.JobID, stateName(last.State), last.Status)
+	}
+	return nil
+}
+
+// drainProgress hands every update to fn and returns the last one. It keeps
+// reading after fn fails so the stream is not left blocked.
+func drainProgress(updates <-chan imageproc.Progress, fn func(imageproc.Progress) error) (imageproc.Progress, error) {
+	var last imageproc.Progress
+	var fnErr error
+	for p := range updates {
+		if p.Err != nil {
+			return last, p.Err
+		}
+		last = p
+		if fnErr == nil {
+			fnErr = fn(p)
+		}
+	}
+	return last, fnErr
+}
+
+func runTune(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("tune")
+	raw := fs.String("params", strings.Join(a.cfg.TuneParams, ","), "comma-separated param:value pairs")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 1, "one image ID"); err != nil {
+		return err
+	}
+	params, err := imageproc.ParseTuneParams(strings.Split(*raw, ","))
+	if err != nil {
+		return usageError{msg: err.Error()}
+	}
+	return tune(ctx, a, fs.Arg(0), params, a.out.preview)
+}
+
+// tune runs a Tune session sending params in order and hands every preview
+// to onPreview
+func tune(ctx context.Context, a *app, imageID string, params []imageproc.TuneParam, onPreview func([]byte) error) error {
+	session, err := a.client.Tune(ctx, imageID)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	sendErr := make(chan error, 1)
+	go func() {
+		for _, p := range params {
+			if err := session.Set(p.Name, p.Value); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- session.CloseSend()
+	}()
+
+	var printErr error
+	for preview := range session.Previews() {
+		if printErr == nil {
+			printErr = onPreview(preview)
+		}
+	}
+	if err := session.Err(); err != nil {
+		return err
+	}
+	if err := <-sendErr; err != nil {
+		return err
+	}
+	return printErr
+}
+
+func runList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("ls")
+	owner := fs.String("owner", "", "principal whose images to list; only your own may be listed")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 0, "no arguments"); err != nil {
+		return err
+	}
+	images, err := a.client.ListImages(ctx, *owner)
+	if err != nil {
+		return err
+	}
+	return a.out.images(images)
+}
+
+func runInfo(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("info")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := exactArgs(fs, 1, "one image ID"); err != nil {
+		return err
+	}
+	info, err := a.client.GetImage(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return a.out.image(info)
+}
+
+func runRemove(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("rm")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("rm: expected at least one image ID")
+	}
+	for _, id := range fs.Args() {
+		if err := a.client.DeleteImage(ctx, id); err != nil {
+			return err
+		}
+		if err := a.out.deleted(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runSign(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return usagef("sign: expected download, upload or render")
+	}
+	op, ok := map[string]pb.SignedOperation{
+		"download": pb.SignedOperation_SIGNED_OPERATION_DOWNLOAD,
+		"upload":   pb.SignedOperation_SIGNED_OPERATION_UPLOAD,
+		"render":   pb.SignedOperation_SIGNED_OPERATION_RENDER,
+	}[args[0]]
+	if !ok {
+		return usagef("sign: unknown operation %q, want download, upload or render", args[0])
+	}
+	fs := newFlagSet("sign " + args[0])
+	ttl := fs.Duration("ttl", 0, "how long the URL is valid (default: the server's)")
+	var maxBytes *int64
+	var query *string
+	switch op {
+	case pb.SignedOperation_SIGNED_OPERATION_UPLOAD:
+		maxBytes = fs.Int64("max-bytes", 0, "largest upload the URL accepts, 0 for the server's limit")
+	case pb.SignedOperation_SIGNED_OPERATION_RENDER:
+		query = fs.String("query", "", "render parameters the URL is limited to, e.g. w=400&h=300&fmt=png")
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	req := &pb.SignURLRequest{Operation: op}
+	if op != pb.SignedOperation_SIGNED_OPERATION_UPLOAD {
+		if err := exactArgs(fs, 1, "one image ID"); err != nil {
+			return err
+		}
+		req.ImageId = fs.Arg(0)
+		if query != nil {
+			req.Query = *query
+		}
+	} else {
+		if err := exactArgs(fs, 0, "no arguments"); err != nil {
+			return err
+		}
+		req.MaxBytes = *maxBytes
+	}
+	if *ttl != 0 {
+		req.Ttl = durationpb.New(*ttl)
+	}
+	resp, err := a.client.SignURL(ctx, req)
+	if err != nil {
+		return err
+	}
+	return a.out.signedURL(resp)
+}
+
+func runCompletion(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return usagef("completion: expected bash or zsh")
+	}
+	switch args[0] {
+	case "bash":
+		return writeBashCompletion(os.Stdout)
+	case "zsh":
+		return writeZshCompletion(os.Stdout)
+	}
+	return usagef("completion: unsupported shell %q, want bash or zsh", args[0])
+}
+
+// runLegacy is the original fixed script driven by -file, -process and
+// -tune, kept so existing Makefile targets and scripts keep working
+func runLegacy(ctx context.Context, a *app, args []string) error {
+	if len(args) > 0 {
+		return usagef("run: unexpected arguments: %s", strings.Join(args, " "))
+	}
+	sugar := a.log
+
+	// Phase 1: unary GetVersion
+	version, err := a.client.Version(ctx)
+	if err != nil {
+		return err
+	}
+	sugar.Infof("Service version: %s", version)
+
+	if a.cfg.File == "" {
+		return nil
+	}
+
+	// Phase 2: client-streaming Upload
+	imgID, err := a.client.UploadFile(ctx, a.cfg.File, nil)
+	if err != nil {
+		return err
+	}
+	sugar.Infof("Uploaded image ID: %s", imgID)
+
+	// Phase 3: server-streaming Process
+	if a.cfg.Process {
+		updates, err := a.client.Process(ctx, imgID, a.cfg.Filters)
+		if err != nil {
+			return err
+		}
+		last, err := drainProgress(updates, func(p imageproc.Progress) error {
+			sugar.Infof("Progress: %d%% - %s", p.Percent, p.Status)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sugar.Infof("Processing complete, result image ID: %s", last.ResultImageID)
+	}
+
+	// Phase 4: bidirectional Tune
+	if a.cfg.Tune {
+		params, err := imageproc.ParseTuneParams(a.cfg.TuneParams)
+		if err != nil {
+			return err
+		}
+		err = tune(ctx, a, imgID, params, func(preview []byte) error {
+			sugar.Infof("Preview: %s", string(preview))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sugar.Info("Tune session ended")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// subcommandWords lists the words completed after a subcommand that takes
+// a fixed argument
+var subcommandWords = map[string]string{
+	"jobs":        "ls get watch deliveries",
+	"deadletters": "ls redrive",
+	"completion":  "bash zsh",
+	"sign":        "download upload render",
+	"download":    "-o",
+	"process":     "-filters -priority -callback-url -detach",
+	"tune":        "-params",
+	"ls":          "-owner",
+}
+
+func commandNames() string {
+	names := make([]string, 0, len(commands))
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, " ")
+}
+
+// writeBashCompletion prints a completion script for bash; load it with
+// `source <(client completion bash)`
+func writeBashCompletion(w io.Writer) error {
+	var cases strings.Builder
+	for _, c := range commands {
+		if words, ok := subcommandWords[c.name]; ok {
+			fmt.Fprintf(&cases, "    %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", c.name, words)
+		}
+	}
+	_, err := fmt.Fprintf(w, `# bash completion for the image-proc client
+_imageproc_client() {
+  local cur cmd i
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  cmd=""
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    case "${COMP_WORDS[i]}" in
+      -*) ;;
+      *) cmd="${COMP_WORDS[i]}"; break ;;
+    esac
+  done
+  if [[ -z "$cmd" ]]; then
+    COMPREPLY=($(compgen -W %q -- "$cur"))
+    return
+  fi
+  case "$cmd" in
+    upload) COMPREPLY=($(compgen -f -- "$cur")) ;;
+    batch) COMPREPLY=($(compgen -W "-filters -priority -concurrency -out -manifest -resume -cleanup" -- "$cur") $(compgen -d -- "$cur")) ;;
+%s  esac
+}
+complete -F _imageproc_client client
+`, commandNames(), cases.String())
+	return err
+}
+
+// writeZshCompletion prints a completion script for zsh; load it with
+// `source <(client completion zsh)`
+func writeZshCompletion(w io.Writer) error {
+	var described strings.Builder
+	for _, c := range commands {
+		fmt.Fprintf(&described, "    '%s:%s'\n", c.name, strings.ReplaceAll(c.summary, "'", ""))
+	}
+	var cases strings.Builder
+	for _, c := range commands {
+		if words, ok := subcommandWords[c.name]; ok {
+			fmt.Fprintf(&cases, "    %s) compadd -- %s ;;\n", c.name, words)
+		}
+	}
+	_, err := fmt.Fprintf(w, `#compdef client
+# zsh completion for the image-proc client
+_imageproc_client() {
+  local -a cmds
+  cmds=(
+%s  )
+  if (( CURRENT == 2 )); then
+    _describe 'command' cmds
+    return
+  fi
+  case "${words[2]}" in
+    upload|batch) _files ;;
+%s  esac
+}
+compdef _imageproc_client client
+`, described.String(), cases.String())
+	return err
+}
@@ -2,176 +2,133 @@ package main
 
 import (
 	"context"
-	"flag"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	pb "image-proc/proto"
-	"io"
+	"image-proc/config"
+	"image-proc/imageproc"
+	"image-proc/logging"
 	"os"
-	"strconv"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"go.uber.org/zap"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/backoff"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// getVersion invokes the unary GetVersion RPC
-func getVersion(client pb.ImageProcessorClient, sugar *zap.SugaredLogger) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
-	resp, err := client.GetVersion(ctx, &emptypb.Empty{})
-	if err != nil {
-		sugar.Fatalf("GetVersion failed: %v", err)
-	}
-	sugar.Infof("Service version: %s", resp.GetVersion())
-}
-
-// uploadFile streams the file contents via the Upload RPC
-func uploadFile(client pb.ImageProcessorClient, filePath string, sugar *zap.SugaredLogger) string {
-	sugar.Infof("Starting upload for %s", filePath)
+// Exit codes; gRPC status codes are folded into a few stable groups so
+// scripts can tell "not found" from "try again later".
+const (
+	exitOK          = 0
+	exitError       = 1 // Unknown, Internal, DataLoss, Unimplemented and local failures
+	exitUsage       = 2 // bad flags or arguments
+	exitNotFound    = 3 // NotFound
+	exitAuth        = 4 // Unauthenticated, PermissionDenied
+	exitInvalid     = 5 // InvalidArgument, FailedPrecondition, OutOfRange, AlreadyExists
+	exitUnavailable = 6 // Unavailable, DeadlineExceeded, Aborted, Canceled
+	exitExhausted   = 7 // ResourceExhausted
+)
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		sugar.Fatalf("file open error: %v", err)
+// exitCode maps an error returned by a command to the process exit code
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
 	}
-	defer file.Close()
-
-	stream, err := client.Upload(context.Background())
-	if err != nil {
-		sugar.Fatalf("Upload init error: %v", err)
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		return exitUsage
 	}
-
-	buf := make([]byte, 64*1024)
-	for {
-		n, err := file.Read(buf)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			sugar.Fatalf("file read error: %v", err)
-		}
-		if err := stream.Send(&pb.UploadRequest{Chunk: buf[:n]}); err != nil {
-			sugar.Fatalf("chunk send error: %v", err)
-		}
+	st, ok := status.FromError(err)
+	if !ok {
+		return exitError
 	}
-
-	resp, err := stream.CloseAndRecv()
-	if err != nil {
-		sugar.Fatalf("Upload failed: %v", err)
+	switch st.Code() {
+	case codes.NotFound:
+		return exitNotFound
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return exitAuth
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange, codes.AlreadyExists:
+		return exitInvalid
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.Canceled:
+		return exitUnavailable
+	case codes.ResourceExhausted:
+		return exitExhausted
 	}
-	fmt.Printf("Uploaded image ID: %s\n", resp.GetImageId())
-	return resp.GetImageId()
+	return exitError
 }
 
-func processImage(client pb.ImageProcessorClient, imageID string, filters []string, sugar *zap.SugaredLogger) {
-	sugar.Info("Processing with %s with %v", imageID, filters)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	stream, err := client.Process(ctx, &pb.ProcessingRequest{ImageId: imageID, Filters: filters})
-	if err != nil {
-		sugar.Fatalf("process init: %v", err)
-	}
-
-	for {
-		upd, err := stream.Recv()
-		if err == io.EOF {
-			sugar.Info("Proccessing Done")
-			break
-		}
-		if err != nil {
-			sugar.Fatalf("Process recv: %v", err)
-		}
-		sugar.Infof("Progress %d%% - %s", upd.GetPercent(), upd.GetStatus())
-	}
-}
-
-// tuneImage opens a bidirectional Tune stream
-func tuneImage(client pb.ImageProcessorClient, imageID string, params []string, sugar *zap.SugaredLogger) {
-	stream, err := client.Tune(context.Background())
-	if err != nil {
-		sugar.Fatalf("Tune init error: %v", err)
-	}
-
-	// recieve loop
-	go func() {
-		for {
-			resp, err := stream.Recv()
-			if err == io.EOF {
-				return
-			}
+// dial connects to the server described by cfg
+func dial(ctx context.Context, cfg *config.Client) (*imageproc.Client, error) {
+	opts := []imageproc.Option{imageproc.WithToken(cfg.Token)}
+	if cfg.TLS {
+		tlsCfg := &tls.Config{ServerName: cfg.TLSServer}
+		if cfg.TLSCAFile != "" {
+			pem, err := os.ReadFile(cfg.TLSCAFile)
 			if err != nil {
-				sugar.Fatalf("Tune recv error: %v", err)
+				return nil, err
+			}
+			tlsCfg.RootCAs = x509.NewCertPool()
+			if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%s: no certificates found", cfg.TLSCAFile)
 			}
-			sugar.Infof("Received preview chunk: %s", string(resp.PreviewChunk))
-		}
-	}()
-
-	// send loop
-	for _, p := range params {
-		parts := strings.SplitN(p, ":", 2)
-		val, _ := strconv.ParseFloat(parts[1], 64)
-		req := &pb.TuneRequest{ImageId: imageID, Parameter: parts[0], Value: val}
-		if err := stream.Send(req); err != nil {
-			sugar.Fatalf("Tune send error: %v", err)
 		}
-		time.Sleep(200 * time.Millisecond)
+		opts = append(opts, imageproc.WithTLS(tlsCfg))
+	}
+	if cfg.Keepalive > 0 {
+		opts = append(opts, imageproc.WithKeepalive(cfg.Keepalive, 20*time.Second))
 	}
-	stream.CloseSend()
+
+	dialCtx, cancel := context.WithTimeout(ctx, cfg.DialTimeout)
+	defer cancel()
+	return imageproc.Dial(dialCtx, cfg.Addr, opts...)
 }
 
 func main() {
-	// command-line flags
-	addr := "localhost:50051"
-	filePath := "./test.jpg"
-	doProcess := true
-	processFilters := []string{"blur", "edge"}
-	doTune := true
-	tuneParams := []string{"brightness:1.2", "contrast:0.8"}
-	flag.Parse()
+	cfg := config.DefaultClient()
+	args := config.MustLoadArgs("client", config.ClientEnvPrefix, cfg)
+	os.Exit(run(cfg, args))
+}
 
-	// initialize logger
-	logger, _ := zap.NewProduction()
-	defer logger.Sync()
-	sugar := logger.Sugar()
+// run executes the subcommand in args and returns the exit code
+func run(cfg *config.Client, args []string) int {
+	// with no subcommand the client runs the original phase-by-phase demo
+	name := "run"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "client: unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
 
-	// set up connection
-	dialCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	conn, err := grpc.DialContext(
-		dialCtx,
-		addr,
-		grpc.WithInsecure(),
-		grpc.WithBlock(),
-		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.Config{
-			BaseDelay:  time.Second,
-			Multiplier: 1.6,
-			Jitter:     0.2,
-			MaxDelay:   5 * time.Second,
-		}}),
-	)
+	logger, err := logging.New(cfg.Log)
 	if err != nil {
-		sugar.Fatalf("Failed to connect: %v", err)
+		fmt.Fprintf(os.Stderr, "client: %v\n", err)
+		return exitUsage
 	}
-	defer conn.Close()
-
-	client := pb.NewImageProcessorClient(conn)
-
-	// Phase 1: GetVersion
-	getVersion(client, sugar)
+	defer logger.Sync()
 
-	// Phase 2: Upload if file flag provided
-	imgID := uploadFile(client, filePath, sugar)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Phase 3
-	if doProcess {
-		processImage(client, imgID, processFilters, sugar)
+	a := &app{cfg: cfg, log: logger.Sugar(), out: newPrinter(os.Stdout, cfg.Output)}
+	if !cmd.offline {
+		client, err := dial(ctx, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "client: %v\n", err)
+			return exitCode(err)
+		}
+		defer client.Close()
+		a.client = client
 	}
 
-	// Phase 4
-	if doTune {
-		tuneImage(client, imgID, tuneParams, sugar)
+	if err := cmd.run(ctx, a, args); err != nil {
+		fmt.Fprintf(os.Stderr, "client %s: %v\n", name, err)
+		return exitCode(err)
 	}
+	return exitOK
 }
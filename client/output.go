@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image-proc/imageproc"
+	pb "image-proc/proto"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// printer writes command results as aligned tables or as JSON. Streams
+// are written as one JSON object per line so they can be piped into jq.
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) *printer {
+	return &printer{w: w, format: format}
+}
+
+func (p *printer) json() bool {
+	return p.format == "json"
+}
+
+// writeProto writes m as a single line of JSON using the proto field names
+func (p *printer) writeProto(m proto.Message) error {
+	data, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(p.w, "%s\n", data)
+	return err
+}
+
+// writeJSON writes v as a single line of JSON
+func (p *printer) writeJSON(v interface{}) error {
+	return json.NewEncoder(p.w).Encode(v)
+}
+
+// table writes rows aligned into columns under header
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) version(v string) error {
+	if p.json() {
+		return p.writeProto(&pb.VersionResponse{Version: v})
+	}
+	_, err := fmt.Fprintln(p.w, v)
+	return err
+}
+
+func (p *printer) uploaded(path, id string) error {
+	if p.json() {
+		return p.writeJSON(map[string]string{"file": path, "image_id": id})
+	}
+	_, err := fmt.Fprintf(p.w, "%s\t%s\n", id, path)
+	return err
+}
+
+func (p *printer) downloaded(id, path string, n int64) error {
+	if p.json() {
+		return p.writeJSON(map[string]interface{}{"image_id": id, "path": path, "bytes": n})
+	}
+	_, err := fmt.Fprintf(p.w, "%s\t%s\t%d bytes\n", id, path, n)
+	return err
+}
+
+func (p *printer) deleted(id string) error {
+	if p.json() {
+		return p.writeJSON(map[string]interface{}{"image_id": id, "deleted": true})
+	}
+	_, err := fmt.Fprintf(p.w, "deleted %s\n", id)
+	return err
+}
+
+func (p *printer) signedURL(resp *pb.SignURLResponse) error {
+	if p.json() {
+		return p.writeProto(resp)
+	}
+	_, err := fmt.Fprintf(p.w, "%s\t%s\texpires %s\n", resp.GetMethod(), resp.GetUrl(), formatTimestamp(resp.GetExpiresAt()))
+	return err
+}
+
+func (p *printer) progress(upd imageproc.Progress) error {
+	if p.json() {
+		return p.writeProto(&pb.ProgressUpdate{
+			JobId:   upd.JobID,
+			State:   upd.State,
+			Percent: int32(upd.Percent),
+			Status:  upd.Status,
+
+			ResultImageId: upd.ResultImageID,
+			QueuePosition: int32(upd.QueuePosition),
+		})
+	}
+	if upd.ResultImageID != "" {
+		_, err := fmt.Fprintf(p.w, "%-9s %3d%%  %s -> %s\n", stateName(upd.State), upd.Percent, upd.Status, upd.ResultImageID)
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "%-9s %3d%%  %s\n", stateName(upd.State), upd.Percent, upd.Status)
+	return err
+}
+
+func (p *printer) preview(chunk []byte) error {
+	if p.json() {
+		return p.writeProto(&pb.TuneResponse{PreviewChunk: chunk})
+	}
+	_, err := fmt.Fprintf(p.w, "%s\n", chunk)
+	return err
+}
+
+func (p *printer) image(info *pb.ImageInfo) error {
+	if p.json() {
+		return p.writeProto(info)
+	}
+	return p.table([]string{"FIELD", "VALUE"}, [][]string{
+		{"id", info.GetImageId()},
+		{"owner", info.GetOwner()},
+		{"format", info.GetFormat()},
+		{"size", fmt.Sprintf("%dx%d", info.GetWidth(), info.GetHeight())},
+		{"bytes", fmt.Sprint(info.GetSizeBytes())},
+		{"created", formatTime(info)},
+		{"source", info.GetSourceImageId()},
+	})
+}
+
+func (p *printer) images(images []*pb.ImageInfo) error {
+	if p.json() {
+		return p.writeProto(&pb.ListImagesResponse{Images: images})
+	}
+	rows := make([][]string, 0, len(images))
+	for _, info := range images {
+		rows = append(rows, []string{
+			info.GetImageId(),
+			info.GetOwner(),
+			info.GetFormat(),
+			fmt.Sprintf("%dx%d", info.GetWidth(), info.GetHeight()),
+			fmt.Sprint(info.GetSizeBytes()),
+			formatTime(info),
+		})
+	}
+	return p.table([]string{"ID", "OWNER", "FORMAT", "SIZE", "BYTES", "CREATED"}, rows)
+}
+
+func (p *printer) job(job *pb.Job) error {
+	if p.json() {
+		return p.writeProto(job)
+	}
+	return p.table([]string{"FIELD", "VALUE"}, [][]string{
+		{"id", job.GetJobId()},
+		{"image", job.GetImageId()},
+		{"filters", strings.Join(job.GetFilters(), ",")},
+		{"owner", job.GetOwner()},
+		{"state", stateName(job.GetState())},
+		{"percent", fmt.Sprint(job.GetPercent())},
+		{"status", job.GetStatus()},
+		{"result", job.GetResultImageId()},
+		{"error", job.GetError()},
+		{"priority", priorityName(job.GetPriority())},
+		{"attempts", fmt.Sprint(job.GetAttempts())},
+		{"callback", job.GetCallbackUrl()},
+		{"restarts", fmt.Sprint(job.GetRestarts())},
+		{"created", formatTimestamp(job.GetCreatedAt())},
+		{"started", formatTimestamp(job.GetStartedAt())},
+		{"updated", formatTimestamp(job.GetUpdatedAt())},
+		{"finished", formatTimestamp(job.GetFinishedAt())},
+	})
+}
+
+func (p *printer) jobs(jobs []*pb.Job) error {
+	if p.json() {
+		return p.writeProto(&pb.ListJobsResponse{Jobs: jobs})
+	}
+	rows := make([][]string, 0, len(jobs))
+	for _, job := range jobs {
+		rows = append(rows, []string{
+			job.GetJobId(),
+			job.GetImageId(),
+			stateName(job.GetState()),
+			fmt.Sprintf("%d%%", job.GetPercent()),
+			strings.Join(job.GetFilters(), ","),
+			formatTimestamp(job.GetCreatedAt()),
+		})
+	}
+	return p.table([]string{"ID", "IMAGE", "STATE", "PROGRESS", "FILTERS", "CREATED"}, rows)
+}
+
+func (p *printer) deliveries(deliveries []*pb.WebhookDelivery) error {
+	if p.json() {
+		return p.writeProto(&pb.ListWebhookDeliveriesResponse{Deliveries: deliveries})
+	}
+	rows := make([][]string, 0, len(deliveries))
+	for _, d := range deliveries {
+		code := "-"
+		if d.GetStatusCode() != 0 {
+			code = fmt.Sprint(d.GetStatusCode())
+		}
+		result := "ok"
+		if !d.GetSucceeded() {
+			result = d.GetError()
+		}
+		rows = append(rows, []string{
+			d.GetDeliveryId(),
+			fmt.Sprint(d.GetAttempt()),
+			formatTimestamp(d.GetSentAt()),
+			fmt.Sprintf("%dms", d.GetDurationMs()),
+			code,
+			result,
+		})
+	}
+	return p.table([]string{"DELIVERY", "ATTEMPT", "SENT", "DURATION", "STATUS", "RESULT"}, rows)
+}
+
+func (p *printer) deadLetters(letters []*pb.DeadLetter) error {
+	if p.json() {
+		return p.writeProto(&pb.ListDeadLettersResponse{DeadLetters: letters})
+	}
+	rows := make([][]string, 0, len(letters))
+	for _, dl := range letters {
+		retry := "no"
+		if dl.GetRetryable() {
+			retry = "yes"
+		}
+		rows = append(rows, []string{
+			dl.GetJob().GetJobId(),
+			dl.GetJob().GetImageId(),
+			codes.Code(dl.GetCode()).String(),
+			retry,
+			fmt.Sprint(dl.GetJob().GetAttempts()),
+			formatTimestamp(dl.GetDeadLetteredAt()),
+			dl.GetJob().GetError(),
+		})
+	}
+	return p.table([]string{"ID", "IMAGE", "CODE", "RETRYABLE", "ATTEMPTS", "FAILED", "ERROR"}, rows)
+}
+
+func (p *printer) batchEvent(ev imageproc.BatchEvent) error {
+	if p.json() {
+		out := &pb.BatchEvent{BatchId: ev.BatchID, ImageId: ev.ImageID}
+		switch {
+		case ev.Progress != nil:
+			out.Event = &pb.BatchEvent_Progress{Progress: &pb.ProgressUpdate{
+				JobId:   ev.Progress.JobID,
+				State:   ev.Progress.State,
+				Percent: int32(ev.Progress.Percent),
+				Status:  ev.Progress.Status,
+
+				ResultImageId: ev.Progress.ResultImageID,
+			}}
+		case ev.Result != nil:
+			out.Event = &pb.BatchEvent_Result{Result: ev.Result}
+		case ev.Summary != nil:
+			out.Event = &pb.BatchEvent_Summary{Summary: ev.Summary}
+		}
+		return p.writeProto(out)
+	}
+
+	switch {
+	case ev.Progress != nil:
+		fmt.Fprintf(p.w, "%s  ", ev.ImageID)
+		return p.progress(*ev.Progress)
+	case ev.Result != nil:
+		if ev.Result.GetState() == pb.JobState_JOB_STATE_SUCCEEDED {
+			return nil // the last progress line already shows the outcome
+		}
+		_, err := fmt.Fprintf(p.w, "%s  %-9s %s\n", ev.ImageID, stateName(ev.Result.GetState()), ev.Result.GetError())
+		return err
+	case ev.Summary != nil:
+		sum := ev.Summary
+		fmt.Fprintf(p.w, "\nbatch %s: %d succeeded, %d failed, %d cancelled of %d\n",
+			ev.BatchID, sum.GetSucceeded(), sum.GetFailed(), sum.GetCancelled(), sum.GetTotal())
+		if len(sum.GetFailures()) == 0 {
+			return nil
+		}
+		rows := make([][]string, 0, len(sum.GetFailures()))
+		for _, f := range sum.GetFailures() {
+			rows = append(rows, []string{f.GetImageId(), stateName(f.GetState()), codes.Code(f.GetCode()).String(), f.GetError()})
+		}
+		return p.table([]string{"IMAGE", "STATE", "CODE", "ERROR"}, rows)
+	}
+	return nil
+}
+
+func (p *printer) batchSummary(m batchManifest) error {
+	if p.json() {
+		return p.writeJSON(m)
+	}
+	return p.table([]string{"SUCCEEDED", "FAILED", "SKIPPED", "OUTPUT"}, [][]string{
+		{fmt.Sprint(m.Succeeded), fmt.Sprint(m.Failed), fmt.Sprint(m.Skipped), m.Output},
+	})
+}
+
+// stateName shortens JOB_STATE_RUNNING to RUNNING
+func stateName(s pb.JobState) string {
+	return strings.TrimPrefix(s.String(), "JOB_STATE_")
+}
+
+func priorityName(p pb.Priority) string {
+	return strings.TrimPrefix(p.String(), "PRIORITY_")
+}
+
+func formatTime(info *pb.ImageInfo) string {
+	return formatTimestamp(info.GetCreatedAt())
+}
+
+func formatTimestamp(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.AsTime().Local().Format(time.RFC3339)
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"image-proc/logging"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientEnvPrefix prefixes every client environment variable.
+const ClientEnvPrefix = "IMAGEPROC_CLIENT"
+
+// Client configures the command-line client.
+type Client struct {
+	Addr        string        `yaml:"addr" toml:"addr" flag:"addr" usage:"gRPC server address"`
+	Token       string        `yaml:"token" toml:"token" flag:"token" usage:"bearer token sent with every call"`
+	DialTimeout time.Duration `yaml:"dial_timeout" toml:"dial_timeout" flag:"dial-timeout" usage:"how long to wait for the connection to become ready"`
+	TLS         bool          `yaml:"tls" toml:"tls" flag:"tls" usage:"connect over TLS"`
+	TLSCAFile   string        `yaml:"tls_ca_file" toml:"tls_ca_file" flag:"tls-ca-file" usage:"PEM CA bundle to verify the server with (default system roots)"`
+	TLSServer   string        `yaml:"tls_server_name" toml:"tls_server_name" flag:"tls-server-name" usage:"server name to verify instead of the host in addr"`
+	Keepalive   time.Duration `yaml:"keepalive" toml:"keepalive" flag:"keepalive" usage:"ping the server after this much idle time, 0 disables"`
+	Output      string        `yaml:"output" toml:"output" flag:"output" usage:"output format for subcommands: table or json"`
+	File        string        `yaml:"file" toml:"file" flag:"file" usage:"image file to upload"`
+	Process     bool          `yaml:"process" toml:"process" flag:"process" usage:"run Process on the uploaded image"`
+	Filters     []string      `yaml:"filters" toml:"filters" flag:"filters" usage:"comma-separated filters for -process"`
+	Tune        bool          `yaml:"tune" toml:"tune" flag:"tune" usage:"open a Tune session on the uploaded image"`
+	TuneParams  []string      `yaml:"tune_params" toml:"tune_params" flag:"tune-params" usage:"comma-separated param:value pairs for -tune"`
+
+	Log logging.Config `yaml:"log" toml:"log"`
+}
+
+// DefaultClient returns the settings used when nothing is configured.
+func DefaultClient() *Client {
+	return &Client{
+		Addr:        "localhost:50051",
+		DialTimeout: 5 * time.Second,
+		Output:      "table",
+		Filters:     []string{"blur", "edge"},
+		TuneParams:  []string{"brightness:1.2", "contrast:0.8"},
+		Log:         logging.DefaultConfig(),
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c *Client) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr: must not be empty"))
+	}
+	if !c.TLS && (c.TLSCAFile != "" || c.TLSServer != "") {
+		errs = append(errs, errors.New("tls-ca-file, tls-server-name: require -tls"))
+	}
+	if c.Keepalive < 0 {
+		errs = append(errs, errors.New("keepalive: must not be negative"))
+	}
+	if c.Output != "table" && c.Output != "json" {
+		errs = append(errs, fmt.Errorf("output: unknown format %q, want table or json", c.Output))
+	}
+	if (c.Process || c.Tune) && c.File == "" {
+		errs = append(errs, errors.New("file: required for -process and -tune"))
+	}
+	for _, p := range c.TuneParams {
+		name, value, ok := strings.Cut(p, ":")
+		if !ok || name == "" {
+			errs = append(errs, fmt.Errorf("tune-params: %q is not param:value", p))
+			continue
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			errs = append(errs, fmt.Errorf("tune-params: %q: %w", p, err))
+		}
+	}
+	errs = append(errs, c.Log.Validate())
+	return errors.Join(errs...)
+}
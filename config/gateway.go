@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"image-proc/tracing"
+	"slices"
+	"time"
+)
+
+// GatewayEnvPrefix prefixes every gateway environment variable.
+const GatewayEnvPrefix = "IMAGEPROC_GATEWAY"
+
+// Gateway configures the REST gateway binary.
+type Gateway struct {
+	GRPCEndpoint     string            `yaml:"grpc_endpoint" toml:"grpc_endpoint" flag:"grpc-endpoint" usage:"gRPC server address"`
+	HTTPAddr         string            `yaml:"http_addr" toml:"http_addr" flag:"http-port" usage:"HTTP listen address"`
+	ShutdownTimeout  time.Duration     `yaml:"shutdown_timeout" toml:"shutdown_timeout" flag:"shutdown-timeout" usage:"how long to wait for open requests to finish on SIGTERM"`
+	SSEHeartbeat     time.Duration     `yaml:"sse_heartbeat" toml:"sse_heartbeat" flag:"sse-heartbeat" usage:"interval of heartbeats on idle SSE and NDJSON streams"`
+	WebSocketOrigins []string          `yaml:"websocket_origins" toml:"websocket_origins" flag:"websocket-origins" usage:"comma-separated origins besides the gateway's own that may open WebSockets; * allows any"`
+	SignedURLKeys    map[string]string `yaml:"signed_url_keys" toml:"signed_url_keys" flag:"url-signing-keys" usage:"comma-separated id=secret pairs the server signs URLs with, so signed download, upload and render links are honored (empty = refused)"`
+	UploadChunkSize  int               `yaml:"upload_chunk_size" toml:"upload_chunk_size" flag:"upload-chunk-size" usage:"size of the chunks HTTP uploads are streamed to the server in; must not exceed the server's max-chunk-bytes"`
+
+	// HTTP middleware
+	MaxBodyBytes      int64         `yaml:"max_body_bytes" toml:"max_body_bytes" flag:"max-body-bytes" usage:"maximum size of a request body in bytes, uploads excepted (0 = unlimited)"`
+	MaxUploadBytes    int64         `yaml:"max_upload_bytes" toml:"max_upload_bytes" flag:"max-upload-bytes" usage:"maximum size of an upload body in bytes (0 = unlimited)"`
+	RequestTimeout    time.Duration `yaml:"request_timeout" toml:"request_timeout" flag:"request-timeout" usage:"deadline for requests other than streams, uploads and downloads (0 = none)"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" flag:"read-header-timeout" usage:"how long a client may take to send request headers"`
+	AccessLog         bool          `yaml:"access_log" toml:"access_log" flag:"access-log" usage:"log one line per request"`
+	Compression       bool          `yaml:"compression" toml:"compression" flag:"compression" usage:"compress text responses with br or gzip when the client accepts it"`
+
+	CORS    CORS           `yaml:"cors" toml:"cors"`
+	Cache   Cache          `yaml:"cache" toml:"cache"`
+	Render  Render         `yaml:"render" toml:"render"`
+	Tracing tracing.Config `yaml:"tracing" toml:"tracing"`
+}
+
+// CORS controls which browser origins may call the gateway. With no
+// origins configured only same-origin pages can read responses.
+type CORS struct {
+	Origins          []string      `yaml:"origins" toml:"origins" flag:"cors-origins" usage:"comma-separated origins allowed to call the gateway from browsers; * allows any"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" toml:"allowed_headers" flag:"cors-allowed-headers" usage:"comma-separated request headers allowed in addition to those the API uses"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials" flag:"cors-allow-credentials" usage:"let browsers send cookies and HTTP auth with cross-origin requests; needs explicit cors-origins"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age" flag:"cors-max-age" usage:"how long browsers may cache a preflight response"`
+}
+
+// Cache controls how image metadata and content, which never change for
+// a given ID, are cached by browsers, proxies and the gateway itself.
+type Cache struct {
+	MaxAge        time.Duration `yaml:"max_age" toml:"max_age" flag:"cache-max-age" usage:"max-age sent in Cache-Control for image metadata and content"`
+	Bytes         int64         `yaml:"bytes" toml:"bytes" flag:"cache-bytes" usage:"size of the gateway's in-memory response cache in bytes (0 = disabled)"`
+	MaxEntryBytes int64         `yaml:"max_entry_bytes" toml:"max_entry_bytes" flag:"cache-max-entry-bytes" usage:"largest response the in-memory cache keeps"`
+	TTL           time.Duration `yaml:"ttl" toml:"ttl" flag:"cache-ttl" usage:"how long the in-memory cache keeps a response; bounds how long a deleted image is still served"`
+}
+
+// Render configures the on-the-fly render URLs. With RequireSigned set,
+// only render URLs issued by SignURL are served, so clients cannot make
+// the server render arbitrary sizes.
+type Render struct {
+	RequireSigned bool `yaml:"require_signed" toml:"require_signed" flag:"render-require-signed" usage:"serve only render URLs signed through SignURL; needs url-signing-keys"`
+}
+
+// DefaultGateway returns the settings used when nothing is configured.
+func DefaultGateway() *Gateway {
+	return &Gateway{
+		GRPCEndpoint:      "localhost:50051",
+		HTTPAddr:          ":8080",
+		ShutdownTimeout:   30 * time.Second,
+		SSEHeartbeat:      15 * time.Second,
+		UploadChunkSize:   64 << 10,
+		WebSocketOrigins:  []string{},
+		SignedURLKeys:     map[string]string{},
+		MaxBodyBytes:      1 << 20,
+		MaxUploadBytes:    64 << 20,
+		RequestTimeout:    30 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		AccessLog:         true,
+		Compression:       true,
+		CORS: CORS{
+			Origins:        []string{},
+			AllowedHeaders: []string{},
+			MaxAge:         10 * time.Minute,
+		},
+		Cache: Cache{
+			MaxAge:        365 * 24 * time.Hour,
+			Bytes:         32 << 20,
+			MaxEntryBytes: 256 << 10,
+			TTL:           5 * time.Minute,
+		},
+		Tracing: tracing.DefaultConfig(),
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c *Gateway) Validate() error {
+	var errs []error
+	if c.GRPCEndpoint == "" {
+		errs = append(errs, errors.New("grpc-endpoint: must not be empty"))
+	}
+	if c.HTTPAddr == "" {
+		errs = append(errs, errors.New("http-port: must not be empty"))
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("shutdown-timeout: must not be negative"))
+	}
+	if c.SSEHeartbeat <= 0 {
+		errs = append(errs, errors.New("sse-heartbeat: must be positive"))
+	}
+	if c.MaxBodyBytes < 0 {
+		errs = append(errs, errors.New("max-body-bytes: must not be negative"))
+	}
+	if c.MaxUploadBytes < 0 {
+		errs = append(errs, errors.New("max-upload-bytes: must not be negative"))
+	}
+	if c.RequestTimeout < 0 {
+		errs = append(errs, errors.New("request-timeout: must not be negative"))
+	}
+	if c.ReadHeaderTimeout <= 0 {
+		errs = append(errs, errors.New("read-header-timeout: must be positive"))
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, errors.New("cors-max-age: must not be negative"))
+	}
+	if c.Render.RequireSigned && len(c.SignedURLKeys) == 0 {
+		errs = append(errs, errors.New("render-require-signed: needs url-signing-keys to check signatures with"))
+	}
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.Origins, "*") {
+		errs = append(errs, errors.New("cors-allow-credentials: cannot be combined with cors-origins=*; list the trusted origins instead"))
+	}
+	if c.Cache.MaxAge < 0 {
+		errs = append(errs, errors.New("cache-max-age: must not be negative"))
+	}
+	if c.Cache.Bytes < 0 || c.Cache.MaxEntryBytes < 0 || c.Cache.TTL < 0 {
+		errs = append(errs, errors.New("cache-bytes, cache-max-entry-bytes and cache-ttl must not be negative"))
+	}
+	if c.UploadChunkSize < 1 {
+		errs = append(errs, errors.New("upload-chunk-size: must be at least 1"))
+	}
+	errs = append(errs, c.Tracing.Validate())
+	return errors.Join(errs...)
+}
+
+// Redacted hides the URL signing keys from -print-config.
+func (c *Gateway) Redacted() interface{} {
+	out := *c
+	out.SignedURLKeys = redactValues(c.SignedURLKeys)
+	return &out
+}
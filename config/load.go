@@ -0,0 +1,341 @@
+// Package config loads settings for the server, gateway and client.
+//
+// Every setting is a struct field tagged with its flag name and usage.
+// Values are resolved in increasing order of precedence: built-in
+// defaults, a YAML or TOML file passed with -config, environment
+// variables, then command-line flags. The environment variable for a
+// setting is the binary's prefix plus the upper-cased flag name, e.g.
+// IMAGEPROC_SERVER_MAX_UPLOAD_BYTES for -max-upload-bytes.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPrintConfig is returned by Load after the effective configuration
+// has been printed because -print-config was given.
+var ErrPrintConfig = errors.New("configuration printed")
+
+// validator is implemented by every top-level config struct.
+type validator interface {
+	Validate() error
+}
+
+// redacter is implemented by configs holding secrets; -print-config
+// prints the value returned by Redacted instead of the config itself.
+type redacter interface {
+	Redacted() interface{}
+}
+
+// Load fills cfg, which must be a pointer to a struct holding defaults,
+// from the config file, environment and args, and returns the positional
+// arguments left after the flags. The returned error already includes the
+// offending source, so callers can print it and exit.
+func Load(name, envPrefix string, cfg validator, args []string, out io.Writer) ([]string, error) {
+	// first pass: only find -config and -print-config; the config file
+	// must be applied before flags so that flags win
+	var path string
+	var printConfig bool
+	pre := flag.NewFlagSet(name, flag.ContinueOnError)
+	pre.SetOutput(io.Discard)
+	bindMeta(pre, &path, &printConfig, envPrefix)
+	bindFields(pre, reflect.New(reflect.TypeOf(cfg).Elem()).Interface())
+	_ = pre.Parse(args) // errors are reported by the second pass
+	if path == "" {
+		path = os.Getenv(envPrefix + "_CONFIG")
+	}
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(envPrefix, cfg); err != nil {
+		return nil, err
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	bindMeta(fs, &path, &printConfig, envPrefix)
+	bindFields(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if printConfig {
+		var printed interface{} = cfg
+		if r, ok := cfg.(redacter); ok {
+			printed = r.Redacted()
+		}
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(printed); err != nil {
+			return nil, err
+		}
+		return nil, ErrPrintConfig
+	}
+	return fs.Args(), nil
+}
+
+// MustLoad is Load for binaries without positional arguments: it exits
+// the process on -h, -print-config, extra arguments or any configuration
+// error.
+func MustLoad(name, envPrefix string, cfg validator) {
+	args := MustLoadArgs(name, envPrefix, cfg)
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unexpected arguments: %s\n", name, strings.Join(args, " "))
+		os.Exit(2)
+	}
+}
+
+// MustLoadArgs is MustLoad for binaries that take positional arguments,
+// such as the client's subcommands, and returns them.
+func MustLoadArgs(name, envPrefix string, cfg validator) []string {
+	args, err := Load(name, envPrefix, cfg, os.Args[1:], os.Stderr)
+	switch {
+	case err == nil:
+		return args
+	case errors.Is(err, ErrPrintConfig), errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(2)
+	}
+	return nil
+}
+
+func bindMeta(fs *flag.FlagSet, path *string, printConfig *bool, envPrefix string) {
+	fs.StringVar(path, "config", "", fmt.Sprintf("YAML or TOML config file (env %s_CONFIG)", envPrefix))
+	fs.BoolVar(printConfig, "print-config", false, "print the effective configuration and exit")
+}
+
+// loadFile decodes a YAML or TOML file over cfg, chosen by extension.
+func loadFile(path string, cfg interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parse %s: unknown keys %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("config %s: unsupported extension, want .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// setting is one flag-tagged struct field.
+type setting struct {
+	flag  string
+	usage string
+	value reflect.Value
+}
+
+// settings walks cfg and returns every field carrying a flag tag,
+// descending into nested structs.
+func settings(cfg interface{}) []setting {
+	var out []setting
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Tag.Get("flag")
+			if name == "" {
+				if f.Type.Kind() == reflect.Struct {
+					walk(v.Field(i))
+				}
+				continue
+			}
+			out = append(out, setting{flag: name, usage: f.Tag.Get("usage"), value: v.Field(i)})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+	return out
+}
+
+// bindFields registers one flag per setting, writing directly into cfg.
+func bindFields(fs *flag.FlagSet, cfg interface{}) {
+	for _, s := range settings(cfg) {
+		fs.Var(fieldValue{s.value}, s.flag, s.usage)
+	}
+}
+
+// applyEnv overrides settings from PREFIX_FLAG_NAME environment variables.
+func applyEnv(prefix string, cfg interface{}) error {
+	for _, s := range settings(cfg) {
+		key := prefix + "_" + strings.ToUpper(strings.ReplaceAll(s.flag, "-", "_"))
+		raw, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := (fieldValue{s.value}).Set(raw); err != nil {
+			return fmt.Errorf("env %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// fieldValue adapts a struct field to flag.Value. Slices are
+// comma-separated and maps are comma-separated key=value pairs, in which
+// a backslash escapes a comma, an equals sign or itself, e.g.
+// -auth-tokens 'a\,b=alice' for the token "a,b". A value may also hold
+// unescaped equals signs, since only the first one ends the key.
+type fieldValue struct {
+	v reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (f fieldValue) String() string {
+	if !f.v.IsValid() {
+		return ""
+	}
+	switch {
+	case f.v.Type() == durationType:
+		return time.Duration(f.v.Int()).String()
+	case f.v.Kind() == reflect.Slice:
+		parts := make([]string, f.v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(f.v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	case f.v.Kind() == reflect.Map:
+		// never echo map values; they hold secrets such as auth tokens
+		if f.v.Len() == 0 {
+			return ""
+		}
+		return fmt.Sprintf("<%d entries>", f.v.Len())
+	}
+	return fmt.Sprint(f.v.Interface())
+}
+
+func (f fieldValue) Set(raw string) error {
+	switch {
+	case f.v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.v.Kind() {
+	case reflect.String:
+		f.v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(n)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		f.v.SetFloat(x)
+	case reflect.Slice:
+		items := splitList(raw)
+		f.v.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		m := make(map[string]string)
+		for _, pair := range splitEscaped(raw, ',', -1) {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			kv := splitEscaped(pair, '=', 2)
+			if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+				return fmt.Errorf("invalid entry %q, want key=value", pair)
+			}
+			m[unescape(kv[0])] = unescape(kv[1])
+		}
+		f.v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.v.Type())
+	}
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given as a bare -flag.
+func (f fieldValue) IsBoolFlag() bool {
+	return f.v.IsValid() && f.v.Kind() == reflect.Bool
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(raw string) []string {
+	items := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitEscaped is strings.SplitN for separators not preceded by a
+// backslash; the escapes are left for unescape.
+func splitEscaped(s string, sep byte, n int) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s) && len(parts) != n-1; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescape drops the backslash before each escaped character.
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapValue(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{raw: "", want: map[string]string{}},
+		{raw: "a=1,b=2", want: map[string]string{"a": "1", "b": "2"}},
+		{raw: " a=1 , ,b=2 ", want: map[string]string{"a": "1", "b": "2"}},
+		// only the first equals sign ends the key, so base64 padding works
+		{raw: "k1=c2VjcmV0==", want: map[string]string{"k1": "c2VjcmV0=="}},
+		{raw: `tok\,en=alice`, want: map[string]string{"tok,en": "alice"}},
+		{raw: `a\=b=c,d=e\,f`, want: map[string]string{"a=b": "c", "d": "e,f"}},
+		{raw: `back\\slash=x`, want: map[string]string{`back\slash`: "x"}},
+		{raw: `trailing=x\`, want: map[string]string{"trailing": `x\`}},
+		{raw: "a", wantErr: true},
+		{raw: "=1", wantErr: true},
+		{raw: "a=", wantErr: true},
+		{raw: `a\=1`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var m map[string]string
+		err := fieldValue{reflect.ValueOf(&m).Elem()}.Set(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) = %v, want error %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(m, tt.want) {
+			t.Errorf("Set(%q) = %v, want %v", tt.raw, m, tt.want)
+		}
+	}
+}
+
+// writeConfig writes content to a config file named name and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeConfig(t, "server.yaml", "workers: 2\naddr: \":7000\"\n")
+	tomlFile := writeConfig(t, "server.toml", "workers = 2\naddr = \":7000\"\n")
+	tests := []struct {
+		name        string
+		file        string
+		env         string
+		args        []string
+		workers     int
+		fromDefault bool
+	}{
+		{name: "default", fromDefault: true},
+		{name: "yaml file", file: yamlFile, workers: 2},
+		{name: "toml file", file: tomlFile, workers: 2},
+		{name: "env over file", file: yamlFile, env: "3", workers: 3},
+		{name: "flag over env", file: yamlFile, env: "3", args: []string{"-workers", "4"}, workers: 4},
+		{name: "flag over file", file: yamlFile, args: []string{"-workers=4"}, workers: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("TEST_WORKERS", tt.env)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", tt.file}, args...)
+			}
+			cfg := DefaultServer()
+			rest, err := Load("test", "TEST", cfg, append(args, "extra"), &bytes.Buffer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.workers
+			if tt.fromDefault {
+				want = DefaultServer().Workers
+			}
+			if cfg.Workers != want {
+				t.Errorf("workers = %d, want %d", cfg.Workers, want)
+			}
+			// what no source overrides keeps the file's or default value
+			wantAddr := DefaultServer().Addr
+			if tt.file != "" {
+				wantAddr = ":7000"
+			}
+			if cfg.Addr != wantAddr {
+				t.Errorf("addr = %q, want %q", cfg.Addr, wantAddr)
+			}
+			if len(rest) != 1 || rest[0] != "extra" {
+				t.Errorf("positional arguments = %v, want [extra]", rest)
+			}
+		})
+	}
+
+	// the file may also come from the environment
+	t.Setenv("TEST_CONFIG", yamlFile)
+	cfg := DefaultServer()
+	if _, err := Load("test", "TEST", cfg, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workers != 2 {
+		t.Errorf("workers = %d with TEST_CONFIG, want the file's 2", cfg.Workers)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "invalid value", args: []string{"-job-recovery", "retry"}, want: `job-recovery: unknown policy "retry"`},
+		{name: "every invalid value", args: []string{"-job-recovery", "retry", "-job-max-restarts", "-1"}, want: "want requeue or fail\njob-max-restarts: must not be negative"},
+		{name: "unparsable flag", args: []string{"-workers", "many"}, want: "-workers"},
+		{name: "unparsable env", env: map[string]string{"TEST_MAX_BATCH_IMAGES": "lots"}, want: "env TEST_MAX_BATCH_IMAGES"},
+		{name: "malformed map", env: map[string]string{"TEST_AUTH_TOKENS": "alice"}, want: `env TEST_AUTH_TOKENS: invalid entry "alice"`},
+		{name: "unknown yaml key", file: writeConfig(t, "bad.yaml", "wrokers: 2\n"), want: "field wrokers not found"},
+		{name: "unknown toml key", file: writeConfig(t, "bad.toml", "wrokers = 2\n"), want: "unknown keys [wrokers]"},
+		{name: "unsupported extension", file: writeConfig(t, "bad.json", "{}"), want: "unsupported extension"},
+		{name: "missing file", file: filepath.Join(t.TempDir(), "missing.yaml"), want: "read config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", tt.file}, args...)
+			}
+			_, err := Load("test", "TEST", DefaultServer(), args, &bytes.Buffer{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintConfigRedacts(t *testing.T) {
+	secrets := []string{"alice-token", "hook-secret", "signing-secret"}
+	var out bytes.Buffer
+	_, err := Load("test", "TEST", DefaultServer(), []string{
+		"-print-config",
+		"-auth-tokens", "alice-token=alice",
+		"-webhook-secret", "hook-secret",
+		"-url-signing-keys", "k1=signing-secret",
+		"-url-signing-active-key", "k1",
+	}, &out)
+	if !errors.Is(err, ErrPrintConfig) {
+		t.Fatalf("Load = %v, want %v", err, ErrPrintConfig)
+	}
+	printed := out.String()
+	for _, secret := range secrets {
+		if strings.Contains(printed, secret) {
+			t.Errorf("-print-config shows %q:\n%s", secret, printed)
+		}
+	}
+	// what is not secret is still shown
+	for _, shown := range []string{"alice", "k1", "<redacted>"} {
+		if !strings.Contains(printed, shown) {
+			t.Errorf("-print-config does not show %q:\n%s", shown, printed)
+		}
+	}
+
+	// nor do flag defaults in -h echo map values
+	cfg := DefaultServer()
+	cfg.AuthTokens = map[string]string{"alice-token": "alice"}
+	var help bytes.Buffer
+	if _, err := Load("test", "TEST", cfg, []string{"-h"}, &help); err == nil {
+		t.Fatal("Load -h returned no error")
+	}
+	if strings.Contains(help.String(), "alice-token") {
+		t.Errorf("-h shows an auth token:\n%s", help.String())
+	}
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"image-proc/logging"
+	"image-proc/tracing"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// ServerEnvPrefix prefixes every server environment variable.
+const ServerEnvPrefix = "IMAGEPROC_SERVER"
+
+// Server configures the gRPC server binary.
+type Server struct {
+	Addr            string            `yaml:"addr" toml:"addr" flag:"addr" usage:"gRPC listen address"`
+	Version         string            `yaml:"version" toml:"version" flag:"version" usage:"version reported by GetVersion"`
+	UploadDir       string            `yaml:"upload_dir" toml:"upload_dir" flag:"upload-dir" usage:"directory uploaded images are stored in"`
+	Workers         int               `yaml:"workers" toml:"workers" flag:"workers" usage:"number of jobs that may run at once; further Process calls wait in the queue"`
+	JobStore        string            `yaml:"job_store" toml:"job_store" flag:"job-store" usage:"bbolt database file jobs are persisted in"`
+	JobRecovery     string            `yaml:"job_recovery" toml:"job_recovery" flag:"job-recovery" usage:"what to do on startup with jobs a previous run left queued or running: requeue or fail"`
+	JobMaxRestarts  int               `yaml:"job_max_restarts" toml:"job_max_restarts" flag:"job-max-restarts" usage:"restarts a requeued job may go through before it is dead-lettered instead (0 = no limit)"`
+	JobRetention    time.Duration     `yaml:"job_retention" toml:"job_retention" flag:"job-retention" usage:"how long finished jobs stay queryable (0 = forever)"`
+	EventLogSize    int               `yaml:"event_log_size" toml:"event_log_size" flag:"event-log-size" usage:"lifecycle events kept for subscribers resuming from a cursor"`
+	MaxBatchImages  int               `yaml:"max_batch_images" toml:"max_batch_images" flag:"max-batch-images" usage:"maximum number of images in one ProcessBatch call"`
+	MetricsAddr     string            `yaml:"metrics_addr" toml:"metrics_addr" flag:"metrics-addr" usage:"address serving Prometheus metrics at /metrics (empty = disabled)"`
+	ShutdownTimeout time.Duration     `yaml:"shutdown_timeout" toml:"shutdown_timeout" flag:"shutdown-timeout" usage:"how long to wait for in-flight RPCs to finish on SIGTERM before forcing them closed"`
+	AuthTokens      map[string]string `yaml:"auth_tokens" toml:"auth_tokens" flag:"auth-tokens" usage:"comma-separated token=principal pairs; when set, callers must send a matching Bearer token"`
+
+	Upload     UploadLimits   `yaml:"upload" toml:"upload"`
+	JobRetry   JobRetry       `yaml:"job_retry" toml:"job_retry"`
+	Webhook    Webhook        `yaml:"webhook" toml:"webhook"`
+	Scheduling Scheduling     `yaml:"scheduling" toml:"scheduling"`
+	Render     RenderLimits   `yaml:"render" toml:"render"`
+	URLSigning URLSigning     `yaml:"url_signing" toml:"url_signing"`
+	Health     Health         `yaml:"health" toml:"health"`
+	Log        logging.Config `yaml:"log" toml:"log"`
+	Tracing    tracing.Config `yaml:"tracing" toml:"tracing"`
+}
+
+// UploadLimits bounds a single Upload stream; zero disables a check.
+type UploadLimits struct {
+	MaxBytes      int64         `yaml:"max_bytes" toml:"max_bytes" flag:"max-upload-bytes" usage:"maximum total size of a single upload in bytes (0 = unlimited)"`
+	MaxChunkBytes int           `yaml:"max_chunk_bytes" toml:"max_chunk_bytes" flag:"max-chunk-bytes" usage:"maximum size of a single upload chunk in bytes"`
+	MaxWidth      int           `yaml:"max_width" toml:"max_width" flag:"max-width" usage:"maximum width in pixels of an uploaded image (0 = unlimited)"`
+	MaxHeight     int           `yaml:"max_height" toml:"max_height" flag:"max-height" usage:"maximum height in pixels of an uploaded image (0 = unlimited)"`
+	MaxPixels     int64         `yaml:"max_pixels" toml:"max_pixels" flag:"max-pixels" usage:"maximum width*height of an uploaded image (0 = unlimited)"`
+	IdleTimeout   time.Duration `yaml:"idle_timeout" toml:"idle_timeout" flag:"upload-idle-timeout" usage:"abort an upload when no chunk arrives within this duration (0 = never)"`
+}
+
+// JobRetry controls how jobs that fail with a retryable error, such as a
+// storage hiccup, are retried before they are dead-lettered.
+type JobRetry struct {
+	MaxAttempts    int           `yaml:"max_attempts" toml:"max_attempts" flag:"job-max-attempts" usage:"attempts a job gets when it keeps failing with retryable errors (1 = no retries)"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" toml:"initial_backoff" flag:"job-retry-backoff" usage:"delay before the first retry; doubled for each further one"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" toml:"max_backoff" flag:"job-retry-max-backoff" usage:"longest delay between two retries"`
+}
+
+// Webhook configures the callbacks sent when a job with a callback URL
+// finishes. Callbacks are refused while Secret is empty, since receivers
+// could not tell them from forged ones, and never reach internal addresses
+// unless AllowPrivateNetworks is set.
+type Webhook struct {
+	Secret               string        `yaml:"secret" toml:"secret" flag:"webhook-secret" usage:"HMAC-SHA256 key webhook payloads are signed with (empty = callbacks disabled)"`
+	AllowedHosts         []string      `yaml:"allowed_hosts" toml:"allowed_hosts" flag:"webhook-allowed-hosts" usage:"comma-separated hosts callbacks may be sent to; *.example.com matches subdomains (empty = any)"`
+	AllowPrivateNetworks bool          `yaml:"allow_private_networks" toml:"allow_private_networks" flag:"webhook-allow-private-networks" usage:"let callbacks reach loopback, private and link-local addresses"`
+	Timeout              time.Duration `yaml:"timeout" toml:"timeout" flag:"webhook-timeout" usage:"how long to wait for a receiver to answer one delivery"`
+	MaxAttempts          int           `yaml:"max_attempts" toml:"max_attempts" flag:"webhook-max-attempts" usage:"deliveries tried before a webhook is given up"`
+	InitialBackoff       time.Duration `yaml:"initial_backoff" toml:"initial_backoff" flag:"webhook-retry-backoff" usage:"delay before the first redelivery; doubled for each further one"`
+	MaxBackoff           time.Duration `yaml:"max_backoff" toml:"max_backoff" flag:"webhook-retry-max-backoff" usage:"longest delay between two deliveries"`
+}
+
+// RenderLimits bounds Render, which works synchronously on the caller's
+// request rather than through the job queue.
+type RenderLimits struct {
+	MaxDimension int `yaml:"max_dimension" toml:"max_dimension" flag:"render-max-dimension" usage:"largest width or height Render produces"`
+	Concurrency  int `yaml:"concurrency" toml:"concurrency" flag:"render-concurrency" usage:"number of Render calls that may run at once; others wait"`
+}
+
+// URLSigning configures the signed URLs SignURL issues. Keys may include
+// retired keys, which keep verifying the URLs they signed until those
+// expire; ActiveKey signs new ones. The gateway needs the same keys.
+type URLSigning struct {
+	Keys       map[string]string `yaml:"keys" toml:"keys" flag:"url-signing-keys" usage:"comma-separated id=secret pairs of HMAC-SHA256 keys for signed URLs (empty = signed URLs disabled)"`
+	ActiveKey  string            `yaml:"active_key" toml:"active_key" flag:"url-signing-active-key" usage:"id of the key new URLs are signed with"`
+	DefaultTTL time.Duration     `yaml:"default_ttl" toml:"default_ttl" flag:"url-signing-default-ttl" usage:"how long a signed URL is valid when the caller does not say"`
+	MaxTTL     time.Duration     `yaml:"max_ttl" toml:"max_ttl" flag:"url-signing-max-ttl" usage:"longest validity a caller may ask for"`
+	BaseURL    string            `yaml:"base_url" toml:"base_url" flag:"url-signing-base-url" usage:"public gateway address signed URLs start with, e.g. https://images.example.com (empty = relative URLs)"`
+}
+
+// Health configures the background probes behind the gRPC health service
+// and the /healthz and /readyz endpoints served next to /metrics.
+type Health struct {
+	Interval      time.Duration `yaml:"interval" toml:"interval" flag:"health-interval" usage:"how often dependency probes run"`
+	Timeout       time.Duration `yaml:"timeout" toml:"timeout" flag:"health-timeout" usage:"how long one probe may take before it counts as failed"`
+	MinFreeBytes  int64         `yaml:"min_free_bytes" toml:"min_free_bytes" flag:"health-min-free-bytes" usage:"free space the upload directory's disk must keep for the server to be ready (0 = unchecked)"`
+	MaxQueueDepth int           `yaml:"max_queue_depth" toml:"max_queue_depth" flag:"health-max-queue-depth" usage:"queued jobs at which the server stops being ready (0 = unchecked)"`
+	StallTimeout  time.Duration `yaml:"stall_timeout" toml:"stall_timeout" flag:"health-stall-timeout" usage:"how long busy workers may go without progress before the server reports itself unhealthy (0 = unchecked)"`
+}
+
+// Scheduling decides how waiting jobs share workers between principals.
+// Within one priority each principal gets workers in proportion to its
+// weight; a principal at its concurrency limit waits even if workers are
+// free.
+type Scheduling struct {
+	TenantWeights        map[string]string `yaml:"tenant_weights" toml:"tenant_weights" flag:"tenant-weights" usage:"comma-separated principal=weight pairs giving principals a larger share of workers"`
+	DefaultTenantWeight  int               `yaml:"default_tenant_weight" toml:"default_tenant_weight" flag:"default-tenant-weight" usage:"weight of principals not listed in tenant-weights"`
+	TenantMaxConcurrency int               `yaml:"tenant_max_concurrency" toml:"tenant_max_concurrency" flag:"tenant-max-concurrency" usage:"maximum jobs one principal may run at once (0 = unlimited)"`
+	TenantConcurrency    map[string]string `yaml:"tenant_concurrency" toml:"tenant_concurrency" flag:"tenant-concurrency" usage:"comma-separated principal=limit pairs overriding tenant-max-concurrency"`
+}
+
+// Weights returns TenantWeights parsed as numbers.
+func (s Scheduling) Weights() (map[string]int, error) {
+	return parseCounts("tenant-weights", s.TenantWeights, 1)
+}
+
+// Concurrency returns TenantConcurrency parsed as numbers.
+func (s Scheduling) Concurrency() (map[string]int, error) {
+	return parseCounts("tenant-concurrency", s.TenantConcurrency, 0)
+}
+
+// parseCounts parses the values of a principal=number map, each of which
+// must be at least min
+func parseCounts(name string, raw map[string]string, min int) (map[string]int, error) {
+	out := make(map[string]int, len(raw))
+	for principal, v := range raw {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min {
+			return nil, fmt.Errorf("%s: %s=%q must be an integer of at least %d", name, principal, v, min)
+		}
+		out[principal] = n
+	}
+	return out, nil
+}
+
+// DefaultServer returns the settings used when nothing is configured.
+func DefaultServer() *Server {
+	return &Server{
+		Addr:            ":50051",
+		Version:         "v0.1.0",
+		UploadDir:       "uploads",
+		Workers:         runtime.NumCPU(),
+		JobStore:        "data/jobs.db",
+		JobRecovery:     "requeue",
+		JobMaxRestarts:  3,
+		JobRetention:    7 * 24 * time.Hour,
+		EventLogSize:    10000,
+		MaxBatchImages:  10000,
+		MetricsAddr:     ":9090",
+		ShutdownTimeout: 30 * time.Second,
+		AuthTokens:      map[string]string{},
+		Upload: UploadLimits{
+			MaxBytes:      50 << 20,
+			MaxChunkBytes: 1 << 20,
+			MaxWidth:      16384,
+			MaxHeight:     16384,
+			MaxPixels:     100_000_000,
+			IdleTimeout:   30 * time.Second,
+		},
+		JobRetry: JobRetry{
+			MaxAttempts:    3,
+			InitialBackoff: time.Second,
+			MaxBackoff:     30 * time.Second,
+		},
+		Webhook: Webhook{
+			AllowedHosts:   []string{},
+			Timeout:        10 * time.Second,
+			MaxAttempts:    5,
+			InitialBackoff: time.Second,
+			MaxBackoff:     time.Minute,
+		},
+		Scheduling: Scheduling{
+			TenantWeights:       map[string]string{},
+			DefaultTenantWeight: 1,
+			TenantConcurrency:   map[string]string{},
+		},
+		Render: RenderLimits{
+			MaxDimension: 4096,
+			Concurrency:  runtime.NumCPU(),
+		},
+		URLSigning: URLSigning{
+			Keys:       map[string]string{},
+			DefaultTTL: 15 * time.Minute,
+			MaxTTL:     7 * 24 * time.Hour,
+		},
+		Health: Health{
+			Interval:      10 * time.Second,
+			Timeout:       2 * time.Second,
+			MinFreeBytes:  256 << 20,
+			MaxQueueDepth: 1000,
+			StallTimeout:  5 * time.Minute,
+		},
+		Log:     logging.DefaultConfig(),
+		Tracing: tracing.DefaultConfig(),
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c *Server) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr: must not be empty"))
+	}
+	if c.UploadDir == "" {
+		errs = append(errs, errors.New("upload-dir: must not be empty"))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("workers: must be at least 1, got %d", c.Workers))
+	}
+	if c.JobStore == "" {
+		errs = append(errs, errors.New("job-store: must not be empty"))
+	}
+	if c.JobRecovery != "requeue" && c.JobRecovery != "fail" {
+		errs = append(errs, fmt.Errorf("job-recovery: unknown policy %q, want requeue or fail", c.JobRecovery))
+	}
+	if c.JobMaxRestarts < 0 {
+		errs = append(errs, errors.New("job-max-restarts: must not be negative"))
+	}
+	if c.JobRetention < 0 {
+		errs = append(errs, errors.New("job-retention: must not be negative"))
+	}
+	if c.EventLogSize < 1 {
+		errs = append(errs, fmt.Errorf("event-log-size: must be at least 1, got %d", c.EventLogSize))
+	}
+	if c.MaxBatchImages < 1 {
+		errs = append(errs, fmt.Errorf("max-batch-images: must be at least 1, got %d", c.MaxBatchImages))
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("shutdown-timeout: must not be negative"))
+	}
+	if c.Upload.MaxChunkBytes < 1 {
+		errs = append(errs, fmt.Errorf("max-chunk-bytes: must be positive, got %d", c.Upload.MaxChunkBytes))
+	}
+	if c.Upload.MaxBytes < 0 || c.Upload.MaxWidth < 0 || c.Upload.MaxHeight < 0 || c.Upload.MaxPixels < 0 || c.Upload.IdleTimeout < 0 {
+		errs = append(errs, errors.New("upload limits: must not be negative"))
+	}
+	if c.JobRetry.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("job-max-attempts: must be at least 1, got %d", c.JobRetry.MaxAttempts))
+	}
+	if c.JobRetry.InitialBackoff < 0 || c.JobRetry.MaxBackoff < c.JobRetry.InitialBackoff {
+		errs = append(errs, errors.New("job-retry-backoff: must not be negative or exceed job-retry-max-backoff"))
+	}
+	if c.Webhook.Timeout <= 0 {
+		errs = append(errs, errors.New("webhook-timeout: must be positive"))
+	}
+	if c.Webhook.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("webhook-max-attempts: must be at least 1, got %d", c.Webhook.MaxAttempts))
+	}
+	if c.Webhook.InitialBackoff < 0 || c.Webhook.MaxBackoff < c.Webhook.InitialBackoff {
+		errs = append(errs, errors.New("webhook-retry-backoff: must not be negative or exceed webhook-retry-max-backoff"))
+	}
+	if c.Scheduling.DefaultTenantWeight < 1 {
+		errs = append(errs, fmt.Errorf("default-tenant-weight: must be at least 1, got %d", c.Scheduling.DefaultTenantWeight))
+	}
+	if c.Scheduling.TenantMaxConcurrency < 0 {
+		errs = append(errs, errors.New("tenant-max-concurrency: must not be negative"))
+	}
+	if c.Render.MaxDimension < 1 {
+		errs = append(errs, fmt.Errorf("render-max-dimension: must be at least 1, got %d", c.Render.MaxDimension))
+	}
+	if c.Render.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("render-concurrency: must be at least 1, got %d", c.Render.Concurrency))
+	}
+	if _, ok := c.URLSigning.Keys[c.URLSigning.ActiveKey]; len(c.URLSigning.Keys) > 0 && !ok {
+		errs = append(errs, fmt.Errorf("url-signing-active-key: %q is not one of url-signing-keys", c.URLSigning.ActiveKey))
+	}
+	if c.URLSigning.DefaultTTL <= 0 || c.URLSigning.MaxTTL < c.URLSigning.DefaultTTL {
+		errs = append(errs, errors.New("url-signing-default-ttl: must be positive and not exceed url-signing-max-ttl"))
+	}
+	if c.Health.Interval <= 0 || c.Health.Timeout <= 0 {
+		errs = append(errs, errors.New("health-interval and health-timeout: must be positive"))
+	}
+	if c.Health.MinFreeBytes < 0 || c.Health.MaxQueueDepth < 0 || c.Health.StallTimeout < 0 {
+		errs = append(errs, errors.New("health-min-free-bytes, health-max-queue-depth and health-stall-timeout: must not be negative"))
+	}
+	if _, err := c.Scheduling.Weights(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := c.Scheduling.Concurrency(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.Log.Validate(), c.Tracing.Validate())
+	return errors.Join(errs...)
+}
+
+// Redacted hides auth tokens, the webhook secret and URL signing keys
+// from -print-config.
+func (c *Server) Redacted() interface{} {
+	out := *c
+	if out.Webhook.Secret != "" {
+		out.Webhook.Secret = "<redacted>"
+	}
+	out.URLSigning.Keys = redactValues(c.URLSigning.Keys)
+	out.AuthTokens = make(map[string]string, len(c.AuthTokens))
+	i := 0
+	for _, principal := range c.AuthTokens {
+		i++
+		out.AuthTokens[fmt.Sprintf("<redacted-%d>", i)] = principal
+	}
+	return &out
+}
+
+// redactValues returns keys with every value hidden
+func redactValues(keys map[string]string) map[string]string {
+	out := make(map[string]string, len(keys))
+	for k := range keys {
+		out[k] = "<redacted>"
+	}
+	return out
+}
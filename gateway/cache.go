@@ -0,0 +1,130 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedResponse is a response body kept by responseCache
+type cachedResponse struct {
+	key         string
+	imageID     string
+	contentType string
+	etag        string
+	body        []byte
+	expires     time.Time
+}
+
+// responseCache is an in-memory LRU of small responses, bounded by the
+// total size of their bodies. Entries also expire after ttl, so an image
+// deleted behind the gateway's back is not served forever.
+type responseCache struct {
+	maxBytes, maxEntry int64
+	ttl                time.Duration
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List // of *cachedResponse, most recently used first
+	items map[string]*list.Element
+}
+
+// newResponseCache returns a cache of up to maxBytes, or nil, which
+// caches nothing, if maxBytes is 0
+func newResponseCache(maxBytes, maxEntry int64, ttl time.Duration) *responseCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &responseCache{
+		maxBytes: maxBytes,
+		maxEntry: min(maxEntry, maxBytes),
+		ttl:      ttl,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+// fits reports whether a body of size bytes would be kept
+func (c *responseCache) fits(size int64) bool {
+	return c != nil && size <= c.maxEntry
+}
+
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cachedResponse)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry, true
+}
+
+func (c *responseCache) put(entry *cachedResponse) {
+	if !c.fits(int64(len(entry.body))) {
+		return
+	}
+	entry.expires = time.Now().Add(c.ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[entry.key]; ok {
+		c.remove(el)
+	}
+	c.items[entry.key] = c.order.PushFront(entry)
+	c.size += int64(len(entry.body))
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// forget drops every entry for an image
+func (c *responseCache) forget(imageID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*cachedResponse).imageID == imageID {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+func (c *responseCache) remove(el *list.Element) {
+	entry := c.order.Remove(el).(*cachedResponse)
+	delete(c.items, entry.key)
+	c.size -= int64(len(entry.body))
+}
+
+// invalidating drops the cached responses of images deleted through the
+// REST API
+func (c *responseCache) invalidating(next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutPrefix(r.URL.Path, "/v1/images/")
+		if r.Method != http.MethodDelete || !ok || strings.ContainsAny(id, "/:") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status < http.StatusBadRequest {
+			c.forget(id)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"image-proc/config"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiRequestHeaders are the request headers browser clients of the REST,
+// SSE and gRPC-Web APIs need to send
+var apiRequestHeaders = []string{
+	"Content-Type", "Authorization", requestIDHeader, "Last-Event-ID",
+	"X-Grpc-Web", "X-User-Agent", "Grpc-Timeout",
+}
+
+// apiResponseHeaders are the response headers scripts may read
+var apiResponseHeaders = []string{"Grpc-Status", "Grpc-Message", requestIDHeader}
+
+// corsPolicy decides which browser origins may call the gateway
+type corsPolicy struct {
+	origins          []string // allowed origins; "*" allows any
+	allowedHeaders   []string // request headers a preflight may ask for
+	exposedHeaders   []string // response headers scripts may read
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+func newCORSPolicy(cfg config.CORS) corsPolicy {
+	return corsPolicy{
+		origins:          cfg.Origins,
+		allowedHeaders:   append(slices.Clone(apiRequestHeaders), cfg.AllowedHeaders...),
+		exposedHeaders:   apiResponseHeaders,
+		allowCredentials: cfg.AllowCredentials,
+		maxAge:           cfg.MaxAge,
+	}
+}
+
+// anyOrigin reports whether every origin may call the gateway
+func (c corsPolicy) anyOrigin() bool {
+	return slices.Contains(c.origins, "*")
+}
+
+func (c corsPolicy) allows(origin string) bool {
+	return c.anyOrigin() || slices.Contains(c.origins, origin)
+}
+
+// withCORS answers preflight requests and marks responses readable by
+// allowed origins. Requests from other origins pass through unmarked, so
+// the browser keeps them from the calling page. A wildcard policy answers
+// with "*" rather than the caller's origin, which browsers never combine
+// with credentials.
+func withCORS(c corsPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !c.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		if c.anyOrigin() {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.allowCredentials && !c.anyOrigin() {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE")
+			h.Set("Access-Control-Allow-Headers", strings.Join(c.allowedHeaders, ", "))
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.maxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", strings.Join(c.exposedHeaders, ", "))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "image-proc/proto"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// eventsPath serves the Subscribe stream as Server-Sent Events
+const eventsPath = "/v1/events"
+
+// subscriptionCursorHeader is the header the server accepts a
+// subscription with
+const subscriptionCursorHeader = "x-subscription-cursor"
+
+// eventsHandler serves Subscribe as Server-Sent Events. Each event's SSE
+// id is its cursor and its SSE event name its type, e.g. job_finished.
+// Query parameter "type" (repeatable) filters the stream; "owner", if
+// given, must be the caller.
+// A reconnecting EventSource sends Last-Event-ID and so resumes where it
+// left off; "cursor" does the same for clients that cannot set headers.
+// When the server no longer holds the missed events, a "reset" event is
+// sent and the stream continues with new events only.
+func eventsHandler(mux *runtime.ServeMux, client pb.ImageProcessorClient, heartbeat time.Duration, done <-chan struct{}) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		fail := func(ctx context.Context, err error) {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+		}
+
+		q := r.URL.Query()
+		req := &pb.SubscribeRequest{Owner: q.Get("owner"), Cursor: q.Get("cursor")}
+		if id := r.Header.Get("Last-Event-ID"); id != "" {
+			req.Cursor = id
+		}
+		for _, name := range q["type"] {
+			t, ok := pb.EventType_value["EVENT_TYPE_"+strings.ToUpper(name)]
+			if !ok || t == 0 {
+				fail(r.Context(), status.Errorf(codes.InvalidArgument, "unknown event type %q", name))
+				return
+			}
+			req.Types = append(req.Types, pb.EventType(t))
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			fail(r.Context(), status.Error(codes.Unimplemented, "streaming is not supported by this connection"))
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		ctx, err := runtime.AnnotateContext(ctx, mux, r, pb.ImageProcessor_Subscribe_FullMethodName, runtime.WithHTTPPathPattern(eventsPath))
+		if err != nil {
+			fail(r.Context(), err)
+			return
+		}
+
+		reset := ""
+		stream, err := subscribe(ctx, client, req)
+		if status.Code(err) == codes.OutOfRange && req.Cursor != "" {
+			reset = status.Convert(err).Message()
+			req.Cursor = ""
+			stream, err = subscribe(ctx, client, req)
+		}
+		if err != nil {
+			fail(ctx, err)
+			return
+		}
+
+		startStream(w, sseContentType)
+		if reset != "" {
+			writeSSE(w, "", "reset", []byte(reset))
+		}
+		flusher.Flush()
+
+		events, streamErr := relay(ctx, stream.Recv)
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case ev := <-events:
+				// rendered like the JSON API renders messages
+				data, err := outbound.Marshal(ev)
+				if err != nil {
+					log.Printf("events: marshal: %v", err)
+					continue
+				}
+				name := strings.ToLower(strings.TrimPrefix(ev.Type.String(), "EVENT_TYPE_"))
+				writeSSE(w, ev.Cursor, name, data)
+			case <-ticker.C:
+				fmt.Fprint(w, sseKeepalive)
+			case err := <-streamErr:
+				// headers are gone; report the end in-band and let the
+				// client reconnect with Last-Event-ID
+				if data, merr := outbound.Marshal(status.Convert(err).Proto()); merr == nil && ctx.Err() == nil {
+					writeSSE(w, "", "error", data)
+					flusher.Flush()
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// subscribe opens a Subscribe stream and waits until the server accepted
+// it, so that a rejected request can still be answered with an HTTP error
+func subscribe(ctx context.Context, client pb.ImageProcessorClient, req *pb.SubscribeRequest) (pb.ImageProcessor_SubscribeClient, error) {
+	stream, err := client.Subscribe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	md, err := stream.Header()
+	if err != nil {
+		return nil, err
+	}
+	if len(md.Get(subscriptionCursorHeader)) == 0 {
+		// the server failed the call before accepting it
+		_, err := stream.Recv()
+		return nil, err
+	}
+	return stream, nil
+}
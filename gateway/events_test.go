@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	pb "image-proc/proto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeEvents answers Subscribe from a log of events by cursor. A cursor
+// it does not hold is refused with OutOfRange, as the server does once
+// the events after it were dropped.
+type fakeEvents struct {
+	pb.ImageProcessorClient
+	events []*pb.Event
+	err    error           // refuses every subscription with err
+	end    <-chan struct{} // keeps the stream open until done
+	endErr error           // ends the stream with endErr
+
+	mu   sync.Mutex
+	reqs []*pb.SubscribeRequest
+}
+
+func (f *fakeEvents) Subscribe(ctx context.Context, req *pb.SubscribeRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[pb.Event], error) {
+	f.mu.Lock()
+	// the handler reuses req when it retries
+	f.reqs = append(f.reqs, proto.Clone(req).(*pb.SubscribeRequest))
+	f.mu.Unlock()
+	refused := func(err error) (grpc.ServerStreamingClient[pb.Event], error) {
+		return newFakeStream[pb.Event](ctx, metadata.MD{}, nil, nil, err), nil
+	}
+	if f.err != nil {
+		return refused(f.err)
+	}
+	events := f.events
+	if req.Cursor != "" {
+		i := 0
+		for i < len(events) && events[i].Cursor != req.Cursor {
+			i++
+		}
+		if i == len(events) {
+			return refused(status.Errorf(codes.OutOfRange, "cursor %s is older than the event log", req.Cursor))
+		}
+		events = events[i+1:]
+	}
+	header := metadata.Pairs(subscriptionCursorHeader, "c0")
+	return newFakeStream(ctx, header, events, f.end, f.endErr), nil
+}
+
+func (f *fakeEvents) requests() []*pb.SubscribeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reqs
+}
+
+var testEvents = []*pb.Event{
+	{Cursor: "c1", Type: pb.EventType_EVENT_TYPE_IMAGE_UPLOADED, ImageId: testImageID},
+	{Cursor: "c2", Type: pb.EventType_EVENT_TYPE_JOB_QUEUED, ImageId: testImageID, JobId: "j1"},
+	{Cursor: "c3", Type: pb.EventType_EVENT_TYPE_JOB_FINISHED, ImageId: testImageID, JobId: "j1"},
+}
+
+// cursors returns the ids of the events that carry one, leaving out the
+// reset and the error that ends the stream
+func cursors(events []sseEvent) []string {
+	var ids []string
+	for _, ev := range events {
+		if ev.id != "" {
+			ids = append(ids, ev.id)
+		}
+	}
+	return ids
+}
+
+// getEvents serves one request for the event stream from client
+func getEvents(t *testing.T, client pb.ImageProcessorClient, heartbeat time.Duration, query string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := runtime.NewServeMux(runtime.WithErrorHandler(problemErrorHandler))
+	if err := mux.HandlePath(http.MethodGet, eventsPath, eventsHandler(mux, client, heartbeat, make(chan struct{}))); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, eventsPath+query, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestEventsFraming(t *testing.T) {
+	client := &fakeEvents{events: testEvents, endErr: status.Error(codes.Unavailable, "server is shutting down")}
+	rec := getEvents(t, client, time.Hour, "?type=job_queued&type=JOB_FINISHED", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != sseContentType || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("status %d, headers %v", rec.Code, rec.Header())
+	}
+	if got := client.requests()[0].Types; len(got) != 2 || got[0] != pb.EventType_EVENT_TYPE_JOB_QUEUED || got[1] != pb.EventType_EVENT_TYPE_JOB_FINISHED {
+		t.Errorf("subscribed to %v, want the requested types", got)
+	}
+
+	events, _ := parseSSE(t, rec.Body.String())
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 3 and the error: %q", len(events), rec.Body)
+	}
+	for i, name := range []string{"image_uploaded", "job_queued", "job_finished"} {
+		ev := events[i]
+		if ev.id != testEvents[i].Cursor || ev.event != name {
+			t.Errorf("event %d: id %q, event %q; want %q, %q", i, ev.id, ev.event, testEvents[i].Cursor, name)
+		}
+		var body struct {
+			Cursor string `json:"cursor"`
+			JobID  string `json:"jobId"`
+		}
+		if err := json.Unmarshal([]byte(ev.data), &body); err != nil || body.Cursor != testEvents[i].Cursor || body.JobID != testEvents[i].JobId {
+			t.Errorf("event %d data %s, want the event as JSON", i, ev.data)
+		}
+	}
+	// the end of the stream is reported in-band, without an id, so a
+	// reconnect resumes after the last real event
+	last := events[3]
+	if last.event != "error" || last.id != "" || !strings.Contains(last.data, "server is shutting down") {
+		t.Errorf("final event %+v, want the stream's error", last)
+	}
+}
+
+func TestEventsHeartbeat(t *testing.T) {
+	client := &fakeEvents{events: testEvents[:1], end: after(60 * time.Millisecond)}
+	rec := getEvents(t, client, 10*time.Millisecond, "", nil)
+	events, comments := parseSSE(t, rec.Body.String())
+	if ids := cursors(events); len(ids) != 1 {
+		t.Errorf("got events %v, want 1", ids)
+	}
+	if comments == 0 {
+		t.Errorf("no keepalive comment while the stream was quiet: %q", rec.Body)
+	}
+}
+
+func TestEventsResume(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		lastID     string
+		wantCursor string
+		wantIDs    []string
+	}{
+		{name: "from now", wantIDs: []string{"c1", "c2", "c3"}},
+		{name: "Last-Event-ID", lastID: "c1", wantCursor: "c1", wantIDs: []string{"c2", "c3"}},
+		{name: "cursor parameter", query: "?cursor=c2", wantCursor: "c2", wantIDs: []string{"c3"}},
+		{name: "Last-Event-ID wins", query: "?cursor=c1", lastID: "c2", wantCursor: "c2", wantIDs: []string{"c3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeEvents{events: testEvents}
+			header := http.Header{}
+			if tt.lastID != "" {
+				header.Set("Last-Event-ID", tt.lastID)
+			}
+			rec := getEvents(t, client, time.Hour, tt.query, header)
+			if got := client.requests()[0].Cursor; got != tt.wantCursor {
+				t.Errorf("subscribed from %q, want %q", got, tt.wantCursor)
+			}
+			events, _ := parseSSE(t, rec.Body.String())
+			if ids := cursors(events); strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("got events %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestEventsReset(t *testing.T) {
+	client := &fakeEvents{events: testEvents}
+	rec := getEvents(t, client, time.Hour, "", http.Header{"Last-Event-Id": {"c0-expired"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want the stream to continue", rec.Code)
+	}
+	reqs := client.requests()
+	if len(reqs) != 2 || reqs[0].Cursor != "c0-expired" || reqs[1].Cursor != "" {
+		t.Fatalf("subscribed with %v, want the expired cursor, then none", reqs)
+	}
+	events, _ := parseSSE(t, rec.Body.String())
+	if ids := cursors(events); len(ids) != 3 {
+		t.Fatalf("got events %v after the reset, want the 3 new ones", ids)
+	}
+	if events[0].event != "reset" || events[0].id != "" || !strings.Contains(events[0].data, "older than the event log") {
+		t.Errorf("first event %+v, want a reset explaining why", events[0])
+	}
+	if events[1].id != "c1" {
+		t.Errorf("stream continues with %q, want c1", events[1].id)
+	}
+}
+
+func TestEventsRefused(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     *fakeEvents
+		query      string
+		wantStatus int
+	}{
+		{name: "unknown type", client: &fakeEvents{}, query: "?type=job_exploded", wantStatus: http.StatusBadRequest},
+		{name: "other owner", client: &fakeEvents{err: status.Error(codes.PermissionDenied, "cannot subscribe to bob's events")}, query: "?owner=bob", wantStatus: http.StatusForbidden},
+		{name: "bad cursor", client: &fakeEvents{err: status.Error(codes.InvalidArgument, "malformed cursor")}, query: "?cursor=zz", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getEvents(t, tt.client, time.Hour, tt.query, nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			readProblem(t, rec)
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC-Web framing (https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md)
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+	grpcWebTrailerFlag     = 0x80
+	// grpcWebMaxMessage matches the server's default receive limit
+	grpcWebMaxMessage = 4 << 20
+)
+
+// skippedRequestHeaders are HTTP headers that are not call metadata
+var skippedRequestHeaders = map[string]bool{
+	"accept": true, "accept-encoding": true, "accept-language": true, "connection": true,
+	"content-length": true, "content-type": true, "cookie": true, "host": true,
+	"origin": true, "referer": true, "te": true, "user-agent": true,
+	"x-grpc-web": true, "x-user-agent": true, "grpc-timeout": true,
+	"traceparent": true, "tracestate": true, // re-injected by the otel stats handler
+}
+
+// rawCodec passes messages through as the bytes the browser framed, so
+// the proxy needs no knowledge of the message types
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec: cannot marshal %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawCodec: cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
+
+// grpcWebProxy translates gRPC-Web calls, unary and server-streaming
+// alike, into calls on the upstream connection. Every request message in
+// the body is sent before the response is read, which is all a browser,
+// unable to stream a request body, can do anyway.
+type grpcWebProxy struct {
+	conn *grpc.ClientConn
+}
+
+func (p *grpcWebProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if r.Method != http.MethodPost {
+		http.Error(w, "gRPC-Web calls must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(contentType, grpcWebContentType) {
+		http.Error(w, "Content-Type must be "+grpcWebContentType+" or "+grpcWebTextContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	text := strings.HasPrefix(contentType, grpcWebTextContentType)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if raw := r.Header.Get("Grpc-Timeout"); raw != "" {
+		timeout, err := parseGRPCTimeout(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx = metadata.NewOutgoingContext(ctx, requestMetadata(r.Header))
+
+	var body io.Reader = bufio.NewReader(r.Body)
+	out := &grpcWebWriter{w: w, text: text}
+	if text {
+		body = &base64Reader{r: body.(*bufio.Reader)}
+		out.contentType = grpcWebTextContentType + "+proto"
+	} else {
+		out.contentType = grpcWebContentType + "+proto"
+	}
+
+	desc := &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+	stream, err := p.conn.NewStream(ctx, desc, r.URL.Path, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		out.finish(nil, err)
+		return
+	}
+	for {
+		msg, err := readGRPCWebFrame(body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cancel()
+			out.finish(nil, status.Errorf(codes.InvalidArgument, "invalid gRPC-Web request: %v", err))
+			return
+		}
+		if err := stream.SendMsg(&msg); err != nil {
+			// the call is over; RecvMsg reports how
+			break
+		}
+	}
+	stream.CloseSend()
+
+	if md, err := stream.Header(); err == nil {
+		out.header(md)
+	}
+	for {
+		var msg []byte
+		err := stream.RecvMsg(&msg)
+		if err == io.EOF {
+			out.finish(stream.Trailer(), nil)
+			return
+		}
+		if err != nil {
+			out.finish(stream.Trailer(), err)
+			return
+		}
+		if err := out.frame(0, msg); err != nil {
+			// the browser went away; the deferred cancel ends the call
+			return
+		}
+	}
+}
+
+// requestMetadata turns request headers into outgoing call metadata
+func requestMetadata(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range h {
+		key = strings.ToLower(key)
+		if skippedRequestHeaders[key] || strings.HasPrefix(key, "grpc-") || strings.HasPrefix(key, "access-control-") {
+			continue
+		}
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				// binary values travel base64-encoded in HTTP headers
+				b, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					b, err = base64.RawStdEncoding.DecodeString(v)
+				}
+				if err != nil {
+					continue
+				}
+				v = string(b)
+			}
+			md.Append(key, v)
+		}
+	}
+	return md
+}
+
+// parseGRPCTimeout parses a grpc-timeout header value such as "500m"
+func parseGRPCTimeout(raw string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}
+	if len(raw) < 2 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", raw)
+	}
+	unit, ok := units[raw[len(raw)-1]]
+	n, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	if !ok || err != nil || n < 0 || len(raw) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", raw)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// readGRPCWebFrame reads one length-prefixed message
+func readGRPCWebFrame(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated frame header")
+		}
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, fmt.Errorf("unsupported frame flags %#x", prefix[0])
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > grpcWebMaxMessage {
+		return nil, fmt.Errorf("message of %d bytes exceeds %d", n, grpcWebMaxMessage)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("truncated message: %v", err)
+	}
+	return msg, nil
+}
+
+// base64Reader decodes a grpc-web-text body, which may be several
+// base64 strings, each with its own padding, one after the other
+type base64Reader struct {
+	r       *bufio.Reader
+	pending []byte
+}
+
+func (b *base64Reader) Read(p []byte) (int, error) {
+	for len(b.pending) == 0 {
+		var quad [4]byte
+		n, err := io.ReadFull(b.r, quad[:])
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, fmt.Errorf("truncated base64 body (%d trailing bytes)", n)
+		}
+		var out [3]byte
+		m, err := base64.StdEncoding.Decode(out[:], quad[:])
+		if err != nil {
+			return 0, err
+		}
+		b.pending = append(b.pending, out[:m]...)
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+// grpcWebWriter writes the response headers, message frames and the
+// trailer frame of one call
+type grpcWebWriter struct {
+	w           http.ResponseWriter
+	text        bool
+	contentType string
+	wroteHeader bool
+}
+
+// header sends the call's header metadata as HTTP headers
+func (g *grpcWebWriter) header(md metadata.MD) {
+	if g.wroteHeader {
+		return
+	}
+	h := g.w.Header()
+	for key, values := range md {
+		if key == "content-type" || key == "x-request-id" {
+			continue
+		}
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			h.Add(key, v)
+		}
+	}
+	h.Set("Content-Type", g.contentType)
+	g.w.WriteHeader(http.StatusOK)
+	g.wroteHeader = true
+}
+
+func (g *grpcWebWriter) frame(flags byte, payload []byte) error {
+	buf := make([]byte, 5+len(payload))
+	buf[0] = flags
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(payload)))
+	copy(buf[5:], payload)
+	if g.text {
+		buf = []byte(base64.StdEncoding.EncodeToString(buf))
+	}
+	if _, err := g.w.Write(buf); err != nil {
+		return err
+	}
+	if f, ok := g.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// finish writes the trailer frame carrying the call's status
+func (g *grpcWebWriter) finish(trailer metadata.MD, err error) {
+	g.header(nil)
+	st := status.Convert(err)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "grpc-status: %d\r\n", st.Code())
+	if st.Message() != "" {
+		fmt.Fprintf(&sb, "grpc-message: %s\r\n", percentEncode(st.Message()))
+	}
+	for key, values := range trailer {
+		if key == "content-type" {
+			// set on calls that failed before sending headers
+			continue
+		}
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			fmt.Fprintf(&sb, "%s: %s\r\n", key, v)
+		}
+	}
+	if err := g.frame(grpcWebTrailerFlag, []byte(sb.String())); err != nil {
+		log.Printf("grpc-web: write trailers: %v", err)
+	}
+}
+
+// percentEncode escapes a grpc-message value as the gRPC spec requires
+func percentEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
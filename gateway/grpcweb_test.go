@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"image-proc/config"
+	pb "image-proc/proto"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// upstream is the server behind the gRPC-Web proxy. GetJob answers with
+// the job asked for, with header and trailer metadata, except that job
+// "missing" is not found and job "slow" waits for the deadline. Process
+// streams three updates.
+type upstream struct {
+	pb.UnimplementedImageProcessorServer
+
+	mu sync.Mutex
+	md metadata.MD
+}
+
+func (u *upstream) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.Job, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	u.mu.Lock()
+	u.md = md
+	u.mu.Unlock()
+	switch req.JobId {
+	case "missing":
+		return nil, status.Error(codes.NotFound, "job missing: 100% gone\n")
+	case "slow":
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-served-by", "upstream"))
+	grpc.SetTrailer(ctx, metadata.Pairs("x-cost-bin", "\x00\x01"))
+	return &pb.Job{JobId: req.JobId}, nil
+}
+
+func (u *upstream) Process(req *pb.ProcessingRequest, stream pb.ImageProcessor_ProcessServer) error {
+	for i := int32(1); i <= 3; i++ {
+		if err := stream.Send(&pb.ProgressUpdate{JobId: req.ImageId, Percent: i * 33}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *upstream) received() metadata.MD {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.md
+}
+
+// newGRPCWebProxy serves a proxy for a fresh upstream
+func newGRPCWebProxy(t *testing.T) (*grpcWebProxy, *upstream) {
+	t.Helper()
+	u := &upstream{}
+	gs := grpc.NewServer()
+	pb.RegisterImageProcessorServer(gs, u)
+	lis := bufconn.Listen(1 << 20)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &grpcWebProxy{conn: conn}, u
+}
+
+// grpcWebFrame frames msg as a gRPC-Web data frame
+func grpcWebFrame(t *testing.T, msg proto.Message) []byte {
+	t.Helper()
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+// grpcWebCall posts body to method and splits the response into its
+// messages and its trailer lines
+func grpcWebCall(t *testing.T, p *grpcWebProxy, method, contentType string, body []byte, header http.Header) (*httptest.ResponseRecorder, [][]byte, map[string]string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/imageproc.ImageProcessor/"+method, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return rec, nil, nil
+	}
+
+	var r io.Reader = rec.Body
+	if strings.HasPrefix(contentType, grpcWebTextContentType) {
+		r = &base64Reader{r: bufio.NewReader(rec.Body)}
+	}
+	var msgs [][]byte
+	var trailer map[string]string
+	for {
+		var prefix [5]byte
+		if _, err := io.ReadFull(r, prefix[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		if prefix[0]&grpcWebTrailerFlag == 0 {
+			if trailer != nil {
+				t.Error("message after the trailer")
+			}
+			msgs = append(msgs, payload)
+			continue
+		}
+		trailer = map[string]string{}
+		for _, line := range strings.Split(strings.TrimSuffix(string(payload), "\r\n"), "\r\n") {
+			k, v, _ := strings.Cut(line, ": ")
+			trailer[k] = v
+		}
+	}
+	if trailer == nil {
+		t.Fatal("response has no trailer frame")
+	}
+	return rec, msgs, trailer
+}
+
+func TestGRPCWebUnary(t *testing.T) {
+	p, u := newGRPCWebProxy(t)
+	header := http.Header{
+		"Authorization": {"Bearer alice-token"},
+		"X-Trace-Bin":   {base64.StdEncoding.EncodeToString([]byte{0xff, 0x00})},
+		"Cookie":        {"session=secret"},
+		"X-Grpc-Web":    {"1"},
+	}
+	rec, msgs, trailer := grpcWebCall(t, p, "GetJob", grpcWebContentType+"+proto", grpcWebFrame(t, &pb.GetJobRequest{JobId: "j1"}), header)
+	if rec.Header().Get("Content-Type") != grpcWebContentType+"+proto" || rec.Header().Get("X-Served-By") != "upstream" {
+		t.Errorf("headers %v, want the upstream's header metadata", rec.Header())
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	job := &pb.Job{}
+	if err := proto.Unmarshal(msgs[0], job); err != nil || job.JobId != "j1" {
+		t.Errorf("response %v, %v; want job j1", job, err)
+	}
+	if trailer["grpc-status"] != "0" || trailer["x-cost-bin"] != base64.StdEncoding.EncodeToString([]byte{0, 1}) {
+		t.Errorf("trailer %v, want status 0 and the upstream's trailer metadata", trailer)
+	}
+
+	md := u.received()
+	if got := md.Get("authorization"); len(got) != 1 || got[0] != "Bearer alice-token" {
+		t.Errorf("authorization metadata %v", got)
+	}
+	if got := md.Get("x-trace-bin"); len(got) != 1 || got[0] != "\xff\x00" {
+		t.Errorf("binary metadata %q, want it decoded", got)
+	}
+	for _, key := range []string{"cookie", "x-grpc-web"} {
+		if got := md.Get(key); len(got) != 0 {
+			t.Errorf("forwarded %s: %v", key, got)
+		}
+	}
+}
+
+func TestGRPCWebServerStreaming(t *testing.T) {
+	p, _ := newGRPCWebProxy(t)
+	// a text body may be several base64 strings, each padded
+	frame := grpcWebFrame(t, &pb.ProcessingRequest{ImageId: "img"})
+	body := base64.StdEncoding.EncodeToString(frame[:4]) + base64.StdEncoding.EncodeToString(frame[4:])
+	rec, msgs, trailer := grpcWebCall(t, p, "Process", grpcWebTextContentType, []byte(body), nil)
+	if rec.Header().Get("Content-Type") != grpcWebTextContentType+"+proto" {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want 3", len(msgs))
+	}
+	for i, msg := range msgs {
+		upd := &pb.ProgressUpdate{}
+		if err := proto.Unmarshal(msg, upd); err != nil || upd.JobId != "img" || upd.Percent != int32(i+1)*33 {
+			t.Errorf("update %d = %v, %v", i, upd, err)
+		}
+	}
+	if trailer["grpc-status"] != "0" {
+		t.Errorf("trailer %v, want status 0", trailer)
+	}
+}
+
+func TestGRPCWebErrors(t *testing.T) {
+	p, _ := newGRPCWebProxy(t)
+	tests := []struct {
+		name        string
+		method      string
+		body        []byte
+		header      http.Header
+		wantCode    codes.Code
+		wantMessage string
+	}{
+		{name: "upstream error", method: "GetJob", body: grpcWebFrame(t, &pb.GetJobRequest{JobId: "missing"}), wantCode: codes.NotFound, wantMessage: "job missing: 100%25 gone%0A"},
+		{name: "deadline", method: "GetJob", body: grpcWebFrame(t, &pb.GetJobRequest{JobId: "slow"}), header: http.Header{"Grpc-Timeout": {"20m"}}, wantCode: codes.DeadlineExceeded},
+		{name: "unknown method", method: "Teleport", body: grpcWebFrame(t, &pb.GetJobRequest{}), wantCode: codes.Unimplemented},
+		{name: "compressed frame", method: "GetJob", body: []byte{1, 0, 0, 0, 0}, wantCode: codes.InvalidArgument, wantMessage: "invalid gRPC-Web request: unsupported frame flags 0x1"},
+		{name: "truncated frame", method: "GetJob", body: []byte{0, 0, 0, 0, 9, 1}, wantCode: codes.InvalidArgument, wantMessage: "invalid gRPC-Web request: truncated message: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, msgs, trailer := grpcWebCall(t, p, tt.method, grpcWebContentType, tt.body, tt.header)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, want errors reported in the trailer", rec.Code)
+			}
+			if len(msgs) != 0 {
+				t.Errorf("got %d messages with an error", len(msgs))
+			}
+			if trailer["grpc-status"] != strconv.Itoa(int(tt.wantCode)) {
+				t.Errorf("trailer %v, want status %d (%s)", trailer, tt.wantCode, tt.wantCode)
+			}
+			if tt.wantMessage != "" && trailer["grpc-message"] != tt.wantMessage {
+				t.Errorf("grpc-message %q, want %q", trailer["grpc-message"], tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestGRPCWebRefused(t *testing.T) {
+	p, _ := newGRPCWebProxy(t)
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		header      http.Header
+		wantStatus  int
+	}{
+		{name: "GET", method: http.MethodGet, contentType: grpcWebContentType, wantStatus: http.StatusMethodNotAllowed},
+		{name: "plain gRPC", method: http.MethodPost, contentType: "application/grpc", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "JSON", method: http.MethodPost, contentType: "application/json", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "bad timeout", method: http.MethodPost, contentType: grpcWebContentType, header: http.Header{"Grpc-Timeout": {"soon"}}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/imageproc.ImageProcessor/GetJob", bytes.NewReader(grpcWebFrame(t, &pb.GetJobRequest{})))
+			req.Header.Set("Content-Type", tt.contentType)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGRPCWebCORS(t *testing.T) {
+	p, _ := newGRPCWebProxy(t)
+	h := withCORS(newCORSPolicy(config.CORS{Origins: []string{"https://app.example"}, MaxAge: time.Minute}), p)
+
+	// the preflight a generated grpc-web client sends
+	req := httptest.NewRequest(http.MethodOptions, "/imageproc.ImageProcessor/GetJob", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent,grpc-timeout")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	allowed := strings.ToLower(rec.Header().Get("Access-Control-Allow-Headers"))
+	for _, name := range []string{"content-type", "x-grpc-web", "x-user-agent", "grpc-timeout", "authorization"} {
+		if !strings.Contains(allowed, name) {
+			t.Errorf("preflight allows %q, missing %s", allowed, name)
+		}
+	}
+
+	// and the call itself lets the page read the status
+	req = httptest.NewRequest(http.MethodPost, "/imageproc.ImageProcessor/GetJob", bytes.NewReader(grpcWebFrame(t, &pb.GetJobRequest{JobId: "j1"})))
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Content-Type", grpcWebContentType)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Fatalf("status %d, headers %v", rec.Code, rec.Header())
+	}
+	exposed := rec.Header().Get("Access-Control-Expose-Headers")
+	if !strings.Contains(exposed, "Grpc-Status") || !strings.Contains(exposed, "Grpc-Message") {
+		t.Errorf("exposed headers %q, want grpc-status and grpc-message", exposed)
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{raw: "500m", want: 500 * time.Millisecond},
+		{raw: "2S", want: 2 * time.Second},
+		{raw: "1H", want: time.Hour},
+		{raw: "10u", want: 10 * time.Microsecond},
+		{raw: "0n", want: 0},
+		{raw: "", wantErr: true},
+		{raw: "5", wantErr: true},
+		{raw: "5s", wantErr: true},
+		{raw: "-1S", wantErr: true},
+		{raw: "123456789S", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseGRPCTimeout(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseGRPCTimeout(%q) = %v, %v; want %v, error %v", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
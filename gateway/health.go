@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	pb "image-proc/proto"
+	"net/http"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// probe endpoints for orchestrators: the gateway is alive whenever it
+// answers, and ready when the server behind it is
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// readyTimeout bounds the upstream health check behind /readyz
+const readyTimeout = 2 * time.Second
+
+// healthStatus is the body of both probe endpoints
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, healthStatus{Status: "ok"})
+}
+
+// readyzHandler asks the server's health service whether ImageProcessor
+// is serving, which it stops doing when its own probes fail
+func readyzHandler(client healthpb.HealthClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		body := healthStatus{Status: "ok", Checks: map[string]string{"upstream": "ok"}}
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: pb.ImageProcessor_ServiceDesc.ServiceName})
+		switch {
+		case err != nil:
+			body.Status, body.Checks["upstream"] = "unavailable", err.Error()
+		case resp.Status != healthpb.HealthCheckResponse_SERVING:
+			body.Status, body.Checks["upstream"] = "unavailable", resp.Status.String()
+		}
+		writeHealth(w, body)
+	}
+}
+
+// writeHealth writes body, with 503 unless it reports ok
+func writeHealth(w http.ResponseWriter, body healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if body.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(body)
+}
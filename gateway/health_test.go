@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	pb "image-proc/proto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// fakeHealth answers Check with status, or fails it with err
+type fakeHealth struct {
+	healthpb.HealthClient
+	status healthpb.HealthCheckResponse_ServingStatus
+	err    error
+
+	service string
+}
+
+func (f *fakeHealth) Check(ctx context.Context, req *healthpb.HealthCheckRequest, _ ...grpc.CallOption) (*healthpb.HealthCheckResponse, error) {
+	f.service = req.Service
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &healthpb.HealthCheckResponse{Status: f.status}, nil
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     *fakeHealth
+		wantStatus int
+		wantCheck  string
+	}{
+		{name: "serving", client: &fakeHealth{status: healthpb.HealthCheckResponse_SERVING}, wantStatus: http.StatusOK, wantCheck: "ok"},
+		{name: "not serving", client: &fakeHealth{status: healthpb.HealthCheckResponse_NOT_SERVING}, wantStatus: http.StatusServiceUnavailable, wantCheck: "NOT_SERVING"},
+		{name: "unknown service", client: &fakeHealth{err: status.Error(codes.NotFound, "unknown service")}, wantStatus: http.StatusServiceUnavailable, wantCheck: "rpc error: code = NotFound desc = unknown service"},
+		{name: "unreachable", client: &fakeHealth{err: status.Error(codes.Unavailable, "connection refused")}, wantStatus: http.StatusServiceUnavailable, wantCheck: "rpc error: code = Unavailable desc = connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			readyzHandler(tt.client)(rec, httptest.NewRequest(http.MethodGet, readyzPath, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", rec.Header().Get("Cache-Control"))
+			}
+			var body healthStatus
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := body.Checks["upstream"]; got != tt.wantCheck {
+				t.Errorf("upstream check = %q, want %q", got, tt.wantCheck)
+			}
+			if tt.client.service != pb.ImageProcessor_ServiceDesc.ServiceName {
+				t.Errorf("checked service %q, want %q", tt.client.service, pb.ImageProcessor_ServiceDesc.ServiceName)
+			}
+		})
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest(http.MethodGet, healthzPath, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Errorf("healthz = %d %q, want 200 ok", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	pb "image-proc/proto"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// routes of an image's metadata and content, served here so responses
+// can be cached: an image never changes once it has an ID
+const (
+	imagePath   = "/v1/images/{image_id}"
+	contentPath = "/v1/images/{image_id}/content"
+)
+
+// imageCache serves GetImage, Download and Render with validators and
+// caching headers, answering conditional and range requests
+type imageCache struct {
+	mux    *runtime.ServeMux
+	client pb.ImageProcessorClient
+	cache  *responseCache
+	maxAge time.Duration
+	links  signedLinks
+
+	requireSignedRenders bool // refuse render URLs SignURL did not issue
+}
+
+// credentials returns what r was authorized with: its bearer token, or
+// the principal of the signed URL it was checked against
+func credentials(r *http.Request) string {
+	if g, ok := grantFromRequest(r); ok {
+		return "signed:" + g.Principal
+	}
+	return r.Header.Get("Authorization")
+}
+
+// cacheKey keys a response by the credentials it was fetched with, so a
+// cached response is only served to callers the server already let see it
+func cacheKey(kind, imageID string, r *http.Request) string {
+	auth := sha256.Sum256([]byte(credentials(r)))
+	return kind + "/" + imageID + "/" + hex.EncodeToString(auth[:8])
+}
+
+// setCacheHeaders marks a response as cacheable for good; responses to
+// authenticated requests are kept out of shared caches
+func (ic *imageCache) setCacheHeaders(w http.ResponseWriter, r *http.Request, etag string, maxAge time.Duration) {
+	scope := "public"
+	if credentials(r) != "" {
+		scope = "private"
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d, immutable", scope, int(maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+}
+
+// info returns the metadata of an image, as JSON and decoded
+func (ic *imageCache) info(ctx context.Context, r *http.Request, marshaler runtime.Marshaler, imageID string) (*cachedResponse, *pb.ImageInfo, error) {
+	key := cacheKey("info", imageID, r)
+	if entry, ok := ic.cache.get(key); ok {
+		info := &pb.ImageInfo{}
+		if err := marshaler.Unmarshal(entry.body, info); err == nil {
+			return entry, info, nil
+		}
+	}
+	info, err := ic.client.GetImage(ctx, &pb.GetImageRequest{ImageId: imageID})
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := marshaler.Marshal(info)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "marshal image info: %v", err)
+	}
+	sum := sha256.Sum256(body)
+	entry := &cachedResponse{
+		key:         key,
+		imageID:     imageID,
+		contentType: marshaler.ContentType(info),
+		etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		body:        body,
+	}
+	ic.cache.put(entry)
+	return entry, info, nil
+}
+
+// imageHandler serves GetImage
+func (ic *imageCache) imageHandler(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	_, outbound := runtime.MarshalerForRequest(ic.mux, r)
+	ctx, err := runtime.AnnotateContext(r.Context(), ic.mux, r, pb.ImageProcessor_GetImage_FullMethodName, runtime.WithHTTPPathPattern(imagePath))
+	if err != nil {
+		runtime.HTTPError(r.Context(), ic.mux, outbound, w, r, err)
+		return
+	}
+	entry, _, err := ic.info(ctx, r, outbound, params["image_id"])
+	if err != nil {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, err)
+		return
+	}
+	ic.setCacheHeaders(w, r, entry.etag, ic.maxAge)
+	if etagMatches(r.Header.Get("If-None-Match"), entry.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", entry.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(entry.body)))
+	if r.Method != http.MethodHead {
+		w.Write(entry.body)
+	}
+}
+
+// contentHandler serves the image itself, or the single byte range a
+// Range header asks for, through Download
+func (ic *imageCache) contentHandler(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	_, outbound := runtime.MarshalerForRequest(ic.mux, r)
+	ctx, err := runtime.AnnotateContext(r.Context(), ic.mux, r, pb.ImageProcessor_Download_FullMethodName, runtime.WithHTTPPathPattern(contentPath))
+	if err != nil {
+		runtime.HTTPError(r.Context(), ic.mux, outbound, w, r, err)
+		return
+	}
+	imageID := params["image_id"]
+	if ctx, r, err = ic.links.check(ctx, r, pb.ImageProcessor_Download_FullMethodName, imageID); err != nil {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, err)
+		return
+	}
+	_, info, err := ic.info(ctx, r, outbound, imageID)
+	if err != nil {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, err)
+		return
+	}
+
+	// content is immutable per ID, so the ID is a strong validator
+	etag := `"` + info.ImageId + `"`
+	// the content of a signed URL is only cacheable until the URL expires
+	maxAge := ic.maxAge
+	if g, ok := grantFromRequest(r); ok {
+		maxAge = min(maxAge, time.Until(g.Expires))
+	}
+	h := w.Header()
+	// only successful responses may be cached
+	cacheable := func() {
+		ic.setCacheHeaders(w, r, etag, maxAge)
+		if info.CreatedAt != nil {
+			h.Set("Last-Modified", info.CreatedAt.AsTime().UTC().Format(http.TimeFormat))
+		}
+	}
+	h.Set("Accept-Ranges", "bytes")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		cacheable()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	size := info.SizeBytes
+	offset, length, httpStatus := int64(0), size, http.StatusOK
+	var contentRange string
+	if rng := r.Header.Get("Range"); rng != "" && ifRangeMatches(r.Header.Get("If-Range"), etag) {
+		start, end, ok, satisfiable := parseRange(rng, size)
+		if !satisfiable {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			writeProblem(w, r, http.StatusRequestedRangeNotSatisfiable, codes.OutOfRange,
+				fmt.Sprintf("range %q is outside the %d byte image", rng, size))
+			return
+		}
+		if ok {
+			offset, length, httpStatus = start, end-start+1, http.StatusPartialContent
+			contentRange = fmt.Sprintf("bytes %d-%d/%d", start, end, size)
+		}
+	}
+	contentType := "application/octet-stream"
+	if info.Format != "" {
+		contentType = "image/" + info.Format
+	}
+	// commit starts a successful response
+	commit := func() {
+		cacheable()
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Length", strconv.FormatInt(length, 10))
+		if contentRange != "" {
+			h.Set("Content-Range", contentRange)
+		}
+		w.WriteHeader(httpStatus)
+	}
+	if r.Method == http.MethodHead {
+		commit()
+		return
+	}
+
+	key := cacheKey("content", imageID, r)
+	if entry, ok := ic.cache.get(key); ok && int64(len(entry.body)) == size {
+		commit()
+		w.Write(entry.body[offset : offset+length])
+		return
+	}
+
+	req := &pb.DownloadRequest{ImageId: imageID, Offset: offset, Length: length}
+	// a whole small image is kept for the next request
+	var kept []byte
+	if httpStatus == http.StatusOK && ic.cache.fits(size) {
+		kept = make([]byte, 0, size)
+	}
+	stream, err := ic.client.Download(ctx, req)
+	var first *pb.DownloadChunk
+	if err == nil {
+		first, err = stream.Recv()
+	}
+	if err != nil && err != io.EOF {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, err)
+		return
+	}
+	commit()
+	var written int64
+	for chunk := first; chunk != nil; {
+		if _, err := w.Write(chunk.Chunk); err != nil {
+			return
+		}
+		written += int64(len(chunk.Chunk))
+		if kept != nil {
+			kept = append(kept, chunk.Chunk...)
+		}
+		if chunk, err = stream.Recv(); err != nil && err != io.EOF {
+			// the status line is gone; cutting the body short is all
+			// that is left to tell the client
+			log.Printf("download %s: %v after %d bytes", imageID, err, written)
+			return
+		}
+	}
+	if kept != nil && int64(len(kept)) == size {
+		ic.cache.put(&cachedResponse{key: key, imageID: imageID, contentType: contentType, etag: etag, body: kept})
+	}
+}
+
+// etagMatches implements If-None-Match's weak comparison, under which
+// the W/ a compressed representation's ETag carries does not matter
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatches reports whether a Range header applies: If-Range, when
+// present, must name the current representation with a strong ETag
+func ifRangeMatches(header, etag string) bool {
+	return header == "" || header == etag
+}
+
+// parseRange parses a Range header against a body of size bytes. ok is
+// false for headers to ignore, such as multiple ranges or other units;
+// satisfiable is false when the range lies entirely past the end.
+func parseRange(header string, size int64) (start, end int64, ok, satisfiable bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, true
+	}
+	if first == "" {
+		// a suffix: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, true
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, false
+		}
+		return max(size-n, 0), size - 1, true, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, true
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false, true
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, false, false
+	}
+	return start, end, true, true
+}
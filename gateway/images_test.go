@@ -0,0 +1,103 @@
+package main
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header      string
+		size        int64
+		start, end  int64
+		ok          bool
+		satisfiable bool
+	}{
+		{header: "bytes=0-99", size: 1000, start: 0, end: 99, ok: true, satisfiable: true},
+		{header: "bytes=100-199", size: 1000, start: 100, end: 199, ok: true, satisfiable: true},
+		{header: "bytes= 5-9", size: 1000, start: 5, end: 9, ok: true, satisfiable: true},
+		{header: "bytes=999-999", size: 1000, start: 999, end: 999, ok: true, satisfiable: true},
+
+		// open-ended and past the end are clamped to the body
+		{header: "bytes=900-", size: 1000, start: 900, end: 999, ok: true, satisfiable: true},
+		{header: "bytes=900-5000", size: 1000, start: 900, end: 999, ok: true, satisfiable: true},
+
+		// suffixes: the last n bytes, or the whole body when n exceeds it
+		{header: "bytes=-100", size: 1000, start: 900, end: 999, ok: true, satisfiable: true},
+		{header: "bytes=-5000", size: 1000, start: 0, end: 999, ok: true, satisfiable: true},
+		{header: "bytes=-0", size: 1000, satisfiable: false},
+		{header: "bytes=-10", size: 0, satisfiable: false},
+
+		// unsatisfiable: starting at or past the end
+		{header: "bytes=1000-", size: 1000, satisfiable: false},
+		{header: "bytes=1000-2000", size: 1000, satisfiable: false},
+		{header: "bytes=0-", size: 0, satisfiable: false},
+
+		// ignored, so the whole body is served
+		{header: "bytes=0-9,20-29", size: 1000, satisfiable: true},
+		{header: "bytes=-5, 0-1", size: 1000, satisfiable: true},
+		{header: "items=0-9", size: 1000, satisfiable: true},
+		{header: "bytes=9-0", size: 1000, satisfiable: true},
+		{header: "bytes=a-9", size: 1000, satisfiable: true},
+		{header: "bytes=-a", size: 1000, satisfiable: true},
+		{header: "bytes=-1-2", size: 1000, satisfiable: true},
+		{header: "bytes=5", size: 1000, satisfiable: true},
+		{header: "bytes=", size: 1000, satisfiable: true},
+	}
+	for _, tt := range tests {
+		start, end, ok, satisfiable := parseRange(tt.header, tt.size)
+		if ok != tt.ok || satisfiable != tt.satisfiable || (ok && (start != tt.start || end != tt.end)) {
+			t.Errorf("parseRange(%q, %d) = %d, %d, ok %v, satisfiable %v; want %d, %d, ok %v, satisfiable %v",
+				tt.header, tt.size, start, end, ok, satisfiable, tt.start, tt.end, tt.ok, tt.satisfiable)
+		}
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"3f2a"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: `"3f2a"`, want: true},
+		{header: `"other"`, want: false},
+		{header: "*", want: true},
+		{header: `"a", "3f2a", "b"`, want: true},
+		{header: `"a","b"`, want: false},
+		{header: `"a",*`, want: true},
+		// weak comparison: what a compressed response handed out still matches
+		{header: `W/"3f2a"`, want: true},
+		{header: `"a", W/"3f2a"`, want: true},
+		{header: `W/"other"`, want: false},
+		{header: `3f2a`, want: false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %s) = %v, want %v", tt.header, etag, got, tt.want)
+		}
+	}
+	if !etagMatches(`"3f2a"`, `W/"3f2a"`) {
+		t.Errorf("a strong tag does not match its weak form")
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	const etag = `"3f2a"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: true},
+		{header: `"3f2a"`, want: true},
+		{header: `"other"`, want: false},
+		// strong comparison only: a weak tag, a list or a date never
+		// match, and the whole body is sent instead
+		{header: `W/"3f2a"`, want: false},
+		{header: `"3f2a", "other"`, want: false},
+		{header: "*", want: false},
+		{header: "Mon, 19 Oct 2026 17:00:00 GMT", want: false},
+	}
+	for _, tt := range tests {
+		if got := ifRangeMatches(tt.header, etag); got != tt.want {
+			t.Errorf("ifRangeMatches(%q, %s) = %v, want %v", tt.header, etag, got, tt.want)
+		}
+	}
+}
@@ -2,35 +2,204 @@ package main
 
 import (
 	"context"
-	"flag"
+	"fmt"
+	"image-proc/config"
+	"image-proc/logging"
 	pb "image-proc/proto"
+	"image-proc/signedurl"
+	"image-proc/tracing"
 	"log"
 	"net/http"
+	"net/textproto"
+	"os/signal"
+	"syscall"
 
+	"github.com/google/uuid"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
+// requestIDHeader is propagated to the server as x-request-id metadata
+const requestIDHeader = "X-Request-Id"
+
+// withRequestID makes sure every request carries a valid X-Request-Id,
+// replacing a missing or malformed one, and echoes it on the response
+// before the mux writes anything.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = uuid.New().String()
+			r.Header.Set(requestIDHeader, id)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// incomingHeaderMatcher forwards X-Request-Id to gRPC in addition to the
+// headers grpc-gateway forwards by default.
+func incomingHeaderMatcher(key string) (string, bool) {
+	if textproto.CanonicalMIMEHeaderKey(key) == requestIDHeader {
+		return "x-request-id", true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher drops the server's echoed x-request-id, which
+// withRequestID has already set on the response.
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if textproto.CanonicalMIMEHeaderKey(key) == requestIDHeader {
+		return "", false
+	}
+	return fmt.Sprintf("%s%s", runtime.MetadataHeaderPrefix, key), true
+}
+
+// outgoingTrailerMatcher is outgoingHeaderMatcher for gRPC trailers.
+func outgoingTrailerMatcher(key string) (string, bool) {
+	if textproto.CanonicalMIMEHeaderKey(key) == requestIDHeader {
+		return "", false
+	}
+	return fmt.Sprintf("%s%s", runtime.MetadataTrailerPrefix, key), true
+}
+
 func main() {
-	grpcEndpoint := flag.String("grpc-endpoint", "localhost:50051", "gRPC server address")
-	httpPort := flag.String("http-port", ":8080", "HTTP listen port")
-	flag.Parse()
+	cfg := config.DefaultGateway()
+	config.MustLoad("gateway", config.GatewayEnvPrefix, cfg)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	mux := runtime.NewServeMux()
+	sigCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, "image-proc-gateway", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+		runtime.WithOutgoingTrailerMatcher(outgoingTrailerMatcher),
+		runtime.WithErrorHandler(problemErrorHandler),
+	)
 	opts := []grpc.DialOption{
 		// NOTE: in Phase 6 you’d swap this for TLS creds
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// injects the active span's trace context into outgoing gRPC metadata
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	conn, err := grpc.NewClient(cfg.GRPCEndpoint, opts...)
+	if err != nil {
+		log.Fatalf("failed to create gRPC client: %v", err)
 	}
-	if err := pb.RegisterImageProcessorHandlerFromEndpoint(ctx, mux, *grpcEndpoint, opts); err != nil {
+	defer conn.Close()
+	if err := pb.RegisterImageProcessorHandler(ctx, mux, conn); err != nil {
 		log.Fatalf("failed to register gateway: %v", err)
 	}
+	client := pb.NewImageProcessorClient(conn)
+	urlKeys, err := signedurl.NewKeys(cfg.SignedURLKeys, "")
+	if err != nil {
+		log.Fatalf("invalid URL signing keys: %v", err)
+	}
+	links := signedLinks{keys: urlKeys}
+	if err := mux.HandlePath(http.MethodPost, uploadPath, uploadHandler(mux, client, cfg.UploadChunkSize, links)); err != nil {
+		log.Fatalf("failed to register upload endpoint: %v", err)
+	}
+	images := &imageCache{
+		mux:    mux,
+		client: client,
+		cache:  newResponseCache(cfg.Cache.Bytes, cfg.Cache.MaxEntryBytes, cfg.Cache.TTL),
+		maxAge: cfg.Cache.MaxAge,
+		links:  links,
+		// render URLs may have to come from SignURL
+		requireSignedRenders: cfg.Render.RequireSigned,
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		if err := mux.HandlePath(method, imagePath, images.imageHandler); err != nil {
+			log.Fatalf("failed to register image endpoint: %v", err)
+		}
+		if err := mux.HandlePath(method, contentPath, images.contentHandler); err != nil {
+			log.Fatalf("failed to register content endpoint: %v", err)
+		}
+	}
+	if err := mux.HandlePath(http.MethodGet, renderPath, images.renderHandler); err != nil {
+		log.Fatalf("failed to register render endpoint: %v", err)
+	}
+	// long-lived streams end when shutdown starts instead of holding it up
+	stopStreams := make(chan struct{})
+	if err := mux.HandlePath(http.MethodGet, tunePath, tuneHandler(mux, client, cfg.WebSocketOrigins, stopStreams)); err != nil {
+		log.Fatalf("failed to register tune endpoint: %v", err)
+	}
+	if err := mux.HandlePath(http.MethodPost, processPath, processHandler(mux, client, cfg.SSEHeartbeat, stopStreams)); err != nil {
+		log.Fatalf("failed to register process endpoint: %v", err)
+	}
+	if err := mux.HandlePath(http.MethodGet, eventsPath, eventsHandler(mux, client, cfg.SSEHeartbeat, stopStreams)); err != nil {
+		log.Fatalf("failed to register events endpoint: %v", err)
+	}
 
-	log.Printf("REST gateway listening on %s", *httpPort)
-	if err := http.ListenAndServe(*httpPort, mux); err != nil {
+	// gRPC-Web calls use the service's own paths, e.g.
+	// /imageproc.ImageProcessor/Process, and bypass the REST mux
+	routes := http.NewServeMux()
+	routes.Handle("/", mux)
+	specHandler, docsHandler, err := openAPIHandlers()
+	if err != nil {
+		log.Fatalf("failed to build OpenAPI spec: %v", err)
+	}
+	routes.HandleFunc("GET "+openAPIPath, specHandler)
+	routes.HandleFunc("GET "+docsPath, docsHandler)
+	routes.HandleFunc("GET "+healthzPath, healthzHandler)
+	routes.HandleFunc("GET "+readyzPath, readyzHandler(healthpb.NewHealthClient(conn)))
+	routes.Handle("/"+pb.ImageProcessor_ServiceDesc.ServiceName+"/", &grpcWebProxy{conn: conn})
+
+	// middleware, innermost first
+	var handler http.Handler = images.cache.invalidating(routes)
+	if cfg.Compression {
+		handler = withCompression(handler)
+	}
+	handler = withBodyLimit(cfg.MaxBodyBytes, cfg.MaxUploadBytes, handler)
+	handler = withTimeout(cfg.RequestTimeout, handler)
+	handler = withCORS(newCORSPolicy(cfg.CORS), handler)
+	handler = withRecovery(handler)
+	if cfg.AccessLog {
+		handler = withAccessLog(handler)
+	}
+	// otelhttp extracts an incoming traceparent header and starts the
+	// request span that the gRPC client call above is parented to
+	handler = otelhttp.NewHandler(withRequestID(handler), "gateway",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+	)
+
+	srv := &http.Server{Addr: cfg.HTTPAddr, Handler: handler, ReadHeaderTimeout: cfg.ReadHeaderTimeout}
+	srv.RegisterOnShutdown(func() { close(stopStreams) })
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("REST gateway listening on %s", cfg.HTTPAddr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
 		log.Fatalf("gateway ListenAndServe: %v", err)
+	case <-sigCtx.Done():
+	}
+
+	// stop accepting connections and let open requests, including
+	// streamed Process responses, finish before the upstream conn closes
+	log.Printf("shutdown signal received, draining for up to %s", cfg.ShutdownTimeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("gateway shutdown: %v", err)
+		srv.Close()
 	}
+	log.Print("gateway stopped")
 }
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	pb "image-proc/proto"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"google.golang.org/grpc/codes"
+)
+
+// responseRecorder remembers the status and size of a response while
+// keeping the Flusher and Hijacker of the writer it wraps reachable, so
+// streams and WebSockets work through it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection cannot be hijacked")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter { return rec.ResponseWriter }
+
+// withAccessLog logs one line per finished request. The query is left
+// out: signed URLs and browser clients carry credentials there.
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %dB %s request_id=%s remote=%s",
+			r.Method, r.URL.Path, rec.status, rec.bytes, time.Since(start).Round(time.Microsecond),
+			r.Header.Get(requestIDHeader), r.RemoteAddr)
+	})
+}
+
+// withRecovery turns a panicking handler into a 500 instead of a
+// dropped connection
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, p, debug.Stack())
+			if rec.status == 0 {
+				writeProblem(w, r, http.StatusInternalServerError, codes.Internal, "internal error")
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// isUpload reports whether r carries an image upload
+func isUpload(r *http.Request) bool {
+	return r.URL.Path == uploadPath || r.URL.Path == pb.ImageProcessor_Upload_FullMethodName
+}
+
+// isLongLived reports whether r may legitimately outlast the request
+// timeout: streams, WebSockets, uploads and downloads
+func isLongLived(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || negotiateStream(r.Header.Get("Accept")) != "" {
+		return true
+	}
+	path := r.URL.Path
+	if isUpload(r) || path == eventsPath || strings.HasPrefix(path, "/"+pb.ImageProcessor_ServiceDesc.ServiceName+"/") {
+		return true
+	}
+	for _, suffix := range []string{"/content", "/process", ":watch", ":processBatch"} {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTimeout gives requests that should answer promptly a deadline,
+// which the gRPC call inherits
+func withTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isLongLived(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withBodyLimit caps request bodies at maxBody, or maxUpload for uploads;
+// zero means no limit. Bodies declared too large are refused up front.
+func withBodyLimit(maxBody, maxUpload int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := maxBody
+		if isUpload(r) {
+			limit = maxUpload
+		}
+		if limit > 0 {
+			if r.ContentLength > limit {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, codes.ResourceExhausted,
+					fmt.Sprintf("request body of %d bytes exceeds the limit of %d bytes", r.ContentLength, limit))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// compressibleTypes are the media types worth compressing; images and
+// gRPC-Web frames are left alone
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"application/javascript":   true,
+	ndjsonContentType:          true,
+	sseContentType:             true,
+}
+
+var (
+	gzipWriters   = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression) }}
+)
+
+// compressor is what gzip and brotli writers have in common
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// acceptedEncoding picks br or gzip from an Accept-Encoding header
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(name)] = true
+	}
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// withCompression compresses text responses for clients that accept br
+// or gzip. Streams are flushed through the compressor, so SSE and NDJSON
+// updates still arrive as they happen.
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter decides on the first header write whether the response
+// is compressed
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	enc         compressor
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	h.Add("Vary", "Accept-Encoding")
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && (compressibleTypes[mediaType] || strings.HasPrefix(mediaType, "text/")) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// the compressed bytes differ from those a strong ETag vouches for
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		if cw.encoding == "br" {
+			cw.enc = brotliWriters.Get().(*brotli.Writer)
+		} else {
+			cw.enc = gzipWriters.Get().(*gzip.Writer)
+		}
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection cannot be hijacked")
+	}
+	return h.Hijack()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
+
+// close finishes the compressed stream and returns the writer to its pool
+func (cw *compressWriter) close() {
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	if cw.encoding == "br" {
+		brotliWriters.Put(cw.enc)
+	} else {
+		gzipWriters.Put(cw.enc)
+	}
+	cw.enc = nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"image-proc/config"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// readProblem decodes a problem+json response
+func readProblem(t *testing.T, rec *httptest.ResponseRecorder) problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+		t.Fatalf("Content-Type = %q, want %s", ct, problemContentType)
+	}
+	var p problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// quietLog discards the gateway's log output for the rest of the test
+func quietLog(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+}
+
+func TestCORS(t *testing.T) {
+	allowed := newCORSPolicy(config.CORS{Origins: []string{"https://app.example"}, AllowedHeaders: []string{"X-Extra"}, AllowCredentials: true, MaxAge: time.Hour})
+	wildcard := newCORSPolicy(config.CORS{Origins: []string{"*"}, AllowCredentials: true})
+	tests := []struct {
+		name        string
+		policy      corsPolicy
+		method      string
+		origin      string
+		preflight   bool
+		wantOrigin  string
+		wantCreds   bool
+		wantHandled bool // answered without reaching the API
+	}{
+		{name: "preflight", policy: allowed, method: http.MethodOptions, origin: "https://app.example", preflight: true, wantOrigin: "https://app.example", wantCreds: true, wantHandled: true},
+		{name: "request", policy: allowed, method: http.MethodGet, origin: "https://app.example", wantOrigin: "https://app.example", wantCreds: true},
+		{name: "disallowed preflight", policy: allowed, method: http.MethodOptions, origin: "https://evil.example", preflight: true},
+		{name: "disallowed request", policy: allowed, method: http.MethodGet, origin: "https://evil.example"},
+		{name: "same origin", policy: allowed, method: http.MethodGet},
+		{name: "wildcard without credentials", policy: wildcard, method: http.MethodGet, origin: "https://any.example", wantOrigin: "*"},
+		{name: "wildcard preflight", policy: wildcard, method: http.MethodOptions, origin: "https://any.example", preflight: true, wantOrigin: "*", wantHandled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			h := withCORS(tt.policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(tt.method, "/v1/version", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				req.Header.Set("Access-Control-Request-Headers", "authorization")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			hdr := rec.Header()
+			if got := hdr.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := hdr.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("Allow-Credentials = %v, want %v", got, tt.wantCreds)
+			}
+			if got := hdr.Values("Vary"); len(got) != 1 || got[0] != "Origin" {
+				t.Errorf("Vary = %v, want Origin", got)
+			}
+			if reached == tt.wantHandled {
+				t.Errorf("reached the API = %v, want %v", reached, !tt.wantHandled)
+			}
+			if !tt.wantHandled {
+				return
+			}
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("preflight status = %d, want %d", rec.Code, http.StatusNoContent)
+			}
+			if got := hdr.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Authorization") || (tt.policy.maxAge > 0 && !strings.Contains(got, "X-Extra")) {
+				t.Errorf("Allow-Headers = %q, want the API's and the configured headers", got)
+			}
+			if tt.policy.maxAge > 0 && hdr.Get("Access-Control-Max-Age") != "3600" {
+				t.Errorf("Max-Age = %q, want 3600", hdr.Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	body := strings.Repeat(`{"image_id":"573339b8-a202-47ba-b3b2-0f2982caaf0a"}`, 50)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		status         int
+		header         map[string]string // request headers besides Accept-Encoding
+		wantEncoding   string
+	}{
+		{name: "gzip", acceptEncoding: "gzip, deflate", wantEncoding: "gzip"},
+		{name: "brotli preferred", acceptEncoding: "gzip, br", wantEncoding: "br"},
+		{name: "brotli refused", acceptEncoding: "br;q=0, gzip", wantEncoding: "gzip"},
+		{name: "gzip refused", acceptEncoding: "gzip;q=0", wantEncoding: ""},
+		{name: "none", acceptEncoding: "", wantEncoding: ""},
+		{name: "problem", acceptEncoding: "gzip", contentType: problemContentType, status: http.StatusNotFound, wantEncoding: "gzip"},
+		{name: "image", acceptEncoding: "gzip, br", contentType: "image/png", wantEncoding: ""},
+		{name: "not modified", acceptEncoding: "gzip", status: http.StatusNotModified, wantEncoding: ""},
+		{name: "range", acceptEncoding: "gzip", header: map[string]string{"Range": "bytes=0-9"}, wantEncoding: ""},
+		{name: "websocket", acceptEncoding: "gzip", header: map[string]string{"Upgrade": "websocket"}, wantEncoding: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, status := tt.contentType, tt.status
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
+			h := withCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", contentType)
+				w.Header().Set("Content-Length", "2500")
+				w.Header().Set("ETag", `"3f2a"`)
+				w.WriteHeader(status)
+				if status != http.StatusNotModified {
+					io.WriteString(w, body)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/v1/images", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != status {
+				t.Fatalf("status = %d, want %d", rec.Code, status)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			var r io.Reader = rec.Body
+			wantETag := `"3f2a"`
+			switch tt.wantEncoding {
+			case "gzip":
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = zr
+				wantETag = `W/"3f2a"`
+			case "br":
+				r = brotli.NewReader(rec.Body)
+				wantETag = `W/"3f2a"`
+			}
+			if got := rec.Header().Get("ETag"); got != wantETag {
+				t.Errorf("ETag = %s, want %s", got, wantETag)
+			}
+			if tt.wantEncoding != "" && rec.Header().Get("Content-Length") != "" {
+				t.Errorf("compressed response keeps Content-Length %s", rec.Header().Get("Content-Length"))
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != http.StatusNotModified && string(got) != body {
+				t.Errorf("body = %d bytes after decoding, want the %d written", len(got), len(body))
+			}
+		})
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		chunked    bool
+		wantStatus int
+	}{
+		{name: "within the limit", path: "/v1/images/x:process", body: strings.Repeat("a", 10), wantStatus: http.StatusOK},
+		{name: "declared too large", path: "/v1/images/x:process", body: strings.Repeat("a", 11), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "streamed too large", path: "/v1/images/x:process", body: strings.Repeat("a", 11), chunked: true, wantStatus: http.StatusBadRequest},
+		{name: "upload within its own limit", path: uploadPath, body: strings.Repeat("a", 100), wantStatus: http.StatusOK},
+		{name: "upload too large", path: uploadPath, body: strings.Repeat("a", 101), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			h := withBodyLimit(10, 100, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				if _, err := io.ReadAll(r.Body); err != nil {
+					var tooLarge *http.MaxBytesError
+					if !errors.As(err, &tooLarge) {
+						t.Errorf("read error %v, want %T", err, tooLarge)
+					}
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusRequestEntityTooLarge {
+				return
+			}
+			if reached {
+				t.Error("a body declared too large reached the API")
+			}
+			if p := readProblem(t, rec); p.Status != http.StatusRequestEntityTooLarge || p.Code != codes.ResourceExhausted.String() || p.Instance != tt.path {
+				t.Errorf("problem = %+v", p)
+			}
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	quietLog(t)
+	h := withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/v1/images", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	p := readProblem(t, rec)
+	if p.Code != codes.Internal.String() || p.Status != http.StatusInternalServerError || p.RequestID != "req-1" || strings.Contains(p.Detail, "nil map") {
+		t.Errorf("problem = %+v, want an Internal error that does not leak the panic", p)
+	}
+
+	// once the response has started, it is left as it is
+	h = withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("late")
+	}))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+		t.Errorf("late panic: status %d, body %q; want the started response", rec.Code, rec.Body)
+	}
+
+	// and aborting a handler still aborts it
+	h = withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want %v", p, http.ErrAbortHandler)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	t.Error("ErrAbortHandler was swallowed")
+}
+
+func TestProblemErrorHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   codes.Code
+		wantDetail string
+	}{
+		{name: "not found", err: status.Error(codes.NotFound, "image x not found"), wantStatus: http.StatusNotFound, wantCode: codes.NotFound, wantDetail: "image x not found"},
+		{name: "unauthenticated", err: status.Error(codes.Unauthenticated, "missing token"), wantStatus: http.StatusUnauthorized, wantCode: codes.Unauthenticated, wantDetail: "missing token"},
+		{name: "exhausted", err: status.Error(codes.ResourceExhausted, "too big"), wantStatus: http.StatusTooManyRequests, wantCode: codes.ResourceExhausted, wantDetail: "too big"},
+		{name: "own http status", err: &runtime.HTTPStatusError{HTTPStatus: http.StatusMethodNotAllowed, Err: status.Error(codes.Unimplemented, "no")}, wantStatus: http.StatusMethodNotAllowed, wantCode: codes.Unimplemented, wantDetail: "no"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/images/x", nil)
+			rec := httptest.NewRecorder()
+			problemErrorHandler(req.Context(), runtime.NewServeMux(), nil, rec, req, tt.err)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			p := readProblem(t, rec)
+			if p.Code != tt.wantCode.String() || p.Detail != tt.wantDetail || p.Instance != "/v1/images/x" {
+				t.Errorf("problem = %+v", p)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); (got == "Bearer") != (tt.wantCode == codes.Unauthenticated) {
+				t.Errorf("WWW-Authenticate = %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	pb "image-proc/proto"
+	"image-proc/signedurl"
+	"net/http"
+	"strings"
+)
+
+// image.swagger.json is generated from image.proto by `make proto`
+//
+//go:embed openapi/image.swagger.json
+var generatedSpec []byte
+
+//go:embed openapi/docs.html
+var docsPage []byte
+
+// routes serving the API description
+const (
+	openAPIPath = "/openapi.json"
+	docsPath    = "/docs"
+)
+
+// handRoutes are the RPCs the gateway serves with its own handlers
+// rather than generated ones, by the HTTP route they are served at
+var handRoutes = map[string]struct{ method, path string }{
+	"Subscribe": {http.MethodGet, eventsPath},
+	"Tune":      {http.MethodGet, tunePath},
+	"Render":    {http.MethodGet, renderPath},
+}
+
+// problemSchema describes the problem+json bodies of failed requests
+var problemSchema = map[string]any{
+	"type":        "object",
+	"description": "RFC 9457 problem details, extended with the gRPC status code and the request id.",
+	"properties": map[string]any{
+		"type":       map[string]any{"type": "string"},
+		"title":      map[string]any{"type": "string", "description": "the HTTP status text"},
+		"status":     map[string]any{"type": "integer", "format": "int32"},
+		"detail":     map[string]any{"type": "string", "description": "the gRPC status message"},
+		"instance":   map[string]any{"type": "string", "description": "the request path"},
+		"code":       map[string]any{"type": "string", "description": "the gRPC status code, e.g. NotFound"},
+		"request_id": map[string]any{"type": "string"},
+		"details":    map[string]any{"type": "array", "items": map[string]any{"$ref": "#/definitions/protobufAny"}},
+	},
+}
+
+var problemResponse = map[string]any{
+	"description": "An error, as application/problem+json.",
+	"schema":      map[string]any{"$ref": "#/definitions/problemDetails"},
+}
+
+// openAPISpec returns the generated spec completed with what the proto
+// annotations cannot express: the routes and media types of the
+// gateway's own handlers.
+func openAPISpec() ([]byte, error) {
+	var spec map[string]any
+	if err := json.Unmarshal(generatedSpec, &spec); err != nil {
+		return nil, fmt.Errorf("parse generated spec: %w", err)
+	}
+	spec["info"] = map[string]any{
+		"title":       "Image processing API",
+		"version":     "v1",
+		"description": "REST mapping of the imageproc.ImageProcessor gRPC service. Errors are RFC 9457 application/problem+json bodies carrying the gRPC status code.",
+	}
+	paths, ok := spec["paths"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("generated spec has no paths")
+	}
+
+	definitions, ok := spec["definitions"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("generated spec has no definitions")
+	}
+	definitions["problemDetails"] = problemSchema
+	for _, item := range paths {
+		for _, op := range item.(map[string]any) {
+			if responses, ok := op.(map[string]any)["responses"].(map[string]any); ok {
+				responses["default"] = problemResponse
+			}
+		}
+	}
+
+	// links issued by SignURL carry their grant in the query
+	signedParams := []any{
+		map[string]any{"name": signedurl.ParamExpires, "in": "query", "type": "integer", "description": "signed URLs: Unix time after which the URL is refused"},
+		map[string]any{"name": signedurl.ParamPrincipal, "in": "query", "type": "string", "description": "signed URLs: whom the call is made for"},
+		map[string]any{"name": signedurl.ParamKeyID, "in": "query", "type": "string", "description": "signed URLs: key the URL was signed with"},
+		map[string]any{"name": signedurl.ParamSignature, "in": "query", "type": "string", "description": "signed URLs: the signature; a signed URL needs no Authorization header"},
+	}
+
+	upload, err := operation(paths, "/v1/images:upload", "post")
+	if err != nil {
+		return nil, err
+	}
+	upload["summary"] = "Upload an image"
+	upload["description"] = "The body is either the raw image or a multipart form whose first file part is the image; it is streamed to the server in chunks."
+	upload["consumes"] = []string{"multipart/form-data", "application/octet-stream", "image/*"}
+	upload["parameters"] = append([]any{
+		map[string]any{
+			"name": uploadFormField, "in": "formData", "type": "file", "required": true,
+			"description": "the image, for multipart/form-data requests",
+		},
+		map[string]any{"name": signedurl.ParamMaxBytes, "in": "query", "type": "integer", "description": "signed URLs: largest upload accepted"},
+	}, signedParams...)
+
+	process, err := operation(paths, swaggerPath(processPath), "post")
+	if err != nil {
+		return nil, err
+	}
+	process["produces"] = []string{"application/json", sseContentType, ndjsonContentType}
+	process["description"] = "Accept: text/event-stream streams \"progress\" events and a final \"done\" or \"error\" event; " +
+		"Accept: application/x-ndjson streams one ProgressUpdate per line. Both send heartbeats while the job is quiet."
+
+	ifNoneMatch := map[string]any{"name": "If-None-Match", "in": "header", "type": "string", "description": "answer 304 if the ETag is unchanged"}
+	notModified := map[string]any{"description": "The cached copy is current."}
+	image, err := operation(paths, swaggerPath(imagePath), "get")
+	if err != nil {
+		return nil, err
+	}
+	image["description"] = "Image metadata never changes, so responses carry an ETag and a long-lived Cache-Control."
+	image["parameters"] = append(image["parameters"].([]any), ifNoneMatch)
+	image["responses"].(map[string]any)["304"] = notModified
+
+	content, err := operation(paths, swaggerPath(contentPath), "get")
+	if err != nil {
+		return nil, err
+	}
+	content["summary"] = "Download an image"
+	content["description"] = "Serves the image bytes with an ETag and a long-lived Cache-Control. A single byte range may be requested with Range."
+	content["produces"] = []string{"image/*", "application/octet-stream"}
+	content["parameters"] = append([]any{
+		map[string]any{"name": "imageId", "in": "path", "required": true, "type": "string"},
+		map[string]any{"name": "Range", "in": "header", "type": "string", "description": "one byte range, e.g. bytes=0-1023"},
+		map[string]any{"name": "If-Range", "in": "header", "type": "string", "description": "honor Range only if the ETag is unchanged"},
+		ifNoneMatch,
+	}, signedParams...)
+	content["responses"] = map[string]any{
+		"200":     map[string]any{"description": "The image.", "schema": map[string]any{"type": "file"}},
+		"206":     map[string]any{"description": "The requested range of the image.", "schema": map[string]any{"type": "file"}},
+		"304":     notModified,
+		"416":     map[string]any{"description": "The range lies past the end of the image.", "schema": map[string]any{"$ref": "#/definitions/problemDetails"}},
+		"default": problemResponse,
+	}
+
+	eventTypes := []string{}
+	for i := 1; i < len(pb.EventType_name); i++ {
+		eventTypes = append(eventTypes, strings.ToLower(strings.TrimPrefix(pb.EventType(i).String(), "EVENT_TYPE_")))
+	}
+	paths[swaggerPath(eventsPath)] = map[string]any{"get": map[string]any{
+		"summary":     "Stream image and job lifecycle events",
+		"description": "Server-Sent Events named after the event type, with the event cursor as id. Reconnecting with Last-Event-ID resumes after that event; a \"reset\" event means missed events were lost.",
+		"operationId": "ImageProcessor_Subscribe",
+		"produces":    []string{sseContentType},
+		"parameters": []any{
+			map[string]any{"name": "type", "in": "query", "type": "array", "collectionFormat": "multi",
+				"items": map[string]any{"type": "string", "enum": eventTypes}, "description": "only these event types"},
+			map[string]any{"name": "owner", "in": "query", "type": "string", "description": "must be the caller, if set: callers only ever see their own events"},
+			map[string]any{"name": "cursor", "in": "query", "type": "string", "description": "resume after this event"},
+			map[string]any{"name": "Last-Event-ID", "in": "header", "type": "string", "description": "resume after this event; overrides cursor"},
+		},
+		"responses": map[string]any{
+			"200":     map[string]any{"description": "A stream of events.", "schema": map[string]any{"$ref": "#/definitions/imageprocEvent"}},
+			"default": problemResponse,
+		},
+		"tags": []string{"ImageProcessor"},
+	}}
+
+	paths[swaggerPath(tunePath)] = map[string]any{"get": map[string]any{
+		"summary":     "Tune an image over a WebSocket",
+		"description": "Upgrades to a WebSocket. Send TuneRequest JSON text frames (image_id defaults to the path's); previews arrive as binary frames. A failed call sends a google.rpc.Status text frame before closing.",
+		"operationId": "ImageProcessor_Tune",
+		"parameters": []any{
+			map[string]any{"name": "imageId", "in": "path", "required": true, "type": "string"},
+			map[string]any{"name": accessTokenParam, "in": "query", "type": "string", "description": "bearer token, for clients that cannot set headers"},
+		},
+		"responses": map[string]any{
+			"101":     map[string]any{"description": "Switching to the WebSocket protocol."},
+			"default": problemResponse,
+		},
+		"tags": []string{"ImageProcessor"},
+	}}
+
+	renderParameters := append([]any{
+		map[string]any{"name": "imageId", "in": "path", "required": true, "type": "string"},
+		map[string]any{"name": "w", "in": "query", "type": "integer", "description": "width in pixels; alone, height follows from the aspect ratio"},
+		map[string]any{"name": "h", "in": "query", "type": "integer", "description": "height in pixels; alone, width follows from the aspect ratio"},
+		map[string]any{"name": "fit", "in": "query", "type": "string", "enum": []string{"clip", "cover", "fill"}, "default": "clip",
+			"description": "with both w and h: fit inside the box, fill it and crop the overflow, or stretch to it"},
+		map[string]any{"name": "fmt", "in": "query", "type": "string", "enum": []string{"jpeg", "jpg", "png"}, "description": "output format; defaults to the stored image's"},
+		map[string]any{"name": "q", "in": "query", "type": "integer", "default": defaultRenderQuality, "description": "JPEG quality, 1-100"},
+		map[string]any{"name": "filter", "in": "query", "type": "string", "description": "comma-separated filters applied after resizing, as in Process"},
+	}, signedParams...)
+	paths[swaggerPath(renderPath)] = map[string]any{"get": map[string]any{
+		"summary": "Render a resized or filtered version of an image",
+		"description": "Renders on the fly without storing anything; results are cached by the image and the parameters that affect the output. " +
+			"Other query parameters are refused. Render URLs issued by SignURL carry their grant in the query and are served as signed, " +
+			"parameters included; a gateway may be set to serve no other render URLs.",
+		"operationId": "ImageProcessor_Render",
+		"produces":    []string{"image/jpeg", "image/png"},
+		"parameters":  append(renderParameters, ifNoneMatch),
+		"responses": map[string]any{
+			"200":     map[string]any{"description": "The rendered image.", "schema": map[string]any{"type": "file"}},
+			"304":     notModified,
+			"default": problemResponse,
+		},
+		"tags": []string{"ImageProcessor"},
+	}}
+
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// operation returns the spec's operation for method on path
+func operation(paths map[string]any, path, method string) (map[string]any, error) {
+	item, _ := paths[path].(map[string]any)
+	op, ok := item[method].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("generated spec has no %s %s", strings.ToUpper(method), path)
+	}
+	return op, nil
+}
+
+// swaggerPath renders a gateway path template with the JSON names the
+// spec uses for path parameters, e.g. {image_id} as {imageId}
+func swaggerPath(template string) string {
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(template, '{')
+		if open < 0 {
+			b.WriteString(template)
+			return b.String()
+		}
+		end := strings.IndexByte(template[open:], '}') + open
+		b.WriteString(template[:open+1])
+		b.WriteString(jsonName(template[open+1 : end]))
+		template = template[end:]
+	}
+}
+
+// jsonName converts a proto field name to its JSON name
+func jsonName(field string) string {
+	parts := strings.Split(field, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// openAPIHandlers returns the handlers for the spec and the docs page
+func openAPIHandlers() (spec, docs http.HandlerFunc, err error) {
+	body, err := openAPISpec()
+	if err != nil {
+		return nil, nil, err
+	}
+	spec = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+	docs = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsPage)
+	}
+	return spec, docs, nil
+}
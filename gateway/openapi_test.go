@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	pb "image-proc/proto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// servedSpec fetches /openapi.json the way a client would
+func servedSpec(t *testing.T) map[string]map[string]struct {
+	OperationID string `json:"operationId"`
+} {
+	t.Helper()
+	spec, _, err := openAPIHandlers()
+	if err != nil {
+		t.Fatalf("openAPIHandlers: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	spec(rec, httptest.NewRequest(http.MethodGet, openAPIPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d", openAPIPath, rec.Code)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	return doc.Paths
+}
+
+// httpRoutes returns every route an RPC is mapped to in image.proto,
+// as "METHOD path" keyed by operation ID
+func httpRoutes(t *testing.T) map[string][]string {
+	t.Helper()
+	svc := pb.File_image_proto.Services().ByName("ImageProcessor")
+	if svc == nil {
+		t.Fatal("image.proto has no ImageProcessor service")
+	}
+	routes := map[string][]string{}
+	methods := svc.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		m := methods.Get(i)
+		op := "ImageProcessor_" + string(m.Name())
+		if r, ok := handRoutes[string(m.Name())]; ok {
+			routes[op] = append(routes[op], r.method+" "+swaggerPath(r.path))
+			continue
+		}
+		rule, _ := proto.GetExtension(m.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if rule == nil {
+			continue
+		}
+		for _, r := range append([]*annotations.HttpRule{rule}, rule.AdditionalBindings...) {
+			routes[op] = append(routes[op], ruleRoute(t, m, r))
+		}
+	}
+	return routes
+}
+
+// ruleRoute renders an http rule the way the spec names its path
+func ruleRoute(t *testing.T, m protoreflect.MethodDescriptor, r *annotations.HttpRule) string {
+	var method, path string
+	switch p := r.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		method, path = http.MethodGet, p.Get
+	case *annotations.HttpRule_Post:
+		method, path = http.MethodPost, p.Post
+	case *annotations.HttpRule_Put:
+		method, path = http.MethodPut, p.Put
+	case *annotations.HttpRule_Patch:
+		method, path = http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Delete:
+		method, path = http.MethodDelete, p.Delete
+	default:
+		t.Fatalf("%s: unsupported http rule %T", m.FullName(), r.Pattern)
+	}
+	// path parameters are named by the request field's JSON name
+	for _, seg := range strings.FieldsFunc(path, func(r rune) bool { return r == '{' || r == '}' }) {
+		if f := m.Input().Fields().ByName(protoreflect.Name(seg)); f != nil {
+			path = strings.Replace(path, "{"+seg+"}", "{"+f.JSONName()+"}", 1)
+		}
+	}
+	return method + " " + path
+}
+
+func TestOpenAPISpecMatchesProto(t *testing.T) {
+	paths := servedSpec(t)
+	want := httpRoutes(t)
+
+	served := map[string][]string{}
+	for path, ops := range paths {
+		for method, op := range ops {
+			served[op.OperationID] = append(served[op.OperationID], strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	for op, routes := range want {
+		for _, route := range routes {
+			method, path, _ := strings.Cut(route, " ")
+			got, ok := paths[path][strings.ToLower(method)]
+			if !ok {
+				t.Errorf("%s: %s is missing from the served spec", op, route)
+				continue
+			}
+			if got.OperationID != op {
+				t.Errorf("%s: served spec has %s as %q", op, route, got.OperationID)
+			}
+		}
+	}
+	for op, routes := range served {
+		if _, ok := want[op]; !ok {
+			t.Errorf("served spec documents %v as %q, which image.proto does not map", routes, op)
+		}
+	}
+}
+
+func TestDocsPageServed(t *testing.T) {
+	_, docs, err := openAPIHandlers()
+	if err != nil {
+		t.Fatalf("openAPIHandlers: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	docs(rec, httptest.NewRequest(http.MethodGet, docsPath, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), openAPIPath) {
+		t.Fatalf("GET %s = %d, want a page loading %s", docsPath, rec.Code, openAPIPath)
+	}
+}
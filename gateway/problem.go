@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// problemContentType is the media type of RFC 9457 error bodies
+const problemContentType = "application/problem+json"
+
+// problem is an RFC 9457 problem details body, extended with the gRPC
+// status it was made from
+type problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+	Details   []json.RawMessage `json:"details,omitempty"`
+}
+
+// newProblem describes a failed request to r
+func newProblem(r *http.Request, httpStatus int, code codes.Code, detail string) *problem {
+	return &problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(httpStatus),
+		Status:    httpStatus,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code.String(),
+		RequestID: r.Header.Get(requestIDHeader),
+	}
+}
+
+func (p *problem) write(w http.ResponseWriter) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("problem: marshal: %v", err)
+		http.Error(w, p.Title, p.Status)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Del("Trailer")
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// writeProblem answers r with an error from outside the gRPC mux
+func writeProblem(w http.ResponseWriter, r *http.Request, httpStatus int, code codes.Code, detail string) {
+	newProblem(r, httpStatus, code, detail).write(w)
+}
+
+// problemErrorHandler renders gRPC errors as problem+json, with the
+// HTTP status grpc-gateway maps the code to unless the error carries its
+// own. Status details are kept, in their protojson form.
+func problemErrorHandler(ctx context.Context, mux *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	var httpStatus int
+	var statusErr *runtime.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		httpStatus = statusErr.HTTPStatus
+		err = statusErr.Err
+	}
+	s := status.Convert(err)
+	if httpStatus == 0 {
+		httpStatus = runtime.HTTPStatusFromCode(s.Code())
+	}
+
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for k, vs := range md.HeaderMD {
+			if h, ok := outgoingHeaderMatcher(k); ok {
+				for _, v := range vs {
+					w.Header().Add(h, v)
+				}
+			}
+		}
+	}
+	if s.Code() == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+
+	p := newProblem(r, httpStatus, s.Code(), s.Message())
+	for _, d := range s.Proto().GetDetails() {
+		data, err := protojson.Marshal(d)
+		if err != nil {
+			log.Printf("problem: marshal detail %s: %v", d.GetTypeUrl(), err)
+			continue
+		}
+		p.Details = append(p.Details, data)
+	}
+	p.write(w)
+}
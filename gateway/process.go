@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "image-proc/proto"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// processPath is the Process route, served here so the response format
+// can be negotiated
+const processPath = "/v1/images/{image_id}/process"
+
+// processHandler serves Process in the format the Accept header asks for:
+//
+//   - text/event-stream: one "progress" event per update and a final
+//     "done" or "error" event, with ids "<job_id>/<n>"
+//   - application/x-ndjson: one update per line, and {"error": status}
+//     as the last line if the call fails
+//   - anything else: grpc-gateway's {"result": ...} stream
+//
+// The first two send a heartbeat while the job is quiet: an SSE comment
+// or an empty line, which NDJSON readers skip.
+func processHandler(mux *runtime.ServeMux, client pb.ImageProcessorClient, heartbeat time.Duration, done <-chan struct{}) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		inbound, outbound := runtime.MarshalerForRequest(mux, r)
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		ctx, err := runtime.AnnotateContext(ctx, mux, r, pb.ImageProcessor_Process_FullMethodName, runtime.WithHTTPPathPattern(processPath))
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		req := &pb.ProcessingRequest{}
+		if err := inbound.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+			runtime.HTTPError(ctx, mux, outbound, w, r, status.Errorf(codes.InvalidArgument, "%v", err))
+			return
+		}
+		req.ImageId = params["image_id"]
+
+		var md runtime.ServerMetadata
+		stream, err := client.Process(ctx, req)
+		if err == nil {
+			md.HeaderMD, err = stream.Header()
+		}
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+
+		format := negotiateStream(r.Header.Get("Accept"))
+		if format == "" {
+			runtime.ForwardResponseStream(ctx, mux, outbound, w, r, func() (proto.Message, error) { return stream.Recv() })
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			runtime.HTTPError(ctx, mux, outbound, w, r, status.Error(codes.Unimplemented, "streaming is not supported by this connection"))
+			return
+		}
+		// the first update decides the status code, so a rejected request
+		// still gets a proper HTTP error
+		first, err := stream.Recv()
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		pw := &progressWriter{w: w, format: format, marshaler: outbound}
+		startStream(w, format)
+		pw.update(first)
+		flusher.Flush()
+
+		updates, streamErr := relay(ctx, stream.Recv)
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case upd := <-updates:
+				pw.update(upd)
+			case <-ticker.C:
+				pw.heartbeat()
+			case err := <-streamErr:
+				if err != io.EOF && ctx.Err() == nil {
+					pw.fail(err)
+				}
+				flusher.Flush()
+				return
+			case <-ctx.Done():
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// progressWriter renders Process updates as SSE or NDJSON
+type progressWriter struct {
+	w         http.ResponseWriter
+	format    string
+	marshaler runtime.Marshaler
+	seq       int
+	jobID     string
+}
+
+func (p *progressWriter) update(upd *pb.ProgressUpdate) {
+	data, err := p.marshaler.Marshal(upd)
+	if err != nil {
+		log.Printf("process: marshal: %v", err)
+		return
+	}
+	if p.format == ndjsonContentType {
+		p.w.Write(append(data, '\n'))
+		return
+	}
+	p.seq++
+	if upd.JobId != "" {
+		p.jobID = upd.JobId
+	}
+	event := "progress"
+	switch upd.State {
+	case pb.JobState_JOB_STATE_SUCCEEDED, pb.JobState_JOB_STATE_FAILED, pb.JobState_JOB_STATE_CANCELLED:
+		event = "done"
+	}
+	writeSSE(p.w, fmt.Sprintf("%s/%d", p.jobID, p.seq), event, data)
+}
+
+func (p *progressWriter) heartbeat() {
+	if p.format == ndjsonContentType {
+		p.w.Write([]byte("\n"))
+		return
+	}
+	fmt.Fprint(p.w, sseKeepalive)
+}
+
+// fail reports the error the stream ended with; the status code was
+// sent with the first update
+func (p *progressWriter) fail(err error) {
+	data, merr := p.marshaler.Marshal(status.Convert(err).Proto())
+	if merr != nil {
+		log.Printf("process: marshal: %v", merr)
+		return
+	}
+	if p.format == ndjsonContentType {
+		fmt.Fprintf(p.w, "{\"error\":%s}\n", data)
+		return
+	}
+	writeSSE(p.w, "", "error", data)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	pb "image-proc/proto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeProcess answers Process with updates, then ends with err once end
+// is done
+type fakeProcess struct {
+	pb.ImageProcessorClient
+	updates []*pb.ProgressUpdate
+	end     <-chan struct{}
+	err     error
+
+	req *pb.ProcessingRequest
+}
+
+func (f *fakeProcess) Process(ctx context.Context, req *pb.ProcessingRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[pb.ProgressUpdate], error) {
+	f.req = req
+	return newFakeStream(ctx, metadata.MD{}, f.updates, f.end, f.err), nil
+}
+
+var testUpdates = []*pb.ProgressUpdate{
+	{JobId: "j1", State: pb.JobState_JOB_STATE_QUEUED, QueuePosition: 1},
+	{JobId: "j1", State: pb.JobState_JOB_STATE_RUNNING, Percent: 50},
+	{JobId: "j1", State: pb.JobState_JOB_STATE_SUCCEEDED, Percent: 100, ResultImageId: "result"},
+}
+
+// postProcess serves one Process request asking for accept
+func postProcess(t *testing.T, client pb.ImageProcessorClient, heartbeat time.Duration, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := runtime.NewServeMux(runtime.WithErrorHandler(problemErrorHandler))
+	if err := mux.HandlePath(http.MethodPost, processPath, processHandler(mux, client, heartbeat, make(chan struct{}))); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/images/"+testImageID+"/process", strings.NewReader(`{"filters":["blur"]}`))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// ndjsonLines returns the lines of an NDJSON body, empty ones included
+func ndjsonLines(body string) []string {
+	var lines []string
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines
+}
+
+func TestProcessSSE(t *testing.T) {
+	client := &fakeProcess{updates: testUpdates}
+	rec := postProcess(t, client, time.Hour, sseContentType)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != sseContentType {
+		t.Fatalf("status %d, headers %v", rec.Code, rec.Header())
+	}
+	if client.req.ImageId != testImageID || len(client.req.Filters) != 1 {
+		t.Errorf("sent %v, want the path's image and the body's filters", client.req)
+	}
+	events, _ := parseSSE(t, rec.Body.String())
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %q", len(events), rec.Body)
+	}
+	for i, want := range []string{"progress", "progress", "done"} {
+		if id := fmt.Sprintf("j1/%d", i+1); events[i].id != id || events[i].event != want {
+			t.Errorf("event %d: id %q, event %q; want %q, %q", i, events[i].id, events[i].event, id, want)
+		}
+	}
+	var last struct {
+		ResultImageID string `json:"resultImageId"`
+	}
+	if err := json.Unmarshal([]byte(events[2].data), &last); err != nil || last.ResultImageID != "result" {
+		t.Errorf("final event data %s, want the result", events[2].data)
+	}
+}
+
+func TestProcessNDJSON(t *testing.T) {
+	client := &fakeProcess{updates: testUpdates[:2], err: status.Error(codes.Unavailable, "server is shutting down")}
+	rec := postProcess(t, client, time.Hour, ndjsonContentType)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != ndjsonContentType {
+		t.Fatalf("status %d, headers %v", rec.Code, rec.Header())
+	}
+	lines := ndjsonLines(rec.Body.String())
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 2 updates and the error: %q", len(lines), rec.Body)
+	}
+	for i, line := range lines[:2] {
+		var upd struct {
+			JobID string `json:"jobId"`
+			State string `json:"state"`
+		}
+		if err := json.Unmarshal([]byte(line), &upd); err != nil || upd.JobID != "j1" || upd.State != testUpdates[i].State.String() {
+			t.Errorf("line %d = %s, want update %d", i, line, i)
+		}
+	}
+	var last struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil || last.Error.Code != int(codes.Unavailable) || last.Error.Message != "server is shutting down" {
+		t.Errorf("last line = %s, want the error", lines[2])
+	}
+}
+
+func TestProcessHeartbeat(t *testing.T) {
+	tests := []struct {
+		accept string
+		isBeat func(line string) bool
+	}{
+		{accept: ndjsonContentType, isBeat: func(line string) bool { return line == "" }},
+		{accept: sseContentType, isBeat: func(line string) bool { return strings.HasPrefix(line, ":") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			client := &fakeProcess{updates: testUpdates[:1], end: after(60 * time.Millisecond)}
+			rec := postProcess(t, client, 10*time.Millisecond, tt.accept)
+			beats := 0
+			for _, line := range ndjsonLines(rec.Body.String()) {
+				if tt.isBeat(line) {
+					beats++
+				}
+			}
+			if beats == 0 {
+				t.Errorf("no heartbeat while the job was quiet: %q", rec.Body)
+			}
+		})
+	}
+}
+
+func TestProcessDefaultFormat(t *testing.T) {
+	rec := postProcess(t, &fakeProcess{updates: testUpdates}, time.Hour, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	lines := ndjsonLines(rec.Body.String())
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), rec.Body)
+	}
+	for i, line := range lines {
+		var msg struct {
+			Result *struct {
+				JobID string `json:"jobId"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil || msg.Result == nil || msg.Result.JobID != "j1" {
+			t.Errorf("line %d = %s, want a result", i, line)
+		}
+	}
+}
+
+func TestProcessRefused(t *testing.T) {
+	for _, accept := range []string{sseContentType, ndjsonContentType} {
+		t.Run(accept, func(t *testing.T) {
+			client := &fakeProcess{err: status.Error(codes.NotFound, "image not found")}
+			rec := postProcess(t, client, time.Hour, accept)
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body)
+			}
+			if p := readProblem(t, rec); p.Code != codes.NotFound.String() {
+				t.Errorf("problem code %s, want %s", p.Code, codes.NotFound)
+			}
+		})
+	}
+}
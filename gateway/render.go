@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	pb "image-proc/proto"
+	"image-proc/signedurl"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// renderPath serves Render with imgix-style query parameters, e.g.
+// ?w=400&h=300&fit=cover&fmt=png&q=80
+const renderPath = "/v1/images/{image_id}/render"
+
+// renderParams are the query parameters a render URL may carry
+var renderParams = []string{"w", "h", "fit", "fmt", "q", "filter"}
+
+// grantParams are the parameters SignURL adds to a render URL, which
+// parseRenderQuery leaves to signedLinks
+var grantParams = []string{signedurl.ParamExpires, signedurl.ParamPrincipal, signedurl.ParamKeyID, signedurl.ParamSignature}
+
+var renderFits = map[string]pb.Fit{"clip": pb.Fit_FIT_CLIP, "cover": pb.Fit_FIT_COVER, "fill": pb.Fit_FIT_FILL}
+
+// defaultRenderQuality matches the quality the server renders JPEGs with
+// when none is given, so both spellings share a cache entry
+const defaultRenderQuality = 85
+
+// parseRenderQuery turns a render URL's query into a request, and returns
+// the parameters that decide the output in a canonical form: parameters
+// that change nothing are dropped and the rest sorted, so equivalent URLs
+// share a cache entry
+func parseRenderQuery(imageID string, query url.Values) (*pb.RenderRequest, string, error) {
+	for name, values := range query {
+		if slices.Contains(grantParams, name) {
+			continue
+		}
+		if !slices.Contains(renderParams, name) {
+			return nil, "", status.Errorf(codes.InvalidArgument, "unknown parameter %q, want one of %s", name, strings.Join(renderParams, ", "))
+		}
+		if len(values) > 1 {
+			return nil, "", status.Errorf(codes.InvalidArgument, "parameter %q given more than once", name)
+		}
+	}
+	positive := func(name string, limit int) (int32, error) {
+		v := query.Get(name)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > limit {
+			return 0, status.Errorf(codes.InvalidArgument, "%s must be an integer between 1 and %d, got %q", name, limit, v)
+		}
+		return int32(n), nil
+	}
+
+	req := &pb.RenderRequest{ImageId: imageID}
+	var err error
+	if req.Width, err = positive("w", 1<<15); err != nil {
+		return nil, "", err
+	}
+	if req.Height, err = positive("h", 1<<15); err != nil {
+		return nil, "", err
+	}
+	if req.Quality, err = positive("q", 100); err != nil {
+		return nil, "", err
+	}
+	if v := query.Get("fit"); v != "" {
+		fit, ok := renderFits[v]
+		if !ok {
+			return nil, "", status.Errorf(codes.InvalidArgument, "unknown fit %q, want clip, cover or fill", v)
+		}
+		req.Fit = fit
+	}
+	switch v := query.Get("fmt"); v {
+	case "", "png", "jpeg":
+		req.Format = v
+	case "jpg":
+		req.Format = "jpeg"
+	default:
+		return nil, "", status.Errorf(codes.InvalidArgument, "unknown fmt %q, want jpeg or png", v)
+	}
+	if v := query.Get("filter"); v != "" {
+		req.Filters = strings.Split(v, ",")
+	}
+
+	canonical := url.Values{}
+	if req.Width > 0 {
+		canonical.Set("w", strconv.Itoa(int(req.Width)))
+	}
+	if req.Height > 0 {
+		canonical.Set("h", strconv.Itoa(int(req.Height)))
+	}
+	if req.Width > 0 && req.Height > 0 && req.Fit != pb.Fit_FIT_UNSPECIFIED && req.Fit != pb.Fit_FIT_CLIP {
+		canonical.Set("fit", query.Get("fit"))
+	}
+	if req.Format != "" {
+		canonical.Set("fmt", req.Format)
+	}
+	if req.Quality > 0 && req.Quality != defaultRenderQuality && req.Format != "png" {
+		canonical.Set("q", strconv.Itoa(int(req.Quality)))
+	}
+	if len(req.Filters) > 0 {
+		canonical.Set("filter", strings.Join(req.Filters, ","))
+	}
+	return req, canonical.Encode(), nil
+}
+
+// renderHandler serves Render. Results are cached like the image they
+// come from, except that the result of a signed URL is only cacheable
+// until the URL expires.
+func (ic *imageCache) renderHandler(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	_, outbound := runtime.MarshalerForRequest(ic.mux, r)
+	ctx, err := runtime.AnnotateContext(r.Context(), ic.mux, r, pb.ImageProcessor_Render_FullMethodName, runtime.WithHTTPPathPattern(renderPath))
+	if err != nil {
+		runtime.HTTPError(r.Context(), ic.mux, outbound, w, r, err)
+		return
+	}
+	imageID := params["image_id"]
+	if ctx, r, err = ic.links.check(ctx, r, pb.ImageProcessor_Render_FullMethodName, imageID); err != nil {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, err)
+		return
+	}
+	grant, signed := grantFromRequest(r)
+	if ic.requireSignedRenders && !signed {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, status.Error(codes.PermissionDenied, "render URLs must be signed; request one through SignURL"))
+		return
+	}
+	req, canonical, err := parseRenderQuery(imageID, r.URL.Query())
+	if err != nil {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, err)
+		return
+	}
+	// the server still decides whether the caller may see the image
+	if _, _, err := ic.info(ctx, r, outbound, imageID); err != nil {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, err)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(imageID + "?" + canonical))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	maxAge := ic.maxAge
+	if signed {
+		maxAge = min(maxAge, time.Until(grant.Expires))
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		ic.setCacheHeaders(w, r, etag, maxAge)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	key := cacheKey("render", imageID, r) + "?" + canonical
+	if entry, ok := ic.cache.get(key); ok {
+		ic.setCacheHeaders(w, r, etag, maxAge)
+		w.Header().Set("Content-Type", entry.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(entry.body)))
+		w.Write(entry.body)
+		return
+	}
+
+	stream, err := ic.client.Render(ctx, req)
+	var first *pb.RenderChunk
+	if err == nil {
+		first, err = stream.Recv()
+	}
+	if err != nil {
+		runtime.HTTPError(ctx, ic.mux, outbound, w, r, err)
+		return
+	}
+	ic.setCacheHeaders(w, r, etag, maxAge)
+	w.Header().Set("Content-Type", first.ContentType)
+	// the result is kept if it turns out small enough
+	var kept []byte
+	keep := ic.cache != nil
+	for chunk := first; chunk != nil; {
+		if _, err := w.Write(chunk.Chunk); err != nil {
+			return
+		}
+		if keep {
+			kept = append(kept, chunk.Chunk...)
+			if keep = ic.cache.fits(int64(len(kept))); !keep {
+				kept = nil
+			}
+		}
+		if chunk, err = stream.Recv(); err != nil && err != io.EOF {
+			log.Printf("render %s: %v", imageID, err)
+			return
+		}
+	}
+	if keep {
+		ic.cache.put(&cachedResponse{key: key, imageID: imageID, contentType: first.ContentType, etag: etag, body: kept})
+	}
+}
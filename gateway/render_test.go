@@ -0,0 +1,83 @@
+package main
+
+import (
+	pb "image-proc/proto"
+	"net/url"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseRenderQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: ""},
+		{query: "w=100", want: "w=100"},
+		{query: "h=50&w=100", want: "h=50&w=100"},
+		{query: "w=100&h=50", want: "h=50&w=100"},
+		// clip is the default, and fit only matters with both sides given
+		{query: "w=100&h=50&fit=clip", want: "h=50&w=100"},
+		{query: "w=100&fit=cover", want: "w=100"},
+		{query: "w=100&h=50&fit=cover", want: "fit=cover&h=50&w=100"},
+		{query: "w=100&h=50&fit=fill", want: "fit=fill&h=50&w=100"},
+		// jpg is jpeg, the default quality is no quality, and png has none
+		{query: "fmt=jpg", want: "fmt=jpeg"},
+		{query: "fmt=jpeg&q=85", want: "fmt=jpeg"},
+		{query: "q=50", want: "q=50"},
+		{query: "fmt=png&q=50", want: "fmt=png"},
+		{query: "filter=blur,grayscale", want: "filter=blur%2Cgrayscale"},
+		// a signed URL's grant is not part of what is rendered
+		{query: "w=10&expires=1700000000&principal=alice&kid=k1&sig=abc", want: "w=10"},
+	}
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, got, err := parseRenderQuery(testImageID, query)
+		if err != nil {
+			t.Errorf("parseRenderQuery(%q) = %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRenderQuery(%q) canonical = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseRenderQueryRequest(t *testing.T) {
+	query, _ := url.ParseQuery("w=400&h=300&fit=cover&fmt=jpg&q=80&filter=blur,invert")
+	req, _, err := parseRenderQuery(testImageID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ImageId != testImageID || req.Width != 400 || req.Height != 300 || req.Fit != pb.Fit_FIT_COVER ||
+		req.Format != "jpeg" || req.Quality != 80 || len(req.Filters) != 2 || req.Filters[1] != "invert" {
+		t.Errorf("request = %v", req)
+	}
+}
+
+func TestParseRenderQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"width=100",
+		"w=100&w=200",
+		"w=0",
+		"w=-1",
+		"w=abc",
+		"h=40000",
+		"q=101",
+		"fit=stretch",
+		"fmt=gif",
+	} {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := parseRenderQuery(testImageID, values); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("parseRenderQuery(%q) = %v, want InvalidArgument", query, err)
+		}
+	}
+}
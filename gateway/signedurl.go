@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image-proc/signedurl"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// signedLinks checks the download and upload URLs the server issues
+// through SignURL. The server checks them again; the gateway refuses bad
+// links before any body is read and enforces an upload's size itself.
+type signedLinks struct {
+	keys *signedurl.Keys
+}
+
+type grantKey struct{}
+
+// grantFromRequest returns the signed URL r was checked against
+func grantFromRequest(r *http.Request) (signedurl.Grant, bool) {
+	g, ok := r.Context().Value(grantKey{}).(signedurl.Grant)
+	return g, ok
+}
+
+// check verifies r's signature, if it has one, for a call of method on
+// imageID. It returns r with the grant recorded and ctx forwarding the
+// signed parameters to the server; unsigned requests, and those it
+// refuses, are returned as is.
+func (l signedLinks) check(ctx context.Context, r *http.Request, method, imageID string) (context.Context, *http.Request, error) {
+	query := r.URL.Query()
+	if !query.Has(signedurl.ParamSignature) {
+		return ctx, r, nil
+	}
+	if l.keys == nil {
+		return ctx, r, status.Error(codes.PermissionDenied, "signed URLs are not enabled on this gateway")
+	}
+	g, err := l.keys.Verify(method, imageID, query, time.Now())
+	switch {
+	case errors.Is(err, signedurl.ErrExpired):
+		return ctx, r, status.Error(codes.PermissionDenied, "the URL has expired")
+	case err != nil:
+		return ctx, r, status.Error(codes.PermissionDenied, "invalid URL signature")
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, signedurl.MetadataKey, r.URL.RawQuery)
+	return ctx, r.WithContext(context.WithValue(r.Context(), grantKey{}, g)), nil
+}
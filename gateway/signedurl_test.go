@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	pb "image-proc/proto"
+	"image-proc/signedurl"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testImageID = "573339b8-a202-47ba-b3b2-0f2982caaf0a"
+
+// fakeImages serves one stored image and records the metadata each call
+// was forwarded with
+type fakeImages struct {
+	pb.ImageProcessorClient
+	content []byte
+
+	mu    sync.Mutex
+	calls map[string]metadata.MD // by method
+}
+
+func (f *fakeImages) record(ctx context.Context, method string) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]metadata.MD)
+	}
+	f.calls[method] = md
+}
+
+func (f *fakeImages) call(method string) (metadata.MD, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	md, ok := f.calls[method]
+	return md, ok
+}
+
+func (f *fakeImages) GetImage(ctx context.Context, req *pb.GetImageRequest, _ ...grpc.CallOption) (*pb.ImageInfo, error) {
+	f.record(ctx, "GetImage")
+	if req.ImageId != testImageID {
+		return nil, status.Errorf(codes.NotFound, "image %s not found", req.ImageId)
+	}
+	return &pb.ImageInfo{ImageId: testImageID, Format: "png", SizeBytes: int64(len(f.content))}, nil
+}
+
+func (f *fakeImages) Download(ctx context.Context, req *pb.DownloadRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[pb.DownloadChunk], error) {
+	f.record(ctx, "Download")
+	end := int64(len(f.content))
+	if req.Length > 0 {
+		end = req.Offset + req.Length
+	}
+	return &chunkStream{chunks: []*pb.DownloadChunk{{Chunk: f.content[req.Offset:end]}}}, nil
+}
+
+// chunkStream replays chunks, then io.EOF
+type chunkStream struct {
+	grpc.ClientStream
+	chunks []*pb.DownloadChunk
+}
+
+func (s *chunkStream) Recv() (*pb.DownloadChunk, error) {
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	c := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return c, nil
+}
+
+// newSignedContentServer serves the content route the way main wires it,
+// checking signed URLs against keys
+func newSignedContentServer(t *testing.T, client pb.ImageProcessorClient, keys *signedurl.Keys) http.Handler {
+	t.Helper()
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithErrorHandler(problemErrorHandler),
+	)
+	ic := &imageCache{mux: mux, client: client, maxAge: time.Hour, links: signedLinks{keys: keys}}
+	if err := mux.HandlePath(http.MethodGet, contentPath, ic.contentHandler); err != nil {
+		t.Fatal(err)
+	}
+	return mux
+}
+
+func TestSignedDownload(t *testing.T) {
+	keys, err := signedurl.NewKeys(map[string]string{"k1": "secret1"}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant := func(imageID string, expires time.Time) string {
+		query, err := keys.Sign(signedurl.Grant{
+			Method:    pb.ImageProcessor_Download_FullMethodName,
+			ImageID:   imageID,
+			Principal: "alice",
+			Expires:   expires.Truncate(time.Second),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return query.Encode()
+	}
+	path := "/v1/images/" + testImageID + "/content"
+	valid := grant(testImageID, time.Now().Add(10*time.Minute))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "signed", query: valid, wantStatus: http.StatusOK},
+		{name: "tampered", query: strings.Replace(valid, "principal=alice", "principal=bob", 1), wantStatus: http.StatusForbidden},
+		{name: "other image", query: grant("0d9c1e2f-3a4b-4c5d-9e8f-7a6b5c4d3e2f", time.Now().Add(time.Minute)), wantStatus: http.StatusForbidden},
+		{name: "expired", query: grant(testImageID, time.Now().Add(-time.Minute)), wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeImages{content: []byte("\x89PNG fake image bytes")}
+			h := newSignedContentServer(t, client, keys)
+			rec := httptest.NewRecorder()
+			// no Authorization header: the URL alone must be enough
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+"?"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if _, called := client.call("Download"); called {
+					t.Error("a refused URL still reached Download")
+				}
+				return
+			}
+			if got := rec.Body.String(); got != string(client.content) {
+				t.Errorf("body = %q, want %q", got, client.content)
+			}
+			if cc := rec.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "private, max-age=") {
+				t.Errorf("Cache-Control = %q, want a private response", cc)
+			}
+			for _, method := range []string{"GetImage", "Download"} {
+				md, ok := client.call(method)
+				if !ok {
+					t.Fatalf("%s was not called", method)
+				}
+				if got := md.Get(signedurl.MetadataKey); len(got) != 1 || got[0] != tt.query {
+					t.Errorf("%s forwarded %s = %q, want the URL's query %q", method, signedurl.MetadataKey, got, tt.query)
+				}
+				if got := md.Get("authorization"); len(got) != 0 {
+					t.Errorf("%s forwarded authorization %q, want none", method, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSignedDownloadDisabled(t *testing.T) {
+	keys, err := signedurl.NewKeys(map[string]string{"k1": "secret1"}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := keys.Sign(signedurl.Grant{
+		Method:    pb.ImageProcessor_Download_FullMethodName,
+		ImageID:   testImageID,
+		Principal: "alice",
+		Expires:   time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &fakeImages{content: []byte("image")}
+	// a gateway without keys refuses signed URLs instead of passing them on
+	h := newSignedContentServer(t, client, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/images/"+testImageID+"/content?"+query.Encode(), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if _, called := client.call("GetImage"); called {
+		t.Error("a refused URL still reached the server")
+	}
+}
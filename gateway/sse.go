@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// media types of the streaming formats the gateway negotiates
+const (
+	sseContentType    = "text/event-stream"
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// sseKeepalive is an SSE comment; clients ignore it, proxies see traffic
+const sseKeepalive = ": keepalive\n\n"
+
+// startStream commits a streaming response of contentType
+func startStream(w http.ResponseWriter, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	// keep nginx and friends from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeSSE writes one event. Multi-line data is split over several data
+// fields, which the client joins back with newlines.
+func writeSSE(w http.ResponseWriter, id, event string, data []byte) {
+	var b bytes.Buffer
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteByte('\n')
+	w.Write(b.Bytes())
+}
+
+// negotiateStream returns the first streaming format named in an Accept
+// header, or "" when the client asked for neither
+func negotiateStream(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == sseContentType || mediaType == ndjsonContentType {
+			return mediaType
+		}
+	}
+	return ""
+}
+
+// relay receives from a stream in the background so the caller can
+// interleave heartbeats. The error channel yields the stream's final
+// error, io.EOF included; nothing is delivered once ctx is done.
+func relay[T any](ctx context.Context, recv func() (T, error)) (<-chan T, <-chan error) {
+	msgs := make(chan T)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return msgs, errc
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStream is a server stream that yields what is sent on msgs; once
+// msgs is closed, Recv returns err, or io.EOF if that is nil
+type fakeStream[T any] struct {
+	grpc.ClientStream
+	ctx    context.Context
+	header metadata.MD
+	msgs   chan *T
+	err    error
+}
+
+// newFakeStream returns a stream that replays msgs, then ends with err
+// once end is done (at once if end is nil)
+func newFakeStream[T any](ctx context.Context, header metadata.MD, msgs []*T, end <-chan struct{}, err error) *fakeStream[T] {
+	s := &fakeStream[T]{ctx: ctx, header: header, msgs: make(chan *T, len(msgs)), err: err}
+	for _, m := range msgs {
+		s.msgs <- m
+	}
+	if end == nil {
+		close(s.msgs)
+	} else {
+		go func() {
+			<-end
+			close(s.msgs)
+		}()
+	}
+	return s
+}
+
+func (s *fakeStream[T]) Recv() (*T, error) {
+	select {
+	case m, ok := <-s.msgs:
+		if ok {
+			return m, nil
+		}
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	case <-s.ctx.Done():
+		return nil, status.FromContextError(s.ctx.Err()).Err()
+	}
+}
+
+func (s *fakeStream[T]) Header() (metadata.MD, error) { return s.header, nil }
+func (s *fakeStream[T]) Trailer() metadata.MD         { return nil }
+
+// after returns a channel closed after d
+func after(d time.Duration) <-chan struct{} {
+	c := make(chan struct{})
+	time.AfterFunc(d, func() { close(c) })
+	return c
+}
+
+// sseEvent is one parsed Server-Sent Event
+type sseEvent struct {
+	id, event, data string
+}
+
+// parseSSE splits an event stream into its events, reporting how many
+// comments it skipped
+func parseSSE(t *testing.T, body string) ([]sseEvent, int) {
+	t.Helper()
+	var events []sseEvent
+	var cur sseEvent
+	var data []string
+	comments := 0
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if data != nil {
+				cur.data = strings.Join(data, "\n")
+				events = append(events, cur)
+			}
+			cur, data = sseEvent{}, nil
+		case strings.HasPrefix(line, ":"):
+			comments++
+		default:
+			field, value, ok := strings.Cut(line, ": ")
+			if !ok {
+				t.Fatalf("malformed SSE line %q", line)
+			}
+			switch field {
+			case "id":
+				cur.id = value
+			case "event":
+				cur.event = value
+			case "data":
+				data = append(data, value)
+			default:
+				t.Fatalf("unknown SSE field %q", field)
+			}
+		}
+	}
+	if cur != (sseEvent{}) || data != nil {
+		t.Fatalf("stream ends inside an event: %q", body)
+	}
+	return events, comments
+}
+
+func TestWriteSSE(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeSSE(rec, "c1", "job_finished", []byte("{\n  \"a\": 1\n}"))
+	writeSSE(rec, "", "", []byte("plain"))
+	want := "id: c1\nevent: job_finished\ndata: {\ndata:   \"a\": 1\ndata: }\n\ndata: plain\n\n"
+	if rec.Body.String() != want {
+		t.Errorf("wrote %q, want %q", rec.Body, want)
+	}
+	events, _ := parseSSE(t, rec.Body.String())
+	if len(events) != 2 || events[0].data != "{\n  \"a\": 1\n}" {
+		t.Errorf("multi-line data does not round-trip: %+v", events)
+	}
+}
+
+func TestNegotiateStream(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ""},
+		{accept: "application/json", want: ""},
+		{accept: "text/event-stream", want: sseContentType},
+		{accept: "application/x-ndjson", want: ndjsonContentType},
+		{accept: "application/json, application/x-ndjson;q=0.9, text/event-stream", want: ndjsonContentType},
+		{accept: "text/event-stream; charset=utf-8", want: sseContentType},
+		{accept: "*/*", want: ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateStream(tt.accept); got != tt.want {
+			t.Errorf("negotiateStream(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	pb "image-proc/proto"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tunePath serves the Tune stream over WebSocket
+const tunePath = "/v1/images/{image_id}/tune"
+
+// accessTokenParam carries the bearer token for clients that cannot set
+// headers on a WebSocket handshake, such as browsers
+const accessTokenParam = "access_token"
+
+// WebSocket close codes (RFC 6455, section 7.4.1)
+const (
+	wsCloseNormal    = 1000
+	wsCloseGoingAway = 1001
+	wsClosePolicy    = 1008
+	wsCloseInternal  = 1011
+)
+
+// tuneHandler bridges a WebSocket to the Tune RPC. Every text frame from
+// the client is a JSON TuneRequest, whose image_id defaults to the one in
+// the path; every preview chunk goes back as a binary frame. When the
+// RPC fails, a text frame with the JSON status is sent before the close.
+// Closing the socket half-closes the RPC, and a dropped socket or a
+// gateway shutdown cancels it.
+func tuneHandler(mux *runtime.ServeMux, client pb.ImageProcessorClient, origins []string, done <-chan struct{}) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		inbound, outbound := runtime.MarshalerForRequest(mux, r)
+		if token := r.URL.Query().Get(accessTokenParam); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		ctx, err := runtime.AnnotateContext(ctx, mux, r, pb.ImageProcessor_Tune_FullMethodName, runtime.WithHTTPPathPattern(tunePath))
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		ws := websocket.Server{
+			Handshake: func(cfg *websocket.Config, r *http.Request) error {
+				return checkOrigin(r, origins)
+			},
+			Handler: func(conn *websocket.Conn) {
+				t := &tuneBridge{
+					conn:     conn,
+					imageID:  params["image_id"],
+					inbound:  inbound,
+					outbound: outbound,
+				}
+				t.run(ctx, cancel, client, done)
+			},
+		}
+		ws.ServeHTTP(w, r)
+	}
+}
+
+// checkOrigin lets through clients that send no Origin, pages served by
+// the gateway's own host and the configured origins
+func checkOrigin(r *http.Request, origins []string) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(origins, "*") || slices.Contains(origins, origin) {
+		return nil
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return nil
+	}
+	return errors.New("origin not allowed")
+}
+
+// tuneBridge relays one WebSocket connection to one Tune stream
+type tuneBridge struct {
+	conn     *websocket.Conn
+	imageID  string
+	inbound  runtime.Marshaler
+	outbound runtime.Marshaler
+}
+
+func (t *tuneBridge) run(ctx context.Context, cancel context.CancelFunc, client pb.ImageProcessorClient, done <-chan struct{}) {
+	defer t.conn.Close()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	stream, err := client.Tune(ctx)
+	if err != nil {
+		t.closeWith(err)
+		return
+	}
+	sendErr := make(chan error, 1)
+	go func() {
+		if err := t.forward(stream); err != nil {
+			sendErr <- err
+			cancel()
+		}
+	}()
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			t.conn.WriteClose(wsCloseNormal)
+			return
+		}
+		if err != nil {
+			select {
+			case <-done:
+				t.conn.WriteClose(wsCloseGoingAway)
+				return
+			case serr := <-sendErr:
+				// the client side is the cause, not the cancellation it led to
+				err = serr
+			default:
+			}
+			t.closeWith(err)
+			return
+		}
+		if err := websocket.Message.Send(t.conn, resp.GetPreviewChunk()); err != nil {
+			// the client is gone
+			cancel()
+			return
+		}
+	}
+}
+
+// forward relays client frames to the stream until the client closes the
+// socket, which half-closes the stream so the server can finish. An error
+// means the stream has to be cancelled: the client sent a message that is
+// not a TuneRequest or went away without closing.
+func (t *tuneBridge) forward(stream pb.ImageProcessor_TuneClient) error {
+	for {
+		var frame []byte
+		if err := websocket.Message.Receive(t.conn, &frame); err != nil {
+			if err == io.EOF {
+				stream.CloseSend()
+				return nil
+			}
+			return status.Error(codes.Canceled, "client went away")
+		}
+		req := &pb.TuneRequest{}
+		if err := t.inbound.Unmarshal(frame, req); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid TuneRequest: %v", err)
+		}
+		if req.ImageId == "" {
+			req.ImageId = t.imageID
+		}
+		if err := stream.Send(req); err != nil {
+			// the stream is done; Recv reports why
+			return nil
+		}
+	}
+}
+
+// closeWith reports err to the client and closes the socket
+func (t *tuneBridge) closeWith(err error) {
+	st := status.Convert(err)
+	if st.Code() == codes.Canceled {
+		return
+	}
+	if data, merr := t.outbound.Marshal(st.Proto()); merr == nil {
+		if serr := websocket.Message.Send(t.conn, string(data)); serr != nil {
+			return
+		}
+	} else {
+		log.Printf("tune: marshal status: %v", merr)
+	}
+	code := wsCloseInternal
+	if st.Code() == codes.InvalidArgument || st.Code() == codes.Unauthenticated || st.Code() == codes.PermissionDenied {
+		code = wsClosePolicy
+	}
+	t.conn.WriteClose(code)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	pb "image-proc/proto"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeTune answers each TuneRequest with a preview of "<image>:<parameter>"
+// and ends the stream once the client half-closes it. With err set the
+// first request fails the stream with err instead.
+type fakeTune struct {
+	pb.ImageProcessorClient
+	err error
+
+	mu     sync.Mutex
+	md     metadata.MD
+	stream *tuneStream
+}
+
+func (f *fakeTune) Tune(ctx context.Context, _ ...grpc.CallOption) (grpc.BidiStreamingClient[pb.TuneRequest, pb.TuneResponse], error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	s := &tuneStream{
+		ctx:      ctx,
+		err:      f.err,
+		replies:  make(chan *pb.TuneResponse, 16),
+		failed:   make(chan error, 1),
+		sendDone: make(chan struct{}),
+	}
+	f.mu.Lock()
+	f.md, f.stream = md, s
+	f.mu.Unlock()
+	return s, nil
+}
+
+// opened returns the last stream and the metadata it was opened with,
+// waiting for the bridge to open one
+func (f *fakeTune) opened(t *testing.T) (*tuneStream, metadata.MD) {
+	t.Helper()
+	var s *tuneStream
+	var md metadata.MD
+	waitUntil(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		s, md = f.stream, f.md
+		return s != nil
+	})
+	return s, md
+}
+
+type tuneStream struct {
+	grpc.ClientStream
+	ctx      context.Context
+	err      error
+	replies  chan *pb.TuneResponse
+	failed   chan error
+	sendDone chan struct{}
+	once     sync.Once
+}
+
+func (s *tuneStream) Send(req *pb.TuneRequest) error {
+	if s.err != nil {
+		select {
+		case s.failed <- s.err:
+			return nil
+		default:
+			return io.EOF
+		}
+	}
+	s.replies <- &pb.TuneResponse{PreviewChunk: []byte(req.ImageId + ":" + req.Parameter)}
+	return nil
+}
+
+func (s *tuneStream) CloseSend() error {
+	s.once.Do(func() { close(s.sendDone) })
+	return nil
+}
+
+func (s *tuneStream) halfClosed() bool {
+	select {
+	case <-s.sendDone:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *tuneStream) Recv() (*pb.TuneResponse, error) {
+	select {
+	case r := <-s.replies:
+		return r, nil
+	case err := <-s.failed:
+		return nil, err
+	case <-s.sendDone:
+		// replies sent before the half-close still go out
+		select {
+		case r := <-s.replies:
+			return r, nil
+		default:
+			return nil, io.EOF
+		}
+	case <-s.ctx.Done():
+		return nil, status.FromContextError(s.ctx.Err()).Err()
+	}
+}
+
+func (s *tuneStream) Header() (metadata.MD, error) { return metadata.MD{}, nil }
+func (s *tuneStream) Trailer() metadata.MD         { return nil }
+func (s *tuneStream) Context() context.Context     { return s.ctx }
+
+// waitUntil polls done until it holds, failing the test after a few seconds
+func waitUntil(t *testing.T, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newTuneServer serves the Tune bridge the way main wires it, allowing
+// origins besides the server's own
+func newTuneServer(t *testing.T, client pb.ImageProcessorClient, origins []string, done <-chan struct{}) *httptest.Server {
+	t.Helper()
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithErrorHandler(problemErrorHandler),
+	)
+	if err := mux.HandlePath(http.MethodGet, tunePath, tuneHandler(mux, client, origins, done)); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dialTune opens the Tune socket for the test image, from origin if set
+// and otherwise from the server's own pages
+func dialTune(srv *httptest.Server, query, origin string, header http.Header) (*websocket.Conn, error) {
+	if origin == "" {
+		origin = srv.URL
+	}
+	cfg, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/images/"+testImageID+"/tune"+query, origin)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		cfg.Header[k] = v
+	}
+	return websocket.DialConfig(cfg)
+}
+
+func TestTuneRelay(t *testing.T) {
+	client := &fakeTune{}
+	srv := newTuneServer(t, client, nil, make(chan struct{}))
+	conn, err := dialTune(srv, "", "", http.Header{"Authorization": {"Bearer alice-token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the path supplies the image unless the message names one
+	for _, msg := range []string{`{"parameter":"brightness","value":0.2}`, `{"imageId":"other","parameter":"contrast"}`} {
+		if err := websocket.Message.Send(conn, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{testImageID + ":brightness", "other:contrast"} {
+		var frame []byte
+		if err := websocket.Message.Receive(conn, &frame); err != nil {
+			t.Fatal(err)
+		}
+		if string(frame) != want {
+			t.Errorf("preview frame %q, want %q", frame, want)
+		}
+	}
+
+	stream, md := client.opened(t)
+	if got := md.Get("authorization"); len(got) != 1 || got[0] != "Bearer alice-token" {
+		t.Errorf("authorization metadata %v, want the caller's token", got)
+	}
+	// closing the socket half-closes the stream, letting the server finish
+	conn.Close()
+	waitUntil(t, stream.halfClosed)
+}
+
+func TestTuneAccessToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		header http.Header
+		want   string
+	}{
+		{name: "query parameter", query: "?access_token=from-query", want: "Bearer from-query"},
+		{name: "header wins", query: "?access_token=from-query", header: http.Header{"Authorization": {"Bearer from-header"}}, want: "Bearer from-header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeTune{}
+			srv := newTuneServer(t, client, nil, make(chan struct{}))
+			conn, err := dialTune(srv, tt.query, "", tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, md := client.opened(t); len(md.Get("authorization")) != 1 || md.Get("authorization")[0] != tt.want {
+				t.Errorf("authorization metadata %v, want %q", md.Get("authorization"), tt.want)
+			}
+		})
+	}
+}
+
+func TestTuneErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *fakeTune
+		msg       string
+		wantCode  codes.Code
+		wantError string
+	}{
+		{name: "refused by the server", client: &fakeTune{err: status.Error(codes.PermissionDenied, "image belongs to another principal")}, msg: `{"parameter":"brightness"}`, wantCode: codes.PermissionDenied, wantError: "another principal"},
+		{name: "not a TuneRequest", client: &fakeTune{}, msg: `{"parameter":`, wantCode: codes.InvalidArgument, wantError: "invalid TuneRequest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTuneServer(t, tt.client, nil, make(chan struct{}))
+			conn, err := dialTune(srv, "", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if err := websocket.Message.Send(conn, tt.msg); err != nil {
+				t.Fatal(err)
+			}
+
+			// the status comes as a text frame, then the socket closes
+			var frame string
+			if err := websocket.Message.Receive(conn, &frame); err != nil {
+				t.Fatal(err)
+			}
+			var st struct {
+				Code    codes.Code `json:"code"`
+				Message string     `json:"message"`
+			}
+			if err := json.Unmarshal([]byte(frame), &st); err != nil || st.Code != tt.wantCode || !strings.Contains(st.Message, tt.wantError) {
+				t.Errorf("status frame %s, want %s mentioning %q", frame, tt.wantCode, tt.wantError)
+			}
+			if err := websocket.Message.Receive(conn, &frame); err != io.EOF {
+				t.Errorf("Receive after the status = %v, want the socket closed", err)
+			}
+			// and the stream is not left open
+			stream, _ := tt.client.opened(t)
+			waitUntil(t, func() bool { return stream.ctx.Err() != nil })
+		})
+	}
+}
+
+func TestTuneCancellation(t *testing.T) {
+	t.Run("gateway shutdown", func(t *testing.T) {
+		client := &fakeTune{}
+		done := make(chan struct{})
+		srv := newTuneServer(t, client, nil, done)
+		conn, err := dialTune(srv, "", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		stream, _ := client.opened(t)
+
+		close(done)
+		waitUntil(t, func() bool { return stream.ctx.Err() != nil })
+		var frame []byte
+		if err := websocket.Message.Receive(conn, &frame); err != io.EOF {
+			t.Errorf("Receive during shutdown = %v, want the socket closed", err)
+		}
+	})
+
+	t.Run("client hangs up", func(t *testing.T) {
+		client := &fakeTune{}
+		srv := newTuneServer(t, client, nil, make(chan struct{}))
+		cfg, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/images/"+testImageID+"/tune", srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := websocket.NewClient(cfg, raw); err != nil {
+			t.Fatal(err)
+		}
+		stream, _ := client.opened(t)
+
+		// dropped without a close frame
+		raw.Close()
+		waitUntil(t, func() bool { return stream.ctx.Err() != nil })
+	})
+}
+
+func TestTuneOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		wantOK  bool
+	}{
+		{name: "own host", wantOK: true},
+		{name: "allowed", origins: []string{"https://editor.example"}, origin: "https://editor.example", wantOK: true},
+		{name: "any", origins: []string{"*"}, origin: "https://elsewhere.example", wantOK: true},
+		{name: "not allowed", origins: []string{"https://editor.example"}, origin: "https://evil.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeTune{}
+			srv := newTuneServer(t, client, tt.origins, make(chan struct{}))
+			conn, err := dialTune(srv, "", tt.origin, nil)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("dial = %v, want success %v", err, tt.wantOK)
+			}
+			if err == nil {
+				conn.Close()
+				return
+			}
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			if client.stream != nil {
+				t.Error("opened a Tune stream for a refused origin")
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "image-proc/proto"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uploadPath replaces the generated Upload route, which can only feed the
+// client stream a single JSON message
+const uploadPath = "/v1/images:upload"
+
+// uploadFormField is the multipart field the file is expected in; a part
+// with a file name is accepted under any field name
+const uploadFormField = "file"
+
+// uploadHandler streams a request body into the Upload RPC chunk by chunk
+// and answers with the JSON UploadResponse. The body is either the raw
+// image (application/octet-stream or any image/* type) or a
+// multipart/form-data form whose first file part is the image. Signed
+// upload URLs stand in for credentials.
+func uploadHandler(mux *runtime.ServeMux, client pb.ImageProcessorClient, chunkSize int, links signedLinks) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		fail := func(ctx context.Context, err error) {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		ctx, err := runtime.AnnotateContext(ctx, mux, r, pb.ImageProcessor_Upload_FullMethodName, runtime.WithHTTPPathPattern(uploadPath))
+		if err != nil {
+			fail(r.Context(), err)
+			return
+		}
+		if ctx, r, err = links.check(ctx, r, pb.ImageProcessor_Upload_FullMethodName, ""); err != nil {
+			fail(ctx, err)
+			return
+		}
+		// a signed URL may allow less than the gateway does
+		if g, ok := grantFromRequest(r); ok && g.MaxBytes > 0 {
+			if r.ContentLength > g.MaxBytes {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, codes.ResourceExhausted,
+					fmt.Sprintf("upload of %d bytes exceeds the %d bytes the URL allows", r.ContentLength, g.MaxBytes))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, g.MaxBytes)
+		}
+
+		body, err := uploadBody(r)
+		if err != nil {
+			fail(ctx, err)
+			return
+		}
+
+		var md runtime.ServerMetadata
+		resp, err := streamUpload(ctx, client, body, chunkSize, &md)
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			// cancel the RPC first so the server drops the partial file
+			cancel()
+			fail(ctx, err)
+			return
+		}
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, resp)
+	}
+}
+
+// uploadBody returns the reader holding the image in r
+func uploadBody(r *http.Request) (io.Reader, error) {
+	var mediaType string
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(ct); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid Content-Type: %v", err)
+		}
+	}
+	switch {
+	case mediaType == "multipart/form-data":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid multipart body: %v", err)
+		}
+		return filePart(mr)
+	case mediaType == "", mediaType == "application/octet-stream", strings.HasPrefix(mediaType, "image/"):
+		return r.Body, nil
+	}
+	return nil, &runtime.HTTPStatusError{
+		HTTPStatus: http.StatusUnsupportedMediaType,
+		Err:        status.Errorf(codes.InvalidArgument, "unsupported Content-Type %q; send multipart/form-data or application/octet-stream", mediaType),
+	}
+}
+
+// filePart skips form fields up to the file to upload. Parts are read in
+// order straight off the body, so nothing before the file is buffered
+// beyond the part itself.
+func filePart(mr *multipart.Reader) (io.Reader, error) {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, status.Errorf(codes.InvalidArgument, "multipart body has no %q file part", uploadFormField)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid multipart body: %v", err)
+		}
+		if part.FileName() != "" || part.FormName() == uploadFormField {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// streamUpload sends body to the Upload RPC in chunks of chunkSize,
+// recording the server's metadata in md
+func streamUpload(ctx context.Context, client pb.ImageProcessorClient, body io.Reader, chunkSize int, md *runtime.ServerMetadata) (*pb.UploadResponse, error) {
+	stream, err := client.Upload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, rerr := io.ReadFull(body, buf)
+		if n > 0 {
+			if err := stream.Send(&pb.UploadRequest{Chunk: buf[:n]}); err != nil {
+				if err == io.EOF {
+					// the server ended the stream; its status says why
+					_, err = stream.CloseAndRecv()
+				}
+				return nil, err
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(rerr, &tooLarge) {
+				return nil, &runtime.HTTPStatusError{
+					HTTPStatus: http.StatusRequestEntityTooLarge,
+					Err:        status.Errorf(codes.ResourceExhausted, "upload exceeds %d bytes", tooLarge.Limit),
+				}
+			}
+			return nil, status.Errorf(codes.InvalidArgument, "read upload body: %v", rerr)
+		}
+	}
+	// headers only arrive with the response, once the upload is complete
+	resp, err := stream.CloseAndRecv()
+	if header, herr := stream.Header(); herr == nil {
+		md.HeaderMD = header
+	}
+	md.TrailerMD = stream.Trailer()
+	return resp, err
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	pb "image-proc/proto"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeUploads accepts uploads, recording the chunks it was sent. With err
+// set it fails the upload, after refusing chunks past failAfter if that
+// is set.
+type fakeUploads struct {
+	pb.ImageProcessorClient
+	err       error
+	failAfter int
+
+	mu     sync.Mutex
+	chunks [][]byte
+}
+
+func (f *fakeUploads) Upload(ctx context.Context, _ ...grpc.CallOption) (grpc.ClientStreamingClient[pb.UploadRequest, pb.UploadResponse], error) {
+	return &uploadStream{f: f}, nil
+}
+
+func (f *fakeUploads) received() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.chunks
+}
+
+type uploadStream struct {
+	grpc.ClientStream
+	f *fakeUploads
+}
+
+func (s *uploadStream) Send(req *pb.UploadRequest) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if s.f.err != nil && s.f.failAfter > 0 && len(s.f.chunks) >= s.f.failAfter {
+		return io.EOF
+	}
+	s.f.chunks = append(s.f.chunks, bytes.Clone(req.Chunk))
+	return nil
+}
+
+func (s *uploadStream) CloseAndRecv() (*pb.UploadResponse, error) {
+	if s.f.err != nil {
+		return nil, s.f.err
+	}
+	return &pb.UploadResponse{ImageId: testImageID}, nil
+}
+
+func (s *uploadStream) Header() (metadata.MD, error) { return metadata.MD{}, nil }
+func (s *uploadStream) Trailer() metadata.MD         { return metadata.MD{} }
+
+// newUploadServer serves the upload route the way main wires it
+func newUploadServer(t *testing.T, client pb.ImageProcessorClient, chunkSize int) http.Handler {
+	t.Helper()
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithErrorHandler(problemErrorHandler),
+	)
+	if err := mux.HandlePath(http.MethodPost, uploadPath, uploadHandler(mux, client, chunkSize, signedLinks{})); err != nil {
+		t.Fatal(err)
+	}
+	return mux
+}
+
+// multipartBody returns a form holding fields, then the image under
+// fileField unless that is empty
+func multipartBody(t *testing.T, fields map[string]string, fileField string, image []byte) (string, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fileField != "" {
+		fw, err := mw.CreateFormFile(fileField, "cat.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(image)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), &buf
+}
+
+func TestUploadChunks(t *testing.T) {
+	image := bytes.Repeat([]byte("0123456789"), 25) // 250 bytes
+	formType, form := multipartBody(t, map[string]string{"title": "a cat"}, "upload", image)
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		chunkSize   int
+		wantChunks  []int
+	}{
+		{name: "raw", contentType: "application/octet-stream", body: image, chunkSize: 100, wantChunks: []int{100, 100, 50}},
+		{name: "image type", contentType: "image/png", body: image, chunkSize: 125, wantChunks: []int{125, 125}},
+		{name: "no type", body: image, chunkSize: 1000, wantChunks: []int{250}},
+		{name: "multipart", contentType: formType, body: form.Bytes(), chunkSize: 100, wantChunks: []int{100, 100, 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeUploads{}
+			h := newUploadServer(t, client, tt.chunkSize)
+			req := httptest.NewRequest(http.MethodPost, uploadPath, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				ImageID string `json:"imageId"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.ImageID != testImageID {
+				t.Errorf("response %s, want the image ID", rec.Body)
+			}
+
+			chunks := client.received()
+			var sizes []int
+			for _, c := range chunks {
+				sizes = append(sizes, len(c))
+			}
+			if len(sizes) != len(tt.wantChunks) {
+				t.Fatalf("chunk sizes %v, want %v", sizes, tt.wantChunks)
+			}
+			for i := range sizes {
+				if sizes[i] != tt.wantChunks[i] {
+					t.Fatalf("chunk sizes %v, want %v", sizes, tt.wantChunks)
+				}
+			}
+			if got := bytes.Join(chunks, nil); !bytes.Equal(got, image) {
+				t.Errorf("server received %d bytes that differ from the image", len(got))
+			}
+		})
+	}
+}
+
+func TestUploadErrors(t *testing.T) {
+	image := bytes.Repeat([]byte("x"), 300)
+	noFileType, noFile := multipartBody(t, map[string]string{"title": "a cat"}, "", nil)
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		client      *fakeUploads
+		wantStatus  int
+		wantCode    codes.Code
+		wantSent    bool // whether anything reached the server
+	}{
+		{name: "no file part", contentType: noFileType, body: noFile.Bytes(), client: &fakeUploads{}, wantStatus: http.StatusBadRequest, wantCode: codes.InvalidArgument},
+		{name: "broken multipart", contentType: "multipart/form-data; boundary=x", body: []byte("garbage"), client: &fakeUploads{}, wantStatus: http.StatusBadRequest, wantCode: codes.InvalidArgument},
+		{name: "unsupported type", contentType: "application/json", body: []byte(`{}`), client: &fakeUploads{}, wantStatus: http.StatusUnsupportedMediaType, wantCode: codes.InvalidArgument},
+		{name: "invalid type", contentType: "image/", body: image, client: &fakeUploads{}, wantStatus: http.StatusBadRequest, wantCode: codes.InvalidArgument},
+
+		// what the server refuses is mapped to its HTTP status
+		{name: "refused at the end", body: image, client: &fakeUploads{err: status.Error(codes.ResourceExhausted, "image width 9000 exceeds limit of 8000")}, wantStatus: http.StatusTooManyRequests, wantCode: codes.ResourceExhausted, wantSent: true},
+		{name: "refused midway", body: image, client: &fakeUploads{err: status.Error(codes.InvalidArgument, "upload is not a supported image format"), failAfter: 1}, wantStatus: http.StatusBadRequest, wantCode: codes.InvalidArgument, wantSent: true},
+		{name: "unauthenticated", body: image, client: &fakeUploads{err: status.Error(codes.Unauthenticated, "missing bearer token"), failAfter: 1}, wantStatus: http.StatusUnauthorized, wantCode: codes.Unauthenticated, wantSent: true},
+		{name: "unavailable", body: image, client: &fakeUploads{err: status.Error(codes.Unavailable, "server is shutting down")}, wantStatus: http.StatusServiceUnavailable, wantCode: codes.Unavailable, wantSent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newUploadServer(t, tt.client, 100)
+			req := httptest.NewRequest(http.MethodPost, uploadPath, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if p := readProblem(t, rec); p.Code != tt.wantCode.String() {
+				t.Errorf("problem code %s, want %s", p.Code, tt.wantCode)
+			}
+			if sent := len(tt.client.received()) > 0; sent != tt.wantSent {
+				t.Errorf("sent chunks = %v, want %v", sent, tt.wantSent)
+			}
+			if tt.client.failAfter > 0 && len(tt.client.received()) != tt.client.failAfter {
+				t.Errorf("kept sending %d chunks after the server gave up", len(tt.client.received())-tt.client.failAfter)
+			}
+		})
+	}
+}
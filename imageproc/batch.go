@@ -0,0 +1,72 @@
+package imageproc
+
+import (
+	"context"
+	pb "image-proc/proto"
+	"io"
+)
+
+// BatchEvent is one event from ProcessBatch. Exactly one of Progress,
+// Result, Summary and Err is set.
+type BatchEvent struct {
+	BatchID string
+	ImageID string
+
+	Progress *Progress
+	Result   *pb.BatchItemResult // final outcome of one image
+	Summary  *pb.BatchSummary    // last event of a complete batch
+
+	// Err is set on the last value sent when the stream failed; the
+	// channel is closed right after it.
+	Err error
+}
+
+// ProcessBatch applies filters to every image in one call. Progress and
+// results for different images arrive interleaved, followed by a summary
+// listing the images that failed. Like Process it is not retried.
+func (c *Client) ProcessBatch(ctx context.Context, imageIDs []string, filters []string, opts ...ProcessOption) (<-chan BatchEvent, error) {
+	o := newProcessOptions(opts)
+	stream, err := c.rpc.ProcessBatch(ctx, &pb.ProcessBatchRequest{ImageIds: imageIDs, Filters: filters, Priority: o.priority})
+	if err != nil {
+		return nil, wrapError("ProcessBatch", err)
+	}
+	ch := make(chan BatchEvent, progressBuffer)
+	go func() {
+		defer close(ch)
+		for {
+			ev, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			var out BatchEvent
+			if err != nil {
+				out.Err = wrapError("ProcessBatch", err)
+			} else {
+				out = batchEventFrom(ev)
+			}
+			select {
+			case ch <- out:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func batchEventFrom(ev *pb.BatchEvent) BatchEvent {
+	out := BatchEvent{BatchID: ev.GetBatchId(), ImageID: ev.GetImageId()}
+	switch e := ev.GetEvent().(type) {
+	case *pb.BatchEvent_Progress:
+		p := progressFrom(e.Progress)
+		out.Progress = &p
+	case *pb.BatchEvent_Result:
+		out.Result = e.Result
+	case *pb.BatchEvent_Summary:
+		out.Summary = e.Summary
+	}
+	return out
+}
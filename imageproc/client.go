@@ -0,0 +1,289 @@
+// Package imageproc is the Go client for the ImageProcessor service.
+//
+// A Client wraps a gRPC connection and exposes the service as plain Go
+// calls that return *Error values instead of exiting. Idempotent calls are
+// retried with exponential backoff; see RetryPolicy.
+//
+//	c, err := imageproc.Dial(ctx, "localhost:50051", imageproc.WithToken(tok))
+//	id, err := c.Upload(ctx, f, nil)
+//	updates, err := c.Process(ctx, id, []string{"blur"})
+//	for p := range updates { ... }
+package imageproc
+
+import (
+	"context"
+	"fmt"
+	pb "image-proc/proto"
+	"io"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ChunkSize is the default size of the chunks Upload sends.
+const ChunkSize = 64 * 1024
+
+// Client talks to one ImageProcessor server. It is safe for concurrent use.
+type Client struct {
+	conn *grpc.ClientConn // nil when built with New
+	rpc  pb.ImageProcessorClient
+	opts options
+}
+
+// Dial connects to addr and waits until the connection is ready or ctx
+// ends, so a bad address fails here rather than on the first call.
+func Dial(ctx context.Context, addr string, opts ...Option) (*Client, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dialOpts := append(o.dialOptions(), grpc.WithBlock())
+	conn, err := grpc.DialContext(ctx, addr, dialOpts...)
+	if err != nil {
+		return nil, wrapError("Dial", fmt.Errorf("connect to %s: %w", addr, err))
+	}
+	return &Client{conn: conn, rpc: pb.NewImageProcessorClient(conn), opts: o}, nil
+}
+
+// New wraps an existing connection. Connection options such as WithTLS
+// are ignored; the caller configured conn already.
+func New(conn grpc.ClientConnInterface, opts ...Option) *Client {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Client{rpc: pb.NewImageProcessorClient(conn), opts: o}
+}
+
+// Close closes the connection opened by Dial.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// RPC returns the generated stub for calls the Client does not wrap.
+func (c *Client) RPC() pb.ImageProcessorClient {
+	return c.rpc
+}
+
+// Version returns the server version.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var version string
+	err := c.opts.retry.do(ctx, "Version", func(ctx context.Context) error {
+		resp, err := c.rpc.GetVersion(ctx, &emptypb.Empty{})
+		if err != nil {
+			return err
+		}
+		version = resp.GetVersion()
+		return nil
+	})
+	return version, err
+}
+
+// UploadOptions tunes a single upload. A nil *UploadOptions uses defaults.
+type UploadOptions struct {
+	// ChunkSize overrides the client's chunk size for this upload.
+	ChunkSize int
+	// OnProgress, if set, is called with the bytes sent so far after
+	// every chunk.
+	OnProgress func(sent int64)
+}
+
+// Upload streams r to the server and returns the new image ID. Uploads
+// are not retried since r cannot be rewound.
+func (c *Client) Upload(ctx context.Context, r io.Reader, opts *UploadOptions) (string, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	size := opts.ChunkSize
+	if size <= 0 {
+		size = c.opts.chunkSize
+	}
+
+	stream, err := c.rpc.Upload(ctx)
+	if err != nil {
+		return "", wrapError("Upload", err)
+	}
+
+	buf := make([]byte, size)
+	var sent int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.UploadRequest{Chunk: buf[:n]}); err != nil {
+				// the server ended the stream; its status explains why
+				if err == io.EOF {
+					break
+				}
+				return "", wrapError("Upload", err)
+			}
+			sent += int64(n)
+			if opts.OnProgress != nil {
+				opts.OnProgress(sent)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stream.CloseSend()
+			return "", wrapError("Upload", fmt.Errorf("read: %w", err))
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", wrapError("Upload", err)
+	}
+	return resp.GetImageId(), nil
+}
+
+// UploadFile uploads the file at path.
+func (c *Client) UploadFile(ctx context.Context, path string, opts *UploadOptions) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", wrapError("Upload", err)
+	}
+	defer f.Close()
+	return c.Upload(ctx, f, opts)
+}
+
+// Download writes the stored image to w and returns the bytes written.
+// Connection failures before the first byte arrives are retried.
+func (c *Client) Download(ctx context.Context, imageID string, w io.Writer) (int64, error) {
+	var total int64
+	err := c.opts.retry.do(ctx, "Download", func(ctx context.Context) error {
+		stream, err := c.rpc.Download(ctx, &pb.DownloadRequest{ImageId: imageID})
+		if err != nil {
+			return err
+		}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				if total > 0 {
+					return permanentError{err}
+				}
+				return err
+			}
+			n, err := w.Write(chunk.GetChunk())
+			total += int64(n)
+			if err != nil {
+				return permanentError{fmt.Errorf("write: %w", err)}
+			}
+		}
+	})
+	return total, err
+}
+
+// ListImages returns the caller's stored images. owner may be left
+// empty; set, it must be the caller's own principal.
+func (c *Client) ListImages(ctx context.Context, owner string) ([]*pb.ImageInfo, error) {
+	var images []*pb.ImageInfo
+	err := c.opts.retry.do(ctx, "ListImages", func(ctx context.Context) error {
+		resp, err := c.rpc.ListImages(ctx, &pb.ListImagesRequest{Owner: owner})
+		if err != nil {
+			return err
+		}
+		images = resp.GetImages()
+		return nil
+	})
+	return images, err
+}
+
+// GetImage returns the metadata of one image.
+func (c *Client) GetImage(ctx context.Context, imageID string) (*pb.ImageInfo, error) {
+	var info *pb.ImageInfo
+	err := c.opts.retry.do(ctx, "GetImage", func(ctx context.Context) error {
+		var err error
+		info, err = c.rpc.GetImage(ctx, &pb.GetImageRequest{ImageId: imageID})
+		return err
+	})
+	return info, err
+}
+
+// DeleteImage removes an image. It is not retried: a retry after a lost
+// response would report NotFound for an image that was deleted.
+func (c *Client) DeleteImage(ctx context.Context, imageID string) error {
+	_, err := c.rpc.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: imageID})
+	return wrapError("DeleteImage", err)
+}
+
+// GetJob returns the current or final state of a job.
+func (c *Client) GetJob(ctx context.Context, jobID string) (*pb.Job, error) {
+	var job *pb.Job
+	err := c.opts.retry.do(ctx, "GetJob", func(ctx context.Context) error {
+		var err error
+		job, err = c.rpc.GetJob(ctx, &pb.GetJobRequest{JobId: jobID})
+		return err
+	})
+	return job, err
+}
+
+// ListJobs returns one page of jobs, newest first. Pass the returned
+// token to fetch the next page; it is empty after the last one.
+func (c *Client) ListJobs(ctx context.Context, req *pb.ListJobsRequest) ([]*pb.Job, string, error) {
+	var resp *pb.ListJobsResponse
+	err := c.opts.retry.do(ctx, "ListJobs", func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.ListJobs(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.GetJobs(), resp.GetNextPageToken(), nil
+}
+
+// ListWebhookDeliveries returns every attempt to deliver a job's
+// callback, oldest first.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, jobID string) ([]*pb.WebhookDelivery, error) {
+	var resp *pb.ListWebhookDeliveriesResponse
+	err := c.opts.retry.do(ctx, "ListWebhookDeliveries", func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.ListWebhookDeliveries(ctx, &pb.ListWebhookDeliveriesRequest{JobId: jobID})
+		return err
+	})
+	return resp.GetDeliveries(), err
+}
+
+// ListDeadLetters returns one page of jobs that failed for good, most
+// recent failure first. Paging works as in ListJobs.
+func (c *Client) ListDeadLetters(ctx context.Context, req *pb.ListDeadLettersRequest) ([]*pb.DeadLetter, string, error) {
+	var resp *pb.ListDeadLettersResponse
+	err := c.opts.retry.do(ctx, "ListDeadLetters", func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.ListDeadLetters(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.GetDeadLetters(), resp.GetNextPageToken(), nil
+}
+
+// RedriveJob runs a dead-lettered job again and returns its new state;
+// follow it with WatchJob. It is not retried: a retry after a lost
+// response would report that the job is no longer dead-lettered.
+func (c *Client) RedriveJob(ctx context.Context, jobID string) (*pb.Job, error) {
+	job, err := c.rpc.RedriveJob(ctx, &pb.RedriveJobRequest{JobId: jobID})
+	return job, wrapError("RedriveJob", err)
+}
+
+// SignURL issues a time-limited URL through which a holder without
+// credentials may download one image, or upload one, through the gateway
+// on the caller's behalf.
+func (c *Client) SignURL(ctx context.Context, req *pb.SignURLRequest) (*pb.SignURLResponse, error) {
+	var resp *pb.SignURLResponse
+	err := c.opts.retry.do(ctx, "SignURL", func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.SignURL(ctx, req)
+		return err
+	})
+	return resp, err
+}
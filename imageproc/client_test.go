@@ -0,0 +1,318 @@
+package imageproc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	pb "image-proc/proto"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// fastRetries retries quickly enough for tests
+var fastRetries = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+
+// fakeServer fails each call with the next of errs while any are left.
+// Download sends chunks, failing with breakErr after the first of them
+// if that is set.
+type fakeServer struct {
+	pb.UnimplementedImageProcessorServer
+	chunks   [][]byte
+	breakErr error
+
+	mu    sync.Mutex
+	errs  []error
+	calls int
+	md    metadata.MD
+}
+
+func (f *fakeServer) next(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.md, _ = metadata.FromIncomingContext(ctx)
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakeServer) attempts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *fakeServer) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.Job, error) {
+	if err := f.next(ctx); err != nil {
+		return nil, err
+	}
+	return &pb.Job{JobId: req.JobId}, nil
+}
+
+func (f *fakeServer) DeleteImage(ctx context.Context, req *pb.DeleteImageRequest) (*emptypb.Empty, error) {
+	if err := f.next(ctx); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeServer) Download(req *pb.DownloadRequest, stream pb.ImageProcessor_DownloadServer) error {
+	if err := f.next(stream.Context()); err != nil {
+		return err
+	}
+	for i, chunk := range f.chunks {
+		if err := stream.Send(&pb.DownloadChunk{Chunk: chunk}); err != nil {
+			return err
+		}
+		if i == 0 && f.breakErr != nil {
+			return f.breakErr
+		}
+	}
+	return nil
+}
+
+// listen serves f in memory and returns a dialer for it
+func listen(t *testing.T, f *fakeServer) grpc.DialOption {
+	t.Helper()
+	gs := grpc.NewServer()
+	pb.RegisterImageProcessorServer(gs, f)
+	lis := bufconn.Listen(1 << 20)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) })
+}
+
+// newTestClient returns a Client of f retrying with fastRetries
+func newTestClient(t *testing.T, f *fakeServer) *Client {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///bufnet", listen(t, f), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return New(conn, WithRetryPolicy(fastRetries))
+}
+
+func TestErrorMapping(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+		want error
+	}{
+		{err: status.Error(codes.NotFound, "image not found"), code: codes.NotFound, want: ErrNotFound},
+		{err: status.Error(codes.InvalidArgument, "bad filter"), code: codes.InvalidArgument, want: ErrInvalidArgument},
+		{err: status.Error(codes.FailedPrecondition, "not dead-lettered"), code: codes.FailedPrecondition, want: ErrInvalidArgument},
+		{err: status.Error(codes.OutOfRange, "cursor expired"), code: codes.OutOfRange, want: ErrInvalidArgument},
+		{err: status.Error(codes.Unauthenticated, "missing token"), code: codes.Unauthenticated, want: ErrUnauthenticated},
+		{err: status.Error(codes.PermissionDenied, "not yours"), code: codes.PermissionDenied, want: ErrPermissionDenied},
+		{err: status.Error(codes.ResourceExhausted, "too large"), code: codes.ResourceExhausted, want: ErrResourceExhausted},
+		{err: status.Error(codes.Unavailable, "restarting"), code: codes.Unavailable, want: ErrUnavailable},
+		{err: status.Error(codes.DeadlineExceeded, "too slow"), code: codes.DeadlineExceeded, want: ErrUnavailable},
+		{err: status.Error(codes.Canceled, "gone"), code: codes.Canceled, want: ErrCanceled},
+		{err: context.Canceled, code: codes.Canceled, want: ErrCanceled},
+		{err: context.DeadlineExceeded, code: codes.DeadlineExceeded, want: ErrUnavailable},
+		{err: status.Error(codes.Internal, "boom"), code: codes.Internal},
+		{err: errors.New("disk full"), code: codes.Unknown},
+	}
+	sentinels := []error{ErrNotFound, ErrInvalidArgument, ErrUnauthenticated, ErrPermissionDenied, ErrResourceExhausted, ErrUnavailable, ErrCanceled}
+	for _, tt := range tests {
+		err := wrapError("GetJob", tt.err)
+		var e *Error
+		if !errors.As(err, &e) || e.Op != "GetJob" || e.Code != tt.code {
+			t.Errorf("wrapError(%v) = %#v, want an *Error for GetJob with %s", tt.err, err, tt.code)
+			continue
+		}
+		for _, s := range sentinels {
+			if got := errors.Is(err, s); got != (s == tt.want) {
+				t.Errorf("errors.Is(wrapError(%v), %v) = %v", tt.err, s, got)
+			}
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("wrapError(%v) hides the underlying error", tt.err)
+		}
+		if got := status.Code(err); got != tt.code {
+			t.Errorf("status.Code(wrapError(%v)) = %s, want %s", tt.err, got, tt.code)
+		}
+	}
+
+	if wrapError("GetJob", nil) != nil {
+		t.Error("wrapError(nil) is not nil")
+	}
+	inner := wrapError("Download", status.Error(codes.NotFound, "x"))
+	if again := wrapError("GetJob", inner); again != inner {
+		t.Errorf("wrapping an *Error again = %v, want it unchanged", again)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: status.Error(codes.Unavailable, "restarting"), want: true},
+		{err: status.Error(codes.Aborted, "conflict"), want: true},
+		{err: status.Error(codes.DeadlineExceeded, "too slow")},
+		{err: status.Error(codes.NotFound, "gone")},
+		{err: status.Error(codes.Internal, "boom")},
+		{err: permanentError{status.Error(codes.Unavailable, "broke midway")}},
+		{err: errors.New("local")},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 500 * time.Millisecond, Multiplier: 2}
+	for n, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  500 * time.Millisecond,
+		20: 500 * time.Millisecond,
+	} {
+		if got := p.backoff(n); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+
+	p.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(2); got < 160*time.Millisecond || got > 240*time.Millisecond {
+			t.Fatalf("backoff(2) with 20%% jitter = %s, want within 160ms-240ms", got)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "restarting")
+	tests := []struct {
+		name         string
+		errs         []error
+		call         func(ctx context.Context, c *Client) error
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "recovers",
+			errs:         []error{unavailable, unavailable},
+			call:         func(ctx context.Context, c *Client) error { _, err := c.GetJob(ctx, "j1"); return err },
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up",
+			errs:         []error{unavailable, unavailable, unavailable, unavailable},
+			call:         func(ctx context.Context, c *Client) error { _, err := c.GetJob(ctx, "j1"); return err },
+			wantAttempts: 3,
+			wantErr:      ErrUnavailable,
+		},
+		{
+			name:         "permanent failure",
+			errs:         []error{status.Error(codes.NotFound, "no such job")},
+			call:         func(ctx context.Context, c *Client) error { _, err := c.GetJob(ctx, "j1"); return err },
+			wantAttempts: 1,
+			wantErr:      ErrNotFound,
+		},
+		{
+			name:         "not idempotent",
+			errs:         []error{unavailable},
+			call:         func(ctx context.Context, c *Client) error { return c.DeleteImage(ctx, "img") },
+			wantAttempts: 1,
+			wantErr:      ErrUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeServer{errs: tt.errs}
+			err := tt.call(context.Background(), newTestClient(t, f))
+			if tt.wantErr == nil && err != nil || !errors.Is(err, tt.wantErr) {
+				t.Errorf("call = %v, want %v", err, tt.wantErr)
+			}
+			if got := f.attempts(); got != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	f := &fakeServer{errs: []error{status.Error(codes.Unavailable, "restarting")}}
+	conn, err := grpc.NewClient("passthrough:///bufnet", listen(t, f), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := New(conn, WithRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.GetJob(ctx, "j1")
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("still waiting to retry after the context ended")
+	}
+	// the failure that was being retried is reported, not the context's
+	if !errors.Is(err, ErrUnavailable) || f.attempts() != 1 {
+		t.Errorf("GetJob = %v after %d attempts, want the first Unavailable", err, f.attempts())
+	}
+}
+
+func TestDownloadRetries(t *testing.T) {
+	chunks := [][]byte{[]byte("hello "), []byte("world")}
+	t.Run("before the first chunk", func(t *testing.T) {
+		f := &fakeServer{chunks: chunks, errs: []error{status.Error(codes.Unavailable, "restarting")}}
+		var buf bytes.Buffer
+		n, err := newTestClient(t, f).Download(context.Background(), "img", &buf)
+		if err != nil || n != 11 || buf.String() != "hello world" {
+			t.Errorf("Download = %d, %v, %q; want the whole image", n, err, buf.String())
+		}
+		if f.attempts() != 2 {
+			t.Errorf("%d attempts, want 2", f.attempts())
+		}
+	})
+	t.Run("after the first chunk", func(t *testing.T) {
+		f := &fakeServer{chunks: chunks, breakErr: status.Error(codes.Unavailable, "connection reset")}
+		var buf bytes.Buffer
+		n, err := newTestClient(t, f).Download(context.Background(), "img", &buf)
+		if !errors.Is(err, ErrUnavailable) || n != 6 || buf.String() != "hello " {
+			t.Errorf("Download = %d, %v, %q; want the failure after what was written", n, err, buf.String())
+		}
+		if f.attempts() != 1 {
+			t.Errorf("%d attempts, want no retry once data was written", f.attempts())
+		}
+	})
+}
+
+func TestDialSendsToken(t *testing.T) {
+	f := &fakeServer{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, "bufnet", WithToken("alice-token"), WithDialOptions(listen(t, f)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.GetJob(ctx, "j1"); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got := f.md.Get("authorization"); len(got) != 1 || got[0] != "Bearer alice-token" {
+		t.Errorf("authorization metadata %v, want the token", got)
+	}
+}
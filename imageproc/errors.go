@@ -0,0 +1,91 @@
+package imageproc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Sentinel errors for the failure classes callers usually branch on. Every
+// error returned by a Client method is an *Error that matches one of these
+// with errors.Is when its status code belongs to the class.
+var (
+	ErrNotFound          = errors.New("imageproc: not found")
+	ErrInvalidArgument   = errors.New("imageproc: invalid argument")
+	ErrUnauthenticated   = errors.New("imageproc: unauthenticated")
+	ErrPermissionDenied  = errors.New("imageproc: permission denied")
+	ErrResourceExhausted = errors.New("imageproc: resource exhausted")
+	ErrUnavailable       = errors.New("imageproc: service unavailable")
+	ErrCanceled          = errors.New("imageproc: canceled")
+)
+
+// sentinels maps status codes onto the sentinel they match
+var sentinels = map[codes.Code]error{
+	codes.NotFound:           ErrNotFound,
+	codes.InvalidArgument:    ErrInvalidArgument,
+	codes.FailedPrecondition: ErrInvalidArgument,
+	codes.OutOfRange:         ErrInvalidArgument,
+	codes.Unauthenticated:    ErrUnauthenticated,
+	codes.PermissionDenied:   ErrPermissionDenied,
+	codes.ResourceExhausted:  ErrResourceExhausted,
+	codes.Unavailable:        ErrUnavailable,
+	codes.DeadlineExceeded:   ErrUnavailable,
+	codes.Canceled:           ErrCanceled,
+}
+
+// Error is returned by every Client method. It carries the operation that
+// failed and the gRPC status code, and still converts back to a status
+// with status.FromError.
+type Error struct {
+	Op      string     // Client method, e.g. "Upload"
+	Code    codes.Code // gRPC status code; codes.Unknown for local failures
+	Message string     // server- or client-side description
+	Err     error      // underlying error, if any
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("imageproc: %s: %s: %s", e.Op, e.Code, e.Message)
+}
+
+// Unwrap exposes the underlying error to errors.Is and errors.As.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel for e's status code.
+func (e *Error) Is(target error) bool {
+	return target != nil && sentinels[e.Code] == target
+}
+
+// GRPCStatus lets status.FromError and status.Code see through the wrapper.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Message)
+}
+
+// wrapError converts err into an *Error for op. Errors that already are an
+// *Error are returned unchanged.
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if st, ok := status.FromError(err); ok {
+		return &Error{Op: op, Code: st.Code(), Message: st.Message(), Err: err}
+	}
+	// context errors surface as statuses from gRPC, but not from our own
+	// waits between retries
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return &Error{Op: op, Code: code, Message: err.Error(), Err: err}
+}
@@ -0,0 +1,101 @@
+package imageproc
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// options collects everything an Option can change.
+type options struct {
+	tls       *tls.Config
+	token     string
+	keepalive *keepalive.ClientParameters
+	retry     RetryPolicy
+	chunkSize int
+	dialOpts  []grpc.DialOption
+}
+
+func defaultOptions() options {
+	return options{retry: DefaultRetryPolicy, chunkSize: ChunkSize}
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithTLS connects over TLS using cfg. Without it the connection is
+// plaintext, which is what the server speaks today.
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) { o.tls = cfg }
+}
+
+// WithToken sends token as a bearer token with every call.
+func WithToken(token string) Option {
+	return func(o *options) { o.token = token }
+}
+
+// WithKeepalive pings the server after time without activity and closes
+// the connection if no reply arrives within timeout. The server rejects
+// pings more often than every five minutes by default.
+func WithKeepalive(time, timeout time.Duration) Option {
+	return func(o *options) {
+		o.keepalive = &keepalive.ClientParameters{Time: time, Timeout: timeout, PermitWithoutStream: true}
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy for idempotent calls.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) { o.retry = p }
+}
+
+// WithChunkSize sets the size of the chunks Upload sends.
+func WithChunkSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.chunkSize = n
+		}
+	}
+}
+
+// WithDialOptions appends raw gRPC dial options, e.g. interceptors.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOpts = append(o.dialOpts, opts...) }
+}
+
+// dialOptions translates o into gRPC dial options.
+func (o *options) dialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if o.tls != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(o.tls)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if o.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken{token: o.token, secure: o.tls != nil}))
+	}
+	if o.keepalive != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(*o.keepalive))
+	}
+	return append(opts, o.dialOpts...)
+}
+
+// bearerToken attaches an authorization header to every RPC.
+type bearerToken struct {
+	token  string
+	secure bool
+}
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity refuses to downgrade a TLS client; plaintext
+// clients may still send tokens since the server has no TLS yet.
+func (t bearerToken) RequireTransportSecurity() bool {
+	return t.secure
+}
@@ -0,0 +1,173 @@
+package imageproc
+
+import (
+	"context"
+	pb "image-proc/proto"
+	"io"
+)
+
+// Progress is one update from a processing job.
+type Progress struct {
+	JobID   string
+	State   pb.JobState
+	Percent int
+	Status  string
+
+	// ResultImageID names the processed image once State is SUCCEEDED.
+	ResultImageID string
+
+	// QueuePosition is the job's 1-based place in the server's queue
+	// while it waits for a worker, 0 otherwise.
+	QueuePosition int
+
+	// Err is set on the last value sent when the stream failed; the
+	// channel is closed right after it.
+	Err error
+}
+
+// Done reports whether p is the final update of its job.
+func (p Progress) Done() bool {
+	switch p.State {
+	case pb.JobState_JOB_STATE_SUCCEEDED, pb.JobState_JOB_STATE_FAILED, pb.JobState_JOB_STATE_CANCELLED:
+		return true
+	}
+	return p.Err != nil
+}
+
+func progressFrom(upd *pb.ProgressUpdate) Progress {
+	return Progress{
+		JobID:   upd.GetJobId(),
+		State:   upd.GetState(),
+		Percent: int(upd.GetPercent()),
+		Status:  upd.GetStatus(),
+
+		ResultImageID: upd.GetResultImageId(),
+		QueuePosition: int(upd.GetQueuePosition()),
+	}
+}
+
+// progressBuffer lets the stream run a few updates ahead of the reader
+const progressBuffer = 16
+
+// progressStream is satisfied by both Process and WatchJob client streams.
+type progressStream interface {
+	Recv() (*pb.ProgressUpdate, error)
+}
+
+// processOptions collects everything a ProcessOption can change.
+type processOptions struct {
+	priority pb.Priority
+	callback string
+}
+
+// ProcessOption configures a single Process or ProcessBatch call.
+type ProcessOption func(*processOptions)
+
+// WithPriority queues the job at p instead of PRIORITY_NORMAL.
+func WithPriority(p pb.Priority) ProcessOption {
+	return func(o *processOptions) { o.priority = p }
+}
+
+// WithCallbackURL has the server POST the job's outcome to url when it
+// finishes. The job then keeps running if the Process stream is closed
+// early. ProcessBatch ignores it.
+func WithCallbackURL(url string) ProcessOption {
+	return func(o *processOptions) { o.callback = url }
+}
+
+func newProcessOptions(opts []ProcessOption) processOptions {
+	var o processOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Process starts a job applying filters to the image and returns its
+// updates. The channel is closed when the job ends, the stream fails (the
+// last value then carries Err) or ctx is cancelled. Process is not
+// retried because every call starts a new job.
+func (c *Client) Process(ctx context.Context, imageID string, filters []string, opts ...ProcessOption) (<-chan Progress, error) {
+	o := newProcessOptions(opts)
+	stream, err := c.rpc.Process(ctx, &pb.ProcessingRequest{
+		ImageId:     imageID,
+		Filters:     filters,
+		Priority:    o.priority,
+		CallbackUrl: o.callback,
+	})
+	if err != nil {
+		return nil, wrapError("Process", err)
+	}
+	ch := make(chan Progress, progressBuffer)
+	go forwardProgress(ctx, "Process", stream, nil, ch)
+	return ch, nil
+}
+
+// WatchJob follows an existing job. Failures before the first update are
+// retried, so WatchJob can be used to reattach after a disconnect.
+func (c *Client) WatchJob(ctx context.Context, jobID string) (<-chan Progress, error) {
+	var stream pb.ImageProcessor_WatchJobClient
+	var first *pb.ProgressUpdate
+	err := c.opts.retry.do(ctx, "WatchJob", func(ctx context.Context) error {
+		var err error
+		stream, err = c.rpc.WatchJob(ctx, &pb.WatchJobRequest{JobId: jobID})
+		if err != nil {
+			return err
+		}
+		// server-streaming calls report errors on the first Recv
+		first, err = stream.Recv()
+		if err == io.EOF {
+			first = nil
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Progress, progressBuffer)
+	go forwardProgress(ctx, "WatchJob", stream, first, ch)
+	return ch, nil
+}
+
+// forwardProgress copies updates from stream to ch, starting with first
+// if it is not nil, and closes ch at the end.
+func forwardProgress(ctx context.Context, op string, stream progressStream, first *pb.ProgressUpdate, ch chan<- Progress) {
+	defer close(ch)
+	send := func(p Progress) bool {
+		select {
+		case ch <- p:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	if first != nil && !send(progressFrom(first)) {
+		return
+	}
+	for {
+		upd, err := stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			send(Progress{Err: wrapError(op, err)})
+			return
+		}
+		if !send(progressFrom(upd)) {
+			return
+		}
+	}
+}
+
+// Wait drains updates and returns the last one, or the stream error.
+func Wait(updates <-chan Progress) (Progress, error) {
+	var last Progress
+	for p := range updates {
+		if p.Err != nil {
+			return last, p.Err
+		}
+		last = p
+	}
+	return last, nil
+}
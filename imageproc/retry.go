@@ -0,0 +1,89 @@
+package imageproc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy controls how idempotent calls are retried. Only calls that
+// are safe to repeat are retried: GetVersion, GetImage, ListImages, GetJob,
+// ListJobs, and Download and WatchJob until they have delivered their
+// first message.
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts including the first; 1 disables retries
+	InitialBackoff time.Duration // delay before the first retry
+	MaxBackoff     time.Duration // upper bound on the delay
+	Multiplier     float64       // growth factor between retries
+	Jitter         float64       // fraction of the delay randomised, 0 to 1
+}
+
+// DefaultRetryPolicy retries up to three more times over roughly two
+// seconds, enough to ride out a server restart behind a load balancer.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// retryable reports whether err is a transient failure worth repeating
+func retryable(err error) bool {
+	var perm permanentError
+	if errors.As(err, &perm) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry number n (starting at 1)
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < n; i++ {
+		d *= p.Multiplier
+		if d >= float64(p.MaxBackoff) {
+			d = float64(p.MaxBackoff)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// do runs fn until it succeeds, fails permanently, the attempts run out
+// or ctx ends. The last error is returned wrapped for op.
+func (p RetryPolicy) do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return wrapError(op, err)
+		}
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return wrapError(op, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// permanentError stops do from retrying an otherwise transient failure,
+// e.g. a stream that broke after it had already delivered data
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
@@ -0,0 +1,148 @@
+package imageproc
+
+import (
+	"context"
+	"fmt"
+	pb "image-proc/proto"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TuneParam is one parameter change sent on a Tune stream.
+type TuneParam struct {
+	Name  string
+	Value float64
+}
+
+// ParseTuneParams parses "name:value" pairs such as "brightness:1.2".
+func ParseTuneParams(params []string) ([]TuneParam, error) {
+	out := make([]TuneParam, 0, len(params))
+	for _, p := range params {
+		name, raw, ok := strings.Cut(p, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("tune param %q is not name:value", p)
+		}
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("tune param %q: %w", p, err)
+		}
+		out = append(out, TuneParam{Name: name, Value: val})
+	}
+	return out, nil
+}
+
+// TuneSession is an open Tune stream on one image. Set sends parameter
+// changes, Previews delivers the rendered previews, and Close ends the
+// session. Set and Close may be called from a different goroutine than
+// the one reading Previews.
+type TuneSession struct {
+	imageID string
+	stream  pb.ImageProcessor_TuneClient
+	cancel  context.CancelFunc
+
+	previews chan []byte
+	done     chan struct{}
+	err      error // set before done is closed
+
+	sendMu sync.Mutex
+}
+
+// Tune opens a session on imageID. The session ends when Close is called
+// or ctx is cancelled.
+func (c *Client) Tune(ctx context.Context, imageID string) (*TuneSession, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.rpc.Tune(ctx)
+	if err != nil {
+		cancel()
+		return nil, wrapError("Tune", err)
+	}
+	s := &TuneSession{
+		imageID:  imageID,
+		stream:   stream,
+		cancel:   cancel,
+		previews: make(chan []byte, progressBuffer),
+		done:     make(chan struct{}),
+	}
+	go s.recv(ctx)
+	return s, nil
+}
+
+func (s *TuneSession) recv(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.previews)
+	for {
+		resp, err := s.stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			s.err = wrapError("Tune", err)
+			return
+		}
+		select {
+		case s.previews <- resp.GetPreviewChunk():
+		case <-ctx.Done():
+			s.err = wrapError("Tune", ctx.Err())
+			return
+		}
+	}
+}
+
+// Set sends one parameter change.
+func (s *TuneSession) Set(name string, value float64) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	err := s.stream.Send(&pb.TuneRequest{ImageId: s.imageID, Parameter: name, Value: value})
+	if err == io.EOF {
+		// the server ended the stream; Close reports why
+		<-s.done
+		if s.err != nil {
+			return s.err
+		}
+	}
+	return wrapError("Tune", err)
+}
+
+// Previews returns the previews in the order the server sends them. The
+// channel is closed when the session ends; read it until then or call
+// Close, otherwise the session stalls once the buffer fills.
+func (s *TuneSession) Previews() <-chan []byte {
+	return s.previews
+}
+
+// CloseSend tells the server no more changes are coming. The remaining
+// previews can still be read until Previews is closed.
+func (s *TuneSession) CloseSend() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return wrapError("Tune", s.stream.CloseSend())
+}
+
+// Err returns the error that ended the session, once Previews is closed.
+func (s *TuneSession) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close ends the session, discarding previews not read yet, and returns
+// the session's error.
+func (s *TuneSession) Close() error {
+	err := s.CloseSend()
+	if err != nil {
+		s.cancel()
+	}
+	for range s.previews {
+	}
+	<-s.done
+	s.cancel()
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
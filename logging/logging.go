@@ -0,0 +1,51 @@
+// Package logging builds the zap loggers used by the binaries.
+package logging
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config selects the minimum log level and the output encoding.
+type Config struct {
+	Level    string `yaml:"level" toml:"level" flag:"log-level" usage:"minimum log level: debug, info, warn or error"`
+	Encoding string `yaml:"encoding" toml:"encoding" flag:"log-encoding" usage:"log encoding: json or console"`
+}
+
+// DefaultConfig logs JSON at info level.
+func DefaultConfig() Config {
+	return Config{Level: "info", Encoding: "json"}
+}
+
+// Validate reports an unknown level or encoding.
+func (c Config) Validate() error {
+	if _, err := zapcore.ParseLevel(c.Level); err != nil {
+		return fmt.Errorf("log-level: %w", err)
+	}
+	if c.Encoding != "json" && c.Encoding != "console" {
+		return fmt.Errorf("log-encoding: unknown encoding %q", c.Encoding)
+	}
+	return nil
+}
+
+// New builds a production-style zap logger from cfg.
+func New(cfg Config) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, fmt.Errorf("logging: %w", err)
+	}
+
+	var zc zap.Config
+	switch cfg.Encoding {
+	case "", "json":
+		zc = zap.NewProductionConfig()
+	case "console":
+		zc = zap.NewDevelopmentConfig()
+	default:
+		return nil, fmt.Errorf("logging: unknown encoding %q", cfg.Encoding)
+	}
+	zc.Level = zap.NewAtomicLevelAt(level)
+	return zc.Build()
+}
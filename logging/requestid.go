@@ -0,0 +1,21 @@
+package logging
+
+// MaxRequestIDLength is the longest request ID taken from a caller.
+const MaxRequestIDLength = 128
+
+// ValidRequestID reports whether a caller's request ID may be used as is:
+// up to MaxRequestIDLength letters, digits, dots, underscores and dashes.
+// Anything else is replaced, since the ID ends up in every log line.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"5f0c6a1e-6c1b-4a55-9d38-0b1f2d7a9e11", true},
+		{"req_42.retry-1", true},
+		{strings.Repeat("a", MaxRequestIDLength), true},
+		{"", false},
+		{strings.Repeat("a", MaxRequestIDLength+1), false},
+		{"id with spaces", false},
+		{"id\nlevel=error", false},
+		{`id"}`, false},
+		{"idé", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRequestID(tt.id); got != tt.want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 	_ "google.golang.org/genproto/googleapis/api/annotations"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -23,6 +25,285 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Jobs of a higher priority always start before waiting jobs of a lower
+// one; within a priority, principals share workers by their weights.
+type Priority int32
+
+const (
+	Priority_PRIORITY_UNSPECIFIED Priority = 0
+	Priority_PRIORITY_LOW         Priority = 1
+	Priority_PRIORITY_NORMAL      Priority = 2
+	Priority_PRIORITY_HIGH        Priority = 3
+)
+
+// Enum value maps for Priority.
+var (
+	Priority_name = map[int32]string{
+		0: "PRIORITY_UNSPECIFIED",
+		1: "PRIORITY_LOW",
+		2: "PRIORITY_NORMAL",
+		3: "PRIORITY_HIGH",
+	}
+	Priority_value = map[string]int32{
+		"PRIORITY_UNSPECIFIED": 0,
+		"PRIORITY_LOW":         1,
+		"PRIORITY_NORMAL":      2,
+		"PRIORITY_HIGH":        3,
+	}
+)
+
+func (x Priority) Enum() *Priority {
+	p := new(Priority)
+	*p = x
+	return p
+}
+
+func (x Priority) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Priority) Descriptor() protoreflect.EnumDescriptor {
+	return file_image_proto_enumTypes[0].Descriptor()
+}
+
+func (Priority) Type() protoreflect.EnumType {
+	return &file_image_proto_enumTypes[0]
+}
+
+func (x Priority) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Priority.Descriptor instead.
+func (Priority) EnumDescriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{0}
+}
+
+type JobState int32
+
+const (
+	JobState_JOB_STATE_UNSPECIFIED JobState = 0
+	JobState_JOB_STATE_QUEUED      JobState = 1
+	JobState_JOB_STATE_RUNNING     JobState = 2
+	JobState_JOB_STATE_SUCCEEDED   JobState = 3
+	JobState_JOB_STATE_FAILED      JobState = 4
+	JobState_JOB_STATE_CANCELLED   JobState = 5
+)
+
+// Enum value maps for JobState.
+var (
+	JobState_name = map[int32]string{
+		0: "JOB_STATE_UNSPECIFIED",
+		1: "JOB_STATE_QUEUED",
+		2: "JOB_STATE_RUNNING",
+		3: "JOB_STATE_SUCCEEDED",
+		4: "JOB_STATE_FAILED",
+		5: "JOB_STATE_CANCELLED",
+	}
+	JobState_value = map[string]int32{
+		"JOB_STATE_UNSPECIFIED": 0,
+		"JOB_STATE_QUEUED":      1,
+		"JOB_STATE_RUNNING":     2,
+		"JOB_STATE_SUCCEEDED":   3,
+		"JOB_STATE_FAILED":      4,
+		"JOB_STATE_CANCELLED":   5,
+	}
+)
+
+func (x JobState) Enum() *JobState {
+	p := new(JobState)
+	*p = x
+	return p
+}
+
+func (x JobState) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JobState) Descriptor() protoreflect.EnumDescriptor {
+	return file_image_proto_enumTypes[1].Descriptor()
+}
+
+func (JobState) Type() protoreflect.EnumType {
+	return &file_image_proto_enumTypes[1]
+}
+
+func (x JobState) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JobState.Descriptor instead.
+func (JobState) EnumDescriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{1}
+}
+
+type EventType int32
+
+const (
+	EventType_EVENT_TYPE_UNSPECIFIED    EventType = 0
+	EventType_EVENT_TYPE_IMAGE_UPLOADED EventType = 1
+	EventType_EVENT_TYPE_IMAGE_DELETED  EventType = 2
+	EventType_EVENT_TYPE_JOB_QUEUED     EventType = 3
+	EventType_EVENT_TYPE_JOB_STARTED    EventType = 4
+	EventType_EVENT_TYPE_JOB_PROGRESS   EventType = 5
+	EventType_EVENT_TYPE_JOB_FINISHED   EventType = 6 // succeeded, failed or cancelled; see progress.state
+)
+
+// Enum value maps for EventType.
+var (
+	EventType_name = map[int32]string{
+		0: "EVENT_TYPE_UNSPECIFIED",
+		1: "EVENT_TYPE_IMAGE_UPLOADED",
+		2: "EVENT_TYPE_IMAGE_DELETED",
+		3: "EVENT_TYPE_JOB_QUEUED",
+		4: "EVENT_TYPE_JOB_STARTED",
+		5: "EVENT_TYPE_JOB_PROGRESS",
+		6: "EVENT_TYPE_JOB_FINISHED",
+	}
+	EventType_value = map[string]int32{
+		"EVENT_TYPE_UNSPECIFIED":    0,
+		"EVENT_TYPE_IMAGE_UPLOADED": 1,
+		"EVENT_TYPE_IMAGE_DELETED":  2,
+		"EVENT_TYPE_JOB_QUEUED":     3,
+		"EVENT_TYPE_JOB_STARTED":    4,
+		"EVENT_TYPE_JOB_PROGRESS":   5,
+		"EVENT_TYPE_JOB_FINISHED":   6,
+	}
+)
+
+func (x EventType) Enum() *EventType {
+	p := new(EventType)
+	*p = x
+	return p
+}
+
+func (x EventType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EventType) Descriptor() protoreflect.EnumDescriptor {
+	return file_image_proto_enumTypes[2].Descriptor()
+}
+
+func (EventType) Type() protoreflect.EnumType {
+	return &file_image_proto_enumTypes[2]
+}
+
+func (x EventType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EventType.Descriptor instead.
+func (EventType) EnumDescriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{2}
+}
+
+// How Render fits an image into the requested width and height
+type Fit int32
+
+const (
+	Fit_FIT_UNSPECIFIED Fit = 0 // same as FIT_CLIP
+	Fit_FIT_CLIP        Fit = 1 // scale to fit inside the box, keeping the aspect ratio
+	Fit_FIT_COVER       Fit = 2 // scale to fill the box, keeping the aspect ratio, and crop the overflow evenly
+	Fit_FIT_FILL        Fit = 3 // stretch to exactly the box
+)
+
+// Enum value maps for Fit.
+var (
+	Fit_name = map[int32]string{
+		0: "FIT_UNSPECIFIED",
+		1: "FIT_CLIP",
+		2: "FIT_COVER",
+		3: "FIT_FILL",
+	}
+	Fit_value = map[string]int32{
+		"FIT_UNSPECIFIED": 0,
+		"FIT_CLIP":        1,
+		"FIT_COVER":       2,
+		"FIT_FILL":        3,
+	}
+)
+
+func (x Fit) Enum() *Fit {
+	p := new(Fit)
+	*p = x
+	return p
+}
+
+func (x Fit) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Fit) Descriptor() protoreflect.EnumDescriptor {
+	return file_image_proto_enumTypes[3].Descriptor()
+}
+
+func (Fit) Type() protoreflect.EnumType {
+	return &file_image_proto_enumTypes[3]
+}
+
+func (x Fit) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Fit.Descriptor instead.
+func (Fit) EnumDescriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{3}
+}
+
+// What a signed URL lets its holder do
+type SignedOperation int32
+
+const (
+	SignedOperation_SIGNED_OPERATION_UNSPECIFIED SignedOperation = 0
+	SignedOperation_SIGNED_OPERATION_DOWNLOAD    SignedOperation = 1 // GET the image's content
+	SignedOperation_SIGNED_OPERATION_UPLOAD      SignedOperation = 2 // POST one new image, owned by the caller
+	SignedOperation_SIGNED_OPERATION_RENDER      SignedOperation = 3 // GET the image rendered with exactly the parameters in query
+)
+
+// Enum value maps for SignedOperation.
+var (
+	SignedOperation_name = map[int32]string{
+		0: "SIGNED_OPERATION_UNSPECIFIED",
+		1: "SIGNED_OPERATION_DOWNLOAD",
+		2: "SIGNED_OPERATION_UPLOAD",
+		3: "SIGNED_OPERATION_RENDER",
+	}
+	SignedOperation_value = map[string]int32{
+		"SIGNED_OPERATION_UNSPECIFIED": 0,
+		"SIGNED_OPERATION_DOWNLOAD":    1,
+		"SIGNED_OPERATION_UPLOAD":      2,
+		"SIGNED_OPERATION_RENDER":      3,
+	}
+)
+
+func (x SignedOperation) Enum() *SignedOperation {
+	p := new(SignedOperation)
+	*p = x
+	return p
+}
+
+func (x SignedOperation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SignedOperation) Descriptor() protoreflect.EnumDescriptor {
+	return file_image_proto_enumTypes[4].Descriptor()
+}
+
+func (SignedOperation) Type() protoreflect.EnumType {
+	return &file_image_proto_enumTypes[4]
+}
+
+func (x SignedOperation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SignedOperation.Descriptor instead.
+func (SignedOperation) EnumDescriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{4}
+}
+
 type VersionResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
@@ -156,9 +437,17 @@ func (x *UploadResponse) GetImageId() string {
 }
 
 type ProcessingRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ImageId       string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"` // ID returned by Upload
-	Filters       []string               `protobuf:"bytes,2,rep,name=filters,proto3" json:"filters,omitempty"`                // e.g. ["blur","edge"]
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	ImageId  string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`             // ID returned by Upload
+	Filters  []string               `protobuf:"bytes,2,rep,name=filters,proto3" json:"filters,omitempty"`                            // applied in order: blur, sharpen, edge, grayscale, invert; none copies the image
+	Priority Priority               `protobuf:"varint,3,opt,name=priority,proto3,enum=imageproc.Priority" json:"priority,omitempty"` // unset means NORMAL
+	// When set, the job keeps running if the caller hangs up, and its
+	// outcome is POSTed here as a signed JSON payload once it finishes.
+	// The payload is signed with HMAC-SHA256 over "<timestamp>.<body>"
+	// using the server's webhook secret; the timestamp and signature are
+	// sent in the X-Imageproc-Timestamp and X-Imageproc-Signature
+	// ("sha256=<hex>") headers.
+	CallbackUrl   string `protobuf:"bytes,4,opt,name=callback_url,json=callbackUrl,proto3" json:"callback_url,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -207,10 +496,28 @@ func (x *ProcessingRequest) GetFilters() []string {
 	return nil
 }
 
+func (x *ProcessingRequest) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+func (x *ProcessingRequest) GetCallbackUrl() string {
+	if x != nil {
+		return x.CallbackUrl
+	}
+	return ""
+}
+
 type ProgressUpdate struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Percent       int32                  `protobuf:"varint,1,opt,name=percent,proto3" json:"percent,omitempty"` // 0–100
-	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`    // e.g. "10% complete"
+	Percent       int32                  `protobuf:"varint,1,opt,name=percent,proto3" json:"percent,omitempty"`         // 0–100
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`            // e.g. "10% complete"
+	JobId         string                 `protobuf:"bytes,3,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"` // job the update belongs to
+	State         JobState               `protobuf:"varint,4,opt,name=state,proto3,enum=imageproc.JobState" json:"state,omitempty"`
+	ResultImageId string                 `protobuf:"bytes,5,opt,name=result_image_id,json=resultImageId,proto3" json:"result_image_id,omitempty"` // processed image, set once SUCCEEDED
+	QueuePosition int32                  `protobuf:"varint,6,opt,name=queue_position,json=queuePosition,proto3" json:"queue_position,omitempty"`  // 1-based place in the queue while QUEUED, 0 otherwise
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -259,6 +566,34 @@ func (x *ProgressUpdate) GetStatus() string {
 	return ""
 }
 
+func (x *ProgressUpdate) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *ProgressUpdate) GetState() JobState {
+	if x != nil {
+		return x.State
+	}
+	return JobState_JOB_STATE_UNSPECIFIED
+}
+
+func (x *ProgressUpdate) GetResultImageId() string {
+	if x != nil {
+		return x.ResultImageId
+	}
+	return ""
+}
+
+func (x *ProgressUpdate) GetQueuePosition() int32 {
+	if x != nil {
+		return x.QueuePosition
+	}
+	return 0
+}
+
 type TuneRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	ImageId       string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"` // ID of the uploaded image
@@ -363,92 +698,2410 @@ func (x *TuneResponse) GetPreviewChunk() []byte {
 	return nil
 }
 
-var File_image_proto protoreflect.FileDescriptor
+type DownloadRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageId       string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	Offset        int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"` // first byte to send; past the end is OUT_OF_RANGE
+	Length        int64                  `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"` // bytes to send from offset; 0 sends the rest
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-const file_image_proto_rawDesc = "" +
-	"\n" +
-	"\vimage.proto\x12\timageproc\x1a\x1cgoogle/api/annotations.proto\x1a\x1bgoogle/protobuf/empty.proto\"+\n" +
-	"\x0fVersionResponse\x12\x18\n" +
-	"\aversion\x18\x01 \x01(\tR\aversion\"%\n" +
-	"\rUploadRequest\x12\x14\n" +
-	"\x05chunk\x18\x01 \x01(\fR\x05chunk\"+\n" +
-	"\x0eUploadResponse\x12\x19\n" +
-	"\bimage_id\x18\x01 \x01(\tR\aimageId\"H\n" +
-	"\x11ProcessingRequest\x12\x19\n" +
-	"\bimage_id\x18\x01 \x01(\tR\aimageId\x12\x18\n" +
-	"\afilters\x18\x02 \x03(\tR\afilters\"B\n" +
-	"\x0eProgressUpdate\x12\x18\n" +
-	"\apercent\x18\x01 \x01(\x05R\apercent\x12\x16\n" +
-	"\x06status\x18\x02 \x01(\tR\x06status\"\\\n" +
-	"\vTuneRequest\x12\x19\n" +
-	"\bimage_id\x18\x01 \x01(\tR\aimageId\x12\x1c\n" +
-	"\tparameter\x18\x02 \x01(\tR\tparameter\x12\x14\n" +
-	"\x05value\x18\x03 \x01(\x01R\x05value\"3\n" +
-	"\fTuneResponse\x12#\n" +
-	"\rpreview_chunk\x18\x01 \x01(\fR\fpreviewChunk2\xf3\x02\n" +
-	"\x0eImageProcessor\x12U\n" +
-	"\n" +
-	"GetVersion\x12\x16.google.protobuf.Empty\x1a\x1a.imageproc.VersionResponse\"\x13\x82\xd3\xe4\x93\x02\r\x12\v/v1/version\x12]\n" +
-	"\x06Upload\x12\x18.imageproc.UploadRequest\x1a\x19.imageproc.UploadResponse\"\x1c\x82\xd3\xe4\x93\x02\x16:\x01*\"\x11/v1/images:upload(\x01\x12n\n" +
-	"\aProcess\x12\x1c.imageproc.ProcessingRequest\x1a\x19.imageproc.ProgressUpdate\"(\x82\xd3\xe4\x93\x02\":\x01*\"\x1d/v1/images/{image_id}/process0\x01\x12;\n" +
-	"\x04Tune\x12\x16.imageproc.TuneRequest\x1a\x17.imageproc.TuneResponse(\x010\x01B\x18Z\x16image-proc/proto;protob\x06proto3"
+func (x *DownloadRequest) Reset() {
+	*x = DownloadRequest{}
+	mi := &file_image_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
 
-var (
-	file_image_proto_rawDescOnce sync.Once
-	file_image_proto_rawDescData []byte
-)
+func (x *DownloadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
 
-func file_image_proto_rawDescGZIP() []byte {
-	file_image_proto_rawDescOnce.Do(func() {
-		file_image_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_image_proto_rawDesc), len(file_image_proto_rawDesc)))
-	})
-	return file_image_proto_rawDescData
+func (*DownloadRequest) ProtoMessage() {}
+
+func (x *DownloadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
 
-var file_image_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
-var file_image_proto_goTypes = []any{
-	(*VersionResponse)(nil),   // 0: imageproc.VersionResponse
-	(*UploadRequest)(nil),     // 1: imageproc.UploadRequest
-	(*UploadResponse)(nil),    // 2: imageproc.UploadResponse
-	(*ProcessingRequest)(nil), // 3: imageproc.ProcessingRequest
-	(*ProgressUpdate)(nil),    // 4: imageproc.ProgressUpdate
-	(*TuneRequest)(nil),       // 5: imageproc.TuneRequest
-	(*TuneResponse)(nil),      // 6: imageproc.TuneResponse
-	(*emptypb.Empty)(nil),     // 7: google.protobuf.Empty
+// Deprecated: Use DownloadRequest.ProtoReflect.Descriptor instead.
+func (*DownloadRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{7}
 }
-var file_image_proto_depIdxs = []int32{
-	7, // 0: imageproc.ImageProcessor.GetVersion:input_type -> google.protobuf.Empty
-	1, // 1: imageproc.ImageProcessor.Upload:input_type -> imageproc.UploadRequest
-	3, // 2: imageproc.ImageProcessor.Process:input_type -> imageproc.ProcessingRequest
-	5, // 3: imageproc.ImageProcessor.Tune:input_type -> imageproc.TuneRequest
-	0, // 4: imageproc.ImageProcessor.GetVersion:output_type -> imageproc.VersionResponse
-	2, // 5: imageproc.ImageProcessor.Upload:output_type -> imageproc.UploadResponse
-	4, // 6: imageproc.ImageProcessor.Process:output_type -> imageproc.ProgressUpdate
-	6, // 7: imageproc.ImageProcessor.Tune:output_type -> imageproc.TuneResponse
-	4, // [4:8] is the sub-list for method output_type
-	0, // [0:4] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+
+func (x *DownloadRequest) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
 }
 
-func init() { file_image_proto_init() }
-func file_image_proto_init() {
-	if File_image_proto != nil {
-		return
+func (x *DownloadRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *DownloadRequest) GetLength() int64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+type DownloadChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Chunk         []byte                 `protobuf:"bytes,1,opt,name=chunk,proto3" json:"chunk,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DownloadChunk) Reset() {
+	*x = DownloadChunk{}
+	mi := &file_image_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadChunk) ProtoMessage() {}
+
+func (x *DownloadChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadChunk.ProtoReflect.Descriptor instead.
+func (*DownloadChunk) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DownloadChunk) GetChunk() []byte {
+	if x != nil {
+		return x.Chunk
+	}
+	return nil
+}
+
+type ListImagesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Owner         string                 `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"` // must be the caller, if set: callers only ever see their own images
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListImagesRequest) Reset() {
+	*x = ListImagesRequest{}
+	mi := &file_image_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListImagesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListImagesRequest) ProtoMessage() {}
+
+func (x *ListImagesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListImagesRequest.ProtoReflect.Descriptor instead.
+func (*ListImagesRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListImagesRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+type ListImagesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Images        []*ImageInfo           `protobuf:"bytes,1,rep,name=images,proto3" json:"images,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListImagesResponse) Reset() {
+	*x = ListImagesResponse{}
+	mi := &file_image_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListImagesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListImagesResponse) ProtoMessage() {}
+
+func (x *ListImagesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListImagesResponse.ProtoReflect.Descriptor instead.
+func (*ListImagesResponse) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListImagesResponse) GetImages() []*ImageInfo {
+	if x != nil {
+		return x.Images
+	}
+	return nil
+}
+
+type GetImageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageId       string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetImageRequest) Reset() {
+	*x = GetImageRequest{}
+	mi := &file_image_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetImageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetImageRequest) ProtoMessage() {}
+
+func (x *GetImageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetImageRequest.ProtoReflect.Descriptor instead.
+func (*GetImageRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetImageRequest) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+type DeleteImageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageId       string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteImageRequest) Reset() {
+	*x = DeleteImageRequest{}
+	mi := &file_image_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteImageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteImageRequest) ProtoMessage() {}
+
+func (x *DeleteImageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteImageRequest.ProtoReflect.Descriptor instead.
+func (*DeleteImageRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *DeleteImageRequest) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+type ImageInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageId       string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	Owner         string                 `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`   // principal that uploaded it
+	Format        string                 `protobuf:"bytes,3,opt,name=format,proto3" json:"format,omitempty"` // e.g. "jpeg", "png"
+	Width         int32                  `protobuf:"varint,4,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,5,opt,name=height,proto3" json:"height,omitempty"`
+	SizeBytes     int64                  `protobuf:"varint,6,opt,name=size_bytes,json=sizeBytes,proto3" json:"size_bytes,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	SourceImageId string                 `protobuf:"bytes,8,opt,name=source_image_id,json=sourceImageId,proto3" json:"source_image_id,omitempty"` // image this one was processed from, if any
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageInfo) Reset() {
+	*x = ImageInfo{}
+	mi := &file_image_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageInfo) ProtoMessage() {}
+
+func (x *ImageInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageInfo.ProtoReflect.Descriptor instead.
+func (*ImageInfo) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ImageInfo) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+func (x *ImageInfo) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *ImageInfo) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *ImageInfo) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetSizeBytes() int64 {
+	if x != nil {
+		return x.SizeBytes
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *ImageInfo) GetSourceImageId() string {
+	if x != nil {
+		return x.SourceImageId
+	}
+	return ""
+}
+
+type WatchJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchJobRequest) Reset() {
+	*x = WatchJobRequest{}
+	mi := &file_image_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchJobRequest) ProtoMessage() {}
+
+func (x *WatchJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchJobRequest.ProtoReflect.Descriptor instead.
+func (*WatchJobRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *WatchJobRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type ProcessBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageIds      []string               `protobuf:"bytes,1,rep,name=image_ids,json=imageIds,proto3" json:"image_ids,omitempty"`
+	Filters       []string               `protobuf:"bytes,2,rep,name=filters,proto3" json:"filters,omitempty"` // applied to every image, as in ProcessingRequest
+	Priority      Priority               `protobuf:"varint,3,opt,name=priority,proto3,enum=imageproc.Priority" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProcessBatchRequest) Reset() {
+	*x = ProcessBatchRequest{}
+	mi := &file_image_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProcessBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessBatchRequest) ProtoMessage() {}
+
+func (x *ProcessBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessBatchRequest.ProtoReflect.Descriptor instead.
+func (*ProcessBatchRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ProcessBatchRequest) GetImageIds() []string {
+	if x != nil {
+		return x.ImageIds
+	}
+	return nil
+}
+
+func (x *ProcessBatchRequest) GetFilters() []string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *ProcessBatchRequest) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+// One event on a ProcessBatch stream. Events for different images are
+// interleaved; image_id says which image progress and result belong to.
+type BatchEvent struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	BatchId string                 `protobuf:"bytes,1,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	ImageId string                 `protobuf:"bytes,2,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*BatchEvent_Progress
+	//	*BatchEvent_Result
+	//	*BatchEvent_Summary
+	Event         isBatchEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchEvent) Reset() {
+	*x = BatchEvent{}
+	mi := &file_image_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchEvent) ProtoMessage() {}
+
+func (x *BatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchEvent.ProtoReflect.Descriptor instead.
+func (*BatchEvent) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *BatchEvent) GetBatchId() string {
+	if x != nil {
+		return x.BatchId
+	}
+	return ""
+}
+
+func (x *BatchEvent) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+func (x *BatchEvent) GetEvent() isBatchEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *BatchEvent) GetProgress() *ProgressUpdate {
+	if x != nil {
+		if x, ok := x.Event.(*BatchEvent_Progress); ok {
+			return x.Progress
+		}
+	}
+	return nil
+}
+
+func (x *BatchEvent) GetResult() *BatchItemResult {
+	if x != nil {
+		if x, ok := x.Event.(*BatchEvent_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+func (x *BatchEvent) GetSummary() *BatchSummary {
+	if x != nil {
+		if x, ok := x.Event.(*BatchEvent_Summary); ok {
+			return x.Summary
+		}
+	}
+	return nil
+}
+
+type isBatchEvent_Event interface {
+	isBatchEvent_Event()
+}
+
+type BatchEvent_Progress struct {
+	Progress *ProgressUpdate `protobuf:"bytes,3,opt,name=progress,proto3,oneof"`
+}
+
+type BatchEvent_Result struct {
+	Result *BatchItemResult `protobuf:"bytes,4,opt,name=result,proto3,oneof"` // one per image, after its last progress
+}
+
+type BatchEvent_Summary struct {
+	Summary *BatchSummary `protobuf:"bytes,5,opt,name=summary,proto3,oneof"` // last event of the stream
+}
+
+func (*BatchEvent_Progress) isBatchEvent_Event() {}
+
+func (*BatchEvent_Result) isBatchEvent_Event() {}
+
+func (*BatchEvent_Summary) isBatchEvent_Event() {}
+
+type BatchItemResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageId       string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	JobId         string                 `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"` // empty if the image was rejected before a job started
+	State         JobState               `protobuf:"varint,3,opt,name=state,proto3,enum=imageproc.JobState" json:"state,omitempty"`
+	ResultImageId string                 `protobuf:"bytes,4,opt,name=result_image_id,json=resultImageId,proto3" json:"result_image_id,omitempty"` // set when state is SUCCEEDED
+	Code          int32                  `protobuf:"varint,5,opt,name=code,proto3" json:"code,omitempty"`                                         // google.rpc.Code of the failure, 0 on success
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchItemResult) Reset() {
+	*x = BatchItemResult{}
+	mi := &file_image_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchItemResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchItemResult) ProtoMessage() {}
+
+func (x *BatchItemResult) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchItemResult.ProtoReflect.Descriptor instead.
+func (*BatchItemResult) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *BatchItemResult) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+func (x *BatchItemResult) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *BatchItemResult) GetState() JobState {
+	if x != nil {
+		return x.State
+	}
+	return JobState_JOB_STATE_UNSPECIFIED
+}
+
+func (x *BatchItemResult) GetResultImageId() string {
+	if x != nil {
+		return x.ResultImageId
+	}
+	return ""
+}
+
+func (x *BatchItemResult) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *BatchItemResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type BatchSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Total         int32                  `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	Succeeded     int32                  `protobuf:"varint,2,opt,name=succeeded,proto3" json:"succeeded,omitempty"`
+	Failed        int32                  `protobuf:"varint,3,opt,name=failed,proto3" json:"failed,omitempty"`
+	Cancelled     int32                  `protobuf:"varint,4,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
+	Failures      []*BatchItemResult     `protobuf:"bytes,5,rep,name=failures,proto3" json:"failures,omitempty"` // every image that did not succeed
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSummary) Reset() {
+	*x = BatchSummary{}
+	mi := &file_image_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSummary) ProtoMessage() {}
+
+func (x *BatchSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSummary.ProtoReflect.Descriptor instead.
+func (*BatchSummary) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *BatchSummary) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *BatchSummary) GetSucceeded() int32 {
+	if x != nil {
+		return x.Succeeded
+	}
+	return 0
+}
+
+func (x *BatchSummary) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *BatchSummary) GetCancelled() int32 {
+	if x != nil {
+		return x.Cancelled
+	}
+	return 0
+}
+
+func (x *BatchSummary) GetFailures() []*BatchItemResult {
+	if x != nil {
+		return x.Failures
+	}
+	return nil
+}
+
+type Job struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	ImageId       string                 `protobuf:"bytes,2,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	Filters       []string               `protobuf:"bytes,3,rep,name=filters,proto3" json:"filters,omitempty"`
+	Owner         string                 `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	State         JobState               `protobuf:"varint,5,opt,name=state,proto3,enum=imageproc.JobState" json:"state,omitempty"`
+	Percent       int32                  `protobuf:"varint,6,opt,name=percent,proto3" json:"percent,omitempty"`
+	Status        string                 `protobuf:"bytes,7,opt,name=status,proto3" json:"status,omitempty"`                                      // latest progress message
+	ResultImageId string                 `protobuf:"bytes,8,opt,name=result_image_id,json=resultImageId,proto3" json:"result_image_id,omitempty"` // set when state is SUCCEEDED
+	Error         string                 `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`                                        // set when state is FAILED or CANCELLED
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	FinishedAt    *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	Restarts      int32                  `protobuf:"varint,13,opt,name=restarts,proto3" json:"restarts,omitempty"` // times the job was requeued after a server restart
+	Priority      Priority               `protobuf:"varint,14,opt,name=priority,proto3,enum=imageproc.Priority" json:"priority,omitempty"`
+	Attempts      int32                  `protobuf:"varint,15,opt,name=attempts,proto3" json:"attempts,omitempty"`                         // times processing started, including retries
+	CallbackUrl   string                 `protobuf:"bytes,16,opt,name=callback_url,json=callbackUrl,proto3" json:"callback_url,omitempty"` // webhook notified when the job finishes
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,17,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`       // first time the job got a worker
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_image_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *Job) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *Job) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+func (x *Job) GetFilters() []string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *Job) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Job) GetState() JobState {
+	if x != nil {
+		return x.State
+	}
+	return JobState_JOB_STATE_UNSPECIFIED
+}
+
+func (x *Job) GetPercent() int32 {
+	if x != nil {
+		return x.Percent
+	}
+	return 0
+}
+
+func (x *Job) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Job) GetResultImageId() string {
+	if x != nil {
+		return x.ResultImageId
+	}
+	return ""
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Job) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Job) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Job) GetRestarts() int32 {
+	if x != nil {
+		return x.Restarts
+	}
+	return 0
+}
+
+func (x *Job) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+func (x *Job) GetAttempts() int32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *Job) GetCallbackUrl() string {
+	if x != nil {
+		return x.CallbackUrl
+	}
+	return ""
+}
+
+func (x *Job) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+type GetJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobRequest) Reset() {
+	*x = GetJobRequest{}
+	mi := &file_image_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobRequest) ProtoMessage() {}
+
+func (x *GetJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobRequest.ProtoReflect.Descriptor instead.
+func (*GetJobRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *GetJobRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type ListJobsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Owner         string                 `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`                          // must be the caller, if set: callers only ever see their own jobs
+	State         JobState               `protobuf:"varint,2,opt,name=state,proto3,enum=imageproc.JobState" json:"state,omitempty"` // only jobs in this state, if set
+	PageSize      int32                  `protobuf:"varint,3,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`   // default 50, at most 500
+	PageToken     string                 `protobuf:"bytes,4,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"` // next_page_token of the previous page
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsRequest) Reset() {
+	*x = ListJobsRequest{}
+	mi := &file_image_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsRequest) ProtoMessage() {}
+
+func (x *ListJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsRequest.ProtoReflect.Descriptor instead.
+func (*ListJobsRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ListJobsRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *ListJobsRequest) GetState() JobState {
+	if x != nil {
+		return x.State
+	}
+	return JobState_JOB_STATE_UNSPECIFIED
+}
+
+func (x *ListJobsRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListJobsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListJobsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*Job                 `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	NextPageToken string                 `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"` // empty on the last page
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsResponse) Reset() {
+	*x = ListJobsResponse{}
+	mi := &file_image_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsResponse) ProtoMessage() {}
+
+func (x *ListJobsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsResponse.ProtoReflect.Descriptor instead.
+func (*ListJobsResponse) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ListJobsResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+func (x *ListJobsResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type ListDeadLettersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Owner         string                 `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`                          // must be the caller, if set: callers only ever see their own jobs
+	PageSize      int32                  `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`   // default 50, at most 500
+	PageToken     string                 `protobuf:"bytes,3,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"` // next_page_token of the previous page
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDeadLettersRequest) Reset() {
+	*x = ListDeadLettersRequest{}
+	mi := &file_image_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDeadLettersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDeadLettersRequest) ProtoMessage() {}
+
+func (x *ListDeadLettersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDeadLettersRequest.ProtoReflect.Descriptor instead.
+func (*ListDeadLettersRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ListDeadLettersRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *ListDeadLettersRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListDeadLettersRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListDeadLettersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeadLetters   []*DeadLetter          `protobuf:"bytes,1,rep,name=dead_letters,json=deadLetters,proto3" json:"dead_letters,omitempty"`
+	NextPageToken string                 `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"` // empty on the last page
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDeadLettersResponse) Reset() {
+	*x = ListDeadLettersResponse{}
+	mi := &file_image_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDeadLettersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDeadLettersResponse) ProtoMessage() {}
+
+func (x *ListDeadLettersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDeadLettersResponse.ProtoReflect.Descriptor instead.
+func (*ListDeadLettersResponse) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ListDeadLettersResponse) GetDeadLetters() []*DeadLetter {
+	if x != nil {
+		return x.DeadLetters
+	}
+	return nil
+}
+
+func (x *ListDeadLettersResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type DeadLetter struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Job            *Job                   `protobuf:"bytes,1,opt,name=job,proto3" json:"job,omitempty"`
+	Code           int32                  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`           // google.rpc.Code of the final failure
+	Retryable      bool                   `protobuf:"varint,3,opt,name=retryable,proto3" json:"retryable,omitempty"` // false if the failure would recur, e.g. a corrupt image
+	DeadLetteredAt *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=dead_lettered_at,json=deadLetteredAt,proto3" json:"dead_lettered_at,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *DeadLetter) Reset() {
+	*x = DeadLetter{}
+	mi := &file_image_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeadLetter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeadLetter) ProtoMessage() {}
+
+func (x *DeadLetter) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeadLetter.ProtoReflect.Descriptor instead.
+func (*DeadLetter) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *DeadLetter) GetJob() *Job {
+	if x != nil {
+		return x.Job
+	}
+	return nil
+}
+
+func (x *DeadLetter) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *DeadLetter) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+func (x *DeadLetter) GetDeadLetteredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DeadLetteredAt
+	}
+	return nil
+}
+
+type RedriveJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RedriveJobRequest) Reset() {
+	*x = RedriveJobRequest{}
+	mi := &file_image_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RedriveJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RedriveJobRequest) ProtoMessage() {}
+
+func (x *RedriveJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RedriveJobRequest.ProtoReflect.Descriptor instead.
+func (*RedriveJobRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *RedriveJobRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type ListWebhookDeliveriesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWebhookDeliveriesRequest) Reset() {
+	*x = ListWebhookDeliveriesRequest{}
+	mi := &file_image_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWebhookDeliveriesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWebhookDeliveriesRequest) ProtoMessage() {}
+
+func (x *ListWebhookDeliveriesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWebhookDeliveriesRequest.ProtoReflect.Descriptor instead.
+func (*ListWebhookDeliveriesRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ListWebhookDeliveriesRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type ListWebhookDeliveriesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deliveries    []*WebhookDelivery     `protobuf:"bytes,1,rep,name=deliveries,proto3" json:"deliveries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWebhookDeliveriesResponse) Reset() {
+	*x = ListWebhookDeliveriesResponse{}
+	mi := &file_image_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWebhookDeliveriesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWebhookDeliveriesResponse) ProtoMessage() {}
+
+func (x *ListWebhookDeliveriesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWebhookDeliveriesResponse.ProtoReflect.Descriptor instead.
+func (*ListWebhookDeliveriesResponse) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *ListWebhookDeliveriesResponse) GetDeliveries() []*WebhookDelivery {
+	if x != nil {
+		return x.Deliveries
+	}
+	return nil
+}
+
+// One attempt to POST a job's outcome to its callback URL
+type WebhookDelivery struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeliveryId    string                 `protobuf:"bytes,1,opt,name=delivery_id,json=deliveryId,proto3" json:"delivery_id,omitempty"` // same for every retry of one payload, sent as X-Imageproc-Delivery
+	Attempt       int32                  `protobuf:"varint,2,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	Url           string                 `protobuf:"bytes,3,opt,name=url,proto3" json:"url,omitempty"`
+	SentAt        *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=sent_at,json=sentAt,proto3" json:"sent_at,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,5,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	StatusCode    int32                  `protobuf:"varint,6,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"` // HTTP status, 0 if no response arrived
+	Error         string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`                              // why the attempt failed
+	Succeeded     bool                   `protobuf:"varint,8,opt,name=succeeded,proto3" json:"succeeded,omitempty"`                     // the receiver answered 2xx
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WebhookDelivery) Reset() {
+	*x = WebhookDelivery{}
+	mi := &file_image_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WebhookDelivery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WebhookDelivery) ProtoMessage() {}
+
+func (x *WebhookDelivery) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WebhookDelivery.ProtoReflect.Descriptor instead.
+func (*WebhookDelivery) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *WebhookDelivery) GetDeliveryId() string {
+	if x != nil {
+		return x.DeliveryId
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *WebhookDelivery) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetSentAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.SentAt
+	}
+	return nil
+}
+
+func (x *WebhookDelivery) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *WebhookDelivery) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *WebhookDelivery) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetSucceeded() bool {
+	if x != nil {
+		return x.Succeeded
+	}
+	return false
+}
+
+type SubscribeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Types []EventType            `protobuf:"varint,1,rep,packed,name=types,proto3,enum=imageproc.EventType" json:"types,omitempty"` // only these types, if set
+	Owner string                 `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`                                  // must be the caller, if set: callers only ever see their own events
+	// Resume after the event with this cursor instead of starting with
+	// the next new event. Fails with OUT_OF_RANGE once the server no
+	// longer holds the events that follow it.
+	Cursor        string `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_image_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *SubscribeRequest) GetTypes() []EventType {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type Event struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Cursor  string                 `protobuf:"bytes,1,opt,name=cursor,proto3" json:"cursor,omitempty"` // pass as SubscribeRequest.cursor to resume after this event
+	Type    EventType              `protobuf:"varint,2,opt,name=type,proto3,enum=imageproc.EventType" json:"type,omitempty"`
+	Time    *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	Owner   string                 `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	ImageId string                 `protobuf:"bytes,5,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	JobId   string                 `protobuf:"bytes,6,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"` // set for job events
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*Event_Image
+	//	*Event_Progress
+	Payload       isEvent_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_image_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *Event) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *Event) GetType() EventType {
+	if x != nil {
+		return x.Type
+	}
+	return EventType_EVENT_TYPE_UNSPECIFIED
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Event) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+func (x *Event) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *Event) GetPayload() isEvent_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Event) GetImage() *ImageInfo {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Image); ok {
+			return x.Image
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetProgress() *ProgressUpdate {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Progress); ok {
+			return x.Progress
+		}
+	}
+	return nil
+}
+
+type isEvent_Payload interface {
+	isEvent_Payload()
+}
+
+type Event_Image struct {
+	Image *ImageInfo `protobuf:"bytes,7,opt,name=image,proto3,oneof"` // image events
+}
+
+type Event_Progress struct {
+	Progress *ProgressUpdate `protobuf:"bytes,8,opt,name=progress,proto3,oneof"` // job events
+}
+
+func (*Event_Image) isEvent_Payload() {}
+
+func (*Event_Progress) isEvent_Payload() {}
+
+type RenderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageId       string                 `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	Width         int32                  `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"` // 0 follows from height and the aspect ratio; both 0 keep the size
+	Height        int32                  `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	Fit           Fit                    `protobuf:"varint,4,opt,name=fit,proto3,enum=imageproc.Fit" json:"fit,omitempty"` // only matters when both width and height are set
+	Format        string                 `protobuf:"bytes,5,opt,name=format,proto3" json:"format,omitempty"`               // "jpeg" or "png"; empty keeps the stored image's
+	Quality       int32                  `protobuf:"varint,6,opt,name=quality,proto3" json:"quality,omitempty"`            // JPEG quality, 1-100; 0 means 85
+	Filters       []string               `protobuf:"bytes,7,rep,name=filters,proto3" json:"filters,omitempty"`             // applied in order after resizing, as in ProcessingRequest
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenderRequest) Reset() {
+	*x = RenderRequest{}
+	mi := &file_image_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderRequest) ProtoMessage() {}
+
+func (x *RenderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderRequest.ProtoReflect.Descriptor instead.
+func (*RenderRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *RenderRequest) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *RenderRequest) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *RenderRequest) GetFit() Fit {
+	if x != nil {
+		return x.Fit
+	}
+	return Fit_FIT_UNSPECIFIED
+}
+
+func (x *RenderRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetQuality() int32 {
+	if x != nil {
+		return x.Quality
+	}
+	return 0
+}
+
+func (x *RenderRequest) GetFilters() []string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+type RenderChunk struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Chunk []byte                 `protobuf:"bytes,1,opt,name=chunk,proto3" json:"chunk,omitempty"`
+	// set on the first chunk only
+	ContentType   string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Width         int32  `protobuf:"varint,3,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32  `protobuf:"varint,4,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenderChunk) Reset() {
+	*x = RenderChunk{}
+	mi := &file_image_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderChunk) ProtoMessage() {}
+
+func (x *RenderChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderChunk.ProtoReflect.Descriptor instead.
+func (*RenderChunk) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *RenderChunk) GetChunk() []byte {
+	if x != nil {
+		return x.Chunk
+	}
+	return nil
+}
+
+func (x *RenderChunk) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *RenderChunk) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *RenderChunk) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type SignURLRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operation     SignedOperation        `protobuf:"varint,1,opt,name=operation,proto3,enum=imageproc.SignedOperation" json:"operation,omitempty"`
+	ImageId       string                 `protobuf:"bytes,2,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`     // the caller's image to download or render; unset for uploads
+	Ttl           *durationpb.Duration   `protobuf:"bytes,3,opt,name=ttl,proto3" json:"ttl,omitempty"`                            // unset means the server default; capped at the server maximum
+	MaxBytes      int64                  `protobuf:"varint,4,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"` // largest upload accepted; 0 means the server's limit
+	Query         string                 `protobuf:"bytes,5,opt,name=query,proto3" json:"query,omitempty"`                        // render parameters, e.g. "w=400&h=300&fmt=png"; renders only
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SignURLRequest) Reset() {
+	*x = SignURLRequest{}
+	mi := &file_image_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SignURLRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SignURLRequest) ProtoMessage() {}
+
+func (x *SignURLRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SignURLRequest.ProtoReflect.Descriptor instead.
+func (*SignURLRequest) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *SignURLRequest) GetOperation() SignedOperation {
+	if x != nil {
+		return x.Operation
+	}
+	return SignedOperation_SIGNED_OPERATION_UNSPECIFIED
+}
+
+func (x *SignURLRequest) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+func (x *SignURLRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+func (x *SignURLRequest) GetMaxBytes() int64 {
+	if x != nil {
+		return x.MaxBytes
+	}
+	return 0
+}
+
+func (x *SignURLRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+type SignURLResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`       // relative to the gateway unless the server is configured with its address
+	Method        string                 `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"` // HTTP method to use it with
+	ExpiresAt     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SignURLResponse) Reset() {
+	*x = SignURLResponse{}
+	mi := &file_image_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SignURLResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SignURLResponse) ProtoMessage() {}
+
+func (x *SignURLResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_image_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SignURLResponse.ProtoReflect.Descriptor instead.
+func (*SignURLResponse) Descriptor() ([]byte, []int) {
+	return file_image_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *SignURLResponse) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *SignURLResponse) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *SignURLResponse) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+var File_image_proto protoreflect.FileDescriptor
+
+const file_image_proto_rawDesc = "" +
+	"\n" +
+	"\vimage.proto\x12\timageproc\x1a\x1cgoogle/api/annotations.proto\x1a\x1egoogle/protobuf/duration.proto\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"+\n" +
+	"\x0fVersionResponse\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\"%\n" +
+	"\rUploadRequest\x12\x14\n" +
+	"\x05chunk\x18\x01 \x01(\fR\x05chunk\"+\n" +
+	"\x0eUploadResponse\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\"\x9c\x01\n" +
+	"\x11ProcessingRequest\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\x12\x18\n" +
+	"\afilters\x18\x02 \x03(\tR\afilters\x12/\n" +
+	"\bpriority\x18\x03 \x01(\x0e2\x13.imageproc.PriorityR\bpriority\x12!\n" +
+	"\fcallback_url\x18\x04 \x01(\tR\vcallbackUrl\"\xd3\x01\n" +
+	"\x0eProgressUpdate\x12\x18\n" +
+	"\apercent\x18\x01 \x01(\x05R\apercent\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x15\n" +
+	"\x06job_id\x18\x03 \x01(\tR\x05jobId\x12)\n" +
+	"\x05state\x18\x04 \x01(\x0e2\x13.imageproc.JobStateR\x05state\x12&\n" +
+	"\x0fresult_image_id\x18\x05 \x01(\tR\rresultImageId\x12%\n" +
+	"\x0equeue_position\x18\x06 \x01(\x05R\rqueuePosition\"\\\n" +
+	"\vTuneRequest\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\x12\x1c\n" +
+	"\tparameter\x18\x02 \x01(\tR\tparameter\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\x01R\x05value\"3\n" +
+	"\fTuneResponse\x12#\n" +
+	"\rpreview_chunk\x18\x01 \x01(\fR\fpreviewChunk\"\\\n" +
+	"\x0fDownloadRequest\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06length\x18\x03 \x01(\x03R\x06length\"%\n" +
+	"\rDownloadChunk\x12\x14\n" +
+	"\x05chunk\x18\x01 \x01(\fR\x05chunk\")\n" +
+	"\x11ListImagesRequest\x12\x14\n" +
+	"\x05owner\x18\x01 \x01(\tR\x05owner\"B\n" +
+	"\x12ListImagesResponse\x12,\n" +
+	"\x06images\x18\x01 \x03(\v2\x14.imageproc.ImageInfoR\x06images\",\n" +
+	"\x0fGetImageRequest\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\"/\n" +
+	"\x12DeleteImageRequest\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\"\x84\x02\n" +
+	"\tImageInfo\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\x12\x14\n" +
+	"\x05owner\x18\x02 \x01(\tR\x05owner\x12\x16\n" +
+	"\x06format\x18\x03 \x01(\tR\x06format\x12\x14\n" +
+	"\x05width\x18\x04 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x05 \x01(\x05R\x06height\x12\x1d\n" +
+	"\n" +
+	"size_bytes\x18\x06 \x01(\x03R\tsizeBytes\x129\n" +
+	"\n" +
+	"created_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12&\n" +
+	"\x0fsource_image_id\x18\b \x01(\tR\rsourceImageId\"(\n" +
+	"\x0fWatchJobRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"}\n" +
+	"\x13ProcessBatchRequest\x12\x1b\n" +
+	"\timage_ids\x18\x01 \x03(\tR\bimageIds\x12\x18\n" +
+	"\afilters\x18\x02 \x03(\tR\afilters\x12/\n" +
+	"\bpriority\x18\x03 \x01(\x0e2\x13.imageproc.PriorityR\bpriority\"\xef\x01\n" +
+	"\n" +
+	"BatchEvent\x12\x19\n" +
+	"\bbatch_id\x18\x01 \x01(\tR\abatchId\x12\x19\n" +
+	"\bimage_id\x18\x02 \x01(\tR\aimageId\x127\n" +
+	"\bprogress\x18\x03 \x01(\v2\x19.imageproc.ProgressUpdateH\x00R\bprogress\x124\n" +
+	"\x06result\x18\x04 \x01(\v2\x1a.imageproc.BatchItemResultH\x00R\x06result\x123\n" +
+	"\asummary\x18\x05 \x01(\v2\x17.imageproc.BatchSummaryH\x00R\asummaryB\a\n" +
+	"\x05event\"\xc0\x01\n" +
+	"\x0fBatchItemResult\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\x12\x15\n" +
+	"\x06job_id\x18\x02 \x01(\tR\x05jobId\x12)\n" +
+	"\x05state\x18\x03 \x01(\x0e2\x13.imageproc.JobStateR\x05state\x12&\n" +
+	"\x0fresult_image_id\x18\x04 \x01(\tR\rresultImageId\x12\x12\n" +
+	"\x04code\x18\x05 \x01(\x05R\x04code\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\"\xb0\x01\n" +
+	"\fBatchSummary\x12\x14\n" +
+	"\x05total\x18\x01 \x01(\x05R\x05total\x12\x1c\n" +
+	"\tsucceeded\x18\x02 \x01(\x05R\tsucceeded\x12\x16\n" +
+	"\x06failed\x18\x03 \x01(\x05R\x06failed\x12\x1c\n" +
+	"\tcancelled\x18\x04 \x01(\x05R\tcancelled\x126\n" +
+	"\bfailures\x18\x05 \x03(\v2\x1a.imageproc.BatchItemResultR\bfailures\"\xfc\x04\n" +
+	"\x03Job\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x19\n" +
+	"\bimage_id\x18\x02 \x01(\tR\aimageId\x12\x18\n" +
+	"\afilters\x18\x03 \x03(\tR\afilters\x12\x14\n" +
+	"\x05owner\x18\x04 \x01(\tR\x05owner\x12)\n" +
+	"\x05state\x18\x05 \x01(\x0e2\x13.imageproc.JobStateR\x05state\x12\x18\n" +
+	"\apercent\x18\x06 \x01(\x05R\apercent\x12\x16\n" +
+	"\x06status\x18\a \x01(\tR\x06status\x12&\n" +
+	"\x0fresult_image_id\x18\b \x01(\tR\rresultImageId\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\x129\n" +
+	"\n" +
+	"created_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12;\n" +
+	"\vfinished_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12\x1a\n" +
+	"\brestarts\x18\r \x01(\x05R\brestarts\x12/\n" +
+	"\bpriority\x18\x0e \x01(\x0e2\x13.imageproc.PriorityR\bpriority\x12\x1a\n" +
+	"\battempts\x18\x0f \x01(\x05R\battempts\x12!\n" +
+	"\fcallback_url\x18\x10 \x01(\tR\vcallbackUrl\x129\n" +
+	"\n" +
+	"started_at\x18\x11 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\"&\n" +
+	"\rGetJobRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"\x8e\x01\n" +
+	"\x0fListJobsRequest\x12\x14\n" +
+	"\x05owner\x18\x01 \x01(\tR\x05owner\x12)\n" +
+	"\x05state\x18\x02 \x01(\x0e2\x13.imageproc.JobStateR\x05state\x12\x1b\n" +
+	"\tpage_size\x18\x03 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x04 \x01(\tR\tpageToken\"^\n" +
+	"\x10ListJobsResponse\x12\"\n" +
+	"\x04jobs\x18\x01 \x03(\v2\x0e.imageproc.JobR\x04jobs\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"j\n" +
+	"\x16ListDeadLettersRequest\x12\x14\n" +
+	"\x05owner\x18\x01 \x01(\tR\x05owner\x12\x1b\n" +
+	"\tpage_size\x18\x02 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x03 \x01(\tR\tpageToken\"{\n" +
+	"\x17ListDeadLettersResponse\x128\n" +
+	"\fdead_letters\x18\x01 \x03(\v2\x15.imageproc.DeadLetterR\vdeadLetters\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\xa6\x01\n" +
+	"\n" +
+	"DeadLetter\x12 \n" +
+	"\x03job\x18\x01 \x01(\v2\x0e.imageproc.JobR\x03job\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x1c\n" +
+	"\tretryable\x18\x03 \x01(\bR\tretryable\x12D\n" +
+	"\x10dead_lettered_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x0edeadLetteredAt\"*\n" +
+	"\x11RedriveJobRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"5\n" +
+	"\x1cListWebhookDeliveriesRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"[\n" +
+	"\x1dListWebhookDeliveriesResponse\x12:\n" +
+	"\n" +
+	"deliveries\x18\x01 \x03(\v2\x1a.imageproc.WebhookDeliveryR\n" +
+	"deliveries\"\x89\x02\n" +
+	"\x0fWebhookDelivery\x12\x1f\n" +
+	"\vdelivery_id\x18\x01 \x01(\tR\n" +
+	"deliveryId\x12\x18\n" +
+	"\aattempt\x18\x02 \x01(\x05R\aattempt\x12\x10\n" +
+	"\x03url\x18\x03 \x01(\tR\x03url\x123\n" +
+	"\asent_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x06sentAt\x12\x1f\n" +
+	"\vduration_ms\x18\x05 \x01(\x03R\n" +
+	"durationMs\x12\x1f\n" +
+	"\vstatus_code\x18\x06 \x01(\x05R\n" +
+	"statusCode\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\x12\x1c\n" +
+	"\tsucceeded\x18\b \x01(\bR\tsucceeded\"l\n" +
+	"\x10SubscribeRequest\x12*\n" +
+	"\x05types\x18\x01 \x03(\x0e2\x14.imageproc.EventTypeR\x05types\x12\x14\n" +
+	"\x05owner\x18\x02 \x01(\tR\x05owner\x12\x16\n" +
+	"\x06cursor\x18\x03 \x01(\tR\x06cursor\"\xb3\x02\n" +
+	"\x05Event\x12\x16\n" +
+	"\x06cursor\x18\x01 \x01(\tR\x06cursor\x12(\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x14.imageproc.EventTypeR\x04type\x12.\n" +
+	"\x04time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x14\n" +
+	"\x05owner\x18\x04 \x01(\tR\x05owner\x12\x19\n" +
+	"\bimage_id\x18\x05 \x01(\tR\aimageId\x12\x15\n" +
+	"\x06job_id\x18\x06 \x01(\tR\x05jobId\x12,\n" +
+	"\x05image\x18\a \x01(\v2\x14.imageproc.ImageInfoH\x00R\x05image\x127\n" +
+	"\bprogress\x18\b \x01(\v2\x19.imageproc.ProgressUpdateH\x00R\bprogressB\t\n" +
+	"\apayload\"\xc6\x01\n" +
+	"\rRenderRequest\x12\x19\n" +
+	"\bimage_id\x18\x01 \x01(\tR\aimageId\x12\x14\n" +
+	"\x05width\x18\x02 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x03 \x01(\x05R\x06height\x12 \n" +
+	"\x03fit\x18\x04 \x01(\x0e2\x0e.imageproc.FitR\x03fit\x12\x16\n" +
+	"\x06format\x18\x05 \x01(\tR\x06format\x12\x18\n" +
+	"\aquality\x18\x06 \x01(\x05R\aquality\x12\x18\n" +
+	"\afilters\x18\a \x03(\tR\afilters\"t\n" +
+	"\vRenderChunk\x12\x14\n" +
+	"\x05chunk\x18\x01 \x01(\fR\x05chunk\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12\x14\n" +
+	"\x05width\x18\x03 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x04 \x01(\x05R\x06height\"\xc5\x01\n" +
+	"\x0eSignURLRequest\x128\n" +
+	"\toperation\x18\x01 \x01(\x0e2\x1a.imageproc.SignedOperationR\toperation\x12\x19\n" +
+	"\bimage_id\x18\x02 \x01(\tR\aimageId\x12+\n" +
+	"\x03ttl\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\x12\x1b\n" +
+	"\tmax_bytes\x18\x04 \x01(\x03R\bmaxBytes\x12\x14\n" +
+	"\x05query\x18\x05 \x01(\tR\x05query\"v\n" +
+	"\x0fSignURLResponse\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x16\n" +
+	"\x06method\x18\x02 \x01(\tR\x06method\x129\n" +
+	"\n" +
+	"expires_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt*^\n" +
+	"\bPriority\x12\x18\n" +
+	"\x14PRIORITY_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fPRIORITY_LOW\x10\x01\x12\x13\n" +
+	"\x0fPRIORITY_NORMAL\x10\x02\x12\x11\n" +
+	"\rPRIORITY_HIGH\x10\x03*\x9a\x01\n" +
+	"\bJobState\x12\x19\n" +
+	"\x15JOB_STATE_UNSPECIFIED\x10\x00\x12\x14\n" +
+	"\x10JOB_STATE_QUEUED\x10\x01\x12\x15\n" +
+	"\x11JOB_STATE_RUNNING\x10\x02\x12\x17\n" +
+	"\x13JOB_STATE_SUCCEEDED\x10\x03\x12\x14\n" +
+	"\x10JOB_STATE_FAILED\x10\x04\x12\x17\n" +
+	"\x13JOB_STATE_CANCELLED\x10\x05*\xd5\x01\n" +
+	"\tEventType\x12\x1a\n" +
+	"\x16EVENT_TYPE_UNSPECIFIED\x10\x00\x12\x1d\n" +
+	"\x19EVENT_TYPE_IMAGE_UPLOADED\x10\x01\x12\x1c\n" +
+	"\x18EVENT_TYPE_IMAGE_DELETED\x10\x02\x12\x19\n" +
+	"\x15EVENT_TYPE_JOB_QUEUED\x10\x03\x12\x1a\n" +
+	"\x16EVENT_TYPE_JOB_STARTED\x10\x04\x12\x1b\n" +
+	"\x17EVENT_TYPE_JOB_PROGRESS\x10\x05\x12\x1b\n" +
+	"\x17EVENT_TYPE_JOB_FINISHED\x10\x06*E\n" +
+	"\x03Fit\x12\x13\n" +
+	"\x0fFIT_UNSPECIFIED\x10\x00\x12\f\n" +
+	"\bFIT_CLIP\x10\x01\x12\r\n" +
+	"\tFIT_COVER\x10\x02\x12\f\n" +
+	"\bFIT_FILL\x10\x03*\x8c\x01\n" +
+	"\x0fSignedOperation\x12 \n" +
+	"\x1cSIGNED_OPERATION_UNSPECIFIED\x10\x00\x12\x1d\n" +
+	"\x19SIGNED_OPERATION_DOWNLOAD\x10\x01\x12\x1b\n" +
+	"\x17SIGNED_OPERATION_UPLOAD\x10\x02\x12\x1b\n" +
+	"\x17SIGNED_OPERATION_RENDER\x10\x032\xb9\r\n" +
+	"\x0eImageProcessor\x12U\n" +
+	"\n" +
+	"GetVersion\x12\x16.google.protobuf.Empty\x1a\x1a.imageproc.VersionResponse\"\x13\x82\xd3\xe4\x93\x02\r\x12\v/v1/version\x12]\n" +
+	"\x06Upload\x12\x18.imageproc.UploadRequest\x1a\x19.imageproc.UploadResponse\"\x1c\x82\xd3\xe4\x93\x02\x16:\x01*\"\x11/v1/images:upload(\x01\x12n\n" +
+	"\aProcess\x12\x1c.imageproc.ProcessingRequest\x1a\x19.imageproc.ProgressUpdate\"(\x82\xd3\xe4\x93\x02\":\x01*\"\x1d/v1/images/{image_id}/process0\x01\x12;\n" +
+	"\x04Tune\x12\x16.imageproc.TuneRequest\x1a\x17.imageproc.TuneResponse(\x010\x01\x12i\n" +
+	"\bDownload\x12\x1a.imageproc.DownloadRequest\x1a\x18.imageproc.DownloadChunk\"%\x82\xd3\xe4\x93\x02\x1f\x12\x1d/v1/images/{image_id}/content0\x01\x12]\n" +
+	"\n" +
+	"ListImages\x12\x1c.imageproc.ListImagesRequest\x1a\x1d.imageproc.ListImagesResponse\"\x12\x82\xd3\xe4\x93\x02\f\x12\n" +
+	"/v1/images\x12[\n" +
+	"\bGetImage\x12\x1a.imageproc.GetImageRequest\x1a\x14.imageproc.ImageInfo\"\x1d\x82\xd3\xe4\x93\x02\x17\x12\x15/v1/images/{image_id}\x12c\n" +
+	"\vDeleteImage\x12\x1d.imageproc.DeleteImageRequest\x1a\x16.google.protobuf.Empty\"\x1d\x82\xd3\xe4\x93\x02\x17*\x15/v1/images/{image_id}\x12d\n" +
+	"\bWatchJob\x12\x1a.imageproc.WatchJobRequest\x1a\x19.imageproc.ProgressUpdate\"\x1f\x82\xd3\xe4\x93\x02\x19\x12\x17/v1/jobs/{job_id}:watch0\x01\x12M\n" +
+	"\x06GetJob\x12\x18.imageproc.GetJobRequest\x1a\x0e.imageproc.Job\"\x19\x82\xd3\xe4\x93\x02\x13\x12\x11/v1/jobs/{job_id}\x12U\n" +
+	"\bListJobs\x12\x1a.imageproc.ListJobsRequest\x1a\x1b.imageproc.ListJobsResponse\"\x10\x82\xd3\xe4\x93\x02\n" +
+	"\x12\b/v1/jobs\x12k\n" +
+	"\fProcessBatch\x12\x1e.imageproc.ProcessBatchRequest\x1a\x15.imageproc.BatchEvent\"\"\x82\xd3\xe4\x93\x02\x1c:\x01*\"\x17/v1/images:processBatch0\x01\x12q\n" +
+	"\x0fListDeadLetters\x12!.imageproc.ListDeadLettersRequest\x1a\".imageproc.ListDeadLettersResponse\"\x17\x82\xd3\xe4\x93\x02\x11\x12\x0f/v1/deadLetters\x12`\n" +
+	"\n" +
+	"RedriveJob\x12\x1c.imageproc.RedriveJobRequest\x1a\x0e.imageproc.Job\"$\x82\xd3\xe4\x93\x02\x1e:\x01*\"\x19/v1/jobs/{job_id}:redrive\x12<\n" +
+	"\tSubscribe\x12\x1b.imageproc.SubscribeRequest\x1a\x10.imageproc.Event0\x01\x12\x90\x01\n" +
+	"\x15ListWebhookDeliveries\x12'.imageproc.ListWebhookDeliveriesRequest\x1a(.imageproc.ListWebhookDeliveriesResponse\"$\x82\xd3\xe4\x93\x02\x1e\x12\x1c/v1/jobs/{job_id}/deliveries\x12<\n" +
+	"\x06Render\x12\x18.imageproc.RenderRequest\x1a\x16.imageproc.RenderChunk0\x01\x12[\n" +
+	"\aSignURL\x12\x19.imageproc.SignURLRequest\x1a\x1a.imageproc.SignURLResponse\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\"\x0e/v1/signedUrlsB\x18Z\x16image-proc/proto;protob\x06proto3"
+
+var (
+	file_image_proto_rawDescOnce sync.Once
+	file_image_proto_rawDescData []byte
+)
+
+func file_image_proto_rawDescGZIP() []byte {
+	file_image_proto_rawDescOnce.Do(func() {
+		file_image_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_image_proto_rawDesc), len(file_image_proto_rawDesc)))
+	})
+	return file_image_proto_rawDescData
+}
+
+var file_image_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_image_proto_msgTypes = make([]protoimpl.MessageInfo, 36)
+var file_image_proto_goTypes = []any{
+	(Priority)(0),                         // 0: imageproc.Priority
+	(JobState)(0),                         // 1: imageproc.JobState
+	(EventType)(0),                        // 2: imageproc.EventType
+	(Fit)(0),                              // 3: imageproc.Fit
+	(SignedOperation)(0),                  // 4: imageproc.SignedOperation
+	(*VersionResponse)(nil),               // 5: imageproc.VersionResponse
+	(*UploadRequest)(nil),                 // 6: imageproc.UploadRequest
+	(*UploadResponse)(nil),                // 7: imageproc.UploadResponse
+	(*ProcessingRequest)(nil),             // 8: imageproc.ProcessingRequest
+	(*ProgressUpdate)(nil),                // 9: imageproc.ProgressUpdate
+	(*TuneRequest)(nil),                   // 10: imageproc.TuneRequest
+	(*TuneResponse)(nil),                  // 11: imageproc.TuneResponse
+	(*DownloadRequest)(nil),               // 12: imageproc.DownloadRequest
+	(*DownloadChunk)(nil),                 // 13: imageproc.DownloadChunk
+	(*ListImagesRequest)(nil),             // 14: imageproc.ListImagesRequest
+	(*ListImagesResponse)(nil),            // 15: imageproc.ListImagesResponse
+	(*GetImageRequest)(nil),               // 16: imageproc.GetImageRequest
+	(*DeleteImageRequest)(nil),            // 17: imageproc.DeleteImageRequest
+	(*ImageInfo)(nil),                     // 18: imageproc.ImageInfo
+	(*WatchJobRequest)(nil),               // 19: imageproc.WatchJobRequest
+	(*ProcessBatchRequest)(nil),           // 20: imageproc.ProcessBatchRequest
+	(*BatchEvent)(nil),                    // 21: imageproc.BatchEvent
+	(*BatchItemResult)(nil),               // 22: imageproc.BatchItemResult
+	(*BatchSummary)(nil),                  // 23: imageproc.BatchSummary
+	(*Job)(nil),                           // 24: imageproc.Job
+	(*GetJobRequest)(nil),                 // 25: imageproc.GetJobRequest
+	(*ListJobsRequest)(nil),               // 26: imageproc.ListJobsRequest
+	(*ListJobsResponse)(nil),              // 27: imageproc.ListJobsResponse
+	(*ListDeadLettersRequest)(nil),        // 28: imageproc.ListDeadLettersRequest
+	(*ListDeadLettersResponse)(nil),       // 29: imageproc.ListDeadLettersResponse
+	(*DeadLetter)(nil),                    // 30: imageproc.DeadLetter
+	(*RedriveJobRequest)(nil),             // 31: imageproc.RedriveJobRequest
+	(*ListWebhookDeliveriesRequest)(nil),  // 32: imageproc.ListWebhookDeliveriesRequest
+	(*ListWebhookDeliveriesResponse)(nil), // 33: imageproc.ListWebhookDeliveriesResponse
+	(*WebhookDelivery)(nil),               // 34: imageproc.WebhookDelivery
+	(*SubscribeRequest)(nil),              // 35: imageproc.SubscribeRequest
+	(*Event)(nil),                         // 36: imageproc.Event
+	(*RenderRequest)(nil),                 // 37: imageproc.RenderRequest
+	(*RenderChunk)(nil),                   // 38: imageproc.RenderChunk
+	(*SignURLRequest)(nil),                // 39: imageproc.SignURLRequest
+	(*SignURLResponse)(nil),               // 40: imageproc.SignURLResponse
+	(*timestamppb.Timestamp)(nil),         // 41: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),           // 42: google.protobuf.Duration
+	(*emptypb.Empty)(nil),                 // 43: google.protobuf.Empty
+}
+var file_image_proto_depIdxs = []int32{
+	0,  // 0: imageproc.ProcessingRequest.priority:type_name -> imageproc.Priority
+	1,  // 1: imageproc.ProgressUpdate.state:type_name -> imageproc.JobState
+	18, // 2: imageproc.ListImagesResponse.images:type_name -> imageproc.ImageInfo
+	41, // 3: imageproc.ImageInfo.created_at:type_name -> google.protobuf.Timestamp
+	0,  // 4: imageproc.ProcessBatchRequest.priority:type_name -> imageproc.Priority
+	9,  // 5: imageproc.BatchEvent.progress:type_name -> imageproc.ProgressUpdate
+	22, // 6: imageproc.BatchEvent.result:type_name -> imageproc.BatchItemResult
+	23, // 7: imageproc.BatchEvent.summary:type_name -> imageproc.BatchSummary
+	1,  // 8: imageproc.BatchItemResult.state:type_name -> imageproc.JobState
+	22, // 9: imageproc.BatchSummary.failures:type_name -> imageproc.BatchItemResult
+	1,  // 10: imageproc.Job.state:type_name -> imageproc.JobState
+	41, // 11: imageproc.Job.created_at:type_name -> google.protobuf.Timestamp
+	41, // 12: imageproc.Job.updated_at:type_name -> google.protobuf.Timestamp
+	41, // 13: imageproc.Job.finished_at:type_name -> google.protobuf.Timestamp
+	0,  // 14: imageproc.Job.priority:type_name -> imageproc.Priority
+	41, // 15: imageproc.Job.started_at:type_name -> google.protobuf.Timestamp
+	1,  // 16: imageproc.ListJobsRequest.state:type_name -> imageproc.JobState
+	24, // 17: imageproc.ListJobsResponse.jobs:type_name -> imageproc.Job
+	30, // 18: imageproc.ListDeadLettersResponse.dead_letters:type_name -> imageproc.DeadLetter
+	24, // 19: imageproc.DeadLetter.job:type_name -> imageproc.Job
+	41, // 20: imageproc.DeadLetter.dead_lettered_at:type_name -> google.protobuf.Timestamp
+	34, // 21: imageproc.ListWebhookDeliveriesResponse.deliveries:type_name -> imageproc.WebhookDelivery
+	41, // 22: imageproc.WebhookDelivery.sent_at:type_name -> google.protobuf.Timestamp
+	2,  // 23: imageproc.SubscribeRequest.types:type_name -> imageproc.EventType
+	2,  // 24: imageproc.Event.type:type_name -> imageproc.EventType
+	41, // 25: imageproc.Event.time:type_name -> google.protobuf.Timestamp
+	18, // 26: imageproc.Event.image:type_name -> imageproc.ImageInfo
+	9,  // 27: imageproc.Event.progress:type_name -> imageproc.ProgressUpdate
+	3,  // 28: imageproc.RenderRequest.fit:type_name -> imageproc.Fit
+	4,  // 29: imageproc.SignURLRequest.operation:type_name -> imageproc.SignedOperation
+	42, // 30: imageproc.SignURLRequest.ttl:type_name -> google.protobuf.Duration
+	41, // 31: imageproc.SignURLResponse.expires_at:type_name -> google.protobuf.Timestamp
+	43, // 32: imageproc.ImageProcessor.GetVersion:input_type -> google.protobuf.Empty
+	6,  // 33: imageproc.ImageProcessor.Upload:input_type -> imageproc.UploadRequest
+	8,  // 34: imageproc.ImageProcessor.Process:input_type -> imageproc.ProcessingRequest
+	10, // 35: imageproc.ImageProcessor.Tune:input_type -> imageproc.TuneRequest
+	12, // 36: imageproc.ImageProcessor.Download:input_type -> imageproc.DownloadRequest
+	14, // 37: imageproc.ImageProcessor.ListImages:input_type -> imageproc.ListImagesRequest
+	16, // 38: imageproc.ImageProcessor.GetImage:input_type -> imageproc.GetImageRequest
+	17, // 39: imageproc.ImageProcessor.DeleteImage:input_type -> imageproc.DeleteImageRequest
+	19, // 40: imageproc.ImageProcessor.WatchJob:input_type -> imageproc.WatchJobRequest
+	25, // 41: imageproc.ImageProcessor.GetJob:input_type -> imageproc.GetJobRequest
+	26, // 42: imageproc.ImageProcessor.ListJobs:input_type -> imageproc.ListJobsRequest
+	20, // 43: imageproc.ImageProcessor.ProcessBatch:input_type -> imageproc.ProcessBatchRequest
+	28, // 44: imageproc.ImageProcessor.ListDeadLetters:input_type -> imageproc.ListDeadLettersRequest
+	31, // 45: imageproc.ImageProcessor.RedriveJob:input_type -> imageproc.RedriveJobRequest
+	35, // 46: imageproc.ImageProcessor.Subscribe:input_type -> imageproc.SubscribeRequest
+	32, // 47: imageproc.ImageProcessor.ListWebhookDeliveries:input_type -> imageproc.ListWebhookDeliveriesRequest
+	37, // 48: imageproc.ImageProcessor.Render:input_type -> imageproc.RenderRequest
+	39, // 49: imageproc.ImageProcessor.SignURL:input_type -> imageproc.SignURLRequest
+	5,  // 50: imageproc.ImageProcessor.GetVersion:output_type -> imageproc.VersionResponse
+	7,  // 51: imageproc.ImageProcessor.Upload:output_type -> imageproc.UploadResponse
+	9,  // 52: imageproc.ImageProcessor.Process:output_type -> imageproc.ProgressUpdate
+	11, // 53: imageproc.ImageProcessor.Tune:output_type -> imageproc.TuneResponse
+	13, // 54: imageproc.ImageProcessor.Download:output_type -> imageproc.DownloadChunk
+	15, // 55: imageproc.ImageProcessor.ListImages:output_type -> imageproc.ListImagesResponse
+	18, // 56: imageproc.ImageProcessor.GetImage:output_type -> imageproc.ImageInfo
+	43, // 57: imageproc.ImageProcessor.DeleteImage:output_type -> google.protobuf.Empty
+	9,  // 58: imageproc.ImageProcessor.WatchJob:output_type -> imageproc.ProgressUpdate
+	24, // 59: imageproc.ImageProcessor.GetJob:output_type -> imageproc.Job
+	27, // 60: imageproc.ImageProcessor.ListJobs:output_type -> imageproc.ListJobsResponse
+	21, // 61: imageproc.ImageProcessor.ProcessBatch:output_type -> imageproc.BatchEvent
+	29, // 62: imageproc.ImageProcessor.ListDeadLetters:output_type -> imageproc.ListDeadLettersResponse
+	24, // 63: imageproc.ImageProcessor.RedriveJob:output_type -> imageproc.Job
+	36, // 64: imageproc.ImageProcessor.Subscribe:output_type -> imageproc.Event
+	33, // 65: imageproc.ImageProcessor.ListWebhookDeliveries:output_type -> imageproc.ListWebhookDeliveriesResponse
+	38, // 66: imageproc.ImageProcessor.Render:output_type -> imageproc.RenderChunk
+	40, // 67: imageproc.ImageProcessor.SignURL:output_type -> imageproc.SignURLResponse
+	50, // [50:68] is the sub-list for method output_type
+	32, // [32:50] is the sub-list for method input_type
+	32, // [32:32] is the sub-list for extension type_name
+	32, // [32:32] is the sub-list for extension extendee
+	0,  // [0:32] is the sub-list for field type_name
+}
+
+func init() { file_image_proto_init() }
+func file_image_proto_init() {
+	if File_image_proto != nil {
+		return
+	}
+	file_image_proto_msgTypes[16].OneofWrappers = []any{
+		(*BatchEvent_Progress)(nil),
+		(*BatchEvent_Result)(nil),
+		(*BatchEvent_Summary)(nil),
+	}
+	file_image_proto_msgTypes[31].OneofWrappers = []any{
+		(*Event_Image)(nil),
+		(*Event_Progress)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_image_proto_rawDesc), len(file_image_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   7,
+			NumEnums:      5,
+			NumMessages:   36,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_image_proto_goTypes,
 		DependencyIndexes: file_image_proto_depIdxs,
+		EnumInfos:         file_image_proto_enumTypes,
 		MessageInfos:      file_image_proto_msgTypes,
 	}.Build()
 	File_image_proto = out.File
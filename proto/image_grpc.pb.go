@@ -20,10 +20,24 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ImageProcessor_GetVersion_FullMethodName = "/imageproc.ImageProcessor/GetVersion"
-	ImageProcessor_Upload_FullMethodName     = "/imageproc.ImageProcessor/Upload"
-	ImageProcessor_Process_FullMethodName    = "/imageproc.ImageProcessor/Process"
-	ImageProcessor_Tune_FullMethodName       = "/imageproc.ImageProcessor/Tune"
+	ImageProcessor_GetVersion_FullMethodName            = "/imageproc.ImageProcessor/GetVersion"
+	ImageProcessor_Upload_FullMethodName                = "/imageproc.ImageProcessor/Upload"
+	ImageProcessor_Process_FullMethodName               = "/imageproc.ImageProcessor/Process"
+	ImageProcessor_Tune_FullMethodName                  = "/imageproc.ImageProcessor/Tune"
+	ImageProcessor_Download_FullMethodName              = "/imageproc.ImageProcessor/Download"
+	ImageProcessor_ListImages_FullMethodName            = "/imageproc.ImageProcessor/ListImages"
+	ImageProcessor_GetImage_FullMethodName              = "/imageproc.ImageProcessor/GetImage"
+	ImageProcessor_DeleteImage_FullMethodName           = "/imageproc.ImageProcessor/DeleteImage"
+	ImageProcessor_WatchJob_FullMethodName              = "/imageproc.ImageProcessor/WatchJob"
+	ImageProcessor_GetJob_FullMethodName                = "/imageproc.ImageProcessor/GetJob"
+	ImageProcessor_ListJobs_FullMethodName              = "/imageproc.ImageProcessor/ListJobs"
+	ImageProcessor_ProcessBatch_FullMethodName          = "/imageproc.ImageProcessor/ProcessBatch"
+	ImageProcessor_ListDeadLetters_FullMethodName       = "/imageproc.ImageProcessor/ListDeadLetters"
+	ImageProcessor_RedriveJob_FullMethodName            = "/imageproc.ImageProcessor/RedriveJob"
+	ImageProcessor_Subscribe_FullMethodName             = "/imageproc.ImageProcessor/Subscribe"
+	ImageProcessor_ListWebhookDeliveries_FullMethodName = "/imageproc.ImageProcessor/ListWebhookDeliveries"
+	ImageProcessor_Render_FullMethodName                = "/imageproc.ImageProcessor/Render"
+	ImageProcessor_SignURL_FullMethodName               = "/imageproc.ImageProcessor/SignURL"
 )
 
 // ImageProcessorClient is the client API for ImageProcessor service.
@@ -40,6 +54,51 @@ type ImageProcessorClient interface {
 	Process(ctx context.Context, in *ProcessingRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressUpdate], error)
 	// Phase 4: Bidirectional “Tune”
 	Tune(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TuneRequest, TuneResponse], error)
+	// Server-streaming download of a stored image, or of the byte range
+	// offset and length select
+	Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadChunk], error)
+	// Lists stored images
+	ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error)
+	// Returns metadata for one image
+	GetImage(ctx context.Context, in *GetImageRequest, opts ...grpc.CallOption) (*ImageInfo, error)
+	// Removes an image and its metadata
+	DeleteImage(ctx context.Context, in *DeleteImageRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Streams progress of a job started by Process until it finishes
+	WatchJob(ctx context.Context, in *WatchJobRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressUpdate], error)
+	// Returns the persisted state of a job, including finished ones
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// Lists jobs, newest first
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// Applies one filter chain to many images, streaming per-image
+	// progress and results interleaved, then a summary. Images that fail
+	// are reported in the summary instead of failing the call.
+	ProcessBatch(ctx context.Context, in *ProcessBatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BatchEvent], error)
+	// Lists jobs that failed for good, either permanently or after
+	// running out of retries, newest first
+	ListDeadLetters(ctx context.Context, in *ListDeadLettersRequest, opts ...grpc.CallOption) (*ListDeadLettersResponse, error)
+	// Runs a dead-lettered job again from the start under the same job
+	// ID and removes it from the dead letters. The job runs in the
+	// background; follow it with WatchJob.
+	RedriveJob(ctx context.Context, in *RedriveJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// Streams image and job lifecycle events as they happen. A subscriber
+	// that reconnects with the cursor of the last event it saw first gets
+	// the events it missed, as long as the server still holds them. The
+	// gateway serves this stream as Server-Sent Events at GET /v1/events.
+	// Once the subscription is accepted the server sends the
+	// "x-subscription-cursor" header: the cursor the stream starts after.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// Lists the attempts to deliver a job's completion webhook, oldest first
+	ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error)
+	// Renders a stored image resized, re-encoded and filtered as requested
+	// and streams the result back without storing it. The gateway serves
+	// this at GET /v1/images/{image_id}/render with imgix-style query
+	// parameters.
+	Render(ctx context.Context, in *RenderRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RenderChunk], error)
+	// Issues a time-limited URL through which a holder without credentials
+	// may download one image, or upload one, through the gateway on the
+	// caller's behalf. The URL is signed with HMAC-SHA256; expired or
+	// altered URLs are refused.
+	SignURL(ctx context.Context, in *SignURLRequest, opts ...grpc.CallOption) (*SignURLResponse, error)
 }
 
 type imageProcessorClient struct {
@@ -105,6 +164,191 @@ func (c *imageProcessorClient) Tune(ctx context.Context, opts ...grpc.CallOption
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ImageProcessor_TuneClient = grpc.BidiStreamingClient[TuneRequest, TuneResponse]
 
+func (c *imageProcessorClient) Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageProcessor_ServiceDesc.Streams[3], ImageProcessor_Download_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadRequest, DownloadChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_DownloadClient = grpc.ServerStreamingClient[DownloadChunk]
+
+func (c *imageProcessorClient) ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListImagesResponse)
+	err := c.cc.Invoke(ctx, ImageProcessor_ListImages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorClient) GetImage(ctx context.Context, in *GetImageRequest, opts ...grpc.CallOption) (*ImageInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImageInfo)
+	err := c.cc.Invoke(ctx, ImageProcessor_GetImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorClient) DeleteImage(ctx context.Context, in *DeleteImageRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, ImageProcessor_DeleteImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorClient) WatchJob(ctx context.Context, in *WatchJobRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageProcessor_ServiceDesc.Streams[4], ImageProcessor_WatchJob_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchJobRequest, ProgressUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_WatchJobClient = grpc.ServerStreamingClient[ProgressUpdate]
+
+func (c *imageProcessorClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, ImageProcessor_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, ImageProcessor_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorClient) ProcessBatch(ctx context.Context, in *ProcessBatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageProcessor_ServiceDesc.Streams[5], ImageProcessor_ProcessBatch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ProcessBatchRequest, BatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_ProcessBatchClient = grpc.ServerStreamingClient[BatchEvent]
+
+func (c *imageProcessorClient) ListDeadLetters(ctx context.Context, in *ListDeadLettersRequest, opts ...grpc.CallOption) (*ListDeadLettersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDeadLettersResponse)
+	err := c.cc.Invoke(ctx, ImageProcessor_ListDeadLetters_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorClient) RedriveJob(ctx context.Context, in *RedriveJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, ImageProcessor_RedriveJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageProcessor_ServiceDesc.Streams[6], ImageProcessor_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_SubscribeClient = grpc.ServerStreamingClient[Event]
+
+func (c *imageProcessorClient) ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWebhookDeliveriesResponse)
+	err := c.cc.Invoke(ctx, ImageProcessor_ListWebhookDeliveries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageProcessorClient) Render(ctx context.Context, in *RenderRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RenderChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageProcessor_ServiceDesc.Streams[7], ImageProcessor_Render_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RenderRequest, RenderChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_RenderClient = grpc.ServerStreamingClient[RenderChunk]
+
+func (c *imageProcessorClient) SignURL(ctx context.Context, in *SignURLRequest, opts ...grpc.CallOption) (*SignURLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SignURLResponse)
+	err := c.cc.Invoke(ctx, ImageProcessor_SignURL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ImageProcessorServer is the server API for ImageProcessor service.
 // All implementations must embed UnimplementedImageProcessorServer
 // for forward compatibility.
@@ -119,6 +363,51 @@ type ImageProcessorServer interface {
 	Process(*ProcessingRequest, grpc.ServerStreamingServer[ProgressUpdate]) error
 	// Phase 4: Bidirectional “Tune”
 	Tune(grpc.BidiStreamingServer[TuneRequest, TuneResponse]) error
+	// Server-streaming download of a stored image, or of the byte range
+	// offset and length select
+	Download(*DownloadRequest, grpc.ServerStreamingServer[DownloadChunk]) error
+	// Lists stored images
+	ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error)
+	// Returns metadata for one image
+	GetImage(context.Context, *GetImageRequest) (*ImageInfo, error)
+	// Removes an image and its metadata
+	DeleteImage(context.Context, *DeleteImageRequest) (*emptypb.Empty, error)
+	// Streams progress of a job started by Process until it finishes
+	WatchJob(*WatchJobRequest, grpc.ServerStreamingServer[ProgressUpdate]) error
+	// Returns the persisted state of a job, including finished ones
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// Lists jobs, newest first
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// Applies one filter chain to many images, streaming per-image
+	// progress and results interleaved, then a summary. Images that fail
+	// are reported in the summary instead of failing the call.
+	ProcessBatch(*ProcessBatchRequest, grpc.ServerStreamingServer[BatchEvent]) error
+	// Lists jobs that failed for good, either permanently or after
+	// running out of retries, newest first
+	ListDeadLetters(context.Context, *ListDeadLettersRequest) (*ListDeadLettersResponse, error)
+	// Runs a dead-lettered job again from the start under the same job
+	// ID and removes it from the dead letters. The job runs in the
+	// background; follow it with WatchJob.
+	RedriveJob(context.Context, *RedriveJobRequest) (*Job, error)
+	// Streams image and job lifecycle events as they happen. A subscriber
+	// that reconnects with the cursor of the last event it saw first gets
+	// the events it missed, as long as the server still holds them. The
+	// gateway serves this stream as Server-Sent Events at GET /v1/events.
+	// Once the subscription is accepted the server sends the
+	// "x-subscription-cursor" header: the cursor the stream starts after.
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Event]) error
+	// Lists the attempts to deliver a job's completion webhook, oldest first
+	ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error)
+	// Renders a stored image resized, re-encoded and filtered as requested
+	// and streams the result back without storing it. The gateway serves
+	// this at GET /v1/images/{image_id}/render with imgix-style query
+	// parameters.
+	Render(*RenderRequest, grpc.ServerStreamingServer[RenderChunk]) error
+	// Issues a time-limited URL through which a holder without credentials
+	// may download one image, or upload one, through the gateway on the
+	// caller's behalf. The URL is signed with HMAC-SHA256; expired or
+	// altered URLs are refused.
+	SignURL(context.Context, *SignURLRequest) (*SignURLResponse, error)
 	mustEmbedUnimplementedImageProcessorServer()
 }
 
@@ -141,6 +430,48 @@ func (UnimplementedImageProcessorServer) Process(*ProcessingRequest, grpc.Server
 func (UnimplementedImageProcessorServer) Tune(grpc.BidiStreamingServer[TuneRequest, TuneResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method Tune not implemented")
 }
+func (UnimplementedImageProcessorServer) Download(*DownloadRequest, grpc.ServerStreamingServer[DownloadChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Download not implemented")
+}
+func (UnimplementedImageProcessorServer) ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListImages not implemented")
+}
+func (UnimplementedImageProcessorServer) GetImage(context.Context, *GetImageRequest) (*ImageInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetImage not implemented")
+}
+func (UnimplementedImageProcessorServer) DeleteImage(context.Context, *DeleteImageRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteImage not implemented")
+}
+func (UnimplementedImageProcessorServer) WatchJob(*WatchJobRequest, grpc.ServerStreamingServer[ProgressUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchJob not implemented")
+}
+func (UnimplementedImageProcessorServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedImageProcessorServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedImageProcessorServer) ProcessBatch(*ProcessBatchRequest, grpc.ServerStreamingServer[BatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method ProcessBatch not implemented")
+}
+func (UnimplementedImageProcessorServer) ListDeadLetters(context.Context, *ListDeadLettersRequest) (*ListDeadLettersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDeadLetters not implemented")
+}
+func (UnimplementedImageProcessorServer) RedriveJob(context.Context, *RedriveJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RedriveJob not implemented")
+}
+func (UnimplementedImageProcessorServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedImageProcessorServer) ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookDeliveries not implemented")
+}
+func (UnimplementedImageProcessorServer) Render(*RenderRequest, grpc.ServerStreamingServer[RenderChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Render not implemented")
+}
+func (UnimplementedImageProcessorServer) SignURL(context.Context, *SignURLRequest) (*SignURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SignURL not implemented")
+}
 func (UnimplementedImageProcessorServer) mustEmbedUnimplementedImageProcessorServer() {}
 func (UnimplementedImageProcessorServer) testEmbeddedByValue()                        {}
 
@@ -205,6 +536,223 @@ func _ImageProcessor_Tune_Handler(srv interface{}, stream grpc.ServerStream) err
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ImageProcessor_TuneServer = grpc.BidiStreamingServer[TuneRequest, TuneResponse]
 
+func _ImageProcessor_Download_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageProcessorServer).Download(m, &grpc.GenericServerStream[DownloadRequest, DownloadChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_DownloadServer = grpc.ServerStreamingServer[DownloadChunk]
+
+func _ImageProcessor_ListImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListImagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).ListImages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_ListImages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).ListImages(ctx, req.(*ListImagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessor_GetImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).GetImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_GetImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).GetImage(ctx, req.(*GetImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessor_DeleteImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).DeleteImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_DeleteImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).DeleteImage(ctx, req.(*DeleteImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessor_WatchJob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchJobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageProcessorServer).WatchJob(m, &grpc.GenericServerStream[WatchJobRequest, ProgressUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_WatchJobServer = grpc.ServerStreamingServer[ProgressUpdate]
+
+func _ImageProcessor_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessor_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessor_ProcessBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ProcessBatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageProcessorServer).ProcessBatch(m, &grpc.GenericServerStream[ProcessBatchRequest, BatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_ProcessBatchServer = grpc.ServerStreamingServer[BatchEvent]
+
+func _ImageProcessor_ListDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDeadLettersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).ListDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_ListDeadLetters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).ListDeadLetters(ctx, req.(*ListDeadLettersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessor_RedriveJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RedriveJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).RedriveJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_RedriveJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).RedriveJob(ctx, req.(*RedriveJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessor_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageProcessorServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_SubscribeServer = grpc.ServerStreamingServer[Event]
+
+func _ImageProcessor_ListWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookDeliveriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).ListWebhookDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_ListWebhookDeliveries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).ListWebhookDeliveries(ctx, req.(*ListWebhookDeliveriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageProcessor_Render_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RenderRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageProcessorServer).Render(m, &grpc.GenericServerStream[RenderRequest, RenderChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageProcessor_RenderServer = grpc.ServerStreamingServer[RenderChunk]
+
+func _ImageProcessor_SignURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageProcessorServer).SignURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageProcessor_SignURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageProcessorServer).SignURL(ctx, req.(*SignURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ImageProcessor_ServiceDesc is the grpc.ServiceDesc for ImageProcessor service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -216,6 +764,42 @@ var ImageProcessor_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetVersion",
 			Handler:    _ImageProcessor_GetVersion_Handler,
 		},
+		{
+			MethodName: "ListImages",
+			Handler:    _ImageProcessor_ListImages_Handler,
+		},
+		{
+			MethodName: "GetImage",
+			Handler:    _ImageProcessor_GetImage_Handler,
+		},
+		{
+			MethodName: "DeleteImage",
+			Handler:    _ImageProcessor_DeleteImage_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _ImageProcessor_GetJob_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _ImageProcessor_ListJobs_Handler,
+		},
+		{
+			MethodName: "ListDeadLetters",
+			Handler:    _ImageProcessor_ListDeadLetters_Handler,
+		},
+		{
+			MethodName: "RedriveJob",
+			Handler:    _ImageProcessor_RedriveJob_Handler,
+		},
+		{
+			MethodName: "ListWebhookDeliveries",
+			Handler:    _ImageProcessor_ListWebhookDeliveries_Handler,
+		},
+		{
+			MethodName: "SignURL",
+			Handler:    _ImageProcessor_SignURL_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -234,6 +818,31 @@ var ImageProcessor_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Download",
+			Handler:       _ImageProcessor_Download_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchJob",
+			Handler:       _ImageProcessor_WatchJob_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ProcessBatch",
+			Handler:       _ImageProcessor_ProcessBatch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _ImageProcessor_Subscribe_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Render",
+			Handler:       _ImageProcessor_Render_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "image.proto",
 }
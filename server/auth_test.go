@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	pb "image-proc/proto"
+	"image/png"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var testTokens = map[string]string{"alice-token": "alice", "bob-token": "bob"}
+
+// withToken returns ctx sending token as a bearer token
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// uploadPNG uploads a small PNG in one chunk and returns its ID
+func uploadPNG(ctx context.Context, t *testing.T, client pb.ImageProcessorClient) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.Upload(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := stream.Send(&pb.UploadRequest{Chunk: buf.Bytes()}); err != nil {
+		return "", err
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	return resp.ImageId, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens map[string]string
+		header []string
+		want   string
+		code   codes.Code
+	}{
+		{name: "no tokens configured", want: anonymousPrincipal},
+		{name: "no tokens configured ignores the header", header: []string{"Bearer whatever"}, want: anonymousPrincipal},
+		{name: "valid", tokens: testTokens, header: []string{"Bearer alice-token"}, want: "alice"},
+		{name: "other token", tokens: testTokens, header: []string{"Bearer bob-token"}, want: "bob"},
+		{name: "missing", tokens: testTokens, code: codes.Unauthenticated},
+		{name: "unknown", tokens: testTokens, header: []string{"Bearer nope"}, code: codes.Unauthenticated},
+		{name: "other scheme", tokens: testTokens, header: []string{"Basic YWxpY2U6"}, code: codes.Unauthenticated},
+		{name: "bare token", tokens: testTokens, header: []string{"alice-token"}, code: codes.Unauthenticated},
+		{name: "lowercase scheme", tokens: testTokens, header: []string{"bearer alice-token"}, code: codes.Unauthenticated},
+		{name: "empty token", tokens: testTokens, header: []string{"Bearer "}, code: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authenticator{tokens: tt.tokens}
+			ctx := context.Background()
+			if tt.header != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.MD{"authorization": tt.header})
+			}
+			got, err := a.authenticate(ctx)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("authenticate = %q, %v; want %s", got, err, tt.code)
+			}
+			if got != tt.want {
+				t.Errorf("authenticate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicMethod(t *testing.T) {
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{method: healthpb.Health_Check_FullMethodName, want: true},
+		{method: healthpb.Health_Watch_FullMethodName, want: true},
+		{method: reflectionpb.ServerReflection_ServerReflectionInfo_FullMethodName, want: true},
+		{method: "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", want: true},
+		{method: pb.ImageProcessor_GetVersion_FullMethodName, want: false},
+		{method: pb.ImageProcessor_Upload_FullMethodName, want: false},
+		{method: "/grpc.health.v1.HealthEvil/Check", want: false},
+	}
+	for _, tt := range tests {
+		if got := isPublicMethod(tt.method); got != tt.want {
+			t.Errorf("isPublicMethod(%q) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	s := newTestServer(t)
+	s.authRequired = true
+	conn := dial(t, s, &authenticator{tokens: testTokens})
+	client := pb.NewImageProcessorClient(conn)
+	ctx := context.Background()
+
+	// unary and streaming calls both need a token
+	if _, err := client.GetVersion(ctx, &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("GetVersion without a token = %v, want %s", err, codes.Unauthenticated)
+	}
+	if _, err := client.GetVersion(withToken(ctx, "nope"), &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("GetVersion with an unknown token = %v, want %s", err, codes.Unauthenticated)
+	}
+	if _, err := uploadPNG(ctx, t, client); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Upload without a token = %v, want %s", err, codes.Unauthenticated)
+	}
+	if entries, _ := os.ReadDir(s.store.dir); len(entries) != 0 {
+		t.Errorf("unauthenticated upload left %d files", len(entries))
+	}
+
+	// probes and tooling do not
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("health check without a token: %v", err)
+	}
+	refl, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := refl.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refl.Recv(); err != nil {
+		t.Errorf("reflection without a token: %v", err)
+	}
+
+	// the principal a token maps to reaches the handlers of both kinds
+	alice := withToken(ctx, "alice-token")
+	id, err := uploadPNG(alice, t, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.GetImage(alice, &pb.GetImageRequest{ImageId: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Owner != "alice" {
+		t.Errorf("uploaded image owned by %q, want alice", info.Owner)
+	}
+	bob := withToken(ctx, "bob-token")
+	if _, err := client.GetImage(bob, &pb.GetImageRequest{ImageId: id}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("GetImage of alice's image as bob = %v, want %s", err, codes.PermissionDenied)
+	}
+	list, err := client.ListImages(bob, &pb.ListImagesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Images) != 0 {
+		t.Errorf("bob lists %d images, want none of alice's", len(list.Images))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	pb "image-proc/proto"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// batchEventBuffer lets workers run ahead of a slow stream a little
+const batchEventBuffer = 64
+
+// ProcessBatch applies one filter chain to many images. Every image runs
+// as its own job on the shared worker pool; the call only fails as a whole
+// for a bad request or when the caller goes away.
+func (s *server) ProcessBatch(req *pb.ProcessBatchRequest, stream pb.ImageProcessor_ProcessBatchServer) error {
+	ctx := stream.Context()
+	if len(req.ImageIds) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one image id is required")
+	}
+	if len(req.ImageIds) > s.maxBatch {
+		return status.Errorf(codes.InvalidArgument, "batch of %d images exceeds the limit of %d", len(req.ImageIds), s.maxBatch)
+	}
+	if err := validateFilters(req.Filters); err != nil {
+		return err
+	}
+
+	batchID := uuid.New().String()
+	addLogFields(ctx, "batch_id", batchID)
+	ctx, span := tracer.Start(ctx, "batch", trace.WithAttributes(
+		attribute.String("batch.id", batchID),
+		attribute.Int("batch.images", len(req.ImageIds)),
+	))
+	defer span.End()
+	s.log(ctx).Infow("batch started", "images", len(req.ImageIds), "filters", req.Filters)
+
+	// workers hand events to this goroutine, the only one calling Send
+	events := make(chan *pb.BatchEvent, batchEventBuffer)
+	items := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(len(req.ImageIds), s.workers.size); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range items {
+				events <- s.batchItem(ctx, batchID, id, req.Filters, req.Priority, events)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+	go func() {
+		defer close(items)
+		for _, id := range req.ImageIds {
+			select {
+			case items <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	summary := &pb.BatchSummary{}
+	var sendErr error
+	for ev := range events {
+		if res := ev.GetResult(); res != nil {
+			summary.Total++
+			switch res.State {
+			case pb.JobState_JOB_STATE_SUCCEEDED:
+				summary.Succeeded++
+			case pb.JobState_JOB_STATE_CANCELLED:
+				summary.Cancelled++
+				summary.Failures = append(summary.Failures, res)
+			default:
+				summary.Failed++
+				summary.Failures = append(summary.Failures, res)
+			}
+		}
+		// after a failed send keep draining so the workers can finish
+		if sendErr == nil {
+			if err := stream.Send(ev); err != nil {
+				sendErr = status.Errorf(codes.Internal, "send error: %v", err)
+			}
+		}
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+
+	s.log(ctx).Infow("batch completed", "succeeded", summary.Succeeded, "failed", summary.Failed, "cancelled", summary.Cancelled)
+	span.SetAttributes(attribute.Int("batch.failed", int(summary.Failed+summary.Cancelled)))
+	return stream.Send(&pb.BatchEvent{BatchId: batchID, Event: &pb.BatchEvent_Summary{Summary: summary}})
+}
+
+// batchItem runs one image of a batch, forwarding its progress to events,
+// and returns the event carrying its result
+func (s *server) batchItem(ctx context.Context, batchID, imageID string, filters []string, priority pb.Priority, events chan<- *pb.BatchEvent) *pb.BatchEvent {
+	result := &pb.BatchItemResult{ImageId: imageID}
+	event := &pb.BatchEvent{BatchId: batchID, ImageId: imageID, Event: &pb.BatchEvent_Result{Result: result}}
+	fail := func(err error) *pb.BatchEvent {
+		result.State = pb.JobState_JOB_STATE_FAILED
+		if ctx.Err() != nil {
+			result.State = pb.JobState_JOB_STATE_CANCELLED
+		}
+		st := status.Convert(err)
+		result.Code, result.Error = int32(st.Code()), st.Message()
+		return event
+	}
+
+	if _, err := s.ownedImage(ctx, imageID); err != nil {
+		return fail(err)
+	}
+	j := s.jobs.create(imageID, filters, principalFromContext(ctx), priority, "")
+	defer s.jobs.finish(j)
+	result.JobId = j.id
+
+	send := func(upd *pb.ProgressUpdate) error {
+		ev := &pb.BatchEvent{BatchId: batchID, ImageId: imageID, Event: &pb.BatchEvent_Progress{Progress: upd}}
+		select {
+		case events <- ev:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := send(j.update(pb.JobState_JOB_STATE_QUEUED, 0, "queued")); err != nil {
+		j.end(pb.JobState_JOB_STATE_CANCELLED, "client went away")
+		return fail(err)
+	}
+	if err := s.execute(ctx, j, send); err != nil {
+		s.log(ctx).Warnw("batch image failed", "image_id", imageID, "job_id", j.id, "error", err)
+		return fail(err)
+	}
+	last := j.latest()
+	result.State, result.ResultImageId = last.State, last.ResultImageId
+	return event
+}
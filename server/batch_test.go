@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"image"
+	pb "image-proc/proto"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runBatch runs a ProcessBatch call to its end and returns its events
+func runBatch(ctx context.Context, client pb.ImageProcessorClient, req *pb.ProcessBatchRequest) ([]*pb.BatchEvent, error) {
+	stream, err := client.ProcessBatch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var events []*pb.BatchEvent
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestProcessBatch(t *testing.T) {
+	s := newTestServer(t)
+	s.maxBatch = 10
+	client := serve(t, s)
+	mine := []string{storeTestImage(t, s), storeTestImage(t, s)}
+	bobs, err := s.store.save(context.Background(), image.NewNRGBA(image.Rect(0, 0, 4, 4)), "png", "bob", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := "0123456789abcdef0123456789abcdef"
+
+	events, err := runBatch(context.Background(), client, &pb.ProcessBatchRequest{
+		ImageIds: []string{mine[0], missing, mine[1], bobs.ID},
+		Filters:  []string{"invert"},
+	})
+	if err != nil {
+		t.Fatalf("ProcessBatch = %v, want the batch to finish despite failures", err)
+	}
+
+	batchID := events[0].BatchId
+	results := map[string]*pb.BatchItemResult{}
+	progress := map[string]int{}
+	for i, ev := range events {
+		if ev.BatchId != batchID {
+			t.Errorf("event %d is for batch %q, want %q", i, ev.BatchId, batchID)
+		}
+		switch {
+		case ev.GetProgress() != nil:
+			if results[ev.ImageId] != nil {
+				t.Errorf("progress for %s after its result", ev.ImageId)
+			}
+			progress[ev.ImageId]++
+		case ev.GetResult() != nil:
+			results[ev.ImageId] = ev.GetResult()
+		case ev.GetSummary() != nil && i != len(events)-1:
+			t.Errorf("summary is event %d of %d, want it last", i, len(events))
+		}
+	}
+
+	for _, id := range mine {
+		res := results[id]
+		if res == nil || res.State != pb.JobState_JOB_STATE_SUCCEEDED || res.ResultImageId == "" || res.JobId == "" {
+			t.Errorf("result for %s = %v, want a succeeded job", id, res)
+		}
+		if progress[id] == 0 {
+			t.Errorf("no progress for %s", id)
+		}
+	}
+	for id, code := range map[string]codes.Code{missing: codes.NotFound, bobs.ID: codes.PermissionDenied} {
+		res := results[id]
+		if res == nil || res.State != pb.JobState_JOB_STATE_FAILED || codes.Code(res.Code) != code || res.Error == "" || res.JobId != "" {
+			t.Errorf("result for %s = %v, want it refused with %s before a job started", id, res, code)
+		}
+		if progress[id] != 0 {
+			t.Errorf("got progress for refused image %s", id)
+		}
+	}
+
+	summary := events[len(events)-1].GetSummary()
+	if summary == nil {
+		t.Fatalf("last event %v, want the summary", events[len(events)-1])
+	}
+	if summary.Total != 4 || summary.Succeeded != 2 || summary.Failed != 2 || summary.Cancelled != 0 {
+		t.Errorf("summary = %v, want 4 total, 2 succeeded, 2 failed", summary)
+	}
+	failed := map[string]bool{}
+	for _, f := range summary.Failures {
+		failed[f.ImageId] = true
+	}
+	if len(summary.Failures) != 2 || !failed[missing] || !failed[bobs.ID] {
+		t.Errorf("summary failures = %v, want the missing and the foreign image", summary.Failures)
+	}
+}
+
+func TestProcessBatchRefused(t *testing.T) {
+	s := newTestServer(t)
+	s.maxBatch = 3
+	client := serve(t, s)
+	imageID := storeTestImage(t, s)
+
+	tests := []struct {
+		name string
+		req  *pb.ProcessBatchRequest
+	}{
+		{name: "no images", req: &pb.ProcessBatchRequest{}},
+		{name: "over the limit", req: &pb.ProcessBatchRequest{ImageIds: []string{imageID, imageID, imageID, imageID}}},
+		{name: "unknown filter", req: &pb.ProcessBatchRequest{ImageIds: []string{imageID}, Filters: []string{"sepia"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := runBatch(context.Background(), client, tt.req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("ProcessBatch = %v, want %s", err, codes.InvalidArgument)
+			}
+			if len(events) != 0 {
+				t.Errorf("got %d events before the refusal", len(events))
+			}
+		})
+	}
+
+	// the limit itself is allowed
+	events, err := runBatch(context.Background(), client, &pb.ProcessBatchRequest{ImageIds: []string{imageID, imageID, imageID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary := events[len(events)-1].GetSummary(); summary == nil || summary.Succeeded != 3 {
+		t.Errorf("batch at the limit ended with %v, want 3 succeeded", events[len(events)-1])
+	}
+}
+
+func TestProcessBatchCancelled(t *testing.T) {
+	s := newTestServer(t)
+	s.maxBatch = 10
+	s.workers = newWorkerPool(1, schedulingPolicy{}, s.metrics)
+	client := serve(t, s)
+	ids := []string{storeTestImage(t, s), storeTestImage(t, s), storeTestImage(t, s)}
+
+	// with the only worker taken the batch's first job waits in the queue
+	release, err := s.workers.acquire(context.Background(), workTicket{principal: "other"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.ProcessBatch(ctx, &pb.ProcessBatchRequest{ImageIds: ids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	upd := ev.GetProgress()
+	if upd == nil || upd.State != pb.JobState_JOB_STATE_QUEUED {
+		t.Fatalf("first event %v, want the first job queued", ev)
+	}
+
+	cancel()
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("Recv after cancelling = %v, want %s", err, codes.Canceled)
+	}
+	// the queued job is cancelled and the rest never start
+	waitFor(t, func() bool {
+		r, err := s.jobs.lookup(upd.JobId)
+		return err == nil && r != nil && r.state() == pb.JobState_JOB_STATE_CANCELLED
+	})
+	records, err := s.jobs.store.scan(func(*jobRecord) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Errorf("%d jobs were created, want only the queued one", len(records))
+	}
+	if n := s.workers.queueDepth(); n != 0 {
+		t.Errorf("%d jobs still queued after the batch was cancelled", n)
+	}
+}
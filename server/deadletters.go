@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	pb "image-proc/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListDeadLetters pages through the caller's jobs that failed for good,
+// most recent failure first
+func (s *server) ListDeadLetters(ctx context.Context, req *pb.ListDeadLettersRequest) (*pb.ListDeadLettersResponse, error) {
+	owner, err := callerOwner(ctx, req.Owner, "dead letters")
+	if err != nil {
+		return nil, err
+	}
+	size, cursor, err := jobPage(req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	keep := func(r *jobRecord) bool {
+		return r.DeadLetteredAt != nil && r.Owner == owner
+	}
+	records, next, err := s.jobs.store.list(deadLettersBucket, keep, cursor, size)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list dead letters: %v", err)
+	}
+	resp := &pb.ListDeadLettersResponse{NextPageToken: pageToken(next)}
+	for _, r := range records {
+		resp.DeadLetters = append(resp.DeadLetters, r.deadLetter())
+	}
+	return resp, nil
+}
+
+// RedriveJob takes one of the caller's jobs out of the dead letters and
+// runs it again in the background under its own ID. Its attempts and
+// restarts keep counting.
+func (s *server) RedriveJob(ctx context.Context, req *pb.RedriveJobRequest) (*pb.Job, error) {
+	addLogFields(ctx, "job_id", req.JobId)
+	if s.workers.isDraining() {
+		return nil, errShuttingDown
+	}
+	existing, err := s.ownedJob(ctx, req.JobId)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.jobs.store.takeDeadLetter(req.JobId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "redrive job: %v", err)
+	}
+	if r == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "job %s is %s, not dead-lettered", req.JobId, existing.state())
+	}
+
+	j := s.jobs.redrive(r)
+	j.update(pb.JobState_JOB_STATE_QUEUED, 0, "re-driven from dead letters")
+	s.runBackground(j)
+	s.log(ctx).Infow("job re-driven", "image_id", j.imageID, "attempts", r.Attempts)
+	return j.record().proto(), nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// freeDiskSupported reports whether freeDiskBytes works on this platform
+const freeDiskSupported = false
+
+func freeDiskBytes(dir string) (uint64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeDiskSupported reports whether freeDiskBytes works on this platform
+const freeDiskSupported = true
+
+// freeDiskBytes returns the space available to unprivileged users on the
+// filesystem holding dir
+func freeDiskBytes(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	pb "image-proc/proto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// subscriptionCursorHeader is sent once a subscription is accepted and
+// carries the cursor the stream starts after
+const subscriptionCursorHeader = "x-subscription-cursor"
+
+// eventLog keeps the most recent lifecycle events in a ring so that
+// subscribers can resume from a cursor. Cursors combine the log's epoch,
+// which changes on every start, with the event's sequence number, so a
+// cursor from an earlier run is recognised as unrecoverable.
+type eventLog struct {
+	epoch string
+
+	mu      sync.Mutex
+	ring    []*pb.Event
+	next    uint64        // sequence number of the next event
+	changed chan struct{} // closed and replaced on every append
+}
+
+func newEventLog(size int) *eventLog {
+	if size < 1 {
+		size = 1
+	}
+	return &eventLog{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		ring:    make([]*pb.Event, size),
+		next:    1,
+		changed: make(chan struct{}),
+	}
+}
+
+// append stamps ev with its cursor and time and wakes subscribers
+func (l *eventLog) append(ev *pb.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ev.Cursor = l.cursor(l.next + 1)
+	ev.Time = timestamppb.Now()
+	l.ring[l.next%uint64(len(l.ring))] = ev
+	l.next++
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// start returns the sequence number a subscription with cursor begins at
+func (l *eventLog) start(cursor string) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cursor == "" {
+		return l.next, nil
+	}
+	epoch, seqText, ok := strings.Cut(cursor, "-")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if !ok || err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid cursor %q", cursor)
+	}
+	if epoch != l.epoch {
+		return 0, status.Error(codes.OutOfRange, "cursor is from an earlier server run; subscribe again without a cursor")
+	}
+	if seq >= l.next {
+		return 0, status.Errorf(codes.InvalidArgument, "cursor %q is ahead of the event log", cursor)
+	}
+	if size := uint64(len(l.ring)); l.next > size && seq+1 < l.next-size {
+		return 0, status.Errorf(codes.OutOfRange, "%d events after cursor %q were dropped; subscribe again without a cursor", l.next-size-seq-1, cursor)
+	}
+	return seq + 1, nil
+}
+
+// cursor returns the cursor of the event before seq
+func (l *eventLog) cursor(seq uint64) string {
+	return l.epoch + "-" + strconv.FormatUint(seq-1, 10)
+}
+
+// since returns the events from seq on and the channel that is closed
+// when more arrive. It fails if the events at seq were already dropped.
+func (l *eventLog) since(seq uint64) ([]*pb.Event, <-chan struct{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size := uint64(len(l.ring)); l.next > size && seq < l.next-size {
+		return nil, nil, status.Errorf(codes.OutOfRange, "%d events were dropped before they were delivered; subscribe again without a cursor", l.next-size-seq)
+	}
+	out := make([]*pb.Event, 0, l.next-seq)
+	for ; seq < l.next; seq++ {
+		out = append(out, l.ring[seq%uint64(len(l.ring))])
+	}
+	return out, l.changed, nil
+}
+
+// imageEvent records an upload or deletion
+func (l *eventLog) imageEvent(typ pb.EventType, meta *imageMeta) {
+	l.append(&pb.Event{
+		Type:    typ,
+		Owner:   meta.Owner,
+		ImageId: meta.ID,
+		Payload: &pb.Event_Image{Image: meta.proto()},
+	})
+}
+
+// jobEventType maps a job update to its event type given the job's
+// previous state; queue position updates yield no event
+func jobEventType(prev, next pb.JobState) pb.EventType {
+	switch {
+	case isTerminal(next):
+		return pb.EventType_EVENT_TYPE_JOB_FINISHED
+	case next == pb.JobState_JOB_STATE_RUNNING && prev != pb.JobState_JOB_STATE_RUNNING:
+		return pb.EventType_EVENT_TYPE_JOB_STARTED
+	case next == pb.JobState_JOB_STATE_RUNNING:
+		return pb.EventType_EVENT_TYPE_JOB_PROGRESS
+	case next == pb.JobState_JOB_STATE_QUEUED && prev != pb.JobState_JOB_STATE_QUEUED:
+		return pb.EventType_EVENT_TYPE_JOB_QUEUED
+	}
+	return pb.EventType_EVENT_TYPE_UNSPECIFIED
+}
+
+// jobEvent records a job update
+func (l *eventLog) jobEvent(typ pb.EventType, j *job, upd *pb.ProgressUpdate) {
+	l.append(&pb.Event{
+		Type:    typ,
+		Owner:   j.owner,
+		ImageId: j.imageID,
+		JobId:   j.id,
+		Payload: &pb.Event_Progress{Progress: proto.Clone(upd).(*pb.ProgressUpdate)},
+	})
+}
+
+// Subscribe streams lifecycle events of the caller's images and jobs that
+// match the request, first any the caller missed since its cursor, then
+// new ones as they happen
+func (s *server) Subscribe(req *pb.SubscribeRequest, stream pb.ImageProcessor_SubscribeServer) error {
+	ctx := stream.Context()
+	owner, err := callerOwner(ctx, req.Owner, "events")
+	if err != nil {
+		return err
+	}
+	for _, t := range req.Types {
+		if _, ok := pb.EventType_name[int32(t)]; !ok || t == pb.EventType_EVENT_TYPE_UNSPECIFIED {
+			return status.Errorf(codes.InvalidArgument, "unknown event type %d", t)
+		}
+	}
+	seq, err := s.events.start(req.Cursor)
+	if err != nil {
+		return err
+	}
+	// headers tell the caller the subscription was accepted even if no
+	// event follows for a while
+	if err := stream.SendHeader(metadata.Pairs(subscriptionCursorHeader, s.events.cursor(seq))); err != nil {
+		return err
+	}
+	s.log(ctx).Infow("subscriber attached", "types", fmt.Sprint(req.Types), "resumed", req.Cursor != "")
+
+	keep := func(ev *pb.Event) bool {
+		return ev.Owner == owner && (len(req.Types) == 0 || slices.Contains(req.Types, ev.Type))
+	}
+	for {
+		events, changed, err := s.events.since(seq)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if keep(ev) {
+				if err := stream.Send(ev); err != nil {
+					return status.Errorf(codes.Internal, "send error: %v", err)
+				}
+			}
+		}
+		seq += uint64(len(events))
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.workers.draining:
+			// let subscribers reconnect instead of being cut off at the deadline
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	pb "image-proc/proto"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// appendEvents adds n image events and returns them
+func appendEvents(l *eventLog, n int) []*pb.Event {
+	var out []*pb.Event
+	for range n {
+		ev := &pb.Event{Type: pb.EventType_EVENT_TYPE_IMAGE_UPLOADED}
+		l.append(ev)
+		out = append(out, ev)
+	}
+	return out
+}
+
+// resume subscribes from cursor and returns the events it is owed
+func resume(t *testing.T, l *eventLog, cursor string) ([]*pb.Event, error) {
+	t.Helper()
+	seq, err := l.start(cursor)
+	if err != nil {
+		return nil, err
+	}
+	events, _, err := l.since(seq)
+	return events, err
+}
+
+func TestEventLogResume(t *testing.T) {
+	l := newEventLog(10)
+	events := appendEvents(l, 3)
+
+	got, err := resume(t, l, events[0].Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != events[1] || got[1] != events[2] {
+		t.Errorf("resuming after the first event got %v, want the other two", got)
+	}
+
+	got, err = resume(t, l, events[2].Cursor)
+	if err != nil || len(got) != 0 {
+		t.Errorf("resuming after the last event = %v, %v; want nothing", got, err)
+	}
+
+	// a new subscription starts after the last event, and the cursor it is
+	// told resumes at the same place
+	seq, err := l.start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := l.cursor(seq); c != events[2].Cursor {
+		t.Errorf("new subscription starts after %q, want after the last event %q", c, events[2].Cursor)
+	}
+	more := appendEvents(l, 1)
+	if got, _, _ := l.since(seq); len(got) != 1 || got[0] != more[0] {
+		t.Errorf("new subscription got %v, want only the event appended after it", got)
+	}
+}
+
+func TestEventLogCursors(t *testing.T) {
+	l := newEventLog(3)
+	events := appendEvents(l, 5) // the ring holds events 3 to 5
+
+	tests := []struct {
+		name   string
+		cursor string
+		want   codes.Code
+		events int
+	}{
+		{name: "oldest held", cursor: events[1].Cursor, want: codes.OK, events: 3},
+		{name: "newest", cursor: events[4].Cursor, want: codes.OK, events: 0},
+		{name: "wrapped around", cursor: events[0].Cursor, want: codes.OutOfRange},
+		{name: "other epoch", cursor: "0123abc-2", want: codes.OutOfRange},
+		{name: "ahead of the log", cursor: l.epoch + "-6", want: codes.InvalidArgument},
+		{name: "far ahead", cursor: l.epoch + "-99", want: codes.InvalidArgument},
+		{name: "malformed", cursor: "not-a-cursor", want: codes.InvalidArgument},
+		{name: "no sequence", cursor: l.epoch, want: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resume(t, l, tt.cursor)
+			if code := status.Code(err); code != tt.want {
+				t.Fatalf("resume(%q) = %v, want %s", tt.cursor, err, tt.want)
+			}
+			if err == nil && len(got) != tt.events {
+				t.Errorf("resume(%q) got %d events, want %d", tt.cursor, len(got), tt.events)
+			}
+		})
+	}
+}
+
+func TestEventLogSubscriberFallsBehind(t *testing.T) {
+	l := newEventLog(3)
+	seq, err := l.start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, changed, err := l.since(seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEvents(l, 3)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("append did not wake subscribers")
+	}
+	if got, _, err := l.since(seq); err != nil || len(got) != 3 {
+		t.Fatalf("since = %d events, %v; want the 3 the ring still holds", len(got), err)
+	}
+
+	// one more and the subscriber's next event is gone
+	appendEvents(l, 1)
+	if _, _, err := l.since(seq); status.Code(err) != codes.OutOfRange {
+		t.Errorf("since after the ring wrapped = %v, want %s", err, codes.OutOfRange)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "image-proc/proto"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// jobFailure marks an error whose retry classification is known up front
+// and need not be guessed from its status code
+type jobFailure struct {
+	err       error
+	retryable bool
+}
+
+func (f *jobFailure) Error() string { return f.err.Error() }
+func (f *jobFailure) Unwrap() error { return f.err }
+
+// GRPCStatus keeps the wrapped error's status code visible to callers
+func (f *jobFailure) GRPCStatus() *status.Status { return status.Convert(f.err) }
+
+// permanent marks err as one that would recur on every retry
+func permanent(err error) error {
+	return &jobFailure{err: err}
+}
+
+// isRetryable reports whether running the job again may succeed. Bad
+// input such as a missing or corrupt image fails the same way every time;
+// storage and other internal errors are assumed to be transient.
+func isRetryable(err error) bool {
+	var f *jobFailure
+	if errors.As(err, &f) {
+		return f.retryable
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted, codes.Internal, codes.Unknown, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// retryPolicy bounds how often and how quickly a failing job or webhook
+// delivery is retried
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// backoff returns the delay after the given failed attempt, starting at 1
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.maxBackoff)
+}
+
+// runAttempt runs j once, turning a panic in a filter or decoder into a
+// permanent failure of the job instead of a crash of the server
+func (s *server) runAttempt(ctx context.Context, j *job, send func(*pb.ProgressUpdate) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Errorw("job panicked", "job_id", j.id, "panic", r, "stack", string(debug.Stack()))
+			err = permanent(status.Errorf(codes.Internal, "job panicked: %v", r))
+		}
+	}()
+	return s.runJob(ctx, j, send)
+}
+
+// retryStatus describes a failed attempt that will be retried
+func retryStatus(attempt, maxAttempts int, delay time.Duration, err error) string {
+	return fmt.Sprintf("attempt %d of %d failed: %s; retrying in %s", attempt, maxAttempts, status.Convert(err).Message(), delay)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	pb "image-proc/proto"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "unavailable", err: status.Error(codes.Unavailable, "x"), want: true},
+		{name: "aborted", err: status.Error(codes.Aborted, "x"), want: true},
+		{name: "resource exhausted", err: status.Error(codes.ResourceExhausted, "x"), want: true},
+		{name: "internal", err: status.Error(codes.Internal, "x"), want: true},
+		{name: "deadline exceeded", err: status.Error(codes.DeadlineExceeded, "x"), want: true},
+		{name: "plain error", err: errors.New("disk hiccup"), want: true},
+		{name: "not found", err: status.Error(codes.NotFound, "x"), want: false},
+		{name: "invalid argument", err: status.Error(codes.InvalidArgument, "x"), want: false},
+		{name: "failed precondition", err: status.Error(codes.FailedPrecondition, "x"), want: false},
+		{name: "permission denied", err: status.Error(codes.PermissionDenied, "x"), want: false},
+		{name: "cancelled", err: status.Error(codes.Canceled, "x"), want: false},
+
+		// a known classification wins over the code
+		{name: "permanent internal", err: permanent(status.Error(codes.Internal, "x")), want: false},
+		{name: "retryable not found", err: &jobFailure{err: status.Error(codes.NotFound, "x"), retryable: true}, want: true},
+		{name: "wrapped permanent", err: fmt.Errorf("attempt 2: %w", permanent(status.Error(codes.Unavailable, "x"))), want: false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: isRetryable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+
+	// marking an error permanent keeps its status for callers
+	err := permanent(status.Error(codes.Internal, "boom"))
+	if s := status.Convert(err); s.Code() != codes.Internal || s.Message() != "boom" {
+		t.Errorf("permanent error has status %s %q, want Internal \"boom\"", s.Code(), s.Message())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := retryPolicy{initialBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{6, time.Second},
+		// doubling stops at the cap, so it never overflows
+		{1000, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+	if got := (retryPolicy{initialBackoff: 2 * time.Second, maxBackoff: time.Second}).backoff(1); got != time.Second {
+		t.Errorf("backoff above the cap = %s, want the cap", got)
+	}
+}
+
+// withFilter makes fn available as filter name for the rest of the test
+func withFilter(t *testing.T, name string, fn filterFunc) {
+	t.Helper()
+	filters[name] = fn
+	t.Cleanup(func() { delete(filters, name) })
+}
+
+// processUntilEnd runs a Process call to its end and returns the last
+// update and the call's error
+func processUntilEnd(t *testing.T, client pb.ImageProcessorClient, req *pb.ProcessingRequest) (*pb.ProgressUpdate, error) {
+	t.Helper()
+	stream, err := client.Process(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last *pb.ProgressUpdate
+	for {
+		upd, err := stream.Recv()
+		if err == io.EOF {
+			return last, nil
+		}
+		if err != nil {
+			return last, err
+		}
+		last = upd
+	}
+}
+
+func TestPanickingFilterFailsJob(t *testing.T) {
+	s := newTestServer(t)
+	s.retry = retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	calls := 0
+	withFilter(t, "explode", func(dst, src *image.NRGBA, y0, y1 int) {
+		calls++
+		panic("out of range")
+	})
+	imageID := storeTestImage(t, s)
+	client := serve(t, s)
+
+	last, err := processUntilEnd(t, client, &pb.ProcessingRequest{ImageId: imageID, Filters: []string{"explode"}})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Process = %v, want %s", err, codes.Internal)
+	}
+	// a panic would happen again, so it is not retried
+	if calls != 1 {
+		t.Errorf("filter ran %d times, want once", calls)
+	}
+	r, err := s.jobs.lookup(last.JobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.state() != pb.JobState_JOB_STATE_FAILED {
+		t.Errorf("job is %s, want FAILED", r.State)
+	}
+	if r.DeadLetteredAt == nil || r.Retryable || codes.Code(r.FailureCode) != codes.Internal || r.Attempts != 1 {
+		t.Errorf("job dead-lettered at %v, retryable %v, code %s, attempts %d; want a dead-lettered permanent Internal failure after 1 attempt",
+			r.DeadLetteredAt, r.Retryable, codes.Code(r.FailureCode), r.Attempts)
+	}
+
+	// the server is still serving
+	if _, err := processUntilEnd(t, client, &pb.ProcessingRequest{ImageId: imageID, Filters: []string{"invert"}}); err != nil {
+		t.Errorf("Process after the panic: %v", err)
+	}
+}
+
+func TestRedriveJob(t *testing.T) {
+	s := newTestServer(t)
+	imageID := storeTestImage(t, s)
+	putJob(t, s.jobs.store, "succeeded", anonymousPrincipal, time.Now(), time.Now())
+	putJob(t, s.jobs.store, "theirs", "bob", time.Now(), time.Now())
+	putUnfinished(t, s, "dead", imageID, 0)
+	dead, _ := s.jobs.store.get("dead")
+	if err := s.deadLetterUnfinished(dead, "boom", true); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		id   string
+		code codes.Code
+	}{
+		{id: "missing", code: codes.NotFound},
+		{id: "theirs", code: codes.PermissionDenied},
+		{id: "succeeded", code: codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		if _, err := s.RedriveJob(ctx, &pb.RedriveJobRequest{JobId: tt.id}); status.Code(err) != tt.code {
+			t.Errorf("RedriveJob(%s) = %v, want %s", tt.id, err, tt.code)
+		}
+	}
+
+	job, err := s.RedriveJob(ctx, &pb.RedriveJobRequest{JobId: "dead"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != pb.JobState_JOB_STATE_QUEUED {
+		t.Errorf("re-driven job is %s, want QUEUED", job.State)
+	}
+	// it leaves the dead letters at once, so it cannot be re-driven twice
+	if _, err := s.RedriveJob(ctx, &pb.RedriveJobRequest{JobId: "dead"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("second RedriveJob = %v, want %s", err, codes.FailedPrecondition)
+	}
+	r := waitForRecord(t, s, "dead", func(r *jobRecord) bool { return isTerminal(r.state()) })
+	s.background.Wait()
+	if r.state() != pb.JobState_JOB_STATE_SUCCEEDED || r.DeadLetteredAt != nil || r.ResultImageID == "" {
+		t.Errorf("re-driven job ended %s, dead-lettered at %v; want SUCCEEDED outside the dead letters", r.State, r.DeadLetteredAt)
+	}
+	dls, _, _ := s.jobs.store.list(deadLettersBucket, func(*jobRecord) bool { return true }, nil, 10)
+	if len(dls) != 0 {
+		t.Errorf("dead letters = %v after the redrive succeeded", ids(dls))
+	}
+
+	s.workers.drain()
+	if _, err := s.RedriveJob(ctx, &pb.RedriveJobRequest{JobId: "dead"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("RedriveJob while draining = %v, want %s", err, codes.Unavailable)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// filterFunc computes rows [y0, y1) of dst from src. Both images have the
+// same bounds starting at (0, 0), so a filter can be applied in bands and
+// report progress between them.
+type filterFunc func(dst, src *image.NRGBA, y0, y1 int)
+
+// filters are the operations Process accepts, by name
+var filters = map[string]filterFunc{
+	"blur":      convolve3x3([9]float64{1, 2, 1, 2, 4, 2, 1, 2, 1}, 16),
+	"sharpen":   convolve3x3([9]float64{0, -1, 0, -1, 5, -1, 0, -1, 0}, 1),
+	"edge":      sobel,
+	"grayscale": grayscale,
+	"invert":    invert,
+}
+
+// validateFilters rejects unknown filter names; an empty chain copies the
+// image unchanged
+func validateFilters(names []string) error {
+	for _, name := range names {
+		if _, ok := filters[name]; !ok {
+			known := make([]string, 0, len(filters))
+			for k := range filters {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return status.Errorf(codes.InvalidArgument, "unknown filter %q, want one of %s", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// toNRGBA copies img into a zero-origin NRGBA image the filters can index
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	return out
+}
+
+func clamp(v float64) uint8 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// convolve3x3 applies a 3x3 kernel to the colour channels, clamping at the
+// image border; alpha is copied through
+func convolve3x3(kernel [9]float64, divisor float64) filterFunc {
+	return func(dst, src *image.NRGBA, y0, y1 int) {
+		w, h := src.Rect.Dx(), src.Rect.Dy()
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				var r, g, b float64
+				k := 0
+				for dy := -1; dy <= 1; dy++ {
+					sy := min(max(y+dy, 0), h-1)
+					for dx := -1; dx <= 1; dx++ {
+						sx := min(max(x+dx, 0), w-1)
+						i := sy*src.Stride + sx*4
+						r += float64(src.Pix[i]) * kernel[k]
+						g += float64(src.Pix[i+1]) * kernel[k]
+						b += float64(src.Pix[i+2]) * kernel[k]
+						k++
+					}
+				}
+				i := y*dst.Stride + x*4
+				dst.Pix[i] = clamp(r / divisor)
+				dst.Pix[i+1] = clamp(g / divisor)
+				dst.Pix[i+2] = clamp(b / divisor)
+				dst.Pix[i+3] = src.Pix[y*src.Stride+x*4+3]
+			}
+		}
+	}
+}
+
+// luma returns the Rec. 601 brightness of the pixel at offset i
+func luma(p []uint8, i int) float64 {
+	return 0.299*float64(p[i]) + 0.587*float64(p[i+1]) + 0.114*float64(p[i+2])
+}
+
+// sobel writes the gradient magnitude of the brightness as a grey image
+func sobel(dst, src *image.NRGBA, y0, y1 int) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	at := func(x, y int) float64 {
+		x = min(max(x, 0), w-1)
+		y = min(max(y, 0), h-1)
+		return luma(src.Pix, y*src.Stride+x*4)
+	}
+	for y := y0; y < y1; y++ {
+		for x := 0; x < w; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			v := clamp(math.Sqrt(gx*gx + gy*gy))
+			i := y*dst.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2] = v, v, v
+			dst.Pix[i+3] = src.Pix[y*src.Stride+x*4+3]
+		}
+	}
+}
+
+func grayscale(dst, src *image.NRGBA, y0, y1 int) {
+	w := src.Rect.Dx()
+	for y := y0; y < y1; y++ {
+		for x := 0; x < w; x++ {
+			i := y*src.Stride + x*4
+			v := clamp(luma(src.Pix, i))
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = v, v, v, src.Pix[i+3]
+		}
+	}
+}
+
+func invert(dst, src *image.NRGBA, y0, y1 int) {
+	w := src.Rect.Dx()
+	for y := y0; y < y1; y++ {
+		for x := 0; x < w; x++ {
+			i := y*src.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = 255-src.Pix[i], 255-src.Pix[i+1], 255-src.Pix[i+2], src.Pix[i+3]
+		}
+	}
+}
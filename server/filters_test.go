@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateFilters(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  codes.Code
+	}{
+		{names: nil, want: codes.OK}, // copies the image unchanged
+		{names: []string{"blur"}, want: codes.OK},
+		{names: []string{"grayscale", "edge", "invert"}, want: codes.OK},
+		{names: []string{"blur", "emboss"}, want: codes.InvalidArgument},
+		{names: []string{""}, want: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		if got := status.Code(validateFilters(tt.names)); got != tt.want {
+			t.Errorf("validateFilters(%q) = %s, want %s", tt.names, got, tt.want)
+		}
+	}
+}
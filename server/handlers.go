@@ -2,86 +2,319 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"image"
 	pb "image-proc/proto"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+// tracer creates the server's child spans for filter stages and storage operations
+var tracer = otel.Tracer("image-proc/server")
+
+// stepsPerFilter is how many bands of rows each filter is applied in, and
+// so how many progress updates it reports
+const stepsPerFilter = 5
+
+// ListJobs page sizes
+const (
+	defaultJobPageSize = 50
+	maxJobPageSize     = 500
+)
+
+// downloadChunkSize matches the 64 KB chunks the client uploads with
+const downloadChunkSize = 64 * 1024
+
 // server implements the ImageProcessor service
 type server struct {
-	version string
-	logger  *zap.SugaredLogger
+	version  string
+	logger   *zap.SugaredLogger
+	store    *imageStore
+	jobs     *jobManager
+	limits   uploadLimits
+	metrics  *serverMetrics
+	workers  *workerPool
+	retry    retryPolicy
+	webhooks *webhookSender
+	events   *eventLog
+	renderer *renderer
+	signer   urlSigner
+	maxBatch int
+
+	// authRequired is set when callers authenticate with tokens
+	authRequired bool
+
+	// jobs recovered after a restart run in the background, detached
+	// from any RPC, until stopBackgroundJobs is called on shutdown
+	background         sync.WaitGroup
+	backgroundCtx      context.Context
+	stopBackgroundJobs context.CancelFunc
+
 	pb.UnimplementedImageProcessorServer
 }
 
+// log returns the request-scoped logger for ctx
+func (s *server) log(ctx context.Context) *zap.SugaredLogger {
+	return loggerFromContext(ctx, s.logger)
+}
+
 // GetVersion returns a static version string
 func (s *server) GetVersion(ctx context.Context, _ *emptypb.Empty) (*pb.VersionResponse, error) {
-	s.logger.Infof("GetVersion called at %s", time.Now().Format(time.RFC3339))
+	s.log(ctx).Infow("GetVersion called", "at", time.Now().Format(time.RFC3339))
 	return &pb.VersionResponse{Version: s.version}, nil
 }
 
 // Upload handles client-streaming image upload
 func (s *server) Upload(stream pb.ImageProcessor_UploadServer) error {
-	s.logger.Info("Upload Started")
-
 	// genearte image ID and file path
 	imgID := uuid.New().String()
+	addLogFields(stream.Context(), "image_id", imgID)
+	s.log(stream.Context()).Info("upload started")
 
-	// write into project-level "uploads" directory
-	uploadDir := "uploads"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+	// write into the configured uploads directory
+	if err := os.MkdirAll(s.store.dir, 0755); err != nil {
 		return status.Errorf(codes.Internal, "failed to create upload dir: %v", err)
 	}
 
-	tmpPath := fmt.Sprintf("%s/%s.jpg", uploadDir, imgID)
+	finalPath := s.store.imagePath(imgID)
+	tmpPath := partialPath(finalPath)
+	ctx, span := tracer.Start(stream.Context(), "storage.write",
+		trace.WithAttributes(attribute.String("image.id", imgID), attribute.String("storage.path", finalPath)))
+	defer span.End()
+
 	file, err := os.Create(tmpPath)
 	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
 		return status.Errorf(codes.Internal, "failed to create file: %v", err)
 	}
-	defer file.Close()
 
-	// receive chunks
-	for {
-		req, err := stream.Recv()
-		if err == io.EOF {
-			s.logger.Infof("Upload completed: %s", tmpPath)
-			return stream.SendAndClose(&pb.UploadResponse{ImageId: imgID})
-		}
-		if err != nil {
-			return status.Errorf(codes.Internal, "upload recv error: %v", err)
-		}
-		if _, err := file.Write(req.GetChunk()); err != nil {
-			return status.Errorf(codes.Internal, "file write error: %v", err)
+	// a signed upload URL may allow less than the server does
+	limits := s.limits
+	if g, ok := grantFromContext(stream.Context()); ok && g.MaxBytes > 0 {
+		if limits.MaxBytes == 0 || g.MaxBytes < limits.MaxBytes {
+			limits.MaxBytes = g.MaxBytes
 		}
 	}
+
+	// receive chunks; anything short of a complete upload removes the partial file
+	n, err := receiveUpload(stream, file, limits)
+	s.metrics.uploadBytes.Add(float64(n))
+	span.SetAttributes(attribute.Int64("upload.bytes", n))
+	if cerr := file.Close(); err == nil && cerr != nil {
+		err = status.Errorf(codes.Internal, "file close error: %v", cerr)
+	}
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		os.Remove(tmpPath)
+		s.log(ctx).Warnw("upload aborted", "bytes", n, "error", err)
+		return err
+	}
+	if err := commitUpload(ctx, tmpPath, finalPath); err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return status.Errorf(codes.Internal, "failed to finalize upload: %v", err)
+	}
+
+	meta, err := s.store.record(ctx, imgID, principalFromContext(ctx), "")
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return status.Errorf(codes.Internal, "failed to record image metadata: %v", err)
+	}
+	s.events.imageEvent(pb.EventType_EVENT_TYPE_IMAGE_UPLOADED, meta)
+
+	s.log(ctx).Infow("upload completed", "path", finalPath, "bytes", n)
+	return stream.SendAndClose(&pb.UploadResponse{ImageId: imgID})
 }
 
-// Process simulates image processing and streams progress
+// Process applies a filter chain to an image and streams progress. Each call is
+// tracked as a job so other clients can follow it with WatchJob.
 func (s *server) Process(req *pb.ProcessingRequest, stream pb.ImageProcessor_ProcessServer) error {
-	s.logger.Info("Starting processing %s with filters %v", req.ImageId, req.Filters)
-	steps := 10
-	for i := 0; i <= steps; i++ {
-		time.Sleep(200 * time.Millisecond)
-		pct := int32(i * 100 / steps)
-		upd := &pb.ProgressUpdate{Percent: pct, Status: fmt.Sprintf("%d%% complete", pct)}
-		if err := stream.Send(upd); err != nil {
+	ctx := stream.Context()
+	addLogFields(ctx, "image_id", req.ImageId)
+	if err := validateFilters(req.Filters); err != nil {
+		return err
+	}
+	if req.CallbackUrl != "" {
+		if err := s.webhooks.validate(req.CallbackUrl); err != nil {
+			return err
+		}
+	}
+	if _, err := s.ownedImage(ctx, req.ImageId); err != nil {
+		return err
+	}
+
+	j := s.jobs.create(req.ImageId, req.Filters, principalFromContext(ctx), req.Priority, req.CallbackUrl)
+	addLogFields(ctx, "job_id", j.id)
+	if j.callback != "" {
+		// the caller may hang up at any time; the job carries on and
+		// reports to its callback instead
+		j.update(pb.JobState_JOB_STATE_QUEUED, 0, "queued")
+		s.log(ctx).Infow("processing started in background", "filters", req.Filters, "priority", j.priority.String())
+		s.runBackground(j)
+		return s.streamJob(ctx, j, stream.Send)
+	}
+
+	defer s.jobs.finish(j)
+	if err := stream.Send(j.update(pb.JobState_JOB_STATE_QUEUED, 0, "queued")); err != nil {
+		j.end(pb.JobState_JOB_STATE_CANCELLED, "client went away")
+		return status.Errorf(codes.Internal, "send error: %v", err)
+	}
+
+	s.log(ctx).Infow("processing started", "filters", req.Filters, "priority", j.priority.String())
+	if err := s.execute(ctx, j, stream.Send); err != nil {
+		s.log(ctx).Warnw("processing stopped", "state", j.latest().State.String(), "error", err)
+		return err
+	}
+	s.log(ctx).Info("processing completed")
+	return nil
+}
+
+// interruptedStatus marks jobs stopped by a shutdown; they stay queued in
+// the job store and are recovered on the next start
+const interruptedStatus = "interrupted by server shutdown"
+
+// errShuttingDown is returned for jobs a shutdown stopped from running
+var errShuttingDown = status.Error(codes.Unavailable, "server is shutting down, retry on another instance")
+
+// execute runs j until it succeeds, is stopped, or fails for good. Each
+// attempt waits for the scheduler to grant a worker, reporting j's queue
+// position through send meanwhile. Retryable failures are retried with
+// exponential backoff up to the retry policy's limit; the final failure
+// moves j to the dead letters.
+func (s *server) execute(ctx context.Context, j *job, send func(*pb.ProgressUpdate) error) error {
+	for attempt := 1; ; attempt++ {
+		err := s.attempt(ctx, j, send)
+		if err == nil {
+			return nil
+		}
+		switch {
+		case errors.Is(err, errPoolDraining) || (ctx.Err() != nil && s.workers.isDraining()):
+			j.interrupt(interruptedStatus)
+			return errShuttingDown
+		case ctx.Err() != nil:
+			j.end(pb.JobState_JOB_STATE_CANCELLED, "client went away")
+			return status.FromContextError(ctx.Err()).Err()
+		}
+
+		retryable := isRetryable(err)
+		if !retryable || attempt >= s.retry.maxAttempts {
+			j.fail(err, retryable)
+			s.metrics.jobsDeadLettered.Inc()
+			return err
+		}
+		delay := s.retry.backoff(attempt)
+		s.logger.Warnw("job attempt failed, retrying", "job_id", j.id, "attempt", attempt, "delay", delay, "error", err)
+		s.metrics.jobRetries.Inc()
+		if err := send(j.update(pb.JobState_JOB_STATE_QUEUED, 0, retryStatus(attempt, s.retry.maxAttempts, delay, err))); err != nil {
+			j.end(pb.JobState_JOB_STATE_CANCELLED, "client went away")
 			return status.Errorf(codes.Internal, "send error: %v", err)
 		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			if s.workers.isDraining() {
+				j.interrupt(interruptedStatus)
+				return errShuttingDown
+			}
+			j.end(pb.JobState_JOB_STATE_CANCELLED, "client went away")
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.workers.draining:
+			t.Stop()
+			j.interrupt(interruptedStatus)
+			return errShuttingDown
+		}
+	}
+}
+
+// attempt waits for a worker and runs j once
+func (s *server) attempt(ctx context.Context, j *job, send func(*pb.ProgressUpdate) error) error {
+	ticket := workTicket{principal: j.owner, priority: j.priority}
+	release, err := s.workers.acquire(ctx, ticket, func(position int) {
+		// a failed send means the client is gone; ctx ends the wait
+		_ = send(j.queued(position))
+	})
+	if err != nil {
+		return err
+	}
+	defer release()
+	j.startAttempt()
+	return s.runAttempt(ctx, j, send)
+}
+
+// runJob applies j's filters in order, reporting progress through send,
+// and stores the result as a new image
+func (s *server) runJob(ctx context.Context, j *job, send func(*pb.ProgressUpdate) error) error {
+	src, format, err := s.store.decode(ctx, j.imageID)
+	if err != nil {
+		return err
+	}
+	cur := toNRGBA(src)
+	height := cur.Rect.Dy()
+
+	// each filter runs as its own stage so its duration can be measured,
+	// and in bands of rows so progress can be reported while it runs
+	totalSteps := stepsPerFilter * len(j.filters)
+	done := 0
+	for _, name := range j.filters {
+		_, span := tracer.Start(ctx, "filter "+name, trace.WithAttributes(
+			attribute.String("image.id", j.imageID),
+			attribute.String("filter.name", name),
+		))
+		start := time.Now()
+		apply := filters[name]
+		dst := image.NewNRGBA(cur.Rect)
+		for i := 0; i < stepsPerFilter; i++ {
+			if err := ctx.Err(); err != nil {
+				span.End()
+				return status.FromContextError(err).Err()
+			}
+			apply(dst, cur, height*i/stepsPerFilter, height*(i+1)/stepsPerFilter)
+			s.workers.advance()
+			done++
+			pct := int32(done * 100 / totalSteps)
+			upd := j.update(pb.JobState_JOB_STATE_RUNNING, pct, fmt.Sprintf("%s: %d%% complete", name, pct))
+			if err := send(upd); err != nil {
+				span.SetStatus(otelcodes.Error, err.Error())
+				span.End()
+				return status.Errorf(codes.Internal, "send error: %v", err)
+			}
+		}
+		cur = dst
+		s.metrics.filterDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		span.End()
+	}
+
+	meta, err := s.store.save(ctx, cur, format, j.owner, j.imageID)
+	if err != nil {
+		return err
+	}
+	addLogFields(ctx, "result_image_id", meta.ID)
+	if err := send(j.succeed(meta.ID)); err != nil {
+		return status.Errorf(codes.Internal, "send error: %v", err)
 	}
-	s.logger.Info("Proccessing Completed")
 	return nil
 }
 
 // Tune handles bidirectional parameter tuning
 func (s *server) Tune(stream pb.ImageProcessor_TuneServer) error {
+	ctx := stream.Context()
+	var imageID string
 	for {
 		req, err := stream.Recv()
 		if err == io.EOF {
@@ -90,11 +323,261 @@ func (s *server) Tune(stream pb.ImageProcessor_TuneServer) error {
 		if err != nil {
 			return err
 		}
-		s.logger.Infof("Tune request: %s = %f on image %s", req.Parameter, req.Value, req.ImageId)
+		if imageID == "" && req.ImageId != "" {
+			imageID = req.ImageId
+			addLogFields(ctx, "image_id", imageID)
+		}
+		s.log(ctx).Infow("tune request", "parameter", req.Parameter, "value", req.Value)
 		// simulate the preview generation
 		preview := []byte(fmt.Sprintf("Preview for %s: %s=%.2f", req.ImageId, req.Parameter, req.Value))
 		if err := stream.Send(&pb.TuneResponse{PreviewChunk: preview}); err != nil {
 			return err
 		}
+		s.metrics.tuneFrames.Inc()
+	}
+}
+
+// Download streams a stored image, or the requested part of it, back in
+// chunks
+func (s *server) Download(req *pb.DownloadRequest, stream pb.ImageProcessor_DownloadServer) error {
+	ctx := stream.Context()
+	addLogFields(ctx, "image_id", req.ImageId)
+	if _, err := s.ownedImage(ctx, req.ImageId); err != nil {
+		return err
+	}
+	f, err := s.store.open(ctx, req.ImageId)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if req.Offset < 0 || req.Length < 0 {
+		return status.Error(codes.InvalidArgument, "offset and length must not be negative")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return status.Errorf(codes.Internal, "stat image: %v", err)
+	}
+	if req.Offset > info.Size() {
+		return status.Errorf(codes.OutOfRange, "offset %d is past the end of the %d byte image", req.Offset, info.Size())
+	}
+	var r io.Reader = io.NewSectionReader(f, req.Offset, info.Size()-req.Offset)
+	if req.Length > 0 {
+		r = io.LimitReader(r, req.Length)
+	}
+
+	buf := make([]byte, downloadChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.DownloadChunk{Chunk: buf[:n]}); err != nil {
+				return status.Errorf(codes.Internal, "send error: %v", err)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "read error: %v", err)
+		}
+	}
+}
+
+// ListImages returns metadata for the caller's images; callers may not
+// list another principal's
+func (s *server) ListImages(ctx context.Context, req *pb.ListImagesRequest) (*pb.ListImagesResponse, error) {
+	principal, err := callerOwner(ctx, req.Owner, "images")
+	if err != nil {
+		return nil, err
+	}
+	metas, err := s.store.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListImagesResponse{}
+	for _, m := range metas {
+		if m.Owner != principal {
+			continue
+		}
+		resp.Images = append(resp.Images, m.proto())
+	}
+	return resp, nil
+}
+
+// GetImage returns metadata for a single image
+func (s *server) GetImage(ctx context.Context, req *pb.GetImageRequest) (*pb.ImageInfo, error) {
+	meta, err := s.ownedImage(ctx, req.ImageId)
+	if err != nil {
+		return nil, err
+	}
+	return meta.proto(), nil
+}
+
+// DeleteImage removes an image; only its owner may do so
+func (s *server) DeleteImage(ctx context.Context, req *pb.DeleteImageRequest) (*emptypb.Empty, error) {
+	meta, err := s.ownedImage(ctx, req.ImageId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.delete(ctx, req.ImageId); err != nil {
+		return nil, err
+	}
+	s.events.imageEvent(pb.EventType_EVENT_TYPE_IMAGE_DELETED, meta)
+	s.log(ctx).Info("image deleted")
+	return &emptypb.Empty{}, nil
+}
+
+// callerOwner resolves the owner filter of a listing: callers only ever
+// see their own resources, so the filter defaults to, and must match, the
+// calling principal
+func callerOwner(ctx context.Context, owner, what string) (string, error) {
+	principal := principalFromContext(ctx)
+	if owner != "" && owner != principal {
+		return "", status.Errorf(codes.PermissionDenied, "cannot list the %s of %q", what, owner)
+	}
+	return principal, nil
+}
+
+// ownedImage returns the metadata of an image the caller may use: one it
+// owns or, when callers do not authenticate, one stored before owners
+// were recorded
+func (s *server) ownedImage(ctx context.Context, id string) (*imageMeta, error) {
+	meta, err := s.store.stat(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if principal := principalFromContext(ctx); meta.Owner != principal && (meta.Owner != "" || s.authRequired) {
+		return nil, status.Errorf(codes.PermissionDenied, "image %s belongs to another principal", id)
+	}
+	return meta, nil
+}
+
+// WatchJob streams a job's progress, starting with its latest update,
+// until the job finishes or the caller goes away
+func (s *server) WatchJob(req *pb.WatchJobRequest, stream pb.ImageProcessor_WatchJobServer) error {
+	ctx := stream.Context()
+	addLogFields(ctx, "job_id", req.JobId)
+	r, err := s.ownedJob(ctx, req.JobId)
+	if err != nil {
+		return err
+	}
+	j, ok := s.jobs.get(req.JobId)
+	if !ok {
+		// a job no longer in memory has finished; report its final state
+		return stream.Send(&pb.ProgressUpdate{
+			JobId:         r.ID,
+			State:         r.state(),
+			Percent:       r.Percent,
+			Status:        r.Status,
+			ResultImageId: r.ResultImageID,
+		})
+	}
+
+	return s.streamJob(ctx, j, stream.Send)
+}
+
+// streamJob sends j's updates, starting with its latest one, until j
+// finishes or ctx is done
+func (s *server) streamJob(ctx context.Context, j *job, send func(*pb.ProgressUpdate) error) error {
+	updates, cancel := j.watch()
+	defer cancel()
+	for {
+		select {
+		case upd, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if err := send(upd); err != nil {
+				return status.Errorf(codes.Internal, "send error: %v", err)
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// GetJob returns the current or final state of a job
+func (s *server) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.Job, error) {
+	addLogFields(ctx, "job_id", req.JobId)
+	r, err := s.ownedJob(ctx, req.JobId)
+	if err != nil {
+		return nil, err
+	}
+	return r.proto(), nil
+}
+
+// ownedJob returns the current or final record of a job the caller
+// started
+func (s *server) ownedJob(ctx context.Context, id string) (*jobRecord, error) {
+	r, err := s.jobs.lookup(id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "look up job: %v", err)
+	}
+	if r == nil {
+		return nil, status.Errorf(codes.NotFound, "job %s not found", id)
+	}
+	if r.Owner != principalFromContext(ctx) {
+		return nil, status.Errorf(codes.PermissionDenied, "job %s belongs to another principal", id)
+	}
+	return r, nil
+}
+
+// ListJobs pages through the caller's persisted jobs, newest first
+func (s *server) ListJobs(ctx context.Context, req *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	owner, err := callerOwner(ctx, req.Owner, "jobs")
+	if err != nil {
+		return nil, err
+	}
+	size, cursor, err := jobPage(req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	keep := func(r *jobRecord) bool {
+		return r.Owner == owner &&
+			(req.State == pb.JobState_JOB_STATE_UNSPECIFIED || r.state() == req.State)
+	}
+	records, next, err := s.jobs.store.list(jobsByCreatedBucket, keep, cursor, size)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list jobs: %v", err)
+	}
+	resp := &pb.ListJobsResponse{}
+	for _, r := range records {
+		// live jobs are persisted at most once a second; prefer memory
+		if j, ok := s.jobs.get(r.ID); ok {
+			r = j.record()
+		}
+		resp.Jobs = append(resp.Jobs, r.proto())
+	}
+	resp.NextPageToken = pageToken(next)
+	return resp, nil
+}
+
+// jobPage validates the paging fields of a job listing and returns the
+// page size and the store cursor to continue from
+func jobPage(pageSize int32, pageToken string) (int, []byte, error) {
+	size := int(pageSize)
+	switch {
+	case size < 0:
+		return 0, nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	case size == 0:
+		size = defaultJobPageSize
+	case size > maxJobPageSize:
+		size = maxJobPageSize
+	}
+	if pageToken == "" {
+		return size, nil, nil
+	}
+	cursor, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err != nil || len(cursor) < 8 {
+		return 0, nil, status.Error(codes.InvalidArgument, "invalid page_token")
+	}
+	return size, cursor, nil
+}
+
+// pageToken encodes a store cursor for next_page_token
+func pageToken(cursor []byte) string {
+	if cursor == nil {
+		return ""
 	}
+	return base64.RawURLEncoding.EncodeToString(cursor)
 }
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"image"
+	pb "image-proc/proto"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestServer returns a server with temporary storage, two workers and
+// no auth, retries or webhooks
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	dir := t.TempDir()
+	jobStore, err := openJobStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jobStore.close() })
+	logger := zap.NewNop().Sugar()
+	metrics := newServerMetrics(filepath.Join(dir, "uploads"))
+	events := newEventLog(100)
+	backgroundCtx, stopBackgroundJobs := context.WithCancel(context.Background())
+	t.Cleanup(stopBackgroundJobs)
+	return &server{
+		logger:             logger,
+		store:              &imageStore{dir: filepath.Join(dir, "uploads")},
+		jobs:               newJobManager(jobStore, events, logger),
+		events:             events,
+		metrics:            metrics,
+		workers:            newWorkerPool(2, schedulingPolicy{}, metrics),
+		retry:              retryPolicy{maxAttempts: 1},
+		renderer:           newRenderer(1024, 1),
+		backgroundCtx:      backgroundCtx,
+		stopBackgroundJobs: stopBackgroundJobs,
+	}
+}
+
+// serve runs s in memory behind the same stats handler and interceptors
+// as main, without auth, and returns a client for it
+func serve(t *testing.T, s *server, opts ...grpc.DialOption) pb.ImageProcessorClient {
+	t.Helper()
+	return pb.NewImageProcessorClient(dial(t, s, &authenticator{}, opts...))
+}
+
+// dial runs s in memory as main does, authenticating callers with auth
+// and serving health and reflection next to it, and connects to it
+func dial(t *testing.T, s *server, auth *authenticator, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	gs := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(loggingUnaryInterceptor(s.logger), s.metrics.unaryInterceptor(), auth.unaryInterceptor()),
+		grpc.ChainStreamInterceptor(loggingStreamInterceptor(s.logger), s.metrics.streamInterceptor(), auth.streamInterceptor()),
+	)
+	pb.RegisterImageProcessorServer(gs, s)
+	healthpb.RegisterHealthServer(gs, health.NewServer())
+	reflection.Register(gs)
+	lis := bufconn.Listen(1 << 20)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// storeTestImage saves a small image owned by the anonymous principal
+func storeTestImage(t *testing.T, s *server) string {
+	t.Helper()
+	meta, err := s.store.save(context.Background(), image.NewNRGBA(image.Rect(0, 0, 16, 16)), "png", anonymousPrincipal, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meta.ID
+}
+
+// waitFor polls done until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// asPrincipal returns ctx as the auth interceptors leave it for principal
+func asPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func TestOwnedImage(t *testing.T) {
+	s := newTestServer(t)
+	owned, err := s.store.save(context.Background(), image.NewNRGBA(image.Rect(0, 0, 4, 4)), "png", "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerless := writeTestImage(t, s.store)
+
+	tests := []struct {
+		name         string
+		id           string
+		principal    string
+		authRequired bool
+		want         codes.Code
+	}{
+		{name: "owner", id: owned.ID, principal: "alice", want: codes.OK},
+		{name: "other principal", id: owned.ID, principal: "bob", want: codes.PermissionDenied},
+		{name: "owner with auth", id: owned.ID, principal: "alice", authRequired: true, want: codes.OK},
+		{name: "other principal with auth", id: owned.ID, principal: "bob", authRequired: true, want: codes.PermissionDenied},
+		{name: "ownerless without auth", id: ownerless, principal: anonymousPrincipal, want: codes.OK},
+		{name: "ownerless with auth", id: ownerless, principal: "bob", authRequired: true, want: codes.PermissionDenied},
+		{name: "missing", id: "0d9c1e2f-3a4b-4c5d-9e8f-7a6b5c4d3e2f", principal: "alice", want: codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.authRequired = tt.authRequired
+			_, err := s.ownedImage(asPrincipal(context.Background(), tt.principal), tt.id)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("ownedImage = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+var (
+	spanRecorderOnce sync.Once
+	spanRecorder     *tracetest.SpanRecorder
+)
+
+// recordSpans installs a global tracer provider that records every span.
+// Tracers bind to the first provider installed, so it is shared by all
+// tests; tell them apart by trace ID.
+func recordSpans() *tracetest.SpanRecorder {
+	spanRecorderOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	return spanRecorder
+}
+
+// traceSpans returns the ended spans of traceID once one of them matches
+// last, waiting for it as spans can end after the RPC has returned
+func traceSpans(t *testing.T, rec *tracetest.SpanRecorder, traceID trace.TraceID, last func(sdktrace.ReadOnlySpan) bool) []sdktrace.ReadOnlySpan {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var spans []sdktrace.ReadOnlySpan
+		found := false
+		for _, s := range rec.Ended() {
+			if s.SpanContext().TraceID() == traceID {
+				spans = append(spans, s)
+				found = found || last(s)
+			}
+		}
+		if found || time.Now().After(deadline) {
+			return spans
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProcessSpans(t *testing.T) {
+	rec := recordSpans()
+	s := newTestServer(t)
+	imageID := storeTestImage(t, s)
+	// the gateway's client side: its gRPC calls run under the HTTP request span
+	client := serve(t, s, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+
+	ctx, request := otel.Tracer("image-proc/gateway").Start(context.Background(), "POST /v1/images/{id}/process",
+		trace.WithSpanKind(trace.SpanKindServer))
+	stream, err := client.Process(ctx, &pb.ProcessingRequest{ImageId: imageID, Filters: []string{"blur", "invert"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	request.End()
+
+	// the server span ends after the client has seen the stream close
+	spans := traceSpans(t, rec, request.SpanContext().TraceID(), func(s sdktrace.ReadOnlySpan) bool {
+		return s.SpanKind() == trace.SpanKindServer && s.Parent().IsRemote()
+	})
+	var clientSpan, serverSpan sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.SpanKind() {
+		case trace.SpanKindClient:
+			clientSpan = span
+		case trace.SpanKindServer:
+			if span.SpanContext().SpanID() != request.SpanContext().SpanID() {
+				serverSpan = span
+			}
+		}
+	}
+	if clientSpan == nil || serverSpan == nil {
+		t.Fatalf("got spans %v, want a gRPC client and server span", spanNames(spans))
+	}
+	if got := clientSpan.Parent().SpanID(); got != request.SpanContext().SpanID() {
+		t.Errorf("client span %q has parent %s, want the gateway request span", clientSpan.Name(), got)
+	}
+	if got := serverSpan.Parent(); got.SpanID() != clientSpan.SpanContext().SpanID() || !got.IsRemote() {
+		t.Errorf("server span %q has parent %s (remote %v), want the client span propagated over gRPC", serverSpan.Name(), got.SpanID(), got.IsRemote())
+	}
+
+	var filtered []string
+	for _, span := range spans {
+		var name string
+		for _, kv := range span.Attributes() {
+			if kv.Key == attribute.Key("filter.name") {
+				name = kv.Value.AsString()
+			}
+		}
+		if name == "" {
+			continue
+		}
+		filtered = append(filtered, name)
+		if span.Name() != "filter "+name {
+			t.Errorf("filter span named %q, want %q", span.Name(), "filter "+name)
+		}
+		if span.Parent().SpanID() != serverSpan.SpanContext().SpanID() {
+			t.Errorf("span %q is not a child of the server span", span.Name())
+		}
+	}
+	if len(filtered) != 2 || filtered[0] != "blur" || filtered[1] != "invert" {
+		t.Errorf("filter spans for %v, want blur then invert", filtered)
+	}
+}
+
+func spanNames(spans []sdktrace.ReadOnlySpan) []string {
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// recvUntil reads updates from stream until one matches done
+func recvUntil(t *testing.T, stream pb.ImageProcessor_ProcessClient, done func(*pb.ProgressUpdate) bool) *pb.ProgressUpdate {
+	t.Helper()
+	for {
+		upd, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("stream ended before the expected update: %v", err)
+		}
+		if done(upd) {
+			return upd
+		}
+	}
+}
+
+func TestProcessWaitsForAWorker(t *testing.T) {
+	s := newTestServer(t)
+	s.workers = newWorkerPool(1, schedulingPolicy{}, s.metrics)
+	imageID := storeTestImage(t, s)
+	client := serve(t, s)
+
+	// another job holds the only worker
+	release, err := s.workers.acquire(context.Background(), workTicket{principal: "other"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.Process(context.Background(), &pb.ProcessingRequest{ImageId: imageID, Filters: []string{"invert"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upd := recvUntil(t, stream, func(u *pb.ProgressUpdate) bool { return u.QueuePosition > 0 })
+	if upd.State != pb.JobState_JOB_STATE_QUEUED || upd.QueuePosition != 1 {
+		t.Errorf("waiting update = %v, want queued at position 1", upd)
+	}
+	if d := s.workers.queueDepth(); d != 1 {
+		t.Errorf("queue depth = %d while waiting, want 1", d)
+	}
+
+	release()
+	upd = recvUntil(t, stream, func(u *pb.ProgressUpdate) bool { return isTerminal(u.State) })
+	if upd.State != pb.JobState_JOB_STATE_SUCCEEDED {
+		t.Errorf("final update = %v, want success once the worker was free", upd)
+	}
+}
+
+func TestProcessRefusedWhileDraining(t *testing.T) {
+	s := newTestServer(t)
+	s.workers = newWorkerPool(1, schedulingPolicy{}, s.metrics)
+	imageID := storeTestImage(t, s)
+	client := serve(t, s)
+
+	release, err := s.workers.acquire(context.Background(), workTicket{principal: "other"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	stream, err := client.Process(context.Background(), &pb.ProcessingRequest{ImageId: imageID, Filters: []string{"invert"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recvUntil(t, stream, func(u *pb.ProgressUpdate) bool { return u.QueuePosition > 0 })
+
+	// a shutdown turns away the queued job instead of leaving it waiting
+	s.workers.drain()
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("queued Process during a drain = %v, want %s", err, codes.Unavailable)
+	}
+	stream, err = client.Process(context.Background(), &pb.ProcessingRequest{ImageId: imageID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("new Process after a drain = %v, want %s", err, codes.Unavailable)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image-proc/config"
+	pb "image-proc/proto"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthProbe checks one dependency of the server
+type healthProbe struct {
+	name string
+	// liveness probes fail only when restarting the process would help;
+	// the others take the server out of rotation until they pass again
+	liveness bool
+	check    func(ctx context.Context) error
+}
+
+// healthChecker runs the probes in the background and reports their
+// results through the gRPC health service, for the ImageProcessor service
+// and the server as a whole, and on /healthz and /readyz
+type healthChecker struct {
+	grpc     *health.Server
+	probes   []healthProbe
+	interval time.Duration
+	timeout  time.Duration
+	metrics  *serverMetrics
+	logger   *zap.SugaredLogger
+	draining func() bool
+
+	mu      sync.Mutex
+	results map[string]error // by probe; nil means it passed
+}
+
+// newHealthChecker sets up the probes cfg enables for srv
+func newHealthChecker(grpcHealth *health.Server, srv *server, cfg config.Health) *healthChecker {
+	probes := []healthProbe{{
+		name:  "storage",
+		check: func(context.Context) error { return srv.store.checkWritable() },
+	}, {
+		name:  "jobs",
+		check: func(context.Context) error { return srv.jobs.store.check() },
+	}}
+	if cfg.MinFreeBytes > 0 && freeDiskSupported {
+		probes = append(probes, healthProbe{name: "disk", check: func(context.Context) error {
+			free, err := freeDiskBytes(srv.store.dir)
+			if err != nil {
+				return err
+			}
+			if free < uint64(cfg.MinFreeBytes) {
+				return fmt.Errorf("%d bytes free, want at least %d", free, cfg.MinFreeBytes)
+			}
+			return nil
+		}})
+	}
+	if cfg.MaxQueueDepth > 0 {
+		probes = append(probes, healthProbe{name: "queue", check: func(context.Context) error {
+			if n := srv.workers.queueDepth(); n >= cfg.MaxQueueDepth {
+				return fmt.Errorf("%d jobs waiting, limit is %d", n, cfg.MaxQueueDepth)
+			}
+			return nil
+		}})
+	}
+	if cfg.StallTimeout > 0 {
+		probes = append(probes, healthProbe{name: "workers", liveness: true, check: func(context.Context) error {
+			return srv.workers.checkProgress(cfg.StallTimeout)
+		}})
+	}
+	return &healthChecker{
+		grpc:     grpcHealth,
+		probes:   probes,
+		interval: cfg.Interval,
+		timeout:  cfg.Timeout,
+		metrics:  srv.metrics,
+		logger:   srv.logger,
+		draining: srv.workers.isDraining,
+		results:  make(map[string]error),
+	}
+}
+
+// run probes every interval until ctx is done
+func (h *healthChecker) run(ctx context.Context) {
+	t := time.NewTicker(h.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			h.checkAll(ctx)
+		}
+	}
+}
+
+// checkAll runs every probe once and publishes the outcome
+func (h *healthChecker) checkAll(ctx context.Context) {
+	healthy := true
+	for _, p := range h.probes {
+		err := h.probe(ctx, p)
+		h.mu.Lock()
+		prev := h.results[p.name]
+		h.results[p.name] = err
+		h.mu.Unlock()
+
+		switch {
+		case err != nil && prev == nil:
+			h.logger.Warnw("health probe failing", "probe", p.name, "error", err)
+		case err == nil && prev != nil:
+			h.logger.Infow("health probe recovered", "probe", p.name)
+		}
+		up := 1.0
+		if err != nil {
+			up, healthy = 0, false
+		}
+		h.metrics.healthProbeUp.WithLabelValues(p.name).Set(up)
+	}
+
+	// ignored once shutdown has marked everything NOT_SERVING
+	status := healthpb.HealthCheckResponse_SERVING
+	if !healthy {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	h.grpc.SetServingStatus(pb.ImageProcessor_ServiceDesc.ServiceName, status)
+	h.grpc.SetServingStatus("", status)
+}
+
+// probe runs p with the probe timeout; a probe stuck on a hung disk is
+// abandoned and counted as failed
+func (h *healthChecker) probe(ctx context.Context, p healthProbe) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- p.check(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("no answer within %s", h.timeout)
+	}
+}
+
+// healthz answers liveness checks: it fails only on liveness probes
+func (h *healthChecker) healthz(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, func(p healthProbe) bool { return p.liveness }, false)
+}
+
+// readyz answers readiness checks: every probe must pass, and a draining
+// server is never ready
+func (h *healthChecker) readyz(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, func(healthProbe) bool { return true }, h.draining())
+}
+
+// respond writes the results of the probes selected by include as JSON,
+// with 503 if any of them failed
+func (h *healthChecker) respond(w http.ResponseWriter, include func(healthProbe) bool, draining bool) {
+	body := struct {
+		Status   string            `json:"status"`
+		Draining bool              `json:"draining,omitempty"`
+		Checks   map[string]string `json:"checks"`
+	}{Status: "ok", Draining: draining, Checks: map[string]string{}}
+	if draining {
+		body.Status = "unavailable"
+	}
+	h.mu.Lock()
+	for _, p := range h.probes {
+		if !include(p) {
+			continue
+		}
+		switch err, ok := h.results[p.name]; {
+		case !ok:
+			body.Checks[p.name] = "pending"
+			body.Status = "unavailable"
+		case err != nil:
+			body.Checks[p.name] = err.Error()
+			body.Status = "unavailable"
+		default:
+			body.Checks[p.name] = "ok"
+		}
+	}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if body.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image-proc/config"
+	pb "image-proc/proto"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// newTestChecker returns a checker for s with cfg's optional probes
+func newTestChecker(s *server, cfg config.Health) *healthChecker {
+	cfg.Interval, cfg.Timeout = time.Hour, time.Second
+	return newHealthChecker(health.NewServer(), s, cfg)
+}
+
+// healthBody is what /healthz and /readyz answer
+type healthBody struct {
+	Status   string            `json:"status"`
+	Draining bool              `json:"draining"`
+	Checks   map[string]string `json:"checks"`
+}
+
+// getHealth calls handler and decodes its answer
+func getHealth(t *testing.T, handler http.HandlerFunc) (int, healthBody) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var body healthBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body, err)
+	}
+	return rec.Code, body
+}
+
+// servingStatus returns what the gRPC health service reports for service
+func servingStatus(t *testing.T, h *healthChecker, service string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	resp, err := h.grpc.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Status
+}
+
+// wantHealth checks the gRPC status and both endpoints against each other
+func wantHealth(t *testing.T, h *healthChecker, serving bool, readyCode, liveCode int) (ready, live healthBody) {
+	t.Helper()
+	want := healthpb.HealthCheckResponse_SERVING
+	if !serving {
+		want = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, service := range []string{"", pb.ImageProcessor_ServiceDesc.ServiceName} {
+		if got := servingStatus(t, h, service); got != want {
+			t.Errorf("service %q is %s, want %s", service, got, want)
+		}
+	}
+	code, ready := getHealth(t, h.readyz)
+	if code != readyCode {
+		t.Errorf("readyz = %d %+v, want %d", code, ready, readyCode)
+	}
+	code, live = getHealth(t, h.healthz)
+	if code != liveCode {
+		t.Errorf("healthz = %d %+v, want %d", code, live, liveCode)
+	}
+	return ready, live
+}
+
+func TestHealthStorage(t *testing.T) {
+	s := newTestServer(t)
+	h := newTestChecker(s, config.Health{})
+
+	// nothing has run yet
+	if code, body := getHealth(t, h.readyz); code != http.StatusServiceUnavailable || body.Checks["storage"] != "pending" {
+		t.Errorf("readyz before the first check = %d %+v, want pending", code, body)
+	}
+
+	h.checkAll(context.Background())
+	ready, _ := wantHealth(t, h, true, http.StatusOK, http.StatusOK)
+	if ready.Status != "ok" || ready.Checks["storage"] != "ok" || ready.Checks["jobs"] != "ok" {
+		t.Errorf("readyz = %+v, want every check ok", ready)
+	}
+	if up := testutil.ToFloat64(s.metrics.healthProbeUp.WithLabelValues("storage")); up != 1 {
+		t.Errorf("storage probe gauge = %v, want 1", up)
+	}
+
+	// a file where the upload directory should be cannot be written to
+	dir := s.store.dir
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h.checkAll(context.Background())
+	ready, live := wantHealth(t, h, false, http.StatusServiceUnavailable, http.StatusOK)
+	if ready.Checks["storage"] == "ok" || ready.Checks["storage"] == "" {
+		t.Errorf("readyz = %+v, want the storage error", ready)
+	}
+	if _, ok := live.Checks["storage"]; ok {
+		t.Errorf("healthz = %+v, want readiness probes left out", live)
+	}
+	if up := testutil.ToFloat64(s.metrics.healthProbeUp.WithLabelValues("storage")); up != 0 {
+		t.Errorf("storage probe gauge = %v, want 0", up)
+	}
+
+	// and it recovers once the directory is back
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	h.checkAll(context.Background())
+	wantHealth(t, h, true, http.StatusOK, http.StatusOK)
+}
+
+func TestHealthJobStore(t *testing.T) {
+	s := newTestServer(t)
+	h := newTestChecker(s, config.Health{})
+	h.checkAll(context.Background())
+	wantHealth(t, h, true, http.StatusOK, http.StatusOK)
+
+	s.jobs.store.close()
+	h.checkAll(context.Background())
+	ready, _ := wantHealth(t, h, false, http.StatusServiceUnavailable, http.StatusOK)
+	if ready.Checks["jobs"] == "ok" || ready.Checks["storage"] != "ok" {
+		t.Errorf("readyz = %+v, want only the job store failing", ready)
+	}
+}
+
+func TestHealthStalledWorkers(t *testing.T) {
+	s := newTestServer(t)
+	h := newTestChecker(s, config.Health{StallTimeout: 20 * time.Millisecond})
+
+	release, err := s.workers.acquire(context.Background(), workTicket{principal: "alice"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.checkAll(context.Background())
+	wantHealth(t, h, true, http.StatusOK, http.StatusOK)
+
+	// a busy worker that stops moving takes liveness down too
+	time.Sleep(40 * time.Millisecond)
+	h.checkAll(context.Background())
+	_, live := wantHealth(t, h, false, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	if !strings.Contains(live.Checks["workers"], "no progress") {
+		t.Errorf("healthz = %+v, want the stalled workers", live)
+	}
+
+	// progress, or having nothing to do, is healthy again
+	s.workers.advance()
+	h.checkAll(context.Background())
+	wantHealth(t, h, true, http.StatusOK, http.StatusOK)
+	release()
+	time.Sleep(40 * time.Millisecond)
+	h.checkAll(context.Background())
+	wantHealth(t, h, true, http.StatusOK, http.StatusOK)
+}
+
+func TestHealthProbeTimeout(t *testing.T) {
+	s := newTestServer(t)
+	h := newTestChecker(s, config.Health{})
+	h.timeout = 10 * time.Millisecond
+	hung := make(chan struct{})
+	defer close(hung)
+	h.probes = append(h.probes, healthProbe{name: "hung", check: func(context.Context) error {
+		<-hung
+		return nil
+	}})
+
+	h.checkAll(context.Background())
+	ready, _ := wantHealth(t, h, false, http.StatusServiceUnavailable, http.StatusOK)
+	if !strings.Contains(ready.Checks["hung"], "no answer within") {
+		t.Errorf("readyz = %+v, want the hung probe timed out", ready)
+	}
+}
+
+func TestReadyzWhileDraining(t *testing.T) {
+	s := newTestServer(t)
+	h := newTestChecker(s, config.Health{})
+	h.checkAll(context.Background())
+	wantHealth(t, h, true, http.StatusOK, http.StatusOK)
+
+	s.workers.drain()
+	code, ready := getHealth(t, h.readyz)
+	if code != http.StatusServiceUnavailable || !ready.Draining || ready.Status != "unavailable" {
+		t.Errorf("readyz while draining = %d %+v, want 503 and draining", code, ready)
+	}
+	// the probes themselves still pass, and the process is alive
+	if ready.Checks["storage"] != "ok" {
+		t.Errorf("readyz while draining = %+v, want the probes still ok", ready)
+	}
+	if code, live := getHealth(t, h.healthz); code != http.StatusOK || live.Draining {
+		t.Errorf("healthz while draining = %d %+v, want 200", code, live)
+	}
+}
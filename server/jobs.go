@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	pb "image-proc/proto"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// jobRetention is how long a finished job stays in memory for watchers;
+// its record stays in the job store until the store's retention expires
+const jobRetention = time.Hour
+
+// jobPersistInterval bounds how often progress within one state is
+// written to the job store; state changes are always written at once
+const jobPersistInterval = time.Second
+
+// job tracks one unit of processing so other clients can watch its
+// progress, and mirrors its state into the job store
+type job struct {
+	id       string
+	imageID  string
+	filters  []string
+	owner    string
+	priority pb.Priority
+	callback string // URL notified when the job finishes, if any
+	created  time.Time
+	restarts int32
+
+	store  *jobStore
+	events *eventLog
+	logger *zap.SugaredLogger
+
+	// publishMu keeps the events and store writes of one job in the
+	// order its updates were published, without holding mu for them
+	publishMu   sync.Mutex
+	persisted   pb.JobState
+	persistedAt time.Time
+
+	mu           sync.Mutex
+	last         *pb.ProgressUpdate
+	errMsg       string
+	attempts     int32
+	started      time.Time
+	failureCode  codes.Code
+	retryable    bool
+	deadLettered time.Time
+	updated      time.Time
+	finished     time.Time
+	watchers     map[chan *pb.ProgressUpdate]struct{}
+}
+
+// isTerminal reports whether state is one a job never leaves
+func isTerminal(state pb.JobState) bool {
+	switch state {
+	case pb.JobState_JOB_STATE_SUCCEEDED, pb.JobState_JOB_STATE_FAILED, pb.JobState_JOB_STATE_CANCELLED:
+		return true
+	}
+	return false
+}
+
+// update records a progress update and fans it out to watchers. The
+// returned message is what the Process stream itself should send.
+func (j *job) update(state pb.JobState, percent int32, msg string) *pb.ProgressUpdate {
+	return j.publish(&pb.ProgressUpdate{JobId: j.id, State: state, Percent: percent, Status: msg})
+}
+
+// succeed records the final update, which names the processed image
+func (j *job) succeed(resultID string) *pb.ProgressUpdate {
+	return j.publish(&pb.ProgressUpdate{
+		JobId:         j.id,
+		State:         pb.JobState_JOB_STATE_SUCCEEDED,
+		Percent:       100,
+		Status:        "100% complete",
+		ResultImageId: resultID,
+	})
+}
+
+// queued reports where a waiting job stands in the queue
+func (j *job) queued(position int) *pb.ProgressUpdate {
+	return j.publish(&pb.ProgressUpdate{
+		JobId:         j.id,
+		State:         pb.JobState_JOB_STATE_QUEUED,
+		Status:        fmt.Sprintf("queued, position %d", position),
+		QueuePosition: int32(position),
+	})
+}
+
+// startAttempt counts another run of the job and returns its number
+func (j *job) startAttempt() int32 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.attempts++
+	if j.started.IsZero() {
+		j.started = time.Now()
+	}
+	return j.attempts
+}
+
+// fail records err as the job's final failure and moves the job to the
+// dead letters, from where RedriveJob can run it again
+func (j *job) fail(err error, retryable bool) *pb.ProgressUpdate {
+	j.mu.Lock()
+	j.failureCode = status.Code(err)
+	j.retryable = retryable
+	j.deadLettered = time.Now()
+	j.mu.Unlock()
+	return j.end(pb.JobState_JOB_STATE_FAILED, status.Convert(err).Message())
+}
+
+// interrupt puts a job that was stopped by a server shutdown back into
+// the queue, so the next start recovers it according to its policy
+func (j *job) interrupt(msg string) *pb.ProgressUpdate {
+	return j.update(pb.JobState_JOB_STATE_QUEUED, 0, msg)
+}
+
+// publish stores upd as the latest update and fans it out to watchers,
+// then records it in the event log and the job store. Watchers and
+// readers of the job are not held up by the store write.
+func (j *job) publish(upd *pb.ProgressUpdate) *pb.ProgressUpdate {
+	j.publishMu.Lock()
+	defer j.publishMu.Unlock()
+
+	j.mu.Lock()
+	prev := pb.JobState_JOB_STATE_UNSPECIFIED
+	if j.last != nil {
+		prev = j.last.State
+	}
+	j.last = upd
+	j.updated = time.Now()
+	if isTerminal(upd.State) {
+		j.finished = j.updated
+		if upd.State != pb.JobState_JOB_STATE_SUCCEEDED {
+			j.errMsg = upd.Status
+		}
+	}
+	var r *jobRecord
+	if upd.State != j.persisted || time.Since(j.persistedAt) >= jobPersistInterval {
+		r = j.recordLocked()
+	}
+
+	for ch := range j.watchers {
+		// watchers only care about the latest state, so a slow one
+		// drops the stale update instead of blocking the job
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- proto.Clone(upd).(*pb.ProgressUpdate)
+	}
+	if isTerminal(upd.State) {
+		for ch := range j.watchers {
+			close(ch)
+		}
+		j.watchers = nil
+	}
+	j.mu.Unlock()
+
+	if typ := jobEventType(prev, upd.State); typ != pb.EventType_EVENT_TYPE_UNSPECIFIED {
+		j.events.jobEvent(typ, j, upd)
+	}
+	if r != nil {
+		j.persist(r, upd.State)
+	}
+	return upd
+}
+
+// persist writes r, the job in state, to the store. j.publishMu must be
+// held.
+func (j *job) persist(r *jobRecord, state pb.JobState) {
+	if err := j.store.put(r); err != nil {
+		// the job itself carries on; only its durability suffers
+		j.logger.Warnw("failed to persist job", "job_id", j.id, "error", err)
+		return
+	}
+	j.persisted, j.persistedAt = state, time.Now()
+}
+
+// record returns the job's persisted form
+func (j *job) record() *jobRecord {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.recordLocked()
+}
+
+func (j *job) recordLocked() *jobRecord {
+	r := &jobRecord{
+		ID:        j.id,
+		ImageID:   j.imageID,
+		Filters:   j.filters,
+		Owner:     j.owner,
+		Priority:  j.priority.String(),
+		Callback:  j.callback,
+		Error:     j.errMsg,
+		Restarts:  j.restarts,
+		Attempts:  j.attempts,
+		CreatedAt: j.created,
+		UpdatedAt: j.updated,
+	}
+	if !j.deadLettered.IsZero() {
+		deadLettered := j.deadLettered
+		r.DeadLetteredAt = &deadLettered
+		r.FailureCode = int32(j.failureCode)
+		r.Retryable = j.retryable
+	}
+	if j.last != nil {
+		r.State = j.last.State.String()
+		r.Percent = j.last.Percent
+		r.Status = j.last.Status
+		r.ResultImageID = j.last.ResultImageId
+	}
+	if !j.started.IsZero() {
+		started := j.started
+		r.StartedAt = &started
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		r.FinishedAt = &finished
+	}
+	return r
+}
+
+// end records a terminal state, keeping the last reported percentage
+func (j *job) end(state pb.JobState, msg string) *pb.ProgressUpdate {
+	j.mu.Lock()
+	var pct int32
+	if j.last != nil {
+		pct = j.last.Percent
+	}
+	j.mu.Unlock()
+	return j.update(state, pct, msg)
+}
+
+// latest returns the most recent update
+func (j *job) latest() *pb.ProgressUpdate {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
+
+// watch subscribes to updates, starting with the most recent one. The
+// channel is closed when the job finishes or cancel is called.
+func (j *job) watch() (<-chan *pb.ProgressUpdate, func()) {
+	ch := make(chan *pb.ProgressUpdate, 1)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.last != nil {
+		ch <- proto.Clone(j.last).(*pb.ProgressUpdate)
+		if isTerminal(j.last.State) {
+			close(ch)
+			return ch, func() {}
+		}
+	}
+	if j.watchers == nil {
+		j.watchers = make(map[chan *pb.ProgressUpdate]struct{})
+	}
+	j.watchers[ch] = struct{}{}
+
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.watchers[ch]; ok {
+			delete(j.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// jobManager is the registry of live jobs, backed by the job store for
+// jobs that have finished or outlived a restart
+type jobManager struct {
+	store  *jobStore
+	events *eventLog
+	logger *zap.SugaredLogger
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+func newJobManager(store *jobStore, events *eventLog, logger *zap.SugaredLogger) *jobManager {
+	return &jobManager{store: store, events: events, logger: logger, jobs: make(map[string]*job)}
+}
+
+// create registers a new job; it is persisted with its first update
+func (m *jobManager) create(imageID string, filters []string, owner string, priority pb.Priority, callback string) *job {
+	return m.register(&job{
+		id:       uuid.New().String(),
+		imageID:  imageID,
+		filters:  filters,
+		owner:    owner,
+		priority: normalizePriority(priority),
+		callback: callback,
+		created:  time.Now(),
+	})
+}
+
+// restore registers a job recovered from the store after a restart
+func (m *jobManager) restore(r *jobRecord) *job {
+	return m.register(&job{
+		id:       r.ID,
+		imageID:  r.ImageID,
+		filters:  r.Filters,
+		owner:    r.Owner,
+		priority: r.priority(),
+		callback: r.Callback,
+		created:  r.CreatedAt,
+		restarts: r.Restarts + 1,
+		attempts: r.Attempts,
+	})
+}
+
+// redrive registers a dead-lettered job to run again under its own ID
+func (m *jobManager) redrive(r *jobRecord) *job {
+	return m.register(&job{
+		id:       r.ID,
+		imageID:  r.ImageID,
+		filters:  r.Filters,
+		owner:    r.Owner,
+		priority: r.priority(),
+		callback: r.Callback,
+		created:  r.CreatedAt,
+		restarts: r.Restarts,
+		attempts: r.Attempts,
+	})
+}
+
+func (m *jobManager) register(j *job) *job {
+	j.store, j.events, j.logger = m.store, m.events, m.logger
+	m.mu.Lock()
+	m.jobs[j.id] = j
+	m.mu.Unlock()
+	return j
+}
+
+// get looks up a live job by ID
+func (m *jobManager) get(id string) (*job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// lookup returns the current record of any job, live or persisted, or
+// nil if the job is unknown
+func (m *jobManager) lookup(id string) (*jobRecord, error) {
+	if j, ok := m.get(id); ok {
+		return j.record(), nil
+	}
+	return m.store.get(id)
+}
+
+// finish forgets j once the retention period has passed, unless a
+// redrive has replaced it in the meantime
+func (m *jobManager) finish(j *job) {
+	time.AfterFunc(jobRetention, func() {
+		m.mu.Lock()
+		if m.jobs[j.id] == j {
+			delete(m.jobs, j.id)
+		}
+		m.mu.Unlock()
+	})
+}
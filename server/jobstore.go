@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	pb "image-proc/proto"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	// jobsBucket maps job ID to its JSON record
+	jobsBucket = []byte("jobs")
+	// jobsByCreatedBucket indexes job IDs by creation time so listings
+	// can page through them newest first
+	jobsByCreatedBucket = []byte("jobs_by_created")
+	// deadLettersBucket indexes dead-lettered job IDs by the time they
+	// were dead-lettered
+	deadLettersBucket = []byte("dead_letters")
+	// deliveriesBucket holds webhook delivery attempts under keys made of
+	// the job ID, a slash and a sequence number
+	deliveriesBucket = []byte("webhook_deliveries")
+)
+
+// jobRecord is the persisted form of a job
+type jobRecord struct {
+	ID            string     `json:"id"`
+	ImageID       string     `json:"image_id"`
+	Filters       []string   `json:"filters"`
+	Owner         string     `json:"owner"`
+	Priority      string     `json:"priority,omitempty"`
+	Callback      string     `json:"callback_url,omitempty"`
+	State         string     `json:"state"`
+	Percent       int32      `json:"percent"`
+	Status        string     `json:"status"`
+	ResultImageID string     `json:"result_image_id,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	Restarts      int32      `json:"restarts,omitempty"`
+	Attempts      int32      `json:"attempts,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+
+	// set while the job is in the dead letters
+	DeadLetteredAt *time.Time `json:"dead_lettered_at,omitempty"`
+	FailureCode    int32      `json:"failure_code,omitempty"`
+	Retryable      bool       `json:"retryable,omitempty"`
+
+	// set once the job's webhook was delivered or given up on
+	CallbackDone bool `json:"callback_done,omitempty"`
+}
+
+func (r *jobRecord) state() pb.JobState {
+	return pb.JobState(pb.JobState_value[r.State])
+}
+
+// priority returns the job's priority; records written before priorities
+// existed run at NORMAL
+func (r *jobRecord) priority() pb.Priority {
+	return normalizePriority(pb.Priority(pb.Priority_value[r.Priority]))
+}
+
+// proto converts the record into its API representation
+func (r *jobRecord) proto() *pb.Job {
+	out := &pb.Job{
+		JobId:         r.ID,
+		ImageId:       r.ImageID,
+		Filters:       r.Filters,
+		Owner:         r.Owner,
+		Priority:      r.priority(),
+		State:         r.state(),
+		Percent:       r.Percent,
+		Status:        r.Status,
+		ResultImageId: r.ResultImageID,
+		Error:         r.Error,
+		CreatedAt:     timestamppb.New(r.CreatedAt),
+		UpdatedAt:     timestamppb.New(r.UpdatedAt),
+		Restarts:      r.Restarts,
+		Attempts:      r.Attempts,
+		CallbackUrl:   r.Callback,
+	}
+	if r.StartedAt != nil {
+		out.StartedAt = timestamppb.New(*r.StartedAt)
+	}
+	if r.FinishedAt != nil {
+		out.FinishedAt = timestamppb.New(*r.FinishedAt)
+	}
+	return out
+}
+
+// deadLetter converts a dead-lettered record into its API representation
+func (r *jobRecord) deadLetter() *pb.DeadLetter {
+	out := &pb.DeadLetter{Job: r.proto(), Code: r.FailureCode, Retryable: r.Retryable}
+	if r.DeadLetteredAt != nil {
+		out.DeadLetteredAt = timestamppb.New(*r.DeadLetteredAt)
+	}
+	return out
+}
+
+// createdKey orders records by creation time, ties broken by ID
+func (r *jobRecord) createdKey() []byte {
+	return timeKey(r.CreatedAt, r.ID)
+}
+
+// deadLetterKey orders dead letters by when they failed, or returns nil
+// if r is not dead-lettered
+func (r *jobRecord) deadLetterKey() []byte {
+	if r.DeadLetteredAt == nil {
+		return nil
+	}
+	return timeKey(*r.DeadLetteredAt, r.ID)
+}
+
+func timeKey(t time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return append(key, id...)
+}
+
+// jobStore persists job records in an embedded bbolt database
+type jobStore struct {
+	db *bolt.DB
+}
+
+// openJobStore opens or creates the database at path
+func openJobStore(path string) (*jobStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// a second server on the same file would block forever without a timeout
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open job store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, jobsByCreatedBucket, deadLettersBucket, deliveriesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &jobStore{db: db}, nil
+}
+
+func (st *jobStore) close() error {
+	return st.db.Close()
+}
+
+// check commits an empty write transaction, which fails once the
+// database is closed or its disk refuses writes
+func (st *jobStore) check() error {
+	return st.db.Update(func(*bolt.Tx) error { return nil })
+}
+
+// put inserts or replaces a record
+func (st *jobStore) put(r *jobRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return st.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(jobsBucket).Put([]byte(r.ID), data); err != nil {
+			return err
+		}
+		if key := r.deadLetterKey(); key != nil {
+			if err := tx.Bucket(deadLettersBucket).Put(key, []byte(r.ID)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(jobsByCreatedBucket).Put(r.createdKey(), []byte(r.ID))
+	})
+}
+
+// takeDeadLetter removes the job from the dead letters and returns its
+// record, or nil if the job is unknown or not dead-lettered. Only one of
+// several concurrent callers gets the record.
+func (st *jobStore) takeDeadLetter(id string) (*jobRecord, error) {
+	var r *jobRecord
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		data := jobs.Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		var rec jobRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		key := rec.deadLetterKey()
+		if key == nil {
+			return nil
+		}
+		if err := tx.Bucket(deadLettersBucket).Delete(key); err != nil {
+			return err
+		}
+		rec.DeadLetteredAt, rec.FailureCode, rec.Retryable = nil, 0, false
+		data, err := json.Marshal(&rec)
+		if err != nil {
+			return err
+		}
+		r = &rec
+		return jobs.Put([]byte(id), data)
+	})
+	return r, err
+}
+
+// get returns the record for id, or nil if there is none
+func (st *jobStore) get(id string) (*jobRecord, error) {
+	var r *jobRecord
+	err := st.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		r = &jobRecord{}
+		return json.Unmarshal(data, r)
+	})
+	return r, err
+}
+
+// list returns up to limit records matching keep, newest first by the
+// time key of index, starting below the cursor returned by the previous
+// call (nil for the first page). The returned cursor is nil once there is
+// nothing left.
+func (st *jobStore) list(index []byte, keep func(*jobRecord) bool, cursor []byte, limit int) ([]*jobRecord, []byte, error) {
+	var out []*jobRecord
+	var next []byte
+	err := st.db.View(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		c := tx.Bucket(index).Cursor()
+
+		var k, v []byte
+		if cursor == nil {
+			k, v = c.Last()
+		} else {
+			// Seek finds the first key >= cursor; step back below it
+			k, v = c.Seek(cursor)
+			if k == nil {
+				k, v = c.Last()
+			}
+			for k != nil && bytes.Compare(k, cursor) >= 0 {
+				k, v = c.Prev()
+			}
+		}
+		for ; k != nil; k, v = c.Prev() {
+			data := jobs.Get(v)
+			if data == nil {
+				continue
+			}
+			var r jobRecord
+			if err := json.Unmarshal(data, &r); err != nil {
+				return err
+			}
+			if !keep(&r) {
+				continue
+			}
+			if len(out) == limit {
+				next = bytes.Clone(k)
+				// the next page starts at this record
+				next = append(next, 0)
+				return nil
+			}
+			out = append(out, &r)
+		}
+		return nil
+	})
+	return out, next, err
+}
+
+// unfinished returns every record not in a terminal state
+func (st *jobStore) unfinished() ([]*jobRecord, error) {
+	return st.scan(func(r *jobRecord) bool { return !isTerminal(r.state()) })
+}
+
+// pendingCallbacks returns finished jobs whose webhook is still due
+func (st *jobStore) pendingCallbacks() ([]*jobRecord, error) {
+	return st.scan(func(r *jobRecord) bool {
+		return isTerminal(r.state()) && r.Callback != "" && !r.CallbackDone
+	})
+}
+
+// scan returns every record matching keep, in no particular order
+func (st *jobStore) scan(keep func(*jobRecord) bool) ([]*jobRecord, error) {
+	var out []*jobRecord
+	err := st.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, data []byte) error {
+			var r jobRecord
+			if err := json.Unmarshal(data, &r); err != nil {
+				return err
+			}
+			if keep(&r) {
+				out = append(out, &r)
+			}
+			return nil
+		})
+	})
+	return out, err
+}
+
+// markCallbackDone records that the job's webhook needs no more attempts
+func (st *jobStore) markCallbackDone(id string) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		data := jobs.Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		var r jobRecord
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		r.CallbackDone = true
+		data, err := json.Marshal(&r)
+		if err != nil {
+			return err
+		}
+		return jobs.Put([]byte(id), data)
+	})
+}
+
+// deliveryRecord is the persisted form of one webhook delivery attempt
+type deliveryRecord struct {
+	DeliveryID string        `json:"delivery_id"`
+	Attempt    int32         `json:"attempt"`
+	URL        string        `json:"url"`
+	SentAt     time.Time     `json:"sent_at"`
+	Duration   time.Duration `json:"duration"`
+	StatusCode int32         `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Succeeded  bool          `json:"succeeded"`
+}
+
+func (d *deliveryRecord) proto() *pb.WebhookDelivery {
+	return &pb.WebhookDelivery{
+		DeliveryId: d.DeliveryID,
+		Attempt:    d.Attempt,
+		Url:        d.URL,
+		SentAt:     timestamppb.New(d.SentAt),
+		DurationMs: d.Duration.Milliseconds(),
+		StatusCode: d.StatusCode,
+		Error:      d.Error,
+		Succeeded:  d.Succeeded,
+	}
+}
+
+func deliveryPrefix(jobID string) []byte {
+	return []byte(jobID + "/")
+}
+
+// addDelivery appends a delivery attempt to the job's history
+func (st *jobStore) addDelivery(jobID string, d *deliveryRecord) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := binary.BigEndian.AppendUint64(deliveryPrefix(jobID), seq)
+		return b.Put(key, data)
+	})
+}
+
+// deliveries returns the job's delivery attempts, oldest first
+func (st *jobStore) deliveries(jobID string) ([]*deliveryRecord, error) {
+	var out []*deliveryRecord
+	prefix := deliveryPrefix(jobID)
+	err := st.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(deliveriesBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var d deliveryRecord
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			out = append(out, &d)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// purge deletes finished records older than cutoff and reports how many
+func (st *jobStore) purge(cutoff time.Time) (int, error) {
+	n := 0
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		index := tx.Bucket(jobsByCreatedBucket)
+		deadLetters := tx.Bucket(deadLettersBucket)
+		deliveries := tx.Bucket(deliveriesBucket)
+
+		// records are ordered by creation, and a job finishes after it
+		// was created, so the scan stops at the first newer record.
+		// Keys are collected first since deleting moves the cursor.
+		var stale, staleDeadLetters [][]byte
+		c := index.Cursor()
+		for k, v := c.First(); k != nil && int64(binary.BigEndian.Uint64(k)) < cutoff.UnixNano(); k, v = c.Next() {
+			if data := jobs.Get(v); data != nil {
+				var r jobRecord
+				if err := json.Unmarshal(data, &r); err != nil {
+					return err
+				}
+				if r.FinishedAt == nil || r.FinishedAt.After(cutoff) {
+					continue
+				}
+				if key := r.deadLetterKey(); key != nil {
+					staleDeadLetters = append(staleDeadLetters, key)
+				}
+			}
+			stale = append(stale, bytes.Clone(k))
+		}
+		for _, k := range stale {
+			if err := jobs.Delete(k[8:]); err != nil {
+				return err
+			}
+			if err := index.Delete(k); err != nil {
+				return err
+			}
+		}
+		for _, k := range staleDeadLetters {
+			if err := deadLetters.Delete(k); err != nil {
+				return err
+			}
+		}
+		for _, k := range stale {
+			var keys [][]byte
+			prefix := deliveryPrefix(string(k[8:]))
+			c := deliveries.Cursor()
+			for dk, _ := c.Seek(prefix); dk != nil && bytes.HasPrefix(dk, prefix); dk, _ = c.Next() {
+				keys = append(keys, bytes.Clone(dk))
+			}
+			for _, dk := range keys {
+				if err := deliveries.Delete(dk); err != nil {
+					return err
+				}
+			}
+		}
+		n = len(stale)
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	pb "image-proc/proto"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestJobStore opens a job store in a temporary directory
+func newTestJobStore(t *testing.T) *jobStore {
+	t.Helper()
+	st, err := openJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.close() })
+	return st
+}
+
+// putJob stores a record for a job created at created, finished at
+// finished unless that is zero
+func putJob(t *testing.T, st *jobStore, id, owner string, created, finished time.Time) *jobRecord {
+	t.Helper()
+	r := &jobRecord{
+		ID:        id,
+		ImageID:   "img-" + id,
+		Filters:   []string{"blur"},
+		Owner:     owner,
+		State:     pb.JobState_JOB_STATE_RUNNING.String(),
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+	if !finished.IsZero() {
+		r.State = pb.JobState_JOB_STATE_SUCCEEDED.String()
+		r.UpdatedAt, r.FinishedAt = finished, &finished
+	}
+	if err := st.put(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func ids(records []*jobRecord) []string {
+	var out []string
+	for _, r := range records {
+		out = append(out, r.ID)
+	}
+	return out
+}
+
+func TestJobStorePutGet(t *testing.T) {
+	st := newTestJobStore(t)
+	created := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	putJob(t, st, "a", "alice", created, time.Time{})
+
+	r, err := st.get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil || r.Owner != "alice" || r.ImageID != "img-a" || r.state() != pb.JobState_JOB_STATE_RUNNING || !r.CreatedAt.Equal(created) {
+		t.Fatalf("get = %+v, want the stored record", r)
+	}
+
+	// put replaces the record without indexing it twice
+	r.State = pb.JobState_JOB_STATE_SUCCEEDED.String()
+	r.ResultImageID = "result"
+	if err := st.put(r); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := st.get("a"); r.state() != pb.JobState_JOB_STATE_SUCCEEDED || r.ResultImageID != "result" {
+		t.Errorf("get after replace = %+v", r)
+	}
+	all, _, err := st.list(jobsByCreatedBucket, func(*jobRecord) bool { return true }, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Errorf("list after replace = %v, want the job once", ids(all))
+	}
+
+	if r, err := st.get("missing"); r != nil || err != nil {
+		t.Errorf("get of a missing job = %+v, %v; want nil, nil", r, err)
+	}
+}
+
+func TestJobStoreList(t *testing.T) {
+	st := newTestJobStore(t)
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	for i := range 7 {
+		owner := "alice"
+		if i%2 == 1 {
+			owner = "bob"
+		}
+		putJob(t, st, fmt.Sprintf("j%d", i), owner, start.Add(time.Duration(i)*time.Minute), time.Time{})
+	}
+	// created at the same instant: the ID breaks the tie
+	putJob(t, st, "j7a", "alice", start.Add(7*time.Minute), time.Time{})
+	putJob(t, st, "j7b", "alice", start.Add(7*time.Minute), time.Time{})
+
+	tests := []struct {
+		name  string
+		keep  func(*jobRecord) bool
+		limit int
+		want  [][]string
+	}{
+		{
+			name:  "all, newest first",
+			keep:  func(*jobRecord) bool { return true },
+			limit: 4,
+			want:  [][]string{{"j7b", "j7a", "j6", "j5"}, {"j4", "j3", "j2", "j1"}, {"j0"}},
+		},
+		{
+			name:  "exact pages",
+			keep:  func(*jobRecord) bool { return true },
+			limit: 3,
+			want:  [][]string{{"j7b", "j7a", "j6"}, {"j5", "j4", "j3"}, {"j2", "j1", "j0"}},
+		},
+		{
+			name:  "one owner",
+			keep:  func(r *jobRecord) bool { return r.Owner == "bob" },
+			limit: 2,
+			want:  [][]string{{"j5", "j3"}, {"j1"}},
+		},
+		{
+			name:  "nobody",
+			keep:  func(r *jobRecord) bool { return r.Owner == "carol" },
+			limit: 2,
+			want:  [][]string{nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cursor []byte
+			for i, want := range tt.want {
+				page, next, err := st.list(jobsByCreatedBucket, tt.keep, cursor, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ids(page); fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Fatalf("page %d = %v, want %v", i, got, want)
+				}
+				if last := i == len(tt.want)-1; last != (next == nil) {
+					t.Fatalf("page %d returned cursor %q", i, next)
+				}
+				cursor = next
+			}
+		})
+	}
+}
+
+func TestJobStorePurge(t *testing.T) {
+	st := newTestJobStore(t)
+	now := time.Now()
+	cutoff := now.Add(-24 * time.Hour)
+	old := now.Add(-48 * time.Hour)
+
+	putJob(t, st, "expired", "alice", old, old.Add(time.Minute))
+	putJob(t, st, "finished-recently", "alice", old, now.Add(-time.Hour))
+	putJob(t, st, "unfinished", "alice", old, time.Time{})
+	putJob(t, st, "new", "alice", now.Add(-time.Hour), now.Add(-time.Minute))
+	dead := putJob(t, st, "dead-lettered", "alice", old, old.Add(time.Minute))
+	dead.State = pb.JobState_JOB_STATE_FAILED.String()
+	dead.DeadLetteredAt = dead.FinishedAt
+	if err := st.put(dead); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.addDelivery("expired", &deliveryRecord{Attempt: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := st.purge(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("purge removed %d jobs, want 2", n)
+	}
+	for id, kept := range map[string]bool{"expired": false, "dead-lettered": false, "finished-recently": true, "unfinished": true, "new": true} {
+		if r, _ := st.get(id); (r != nil) != kept {
+			t.Errorf("%s: kept = %v, want %v", id, r != nil, kept)
+		}
+	}
+	all, _, _ := st.list(jobsByCreatedBucket, func(*jobRecord) bool { return true }, nil, 10)
+	if len(all) != 3 {
+		t.Errorf("index lists %v after purge, want the 3 kept jobs", ids(all))
+	}
+	dls, _, _ := st.list(deadLettersBucket, func(*jobRecord) bool { return true }, nil, 10)
+	if len(dls) != 0 {
+		t.Errorf("dead letters list %v after purge, want none", ids(dls))
+	}
+	if ds, _ := st.deliveries("expired"); len(ds) != 0 {
+		t.Errorf("purged job kept %d webhook deliveries", len(ds))
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"image-proc/logging"
+	"image-proc/tracing"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is the metadata key carrying the request ID in both directions.
+const requestIDKey = "x-request-id"
+
+// requestLogger is the per-RPC logger stored in the context. Interceptors
+// and handlers add fields to it as they learn more about the call, and
+// the final log line written by the interceptor includes all of them.
+type requestLogger struct {
+	mu     sync.Mutex
+	logger *zap.SugaredLogger
+}
+
+type requestLoggerKey struct{}
+
+// addLogFields attaches key/value pairs to the request logger in ctx.
+// It is a no-op when ctx was not created by the logging interceptors.
+func addLogFields(ctx context.Context, keysAndValues ...interface{}) {
+	rl, ok := ctx.Value(requestLoggerKey{}).(*requestLogger)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	rl.logger = rl.logger.With(keysAndValues...)
+	rl.mu.Unlock()
+}
+
+// loggerFromContext returns the request logger in ctx, or fallback when
+// there is none.
+func loggerFromContext(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	rl, ok := ctx.Value(requestLoggerKey{}).(*requestLogger)
+	if !ok {
+		return fallback
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.logger
+}
+
+// requestIDFromIncoming returns the caller's x-request-id, or a new one
+// if it sent none or one that is not a valid ID.
+func requestIDFromIncoming(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDKey); len(ids) > 0 && logging.ValidRequestID(ids[0]) {
+			return ids[0]
+		}
+	}
+	return uuid.New().String()
+}
+
+// newRequestContext derives the per-RPC context: it carries a logger
+// populated with request ID, method, peer and trace fields.
+func newRequestContext(ctx context.Context, base *zap.SugaredLogger, method, requestID string) context.Context {
+	fields := []interface{}{"request_id", requestID, "method", method}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields = append(fields, "peer", p.Addr.String())
+	}
+	fields = append(fields, tracing.LogFields(ctx)...)
+	return context.WithValue(ctx, requestLoggerKey{}, &requestLogger{logger: base.With(fields...)})
+}
+
+// logCompletion writes the single summary line for a finished RPC.
+func logCompletion(ctx context.Context, start time.Time, err error) {
+	log := loggerFromContext(ctx, zap.S())
+	fields := []interface{}{"duration", time.Since(start), "code", status.Code(err).String()}
+	if err != nil {
+		log.Warnw("rpc failed", append(fields, "error", err)...)
+		return
+	}
+	log.Infow("rpc completed", fields...)
+}
+
+// loggingUnaryInterceptor creates the request-scoped logger for each unary
+// RPC, echoes the request ID and logs the outcome.
+func loggingUnaryInterceptor(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+		requestID := requestIDFromIncoming(ctx)
+		ctx = newRequestContext(ctx, logger, info.FullMethod, requestID)
+		if r, ok := req.(interface{ GetImageId() string }); ok && r.GetImageId() != "" {
+			addLogFields(ctx, "image_id", r.GetImageId())
+		}
+
+		md := metadata.Pairs(requestIDKey, requestID)
+		grpc.SetHeader(ctx, md)
+		grpc.SetTrailer(ctx, md)
+
+		resp, err := handler(ctx, req)
+		logCompletion(ctx, start, err)
+		return resp, err
+	}
+}
+
+// loggingStreamInterceptor does the same for streaming RPCs. Handlers add
+// the image ID themselves once they have received it.
+func loggingStreamInterceptor(logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+		requestID := requestIDFromIncoming(ss.Context())
+		ctx := newRequestContext(ss.Context(), logger, info.FullMethod, requestID)
+
+		md := metadata.Pairs(requestIDKey, requestID)
+		ss.SetHeader(md)
+		ss.SetTrailer(md)
+
+		err := handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+		logCompletion(ctx, start, err)
+		return err
+	}
+}
+
+// contextServerStream overrides the context of a wrapped ServerStream so
+// values added by interceptors reach the handler.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
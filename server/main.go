@@ -2,10 +2,19 @@ package main
 
 import (
 	"context"
+	"image-proc/config"
+	"image-proc/logging"
 	pb "image-proc/proto"
+	"image-proc/signedurl"
+	"image-proc/tracing"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
@@ -13,74 +22,205 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
-// loggingUnaryInterceptor logs each unary RPC’s method, duration, and error.
-func loggingUnaryInterceptor(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
-	return func(
-		ctx context.Context,
-		req interface{},
-		info *grpc.UnaryServerInfo,
-		handler grpc.UnaryHandler,
-	) (interface{}, error) {
-		start := time.Now()
-		resp, err := handler(ctx, req)
-		logger.Infof("[UNARY] %s took %s; err=%v", info.FullMethod, time.Since(start), err)
-		return resp, err
-	}
-}
+func main() {
+	// set instead of exiting at once so the deferred cleanup below runs;
+	// deferred first, the exit happens last
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 
-// loggingStreamInterceptor logs each streaming RPC’s method, duration, and error.
-func loggingStreamInterceptor(logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
-	return func(
-		srv interface{},
-		ss grpc.ServerStream,
-		info *grpc.StreamServerInfo,
-		handler grpc.StreamHandler,
-	) error {
-		start := time.Now()
-		err := handler(srv, ss)
-		logger.Infof("[STREAM] %s took %s; err=%v", info.FullMethod, time.Since(start), err)
-		return err
-	}
-}
+	cfg := config.DefaultServer()
+	config.MustLoad("server", config.ServerEnvPrefix, cfg)
 
-func main() {
 	// logger
-	logger, err := zap.NewProduction()
+	logger, err := logging.New(cfg.Log)
 	if err != nil {
 		panic(err)
 	}
 	defer logger.Sync()
 	sugar := logger.Sugar()
 
-	// Health service reports SERVING
+	// Health service, kept current by the probes started below
 	healthServer := health.NewServer()
-	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	// tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), "image-proc-server", cfg.Tracing)
+	if err != nil {
+		sugar.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// auth
+	urlKeys, err := signedurl.NewKeys(cfg.URLSigning.Keys, cfg.URLSigning.ActiveKey)
+	if err != nil {
+		sugar.Fatalf("invalid URL signing keys: %v", err)
+	}
+	auth := &authenticator{tokens: cfg.AuthTokens, urlKeys: urlKeys}
+
+	// uploads interrupted by a previous crash are never resumed
+	if n, err := cleanupPartialUploads(cfg.UploadDir); err != nil {
+		sugar.Warnf("partial upload cleanup failed: %v", err)
+	} else if n > 0 {
+		sugar.Infof("removed %d stale partial uploads", n)
+	}
+
+	// metrics
+	metrics := newServerMetrics(cfg.UploadDir)
+	metricsServer := &http.Server{Addr: cfg.MetricsAddr}
 
 	// listen
-	lis, err := net.Listen("tcp", ":50051")
+	lis, err := net.Listen("tcp", cfg.Addr)
 	if err != nil {
 		sugar.Fatalf("failed to listen: %v", err)
 	}
 	sugar.Infof("gRPC server listening on %s", lis.Addr())
 
-	// Build gRPC server with interceptors
+	// Build gRPC server with interceptors; the receive limit leaves room
+	// for the protobuf framing around a maximum-sized chunk
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(loggingUnaryInterceptor(sugar)),
-		grpc.StreamInterceptor(loggingStreamInterceptor(sugar)),
+		grpc.MaxRecvMsgSize(cfg.Upload.MaxChunkBytes+1024),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(loggingUnaryInterceptor(sugar), metrics.unaryInterceptor(), auth.unaryInterceptor()),
+		grpc.ChainStreamInterceptor(loggingStreamInterceptor(sugar), metrics.streamInterceptor(), auth.streamInterceptor()),
 	)
 
+	// jobs survive restarts in the job store
+	jobStore, err := openJobStore(cfg.JobStore)
+	if err != nil {
+		sugar.Fatalf("failed to open job store: %v", err)
+	}
+	defer jobStore.close()
+
 	// Register our ImageProcessor service
-	pb.RegisterImageProcessorServer(grpcServer, &server{
-		version: "v0.1.0",
+	weights, _ := cfg.Scheduling.Weights()
+	concurrency, _ := cfg.Scheduling.Concurrency()
+	workerPool := newWorkerPool(cfg.Workers, schedulingPolicy{
+		weights:        weights,
+		defaultWeight:  cfg.Scheduling.DefaultTenantWeight,
+		maxConcurrency: cfg.Scheduling.TenantMaxConcurrency,
+		concurrency:    concurrency,
+	}, metrics)
+	sugar.Infof("running up to %d jobs at once", cfg.Workers)
+	backgroundCtx, stopBackgroundJobs := context.WithCancel(context.Background())
+	events := newEventLog(cfg.EventLogSize)
+	srv := &server{
+		version: cfg.Version,
 		logger:  sugar,
-	})
+		store:   &imageStore{dir: cfg.UploadDir},
+		jobs:    newJobManager(jobStore, events, sugar),
+		events:  events,
+		limits:  uploadLimits(cfg.Upload),
+		metrics: metrics,
+		workers: workerPool,
+		retry: retryPolicy{
+			maxAttempts:    cfg.JobRetry.MaxAttempts,
+			initialBackoff: cfg.JobRetry.InitialBackoff,
+			maxBackoff:     cfg.JobRetry.MaxBackoff,
+		},
+		webhooks: newWebhookSender(cfg.Webhook.Secret, cfg.Webhook.AllowedHosts, cfg.Webhook.AllowPrivateNetworks, cfg.Webhook.Timeout, retryPolicy{
+			maxAttempts:    cfg.Webhook.MaxAttempts,
+			initialBackoff: cfg.Webhook.InitialBackoff,
+			maxBackoff:     cfg.Webhook.MaxBackoff,
+		}, jobStore, sugar),
+		renderer: newRenderer(cfg.Render.MaxDimension, cfg.Render.Concurrency),
+		signer: urlSigner{
+			keys:       urlKeys,
+			defaultTTL: cfg.URLSigning.DefaultTTL,
+			maxTTL:     cfg.URLSigning.MaxTTL,
+			baseURL:    cfg.URLSigning.BaseURL,
+		},
+		maxBatch:     cfg.MaxBatchImages,
+		authRequired: len(cfg.AuthTokens) > 0,
+
+		backgroundCtx:      backgroundCtx,
+		stopBackgroundJobs: stopBackgroundJobs,
+	}
+	pb.RegisterImageProcessorServer(grpcServer, srv)
+
+	if n, err := srv.recoverJobs(cfg.JobRecovery, cfg.JobMaxRestarts); err != nil {
+		sugar.Fatalf("job recovery failed: %v", err)
+	} else if n > 0 {
+		sugar.Infow("recovered unfinished jobs", "jobs", n, "policy", cfg.JobRecovery)
+	}
+	if n, err := srv.recoverWebhooks(); err != nil {
+		sugar.Fatalf("webhook recovery failed: %v", err)
+	} else if n > 0 {
+		sugar.Infow("resuming webhook deliveries", "jobs", n)
+	}
+	if cfg.JobRetention > 0 {
+		go srv.purgeJobs(backgroundCtx, cfg.JobRetention)
+	}
+
+	// probe dependencies once before serving, then in the background
+	checker := newHealthChecker(healthServer, srv, cfg.Health)
+	checker.checkAll(backgroundCtx)
+	go checker.run(backgroundCtx)
+	if cfg.MetricsAddr != "" {
+		go serveMetrics(metricsServer, metrics, checker, sugar)
+	}
 
 	// Register health and reflection for introspection
 	healthpb.RegisterHealthServer(grpcServer, healthServer)
 	reflection.Register(grpcServer)
 
-	// Serve
-	if err := grpcServer.Serve(lis); err != nil {
-		sugar.Fatalf("serve error: %v", err)
+	// Serve until the listener fails or a shutdown signal arrives
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- grpcServer.Serve(lis) }()
+
+	// a serve error still shuts down in order, so the job store is closed
+	// and logs and traces are flushed before the process exits non-zero
+	select {
+	case err := <-serveErr:
+		sugar.Errorf("serve error: %v", err)
+		exitCode = 1
+		sugar.Infof("shutting down after serve error, draining for up to %s", cfg.ShutdownTimeout)
+	case <-ctx.Done():
+		sugar.Infof("shutdown signal received, draining for up to %s", cfg.ShutdownTimeout)
+	}
+	shutdown(grpcServer, healthServer, srv, cfg.UploadDir, cfg.ShutdownTimeout, sugar)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		sugar.Warnf("metrics server shutdown: %v", err)
+	}
+	sugar.Info("server stopped")
+}
+
+// shutdown drains the server: health flips to NOT_SERVING so load
+// balancers stop routing here, queued Process calls are turned away,
+// and in-flight RPCs get until timeout to finish before being cut off.
+// Jobs cut off this way are left queued for the next start to recover.
+// Uploads that did not complete are removed from disk.
+func shutdown(grpcServer *grpc.Server, healthServer *health.Server, srv *server, uploadDir string, timeout time.Duration, logger *zap.SugaredLogger) {
+	healthServer.Shutdown()
+	srv.workers.drain()
+
+	stopped := make(chan struct{})
+	go func() {
+		// stops the listener immediately, then waits for running RPCs
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		logger.Info("all RPCs finished")
+	case <-time.After(timeout):
+		logger.Warn("shutdown deadline exceeded, cancelling remaining RPCs")
+		grpcServer.Stop()
+	}
+	srv.stopBackground()
+
+	if n, err := cleanupPartialUploads(uploadDir); err != nil {
+		logger.Warnf("partial upload cleanup failed: %v", err)
+	} else if n > 0 {
+		logger.Infof("removed %d partial uploads", n)
 	}
 }
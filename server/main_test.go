@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	pb "image-proc/proto"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestShutdown(t *testing.T) {
+	s := newTestServer(t)
+	s.workers = newWorkerPool(1, schedulingPolicy{}, s.metrics)
+	imageID := storeTestImage(t, s)
+
+	// served as main does, with the health service whose status
+	// shutdown flips
+	gs := grpc.NewServer()
+	healthServer := health.NewServer()
+	pb.RegisterImageProcessorServer(gs, s)
+	healthpb.RegisterHealthServer(gs, healthServer)
+	lis := bufconn.Listen(1 << 20)
+	served := make(chan error, 1)
+	go func() { served <- gs.Serve(lis) }()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewImageProcessorClient(conn)
+
+	// a job waiting for the only worker, an upload that never ends and
+	// the leftovers of one that was cut off
+	release, err := s.workers.acquire(context.Background(), workTicket{principal: "other"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	queued, err := client.Process(context.Background(), &pb.ProcessingRequest{ImageId: imageID, Filters: []string{"invert"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recvUntil(t, queued, func(u *pb.ProgressUpdate) bool { return u.QueuePosition > 0 })
+	upload, err := client.Upload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := upload.Send(&pb.UploadRequest{Chunk: []byte("not done yet")}); err != nil {
+		t.Fatal(err)
+	}
+	partial := filepath.Join(s.store.dir, "cut-off.png.part")
+	if err := os.WriteFile(partial, []byte("half"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	shutdown(gs, healthServer, s, s.store.dir, 50*time.Millisecond, zap.NewNop().Sugar())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("shutdown took %s with a 50ms timeout", elapsed)
+	}
+
+	if _, err := queued.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("queued Process = %v, want %s", err, codes.Unavailable)
+	}
+	if _, err := upload.CloseAndRecv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("upload outlasting the timeout = %v, want it cut off with %s", err, codes.Unavailable)
+	}
+	resp, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("health after shutdown = %v, %v; want NOT_SERVING", resp, err)
+	}
+	if !s.workers.isDraining() {
+		t.Error("worker pool still accepts jobs")
+	}
+	if s.backgroundCtx.Err() == nil {
+		t.Error("background jobs still running")
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("partial upload left behind: %v", err)
+	}
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Error("Serve still running after shutdown")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const metricsNamespace = "imageproc"
+
+// serverMetrics holds every Prometheus collector exported by the server.
+// Interceptors cover the RPC level; handlers report through the other fields.
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	rpcTotal        *prometheus.CounterVec
+	rpcDuration     *prometheus.HistogramVec
+	streamsInFlight *prometheus.GaugeVec
+
+	uploadBytes    prometheus.Counter
+	filterDuration *prometheus.HistogramVec
+	tuneFrames     prometheus.Counter
+	renderDuration prometheus.Histogram
+
+	jobQueueDepth prometheus.Gauge
+	workers       prometheus.Gauge
+	workersBusy   prometheus.Gauge
+
+	jobRetries       prometheus.Counter
+	jobsDeadLettered prometheus.Counter
+
+	healthProbeUp *prometheus.GaugeVec
+}
+
+// newServerMetrics registers all collectors on a fresh registry.
+// storageDir is scanned on every scrape to report storage usage.
+func newServerMetrics(storageDir string) *serverMetrics {
+	reg := prometheus.NewRegistry()
+	m := &serverMetrics{
+		registry: reg,
+		rpcTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rpc_requests_total",
+			Help:      "Completed RPCs by method and status code.",
+		}, []string{"method", "code"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "rpc_duration_seconds",
+			Help:      "RPC latency by method and status code.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"method", "code"}),
+		streamsInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "streams_in_flight",
+			Help:      "Streaming RPCs currently open, by method.",
+		}, []string{"method"}),
+		uploadBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upload_bytes_received_total",
+			Help:      "Image bytes received through Upload.",
+		}),
+		filterDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "filter_duration_seconds",
+			Help:      "Time spent applying a single filter during Process.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		}, []string{"filter"}),
+		tuneFrames: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tune_frames_rendered_total",
+			Help:      "Preview frames sent on Tune streams.",
+		}),
+		renderDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "render_duration_seconds",
+			Help:      "Time spent decoding, transforming and encoding an image for Render.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		}),
+		jobQueueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_queue_depth",
+			Help:      "Process calls waiting for a free worker.",
+		}),
+		workers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "workers",
+			Help:      "Configured number of processing workers.",
+		}),
+		workersBusy: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "workers_busy",
+			Help:      "Processing workers currently running a job.",
+		}),
+		jobRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_retries_total",
+			Help:      "Failed job attempts that were retried.",
+		}),
+		jobsDeadLettered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "jobs_dead_lettered_total",
+			Help:      "Jobs that failed for good and were moved to the dead letters.",
+		}),
+		healthProbeUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "health_probe_up",
+			Help:      "Whether a health probe passed on its last run (1) or not (0), by probe.",
+		}, []string{"probe"}),
+	}
+
+	reg.MustRegister(
+		m.rpcTotal, m.rpcDuration, m.streamsInFlight,
+		m.uploadBytes, m.filterDuration, m.tuneFrames, m.renderDuration,
+		m.jobQueueDepth, m.workers, m.workersBusy,
+		m.jobRetries, m.jobsDeadLettered,
+		m.healthProbeUp,
+		newStorageCollector(storageDir),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// observeRPC records the outcome of a finished RPC.
+func (m *serverMetrics) observeRPC(method string, start time.Time, err error) {
+	code := status.Code(err).String()
+	m.rpcTotal.WithLabelValues(method, code).Inc()
+	m.rpcDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+}
+
+// unaryInterceptor counts unary RPCs and their latency.
+func (m *serverMetrics) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observeRPC(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// streamInterceptor counts streaming RPCs, their latency and how many are open.
+func (m *serverMetrics) streamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		inFlight := m.streamsInFlight.WithLabelValues(info.FullMethod)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		err := handler(srv, ss)
+		m.observeRPC(info.FullMethod, start, err)
+		return err
+	}
+}
+
+// serveMetrics exposes the registry on srv.Addr at /metrics, and the
+// health probes at /healthz and /readyz, until srv is shut down.
+func serveMetrics(srv *http.Server, m *serverMetrics, checker *healthChecker, logger *zap.SugaredLogger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /healthz", checker.healthz)
+	mux.HandleFunc("GET /readyz", checker.readyz)
+	srv.Handler = mux
+	logger.Infof("metrics listening on %s", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("metrics server: %v", err)
+	}
+}
+
+// storageCollector reports the size of the uploads directory at scrape time.
+type storageCollector struct {
+	dir    string
+	bytes  *prometheus.Desc
+	images *prometheus.Desc
+}
+
+func newStorageCollector(dir string) *storageCollector {
+	return &storageCollector{
+		dir: dir,
+		bytes: prometheus.NewDesc(metricsNamespace+"_storage_bytes",
+			"Bytes used by stored images.", nil, nil),
+		images: prometheus.NewDesc(metricsNamespace+"_storage_images",
+			"Number of stored images.", nil, nil),
+	}
+}
+
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytes
+	ch <- c.images
+}
+
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.bytes, err)
+		return
+	}
+	var size, count int64
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != imageExt {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		size += info.Size()
+		count++
+	}
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(size))
+	ch <- prometheus.MustNewConstMetric(c.images, prometheus.GaugeValue, float64(count))
+}
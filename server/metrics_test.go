@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	pb "image-proc/proto"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestRPCMetrics(t *testing.T) {
+	s := newTestServer(t)
+	imageID := storeTestImage(t, s)
+	client := serve(t, s)
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := client.GetVersion(ctx, &emptypb.Empty{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := client.GetImage(ctx, &pb.GetImageRequest{ImageId: "0d9c1e2f-3a4b-4c5d-9e8f-7a6b5c4d3e2f"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("GetImage of a missing image = %v, want %s", err, codes.NotFound)
+	}
+	stream, err := client.Process(ctx, &pb.ProcessingRequest{ImageId: imageID, Filters: []string{"blur", "grayscale"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := `
+# HELP imageproc_rpc_requests_total Completed RPCs by method and status code.
+# TYPE imageproc_rpc_requests_total counter
+imageproc_rpc_requests_total{code="NotFound",method="/imageproc.ImageProcessor/GetImage"} 1
+imageproc_rpc_requests_total{code="OK",method="/imageproc.ImageProcessor/GetVersion"} 2
+imageproc_rpc_requests_total{code="OK",method="/imageproc.ImageProcessor/Process"} 1
+`
+	// the stream interceptor records after the handler returns, which can
+	// be after the client has seen the end of the stream
+	waitFor(t, func() bool {
+		return testutil.ToFloat64(s.metrics.rpcTotal.WithLabelValues(pb.ImageProcessor_Process_FullMethodName, "OK")) == 1
+	})
+	if err := testutil.GatherAndCompare(s.metrics.registry, strings.NewReader(want), "imageproc_rpc_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(s.metrics.rpcDuration); n != 3 {
+		t.Errorf("rpc_duration_seconds has %d series, want one per method and code (3)", n)
+	}
+	if got := testutil.ToFloat64(s.metrics.streamsInFlight.WithLabelValues(pb.ImageProcessor_Process_FullMethodName)); got != 0 {
+		t.Errorf("streams_in_flight = %v after the stream ended, want 0", got)
+	}
+
+	// the handlers report through the same registry
+	if n := testutil.CollectAndCount(s.metrics.filterDuration); n != 2 {
+		t.Errorf("filter_duration_seconds has %d series, want one per filter (2)", n)
+	}
+	want = `
+# HELP imageproc_workers Configured number of processing workers.
+# TYPE imageproc_workers gauge
+imageproc_workers 2
+# HELP imageproc_workers_busy Processing workers currently running a job.
+# TYPE imageproc_workers_busy gauge
+imageproc_workers_busy 0
+# HELP imageproc_job_queue_depth Process calls waiting for a free worker.
+# TYPE imageproc_job_queue_depth gauge
+imageproc_job_queue_depth 0
+# HELP imageproc_storage_images Number of stored images.
+# TYPE imageproc_storage_images gauge
+imageproc_storage_images 2
+`
+	if err := testutil.GatherAndCompare(s.metrics.registry, strings.NewReader(want),
+		"imageproc_workers", "imageproc_workers_busy", "imageproc_job_queue_depth", "imageproc_storage_images"); err != nil {
+		t.Error(err)
+	}
+}
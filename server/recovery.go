@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "image-proc/proto"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// job recovery policies, see config.Server.JobRecovery
+const (
+	recoverRequeue = "requeue"
+	recoverFail    = "fail"
+)
+
+// jobPurgeInterval is how often expired job records are deleted
+const jobPurgeInterval = time.Hour
+
+// recoverJobs applies policy to the jobs a previous run left queued or
+// running: requeue runs them again from the start in the background, fail
+// marks them failed. Under requeue, a job already restarted maxRestarts
+// times is failed instead (0 = no limit), so a job that brings the server
+// down cannot do so forever. It returns how many jobs it recovered.
+func (s *server) recoverJobs(policy string, maxRestarts int) (int, error) {
+	records, err := s.jobs.store.unfinished()
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range records {
+		switch {
+		case policy == recoverFail:
+			// the job itself never ran into a problem, so it may well
+			// succeed when re-driven
+			if err := s.deadLetterUnfinished(r, "server restarted before the job finished", true); err != nil {
+				return 0, err
+			}
+		case maxRestarts > 0 && int(r.Restarts) >= maxRestarts:
+			msg := fmt.Sprintf("server restarted %d times before the job finished", r.Restarts+1)
+			if err := s.deadLetterUnfinished(r, msg, false); err != nil {
+				return 0, err
+			}
+			s.logger.Warnw("job dead-lettered after too many restarts", "job_id", r.ID, "restarts", r.Restarts)
+		default:
+			j := s.jobs.restore(r)
+			j.update(pb.JobState_JOB_STATE_QUEUED, 0, "requeued after server restart")
+			s.runBackground(j)
+		}
+	}
+	return len(records), nil
+}
+
+// deadLetterUnfinished marks a job left unfinished by a restart failed
+// and moves it to the dead letters
+func (s *server) deadLetterUnfinished(r *jobRecord, msg string, retryable bool) error {
+	now := time.Now()
+	r.State = pb.JobState_JOB_STATE_FAILED.String()
+	r.Error, r.Status = msg, msg
+	r.UpdatedAt, r.FinishedAt = now, &now
+	r.DeadLetteredAt, r.FailureCode, r.Retryable = &now, int32(codes.Aborted), retryable
+	return s.jobs.store.put(r)
+}
+
+// runBackground runs j detached from any client stream, as for recovered
+// and re-driven jobs and jobs with a callback; progress is visible through
+// WatchJob and GetJob, and the callback is notified when j finishes
+func (s *server) runBackground(j *job) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		defer s.jobs.finish(j)
+		ctx := s.backgroundCtx
+		log := s.logger.With("job_id", j.id, "image_id", j.imageID)
+
+		defer s.notify(j)
+
+		if _, err := s.store.stat(ctx, j.imageID); err != nil {
+			j.fail(err, false)
+			log.Warnw("background job failed", "error", err)
+			return
+		}
+		if err := s.execute(ctx, j, func(*pb.ProgressUpdate) error { return nil }); err != nil {
+			log.Warnw("background job stopped", "state", j.latest().State.String(), "error", err)
+			return
+		}
+		log.Info("background job completed")
+	}()
+}
+
+// stopBackground interrupts background jobs and waits for them to record
+// their state; they are recovered again on the next start
+func (s *server) stopBackground() {
+	s.stopBackgroundJobs()
+	s.background.Wait()
+}
+
+// purgeJobs deletes job records that finished more than retention ago,
+// now and then every jobPurgeInterval until ctx is done
+func (s *server) purgeJobs(ctx context.Context, retention time.Duration) {
+	purge := func() {
+		n, err := s.jobs.store.purge(time.Now().Add(-retention))
+		if err != nil {
+			s.logger.Warnw("job purge failed", "error", err)
+		} else if n > 0 {
+			s.logger.Infow("purged expired jobs", "jobs", n)
+		}
+	}
+	purge()
+	t := time.NewTicker(jobPurgeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			purge()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
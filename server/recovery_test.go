@@ -0,0 +1,116 @@
+package main
+
+import (
+	pb "image-proc/proto"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// putUnfinished stores a job on imageID that a previous run left running
+// after restarts restarts
+func putUnfinished(t *testing.T, s *server, id, imageID string, restarts int32) {
+	t.Helper()
+	now := time.Now()
+	r := &jobRecord{
+		ID:        id,
+		ImageID:   imageID,
+		Filters:   []string{"grayscale"},
+		Owner:     anonymousPrincipal,
+		State:     pb.JobState_JOB_STATE_RUNNING.String(),
+		Percent:   50,
+		Restarts:  restarts,
+		CreatedAt: now,
+		UpdatedAt: now,
+		StartedAt: &now,
+	}
+	if err := s.jobs.store.put(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForRecord waits until the stored record of id satisfies done
+func waitForRecord(t *testing.T, s *server, id string, done func(*jobRecord) bool) *jobRecord {
+	t.Helper()
+	var r *jobRecord
+	waitFor(t, func() bool {
+		var err error
+		r, err = s.jobs.store.get(id)
+		return err == nil && r != nil && done(r)
+	})
+	return r
+}
+
+func TestRecoverJobs(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		maxRestarts int
+		restarts    int32
+		requeued    bool
+		retryable   bool
+	}{
+		{name: "requeue", policy: recoverRequeue, maxRestarts: 3, restarts: 0, requeued: true},
+		{name: "requeue below the cap", policy: recoverRequeue, maxRestarts: 3, restarts: 2, requeued: true},
+		{name: "requeue at the cap", policy: recoverRequeue, maxRestarts: 3, restarts: 3, requeued: false},
+		{name: "requeue without a cap", policy: recoverRequeue, maxRestarts: 0, restarts: 100, requeued: true},
+		{name: "fail", policy: recoverFail, maxRestarts: 3, restarts: 0, requeued: false, retryable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			putUnfinished(t, s, "job", storeTestImage(t, s), tt.restarts)
+			putJob(t, s.jobs.store, "done", anonymousPrincipal, time.Now(), time.Now())
+
+			n, err := s.recoverJobs(tt.policy, tt.maxRestarts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Errorf("recovered %d jobs, want only the unfinished one", n)
+			}
+
+			if tt.requeued {
+				r := waitForRecord(t, s, "job", func(r *jobRecord) bool { return isTerminal(r.state()) })
+				s.background.Wait()
+				if r.state() != pb.JobState_JOB_STATE_SUCCEEDED || r.ResultImageID == "" {
+					t.Fatalf("requeued job ended %s (%s), want SUCCEEDED", r.State, r.Error)
+				}
+				if r.Restarts != tt.restarts+1 {
+					t.Errorf("restarts = %d, want %d", r.Restarts, tt.restarts+1)
+				}
+				if r.DeadLetteredAt != nil {
+					t.Error("requeued job is dead-lettered")
+				}
+				return
+			}
+
+			r, err := s.jobs.store.get("job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.state() != pb.JobState_JOB_STATE_FAILED || r.FinishedAt == nil || r.Error == "" {
+				t.Fatalf("job = %s, finished %v, error %q; want it failed", r.State, r.FinishedAt, r.Error)
+			}
+			if r.DeadLetteredAt == nil || codes.Code(r.FailureCode) != codes.Aborted || r.Retryable != tt.retryable {
+				t.Errorf("dead-lettered at %v with %s, retryable %v; want dead-lettered with %s, retryable %v",
+					r.DeadLetteredAt, codes.Code(r.FailureCode), r.Retryable, codes.Aborted, tt.retryable)
+			}
+			if r.Restarts != tt.restarts {
+				t.Errorf("restarts = %d, want %d", r.Restarts, tt.restarts)
+			}
+			if _, running := s.jobs.get("job"); running {
+				t.Error("failed job was started")
+			}
+			dls, _, _ := s.jobs.store.list(deadLettersBucket, func(*jobRecord) bool { return true }, nil, 10)
+			if len(dls) != 1 || dls[0].ID != "job" {
+				t.Errorf("dead letters = %v, want the job", ids(dls))
+			}
+			// and a second start finds nothing left to recover
+			if n, err := s.recoverJobs(tt.policy, tt.maxRestarts); n != 0 || err != nil {
+				t.Errorf("second recovery = %d, %v; want nothing", n, err)
+			}
+		})
+	}
+}
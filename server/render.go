@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	pb "image-proc/proto"
+	"image/jpeg"
+	"image/png"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultRenderQuality is the JPEG quality Render uses when none is asked for
+const defaultRenderQuality = 85
+
+// renderer bounds Render calls, which decode and encode whole images on
+// the caller's request instead of going through the job queue
+type renderer struct {
+	maxDimension int
+	slots        chan struct{}
+}
+
+func newRenderer(maxDimension, concurrency int) *renderer {
+	return &renderer{maxDimension: maxDimension, slots: make(chan struct{}, concurrency)}
+}
+
+// acquire waits for a free render slot; the caller calls release
+func (r *renderer) acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case r.slots <- struct{}{}:
+		return func() { <-r.slots }, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// validate rejects requests Render cannot serve before any work is done
+func (r *renderer) validate(req *pb.RenderRequest) error {
+	if req.Width < 0 || req.Height < 0 || int(req.Width) > r.maxDimension || int(req.Height) > r.maxDimension {
+		return status.Errorf(codes.InvalidArgument, "width and height must be between 0 and %d", r.maxDimension)
+	}
+	if _, ok := pb.Fit_name[int32(req.Fit)]; !ok {
+		return status.Errorf(codes.InvalidArgument, "unknown fit %d", req.Fit)
+	}
+	if req.Format != "" && req.Format != "jpeg" && req.Format != "png" {
+		return status.Errorf(codes.InvalidArgument, "unknown format %q, want jpeg or png", req.Format)
+	}
+	if req.Quality < 0 || req.Quality > 100 {
+		return status.Errorf(codes.InvalidArgument, "quality must be between 1 and 100, got %d", req.Quality)
+	}
+	return validateFilters(req.Filters)
+}
+
+// Render resizes, filters and encodes a stored image and streams the
+// result back in chunks; nothing is stored
+func (s *server) Render(req *pb.RenderRequest, stream pb.ImageProcessor_RenderServer) error {
+	ctx := stream.Context()
+	addLogFields(ctx, "image_id", req.ImageId)
+	if err := s.renderer.validate(req); err != nil {
+		return err
+	}
+	if _, err := s.ownedImage(ctx, req.ImageId); err != nil {
+		return err
+	}
+	release, err := s.renderer.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	start := time.Now()
+	src, format, err := s.store.decode(ctx, req.ImageId)
+	if err != nil {
+		return err
+	}
+	img := toNRGBA(src)
+	crop, w, h := renderGeometry(img.Rect.Dx(), img.Rect.Dy(), int(req.Width), int(req.Height), req.Fit)
+	if w > s.renderer.maxDimension || h > s.renderer.maxDimension {
+		return status.Errorf(codes.InvalidArgument, "rendered image would be %dx%d, larger than %d pixels a side", w, h, s.renderer.maxDimension)
+	}
+	if crop != img.Rect || w != crop.Dx() || h != crop.Dy() {
+		img = resample(img, crop, w, h)
+	}
+	for _, name := range req.Filters {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		dst := image.NewNRGBA(img.Rect)
+		filters[name](dst, img, 0, h)
+		img = dst
+	}
+
+	if req.Format != "" {
+		format = req.Format
+	}
+	var buf bytes.Buffer
+	contentType := "image/jpeg"
+	if format == "png" || format == "gif" {
+		contentType = "image/png"
+		err = png.Encode(&buf, img)
+	} else {
+		quality := int(req.Quality)
+		if quality == 0 {
+			quality = defaultRenderQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "encode image: %v", err)
+	}
+	s.metrics.renderDuration.Observe(time.Since(start).Seconds())
+
+	first := &pb.RenderChunk{ContentType: contentType, Width: int32(w), Height: int32(h)}
+	for data := buf.Bytes(); ; {
+		n := min(len(data), downloadChunkSize)
+		chunk := &pb.RenderChunk{Chunk: data[:n]}
+		if first != nil {
+			first.Chunk = chunk.Chunk
+			chunk, first = first, nil
+		}
+		if err := stream.Send(chunk); err != nil {
+			return status.Errorf(codes.Internal, "send error: %v", err)
+		}
+		if data = data[n:]; len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+// renderGeometry returns the part of a srcW x srcH image to use and the
+// size to scale it to for a requested width and height, either of which
+// may be 0 to follow from the other
+func renderGeometry(srcW, srcH, w, h int, fit pb.Fit) (crop image.Rectangle, outW, outH int) {
+	crop = image.Rect(0, 0, srcW, srcH)
+	switch {
+	case w == 0 && h == 0:
+		return crop, srcW, srcH
+	case h == 0:
+		return crop, w, max(1, (srcH*w+srcW/2)/srcW)
+	case w == 0:
+		return crop, max(1, (srcW*h+srcH/2)/srcH), h
+	}
+	switch fit {
+	case pb.Fit_FIT_FILL:
+		return crop, w, h
+	case pb.Fit_FIT_COVER:
+		// cut the source to the box's aspect ratio, keeping the middle
+		if srcW*h > w*srcH {
+			cw := max(1, (w*srcH+h/2)/h)
+			crop.Min.X = (srcW - cw) / 2
+			crop.Max.X = crop.Min.X + cw
+		} else {
+			ch := max(1, (h*srcW+w/2)/w)
+			crop.Min.Y = (srcH - ch) / 2
+			crop.Max.Y = crop.Min.Y + ch
+		}
+		return crop, w, h
+	}
+	// clip: the largest size inside the box
+	if srcW*h > w*srcH {
+		return crop, w, max(1, (srcH*w+srcW/2)/srcW)
+	}
+	return crop, max(1, (srcW*h+srcH/2)/srcH), h
+}
+
+// resample scales the crop rectangle of src to w x h. Each output pixel
+// averages the source pixels it covers, weighting colour by alpha, which
+// keeps downscaled images smooth; enlarging repeats pixels.
+func resample(src *image.NRGBA, crop image.Rectangle, w, h int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	cw, ch := crop.Dx(), crop.Dy()
+	for y := 0; y < h; y++ {
+		sy0 := crop.Min.Y + y*ch/h
+		sy1 := max(crop.Min.Y+(y+1)*ch/h, sy0+1)
+		for x := 0; x < w; x++ {
+			sx0 := crop.Min.X + x*cw/w
+			sx1 := max(crop.Min.X+(x+1)*cw/w, sx0+1)
+			var r, g, b, a, n float64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					i := sy*src.Stride + sx*4
+					alpha := float64(src.Pix[i+3])
+					r += float64(src.Pix[i]) * alpha
+					g += float64(src.Pix[i+1]) * alpha
+					b += float64(src.Pix[i+2]) * alpha
+					a += alpha
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			if a > 0 {
+				dst.Pix[i] = clamp(r / a)
+				dst.Pix[i+1] = clamp(g / a)
+				dst.Pix[i+2] = clamp(b / a)
+			}
+			dst.Pix[i+3] = clamp(a / n)
+		}
+	}
+	return dst
+}
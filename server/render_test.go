@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	pb "image-proc/proto"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRenderGeometry(t *testing.T) {
+	full := image.Rect(0, 0, 200, 100)
+	tests := []struct {
+		name       string
+		srcW, srcH int
+		w, h       int
+		fit        pb.Fit
+		wantCrop   image.Rectangle
+		wantW      int
+		wantH      int
+	}{
+		{name: "no size", srcW: 200, srcH: 100, wantCrop: full, wantW: 200, wantH: 100},
+		{name: "width only", srcW: 200, srcH: 100, w: 100, fit: pb.Fit_FIT_FILL, wantCrop: full, wantW: 100, wantH: 50},
+		{name: "height only", srcW: 200, srcH: 100, h: 25, fit: pb.Fit_FIT_COVER, wantCrop: full, wantW: 50, wantH: 25},
+		{name: "rounds to nearest", srcW: 3, srcH: 2, w: 2, wantCrop: image.Rect(0, 0, 3, 2), wantW: 2, wantH: 1},
+		{name: "at least a pixel", srcW: 1000, srcH: 1, w: 10, wantCrop: image.Rect(0, 0, 1000, 1), wantW: 10, wantH: 1},
+
+		{name: "clip wide", srcW: 200, srcH: 100, w: 50, h: 50, fit: pb.Fit_FIT_CLIP, wantCrop: full, wantW: 50, wantH: 25},
+		{name: "clip tall", srcW: 100, srcH: 200, w: 50, h: 50, fit: pb.Fit_FIT_CLIP, wantCrop: image.Rect(0, 0, 100, 200), wantW: 25, wantH: 50},
+		{name: "unset fit clips", srcW: 200, srcH: 100, w: 50, h: 50, wantCrop: full, wantW: 50, wantH: 25},
+		{name: "clip enlarges", srcW: 20, srcH: 10, w: 100, h: 100, fit: pb.Fit_FIT_CLIP, wantCrop: image.Rect(0, 0, 20, 10), wantW: 100, wantH: 50},
+
+		{name: "fill", srcW: 200, srcH: 100, w: 50, h: 50, fit: pb.Fit_FIT_FILL, wantCrop: full, wantW: 50, wantH: 50},
+
+		{name: "cover wide", srcW: 200, srcH: 100, w: 50, h: 50, fit: pb.Fit_FIT_COVER, wantCrop: image.Rect(50, 0, 150, 100), wantW: 50, wantH: 50},
+		{name: "cover tall", srcW: 100, srcH: 200, w: 50, h: 50, fit: pb.Fit_FIT_COVER, wantCrop: image.Rect(0, 50, 100, 150), wantW: 50, wantH: 50},
+		{name: "cover same aspect", srcW: 200, srcH: 100, w: 100, h: 50, fit: pb.Fit_FIT_COVER, wantCrop: full, wantW: 100, wantH: 50},
+	}
+	for _, tt := range tests {
+		crop, w, h := renderGeometry(tt.srcW, tt.srcH, tt.w, tt.h, tt.fit)
+		if crop != tt.wantCrop || w != tt.wantW || h != tt.wantH {
+			t.Errorf("%s: renderGeometry(%d, %d, %d, %d, %s) = %v, %d, %d; want %v, %d, %d",
+				tt.name, tt.srcW, tt.srcH, tt.w, tt.h, tt.fit, crop, w, h, tt.wantCrop, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+// render calls Render and reassembles the result
+func render(ctx context.Context, client pb.ImageProcessorClient, req *pb.RenderRequest) (*pb.RenderChunk, []byte, error) {
+	stream, err := client.Render(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	var first *pb.RenderChunk
+	var data []byte
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return first, data, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if first == nil {
+			first = chunk
+		}
+		data = append(data, chunk.Chunk...)
+	}
+}
+
+func TestRender(t *testing.T) {
+	s := newTestServer(t)
+	client := serve(t, s)
+	square := storeTestImage(t, s)
+	strip, err := s.store.save(context.Background(), image.NewNRGBA(image.Rect(0, 0, 64, 8)), "png", anonymousPrincipal, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		req      *pb.RenderRequest
+		wantType string
+		wantW    int
+		wantH    int
+		wantCode codes.Code
+	}{
+		{name: "as stored", req: &pb.RenderRequest{ImageId: square}, wantType: "image/png", wantW: 16, wantH: 16},
+		{name: "scaled", req: &pb.RenderRequest{ImageId: strip.ID, Width: 32}, wantType: "image/png", wantW: 32, wantH: 4},
+		{name: "covered as jpeg", req: &pb.RenderRequest{ImageId: strip.ID, Width: 8, Height: 8, Fit: pb.Fit_FIT_COVER, Format: "jpeg", Quality: 50}, wantType: "image/jpeg", wantW: 8, wantH: 8},
+		{name: "filtered", req: &pb.RenderRequest{ImageId: square, Width: 4, Filters: []string{"grayscale", "invert"}}, wantType: "image/png", wantW: 4, wantH: 4},
+
+		{name: "too wide", req: &pb.RenderRequest{ImageId: square, Width: 2000}, wantCode: codes.InvalidArgument},
+		{name: "scales past the limit", req: &pb.RenderRequest{ImageId: strip.ID, Height: 512}, wantCode: codes.InvalidArgument},
+		{name: "unknown format", req: &pb.RenderRequest{ImageId: square, Format: "gif"}, wantCode: codes.InvalidArgument},
+		{name: "unknown filter", req: &pb.RenderRequest{ImageId: square, Filters: []string{"sepia"}}, wantCode: codes.InvalidArgument},
+		{name: "missing image", req: &pb.RenderRequest{ImageId: "0123456789abcdef0123456789abcdef"}, wantCode: codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, data, err := render(context.Background(), client, tt.req)
+			if tt.wantCode != codes.OK {
+				if status.Code(err) != tt.wantCode {
+					t.Fatalf("Render = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.ContentType != tt.wantType || int(first.Width) != tt.wantW || int(first.Height) != tt.wantH {
+				t.Errorf("first chunk says %s %dx%d, want %s %dx%d", first.ContentType, first.Width, first.Height, tt.wantType, tt.wantW, tt.wantH)
+			}
+			img, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode result: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Errorf("result is %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
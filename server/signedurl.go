@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	pb "image-proc/proto"
+	"image-proc/signedurl"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// signedRoute is the gRPC method a signed URL calls and the gateway route
+// it is served at
+type signedRoute struct {
+	method     string
+	httpMethod string
+	path       func(imageID string) string
+}
+
+// signedRoutes are the operations SignURL issues URLs for
+var signedRoutes = map[pb.SignedOperation]signedRoute{
+	pb.SignedOperation_SIGNED_OPERATION_DOWNLOAD: {
+		method:     pb.ImageProcessor_Download_FullMethodName,
+		httpMethod: http.MethodGet,
+		path:       func(id string) string { return "/v1/images/" + url.PathEscape(id) + "/content" },
+	},
+	pb.SignedOperation_SIGNED_OPERATION_UPLOAD: {
+		method:     pb.ImageProcessor_Upload_FullMethodName,
+		httpMethod: http.MethodPost,
+		path:       func(string) string { return "/v1/images:upload" },
+	},
+	pb.SignedOperation_SIGNED_OPERATION_RENDER: {
+		method:     pb.ImageProcessor_Render_FullMethodName,
+		httpMethod: http.MethodGet,
+		path:       func(id string) string { return "/v1/images/" + url.PathEscape(id) + "/render" },
+	},
+}
+
+// grantedBy maps the methods a signed URL may call to the methods it may
+// have been signed for: the gateway reads an image's metadata to serve
+// its content or a rendering of it
+var grantedBy = map[string][]string{
+	pb.ImageProcessor_Download_FullMethodName: {pb.ImageProcessor_Download_FullMethodName},
+	pb.ImageProcessor_GetImage_FullMethodName: {pb.ImageProcessor_Download_FullMethodName, pb.ImageProcessor_Render_FullMethodName},
+	pb.ImageProcessor_Render_FullMethodName:   {pb.ImageProcessor_Render_FullMethodName},
+	pb.ImageProcessor_Upload_FullMethodName:   {pb.ImageProcessor_Upload_FullMethodName},
+}
+
+// urlSigner issues signed URLs on behalf of the calling principal
+type urlSigner struct {
+	keys       *signedurl.Keys
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	baseURL    string
+}
+
+// SignURL issues a signed URL for one download, upload or rendering
+func (s *server) SignURL(ctx context.Context, req *pb.SignURLRequest) (*pb.SignURLResponse, error) {
+	if !s.signer.keys.CanSign() {
+		return nil, status.Error(codes.FailedPrecondition, "signed URLs are not enabled on this server")
+	}
+	route, ok := signedRoutes[req.Operation]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "operation must be DOWNLOAD, UPLOAD or RENDER, got %s", req.Operation)
+	}
+	if req.Operation != pb.SignedOperation_SIGNED_OPERATION_RENDER && req.Query != "" {
+		return nil, status.Error(codes.InvalidArgument, "query only applies to renders")
+	}
+	params, err := url.ParseQuery(req.Query)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+	}
+	for name := range params {
+		switch name {
+		case signedurl.ParamExpires, signedurl.ParamPrincipal, signedurl.ParamMaxBytes, signedurl.ParamKeyID, signedurl.ParamSignature:
+			return nil, status.Errorf(codes.InvalidArgument, "query must not set %q", name)
+		}
+	}
+	switch req.Operation {
+	case pb.SignedOperation_SIGNED_OPERATION_DOWNLOAD, pb.SignedOperation_SIGNED_OPERATION_RENDER:
+		addLogFields(ctx, "image_id", req.ImageId)
+		// a link acts for the caller, so it may only name the caller's images
+		if _, err := s.ownedImage(ctx, req.ImageId); err != nil {
+			return nil, err
+		}
+		if req.MaxBytes != 0 {
+			return nil, status.Error(codes.InvalidArgument, "max_bytes only applies to uploads")
+		}
+	case pb.SignedOperation_SIGNED_OPERATION_UPLOAD:
+		if req.ImageId != "" {
+			return nil, status.Error(codes.InvalidArgument, "image_id must be unset for uploads")
+		}
+		if req.MaxBytes < 0 {
+			return nil, status.Error(codes.InvalidArgument, "max_bytes must not be negative")
+		}
+	}
+	ttl := s.signer.defaultTTL
+	if req.Ttl != nil {
+		if err := req.Ttl.CheckValid(); err != nil || req.Ttl.AsDuration() <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "ttl must be positive")
+		}
+		ttl = min(req.Ttl.AsDuration(), s.signer.maxTTL)
+	}
+
+	grant := signedurl.Grant{
+		Method:    route.method,
+		ImageID:   req.ImageId,
+		Principal: principalFromContext(ctx),
+		Expires:   time.Now().Add(ttl).Truncate(time.Second),
+		MaxBytes:  req.MaxBytes,
+		Params:    params,
+	}
+	query, err := s.signer.keys.Sign(grant)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "sign URL: %v", err)
+	}
+	s.log(ctx).Infow("signed URL issued", "operation", req.Operation.String(), "expires", grant.Expires)
+	return &pb.SignURLResponse{
+		Url:       strings.TrimSuffix(s.signer.baseURL, "/") + route.path(req.ImageId) + "?" + query.Encode(),
+		Method:    route.httpMethod,
+		ExpiresAt: timestamppb.New(grant.Expires),
+	}, nil
+}
+
+type grantKey struct{}
+
+// grantFromContext returns the signed URL a call was authorized by
+func grantFromContext(ctx context.Context) (signedurl.Grant, bool) {
+	g, ok := ctx.Value(grantKey{}).(signedurl.Grant)
+	return g, ok
+}
+
+// grantQuery returns the signed URL query the gateway forwarded, if the
+// caller sent no credentials of its own
+func grantQuery(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get("authorization")) > 0 {
+		return "", false
+	}
+	values := md.Get(signedurl.MetadataKey)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// verifyGrant checks a signed URL forwarded by the gateway and records
+// its principal and grant in ctx
+func (a *authenticator) verifyGrant(ctx context.Context, fullMethod, imageID, rawQuery string) (context.Context, error) {
+	methods, ok := grantedBy[fullMethod]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "signed URLs do not allow %s", fullMethod)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "malformed signed URL: %v", err)
+	}
+	var g signedurl.Grant
+	for _, signedFor := range methods {
+		// a URL signed for another method fails as invalid; any other
+		// outcome is final
+		if g, err = a.urlKeys.Verify(signedFor, imageID, query, time.Now()); !errors.Is(err, signedurl.ErrInvalid) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	addLogFields(ctx, "principal", g.Principal, "signed_url", true)
+	ctx = context.WithValue(ctx, principalKey{}, g.Principal)
+	return context.WithValue(ctx, grantKey{}, g), nil
+}
+
+// grantStream checks a signed URL against the first request of a call
+// that names its image there, since the signature covers the image ID.
+// The handler sees the grant's principal once that request is read.
+type grantStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	verify func(imageID string) (context.Context, error)
+}
+
+func (s *grantStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *grantStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil || s.verify == nil {
+		return err
+	}
+	var imageID string
+	if req, ok := m.(interface{ GetImageId() string }); ok {
+		imageID = req.GetImageId()
+	}
+	ctx, err := s.verify(imageID)
+	if err != nil {
+		return err
+	}
+	s.ctx, s.verify = ctx, nil
+	return nil
+}
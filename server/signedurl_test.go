@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	pb "image-proc/proto"
+	"image-proc/signedurl"
+	"net/url"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSignURLNeedsActiveKey(t *testing.T) {
+	secrets := map[string]string{"k1": "secret1"}
+	tests := []struct {
+		name   string
+		active string
+		keys   map[string]string
+		code   codes.Code
+	}{
+		{name: "no keys", code: codes.FailedPrecondition},
+		{name: "verify only", keys: secrets, code: codes.FailedPrecondition},
+		{name: "active key", keys: secrets, active: "k1", code: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := signedurl.NewKeys(tt.keys, tt.active)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newTestServer(t)
+			s.signer = urlSigner{keys: keys, defaultTTL: time.Minute, maxTTL: time.Hour, baseURL: "http://gw"}
+			resp, err := s.SignURL(context.Background(), &pb.SignURLRequest{Operation: pb.SignedOperation_SIGNED_OPERATION_UPLOAD})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("SignURL = %v, want %s", err, tt.code)
+			}
+			if err != nil {
+				return
+			}
+			u, err := url.Parse(resp.Url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := keys.Verify(pb.ImageProcessor_Upload_FullMethodName, "", u.Query(), time.Now()); err != nil {
+				t.Errorf("issued URL does not verify: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	pb "image-proc/proto"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// imageMeta is the JSON sidecar stored next to every image as <id>.json
+type imageMeta struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Format    string    `json:"format"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Size      int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source_image_id,omitempty"`
+}
+
+// proto converts the sidecar into its API representation
+func (m *imageMeta) proto() *pb.ImageInfo {
+	return &pb.ImageInfo{
+		ImageId:       m.ID,
+		Owner:         m.Owner,
+		Format:        m.Format,
+		Width:         int32(m.Width),
+		Height:        int32(m.Height),
+		SizeBytes:     m.Size,
+		CreatedAt:     timestamppb.New(m.CreatedAt),
+		SourceImageId: m.Source,
+	}
+}
+
+// outputJPEGQuality is the quality processed JPEG images are saved with
+const outputJPEGQuality = 90
+
+// imageExt is the extension of every stored image, whatever its format:
+// it predates PNG output and is kept so existing stores stay readable. The
+// real format is recorded in the sidecar and sniffed when decoding.
+const imageExt = ".jpg"
+
+// imageStore keeps images as <id>.jpg files plus a JSON sidecar in dir
+type imageStore struct {
+	dir string
+}
+
+// validateImageID rejects anything that is not a UUID, which also keeps
+// caller-supplied IDs from escaping the storage directory
+func validateImageID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid image id %q", id)
+	}
+	return nil
+}
+
+// checkWritable writes, syncs and removes a scratch file in the store's
+// directory, failing if the disk is read-only, full or gone
+func (st *imageStore) checkWritable() error {
+	if err := os.MkdirAll(st.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(st.dir, ".healthcheck-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("ok")
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (st *imageStore) imagePath(id string) string {
+	return filepath.Join(st.dir, id+imageExt)
+}
+
+func (st *imageStore) metaPath(id string) string {
+	return filepath.Join(st.dir, id+".json")
+}
+
+// startSpan opens a child span for a storage operation on id
+func (st *imageStore) startSpan(ctx context.Context, op, id string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "storage."+op, trace.WithAttributes(attribute.String("image.id", id)))
+}
+
+// describe builds metadata for a committed image by reading its header
+func (st *imageStore) describe(id, owner string) (*imageMeta, error) {
+	f, err := os.Open(st.imagePath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	meta := &imageMeta{ID: id, Owner: owner, Size: info.Size(), CreatedAt: info.ModTime().UTC()}
+	if cfg, format, err := image.DecodeConfig(f); err == nil {
+		meta.Format, meta.Width, meta.Height = format, cfg.Width, cfg.Height
+	}
+	return meta, nil
+}
+
+// writeMeta stores the sidecar for a freshly committed upload. It is
+// written next to its final path and renamed into place, so readers never
+// see a torn sidecar; leftovers are removed with the partial uploads.
+func (st *imageStore) writeMeta(ctx context.Context, meta *imageMeta) error {
+	_, span := st.startSpan(ctx, "write_meta", meta.ID)
+	defer span.End()
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	final := st.metaPath(meta.ID)
+	tmp := partialPath(final)
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		os.Remove(tmp)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// record describes a committed image and writes its sidecar. If that
+// fails the image is removed: without a sidecar it would have no owner.
+func (st *imageStore) record(ctx context.Context, id, owner, source string) (*imageMeta, error) {
+	meta, err := st.describe(id, owner)
+	if err == nil {
+		meta.Source = source
+		err = st.writeMeta(ctx, meta)
+	}
+	if err != nil {
+		os.Remove(st.imagePath(id))
+		return nil, err
+	}
+	return meta, nil
+}
+
+// stat returns the metadata for id, or a NotFound status. Images uploaded
+// before sidecars existed are described from the file itself.
+func (st *imageStore) stat(ctx context.Context, id string) (*imageMeta, error) {
+	if err := validateImageID(id); err != nil {
+		return nil, err
+	}
+	_, span := st.startSpan(ctx, "stat", id)
+	defer span.End()
+
+	data, err := os.ReadFile(st.metaPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		meta, err := st.describe(id, "")
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, status.Errorf(codes.NotFound, "image %s not found", id)
+		}
+		if err != nil {
+			span.SetStatus(otelcodes.Error, err.Error())
+			return nil, status.Errorf(codes.Internal, "stat image: %v", err)
+		}
+		return meta, nil
+	}
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, status.Errorf(codes.Internal, "read image metadata: %v", err)
+	}
+	var meta imageMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, status.Errorf(codes.Internal, "decode image metadata: %v", err)
+	}
+	return &meta, nil
+}
+
+// list returns metadata for every stored image, oldest first
+func (st *imageStore) list(ctx context.Context) ([]*imageMeta, error) {
+	_, span := tracer.Start(ctx, "storage.list")
+	defer span.End()
+
+	entries, err := os.ReadDir(st.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, status.Errorf(codes.Internal, "list images: %v", err)
+	}
+
+	var metas []*imageMeta
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), imageExt)
+		if !ok || e.IsDir() || validateImageID(id) != nil {
+			continue
+		}
+		meta, err := st.stat(ctx, id)
+		if err != nil {
+			// deleted between ReadDir and stat
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].CreatedAt.Before(metas[j].CreatedAt) })
+	span.SetAttributes(attribute.Int("storage.images", len(metas)))
+	return metas, nil
+}
+
+// open returns the image file for reading; the caller closes it
+func (st *imageStore) open(ctx context.Context, id string) (*os.File, error) {
+	if err := validateImageID(id); err != nil {
+		return nil, err
+	}
+	_, span := st.startSpan(ctx, "open", id)
+	defer span.End()
+
+	f, err := os.Open(st.imagePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, status.Errorf(codes.NotFound, "image %s not found", id)
+	}
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, status.Errorf(codes.Internal, "open image: %v", err)
+	}
+	return f, nil
+}
+
+// delete removes the image and its sidecar
+func (st *imageStore) delete(ctx context.Context, id string) error {
+	if err := validateImageID(id); err != nil {
+		return err
+	}
+	_, span := st.startSpan(ctx, "delete", id)
+	defer span.End()
+
+	err := os.Remove(st.imagePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return status.Errorf(codes.NotFound, "image %s not found", id)
+	}
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return status.Errorf(codes.Internal, "delete image: %v", err)
+	}
+	if err := os.Remove(st.metaPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return status.Errorf(codes.Internal, "delete image metadata: %v", err)
+	}
+	return nil
+}
+
+// decode loads and decodes a stored image
+func (st *imageStore) decode(ctx context.Context, id string) (image.Image, string, error) {
+	f, err := st.open(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	_, span := st.startSpan(ctx, "decode", id)
+	defer span.End()
+	img, format, err := image.Decode(f)
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, "", status.Errorf(codes.FailedPrecondition, "decode image %s: %v", id, err)
+	}
+	return img, format, nil
+}
+
+// save encodes img as a new image derived from source and returns its
+// metadata. PNG and GIF sources are saved as PNG to stay lossless; the
+// rest are saved as JPEG. Either way the file is named <id>.jpg; see
+// imageExt.
+func (st *imageStore) save(ctx context.Context, img image.Image, format, owner, source string) (*imageMeta, error) {
+	id := uuid.New().String()
+	ctx, span := st.startSpan(ctx, "save", id)
+	defer span.End()
+
+	fail := func(err error) (*imageMeta, error) {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, status.Errorf(codes.Internal, "save image: %v", err)
+	}
+	if err := os.MkdirAll(st.dir, 0755); err != nil {
+		return fail(err)
+	}
+
+	final := st.imagePath(id)
+	tmp := partialPath(final)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fail(err)
+	}
+	if format == "png" || format == "gif" {
+		format = "png"
+		err = png.Encode(f, img)
+	} else {
+		format = "jpeg"
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: outputJPEGQuality})
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fail(err)
+	}
+	if err := commitUpload(ctx, tmp, final); err != nil {
+		return fail(err)
+	}
+
+	meta, err := st.record(ctx, id, owner, source)
+	if err != nil {
+		return fail(err)
+	}
+	return meta, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// writeTestImage stores a small PNG under a new ID without a sidecar, as
+// images uploaded before sidecars existed are
+func writeTestImage(t *testing.T, st *imageStore) string {
+	t.Helper()
+	if err := os.MkdirAll(st.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New().String()
+	f, err := os.Create(st.imagePath(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestRecord(t *testing.T) {
+	st := &imageStore{dir: t.TempDir()}
+	id := writeTestImage(t, st)
+
+	meta, err := st.record(context.Background(), id, "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Owner != "alice" || meta.Format != "png" || meta.Width != 4 || meta.Height != 3 {
+		t.Errorf("record = %+v, want alice's 4x3 png", meta)
+	}
+	stored, err := st.stat(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Owner != "alice" {
+		t.Errorf("sidecar owner = %q, want alice", stored.Owner)
+	}
+}
+
+func TestRecordRemovesImageWithoutSidecar(t *testing.T) {
+	st := &imageStore{dir: t.TempDir()}
+	id := writeTestImage(t, st)
+	// a non-empty directory where the sidecar goes makes the rename fail
+	if err := os.MkdirAll(filepath.Join(st.metaPath(id), "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.record(context.Background(), id, "alice", ""); err == nil {
+		t.Fatal("record succeeded without writing the sidecar")
+	}
+	if _, err := os.Stat(st.imagePath(id)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("image left behind without an owner: %v", err)
+	}
+	os.RemoveAll(st.metaPath(id))
+	if _, err := st.stat(context.Background(), id); status.Code(err) != codes.NotFound {
+		t.Errorf("stat = %v, want %s", err, codes.NotFound)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	pb "image-proc/proto"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// minSniffBytes is how much data must arrive before an unknown format is rejected.
+	minSniffBytes = 16
+	// maxHeaderBytes caps how much we buffer while waiting for a decodable header.
+	maxHeaderBytes = 512 * 1024
+)
+
+// uploadLimits bounds what a single Upload stream may write to disk.
+// A zero value for any field disables that particular check.
+type uploadLimits struct {
+	MaxBytes      int64         // total bytes per upload
+	MaxChunkBytes int           // bytes per UploadRequest chunk
+	MaxWidth      int           // pixels
+	MaxHeight     int           // pixels
+	MaxPixels     int64         // width * height
+	IdleTimeout   time.Duration // max gap between two chunks
+}
+
+// checksDimensions reports whether the image header has to be inspected.
+func (l uploadLimits) checksDimensions() bool {
+	return l.MaxWidth > 0 || l.MaxHeight > 0 || l.MaxPixels > 0
+}
+
+// checkConfig validates decoded image dimensions against the limits.
+func (l uploadLimits) checkConfig(cfg image.Config) error {
+	if l.MaxWidth > 0 && cfg.Width > l.MaxWidth {
+		return status.Errorf(codes.ResourceExhausted, "image width %d exceeds limit of %d", cfg.Width, l.MaxWidth)
+	}
+	if l.MaxHeight > 0 && cfg.Height > l.MaxHeight {
+		return status.Errorf(codes.ResourceExhausted, "image height %d exceeds limit of %d", cfg.Height, l.MaxHeight)
+	}
+	if px := int64(cfg.Width) * int64(cfg.Height); l.MaxPixels > 0 && px > l.MaxPixels {
+		return status.Errorf(codes.ResourceExhausted, "image has %d pixels, limit is %d", px, l.MaxPixels)
+	}
+	return nil
+}
+
+// headerSniffer buffers the first bytes of an upload until the image
+// header can be decoded, so oversized images are rejected before the
+// rest of the payload is written to disk.
+type headerSniffer struct {
+	limits uploadLimits
+	buf    bytes.Buffer
+	done   bool
+}
+
+// feed appends chunk to the buffered header and validates it once enough
+// bytes are available. It returns nil while more data is needed.
+func (h *headerSniffer) feed(chunk []byte) error {
+	if h.done {
+		return nil
+	}
+	h.buf.Write(chunk)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(h.buf.Bytes()))
+	switch {
+	case err == nil:
+		h.done = true
+		h.buf = bytes.Buffer{}
+		return h.limits.checkConfig(cfg)
+	case errors.Is(err, image.ErrFormat) && h.buf.Len() >= minSniffBytes:
+		return status.Error(codes.InvalidArgument, "upload is not a supported image format")
+	case h.buf.Len() >= maxHeaderBytes:
+		return status.Errorf(codes.InvalidArgument, "could not decode image header within %d bytes: %v", maxHeaderBytes, err)
+	}
+	return nil
+}
+
+// finish is called on EOF and fails if the header never became decodable.
+func (h *headerSniffer) finish() error {
+	if h.done {
+		return nil
+	}
+	return status.Error(codes.InvalidArgument, "upload ended before a valid image header was received")
+}
+
+// recvResult carries one Recv outcome from the reader goroutine.
+type recvResult struct {
+	req *pb.UploadRequest
+	err error
+}
+
+// receiveUpload reads chunks from stream into file while enforcing limits.
+// It returns the number of bytes written, or a status error describing
+// why the upload was aborted.
+func receiveUpload(stream pb.ImageProcessor_UploadServer, file *os.File, limits uploadLimits) (int64, error) {
+	ctx := stream.Context()
+
+	// Recv blocks without a deadline, so it runs in its own goroutine and
+	// the idle timer is enforced here. Returning from the handler cancels
+	// the stream context, which unblocks and ends the reader.
+	msgs := make(chan recvResult)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			select {
+			case msgs <- recvResult{req, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if limits.IdleTimeout > 0 {
+		timer = time.NewTimer(limits.IdleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	var sniffer *headerSniffer
+	if limits.checksDimensions() {
+		sniffer = &headerSniffer{limits: limits}
+	}
+
+	var written int64
+	for {
+		var res recvResult
+		select {
+		case res = <-msgs:
+		case <-idle:
+			return written, status.Errorf(codes.DeadlineExceeded, "no upload data received for %s", limits.IdleTimeout)
+		case <-ctx.Done():
+			return written, status.FromContextError(ctx.Err()).Err()
+		}
+
+		if res.err == io.EOF {
+			if sniffer != nil {
+				if err := sniffer.finish(); err != nil {
+					return written, err
+				}
+			}
+			return written, nil
+		}
+		if res.err != nil {
+			if _, ok := status.FromError(res.err); ok {
+				// e.g. ResourceExhausted from the server's MaxRecvMsgSize
+				return written, res.err
+			}
+			return written, status.Errorf(codes.Internal, "upload recv error: %v", res.err)
+		}
+
+		chunk := res.req.GetChunk()
+		if limits.MaxChunkBytes > 0 && len(chunk) > limits.MaxChunkBytes {
+			return written, status.Errorf(codes.InvalidArgument, "chunk of %d bytes exceeds limit of %d", len(chunk), limits.MaxChunkBytes)
+		}
+		if limits.MaxBytes > 0 && written+int64(len(chunk)) > limits.MaxBytes {
+			return written, status.Errorf(codes.ResourceExhausted, "upload exceeds limit of %d bytes", limits.MaxBytes)
+		}
+		if sniffer != nil {
+			if err := sniffer.feed(chunk); err != nil {
+				return written, err
+			}
+		}
+		if _, err := file.Write(chunk); err != nil {
+			return written, status.Errorf(codes.Internal, "file write error: %v", err)
+		}
+		written += int64(len(chunk))
+
+		if timer != nil {
+			timer.Reset(limits.IdleTimeout)
+		}
+	}
+}
+
+// commitUpload moves a fully received upload from tmpPath to finalPath.
+func commitUpload(ctx context.Context, tmpPath, finalPath string) error {
+	_, span := tracer.Start(ctx, "storage.commit")
+	defer span.End()
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// cleanupPartialUploads removes leftover .part files in dir, e.g. from
+// uploads cut off by a shutdown or crash, and returns how many it removed.
+func cleanupPartialUploads(dir string) (int, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.part"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, path := range matches {
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// partialPath is where an upload is written until it has been fully received.
+func partialPath(finalPath string) string {
+	return fmt.Sprintf("%s.part", finalPath)
+}
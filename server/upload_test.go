@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	pb "image-proc/proto"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// encodePNG returns a w x h PNG
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// split cuts data into chunks of at most size bytes
+func split(data []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(data) > size {
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+	return append(chunks, data)
+}
+
+// uploadChunks sends chunks as one upload and returns the outcome
+func uploadChunks(ctx context.Context, client pb.ImageProcessorClient, chunks [][]byte) (string, error) {
+	stream, err := client.Upload(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, chunk := range chunks {
+		// once the server has given up, the error comes with CloseAndRecv
+		if err := stream.Send(&pb.UploadRequest{Chunk: chunk}); err != nil {
+			break
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	return resp.ImageId, nil
+}
+
+// storedFiles lists what is left in the upload directory
+func storedFiles(t *testing.T, s *server) []string {
+	t.Helper()
+	entries, err := os.ReadDir(s.store.dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestUploadLimits(t *testing.T) {
+	wide := encodePNG(t, 64, 8)
+	tests := []struct {
+		name   string
+		limits uploadLimits
+		chunks [][]byte
+		code   codes.Code
+	}{
+		{name: "within limits", limits: uploadLimits{MaxBytes: 1 << 20, MaxChunkBytes: 64, MaxWidth: 64, MaxHeight: 8, MaxPixels: 512}, chunks: split(wide, 64)},
+		{name: "no limits", chunks: [][]byte{wide}},
+		{name: "total size", limits: uploadLimits{MaxBytes: int64(len(wide)) - 1}, chunks: split(wide, 16), code: codes.ResourceExhausted},
+		{name: "chunk size", limits: uploadLimits{MaxChunkBytes: 16}, chunks: split(wide, 17), code: codes.InvalidArgument},
+		{name: "width", limits: uploadLimits{MaxWidth: 63}, chunks: split(wide, 16), code: codes.ResourceExhausted},
+		{name: "height", limits: uploadLimits{MaxHeight: 7}, chunks: split(wide, 16), code: codes.ResourceExhausted},
+		{name: "pixels", limits: uploadLimits{MaxPixels: 511}, chunks: split(wide, 16), code: codes.ResourceExhausted},
+		{name: "not an image", limits: uploadLimits{MaxWidth: 64}, chunks: [][]byte{bytes.Repeat([]byte("x"), minSniffBytes)}, code: codes.InvalidArgument},
+		{name: "ends inside the header", limits: uploadLimits{MaxWidth: 64}, chunks: [][]byte{wide[:8]}, code: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.limits = tt.limits
+			client := serve(t, s)
+			id, err := uploadChunks(context.Background(), client, tt.chunks)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("Upload = %v, want %s", err, tt.code)
+			}
+			if err == nil {
+				data, err := os.ReadFile(s.store.imagePath(id))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, wide) {
+					t.Errorf("stored %d bytes, want the %d uploaded", len(data), len(wide))
+				}
+				return
+			}
+			// a refused upload leaves nothing behind, partial or not
+			if files := storedFiles(t, s); len(files) != 0 {
+				t.Errorf("refused upload left %v", files)
+			}
+		})
+	}
+}
+
+func TestUploadIdleTimeout(t *testing.T) {
+	s := newTestServer(t)
+	s.limits = uploadLimits{IdleTimeout: 50 * time.Millisecond}
+	client := serve(t, s)
+	stream, err := client.Upload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&pb.UploadRequest{Chunk: encodePNG(t, 8, 8)[:16]}); err != nil {
+		t.Fatal(err)
+	}
+	// the client stalls without closing the stream
+	if err := stream.RecvMsg(&pb.UploadResponse{}); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("stalled upload = %v, want %s", err, codes.DeadlineExceeded)
+	}
+	if files := storedFiles(t, s); len(files) != 0 {
+		t.Errorf("timed out upload left %v", files)
+	}
+}
+
+func TestUploadCancelled(t *testing.T) {
+	s := newTestServer(t)
+	client := serve(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Upload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&pb.UploadRequest{Chunk: encodePNG(t, 8, 8)[:16]}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(storedFiles(t, s)) == 1 })
+	cancel()
+	// the partial file goes once the server notices
+	waitFor(t, func() bool { return len(storedFiles(t, s)) == 0 })
+}
+
+func TestCleanupPartialUploads(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.png.part", "b.jpg.part", "c.png", "c.png.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := cleanupPartialUploads(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("removed %d partial uploads, want 2", n)
+	}
+	entries, _ := os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	if len(left) != 2 || left[0] != "c.png" || left[1] != "c.png.json" {
+		t.Errorf("left %v, want the committed image and its sidecar", left)
+	}
+
+	if n, err := cleanupPartialUploads(filepath.Join(dir, "missing")); n != 0 || err != nil {
+		t.Errorf("cleanup of a missing dir = %d, %v; want nothing", n, err)
+	}
+}
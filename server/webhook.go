@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	pb "image-proc/proto"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// webhook request headers; the signature covers "<timestamp>.<body>"
+const (
+	webhookDeliveryHeader  = "X-Imageproc-Delivery"
+	webhookEventHeader     = "X-Imageproc-Event"
+	webhookTimestampHeader = "X-Imageproc-Timestamp"
+	webhookSignatureHeader = "X-Imageproc-Signature"
+)
+
+// webhookPayload is the JSON body POSTed to a job's callback URL
+type webhookPayload struct {
+	Event     string          `json:"event"` // job.succeeded, job.failed or job.cancelled
+	JobID     string          `json:"job_id"`
+	ImageID   string          `json:"image_id"`
+	Owner     string          `json:"owner"`
+	Filters   []string        `json:"filters"`
+	State     string          `json:"state"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	Attempts  int32           `json:"attempts"`
+	Outputs   []webhookOutput `json:"outputs"`
+	Timings   webhookTimings  `json:"timings"`
+	Delivered time.Time       `json:"delivered_at"`
+}
+
+// webhookOutput names an image the job produced
+type webhookOutput struct {
+	ImageID     string `json:"image_id"`
+	ContentPath string `json:"content_path"` // gateway path to download it from
+}
+
+type webhookTimings struct {
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	QueuedMS     int64      `json:"queued_ms"`
+	ProcessingMS int64      `json:"processing_ms"`
+}
+
+// newWebhookPayload describes a finished job
+func newWebhookPayload(r *jobRecord) *webhookPayload {
+	p := &webhookPayload{
+		Event:    "job." + strings.ToLower(strings.TrimPrefix(r.State, "JOB_STATE_")),
+		JobID:    r.ID,
+		ImageID:  r.ImageID,
+		Owner:    r.Owner,
+		Filters:  r.Filters,
+		State:    r.State,
+		Status:   r.Status,
+		Error:    r.Error,
+		Attempts: r.Attempts,
+		Outputs:  []webhookOutput{},
+		Timings: webhookTimings{
+			CreatedAt:  r.CreatedAt,
+			StartedAt:  r.StartedAt,
+			FinishedAt: r.FinishedAt,
+		},
+	}
+	if r.ResultImageID != "" {
+		p.Outputs = append(p.Outputs, webhookOutput{
+			ImageID:     r.ResultImageID,
+			ContentPath: "/v1/images/" + r.ResultImageID + "/content",
+		})
+	}
+	if r.StartedAt != nil {
+		p.Timings.QueuedMS = r.StartedAt.Sub(r.CreatedAt).Milliseconds()
+		if r.FinishedAt != nil {
+			p.Timings.ProcessingMS = r.FinishedAt.Sub(*r.StartedAt).Milliseconds()
+		}
+	}
+	return p
+}
+
+// signWebhook returns the signature header value for body sent at ts
+func signWebhook(secret []byte, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSender delivers job outcomes to callback URLs and records every
+// attempt in the job store
+type webhookSender struct {
+	secret       []byte
+	allowed      []string
+	allowPrivate bool
+	retry        retryPolicy
+	client       *http.Client
+	store        *jobStore
+	logger       *zap.SugaredLogger
+}
+
+// newWebhookSender sets up deliveries. Unless allowPrivate is set, the
+// sender refuses to connect to loopback, private and link-local addresses,
+// which a callback URL could otherwise use to reach internal services.
+func newWebhookSender(secret string, allowed []string, allowPrivate bool, timeout time.Duration, retry retryPolicy, store *jobStore, logger *zap.SugaredLogger) *webhookSender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// checked on the address actually dialed, after DNS resolution,
+		// so a name that resolves to an internal address is caught too
+		dialer.Control = refusePrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &webhookSender{
+		secret:       []byte(secret),
+		allowed:      allowed,
+		allowPrivate: allowPrivate,
+		retry:        retry,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// a redirect could point anywhere, past the allowed hosts
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		store:  store,
+		logger: logger,
+	}
+}
+
+// isPrivateAddress reports whether ip belongs to the host itself or to an
+// internal network, including the link-local cloud metadata address
+func isPrivateAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// refusePrivateAddress is a net.Dialer Control function that fails dials
+// to private addresses
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("webhook: unexpected dial address %q", address)
+	}
+	if isPrivateAddress(addr.Addr()) {
+		return fmt.Errorf("webhook: refusing to connect to private address %s", addr.Addr())
+	}
+	return nil
+}
+
+// validate checks a callback URL before a job is accepted with it
+func (w *webhookSender) validate(raw string) error {
+	if len(w.secret) == 0 {
+		return status.Error(codes.FailedPrecondition, "callbacks are disabled on this server")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return status.Errorf(codes.InvalidArgument, "callback_url %q must be an absolute http or https URL", raw)
+	}
+	host := u.Hostname()
+	// names are checked when they are dialed; literal addresses can be
+	// refused right away
+	if ip, err := netip.ParseAddr(host); err == nil && !w.allowPrivate && isPrivateAddress(ip) {
+		return status.Errorf(codes.InvalidArgument, "callback_url %q points to a private address", raw)
+	}
+	if len(w.allowed) == 0 {
+		return nil
+	}
+	for _, pattern := range w.allowed {
+		if host == pattern || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return nil
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "callback host %q is not allowed", host)
+}
+
+// deliver POSTs r's outcome to its callback URL until the receiver
+// accepts it, the retry policy gives up or ctx is done. Delivery is
+// marked done in the store unless ctx ended it, so a delivery cut short
+// by a shutdown is resumed on the next start.
+func (w *webhookSender) deliver(ctx context.Context, r *jobRecord) {
+	log := w.logger.With("job_id", r.ID, "callback_url", r.Callback)
+	payload := newWebhookPayload(r)
+	deliveryID := uuid.New().String()
+
+	for attempt := 1; ; attempt++ {
+		payload.Delivered = time.Now().UTC()
+		d := w.send(ctx, r.Callback, deliveryID, attempt, payload)
+		if ctx.Err() != nil {
+			return
+		}
+		if err := w.store.addDelivery(r.ID, d); err != nil {
+			log.Warnw("failed to record webhook delivery", "error", err)
+		}
+		if d.Succeeded || attempt >= w.retry.maxAttempts {
+			if d.Succeeded {
+				log.Infow("webhook delivered", "attempt", attempt)
+			} else {
+				log.Warnw("webhook given up", "attempts", attempt, "error", d.Error)
+			}
+			if err := w.store.markCallbackDone(r.ID); err != nil {
+				log.Warnw("failed to record webhook completion", "error", err)
+			}
+			return
+		}
+
+		delay := w.retry.backoff(attempt)
+		log.Infow("webhook delivery failed, retrying", "attempt", attempt, "delay", delay, "error", d.Error)
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// send makes one delivery attempt
+func (w *webhookSender) send(ctx context.Context, target, deliveryID string, attempt int, payload *webhookPayload) *deliveryRecord {
+	d := &deliveryRecord{DeliveryID: deliveryID, Attempt: int32(attempt), URL: target, SentAt: time.Now()}
+	defer func() { d.Duration = time.Since(d.SentAt) }()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	ts := d.SentAt.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "image-proc-webhook/1")
+	req.Header.Set(webhookDeliveryHeader, deliveryID)
+	req.Header.Set(webhookEventHeader, payload.Event)
+	req.Header.Set(webhookTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(webhookSignatureHeader, signWebhook(w.secret, ts, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	defer resp.Body.Close()
+	// the body, and even the reason phrase, are up to the receiver and
+	// are never recorded; drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	d.StatusCode = int32(resp.StatusCode)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		d.Succeeded = true
+		return d
+	}
+	d.Error = fmt.Sprintf("receiver answered %d", resp.StatusCode)
+	return d
+}
+
+// notify starts delivering j's webhook if it has one and has finished
+func (s *server) notify(j *job) {
+	if j.callback == "" || !isTerminal(j.latest().State) {
+		return
+	}
+	s.deliverInBackground(j.record())
+}
+
+func (s *server) deliverInBackground(r *jobRecord) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		s.webhooks.deliver(s.backgroundCtx, r)
+	}()
+}
+
+// recoverWebhooks resumes deliveries a previous run did not finish and
+// reports how many there were
+func (s *server) recoverWebhooks() (int, error) {
+	records, err := s.jobs.store.pendingCallbacks()
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range records {
+		s.deliverInBackground(r)
+	}
+	return len(records), nil
+}
+
+// ListWebhookDeliveries returns every attempt to deliver the webhook of
+// one of the caller's jobs
+func (s *server) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	addLogFields(ctx, "job_id", req.JobId)
+	if _, err := s.ownedJob(ctx, req.JobId); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.jobs.store.deliveries(req.JobId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list deliveries: %v", err)
+	}
+	resp := &pb.ListWebhookDeliveriesResponse{}
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, d.proto())
+	}
+	return resp, nil
+}
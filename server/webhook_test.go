@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+// receiver is a webhook endpoint that answers with the next of its
+// statuses, repeating the last one, and records what it was sent
+type receiver struct {
+	*httptest.Server
+	statuses []int
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	times    []time.Time
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rc := &receiver{statuses: statuses}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		n := len(rc.requests)
+		rc.requests = append(rc.requests, r)
+		rc.bodies = append(rc.bodies, body)
+		rc.times = append(rc.times, time.Now())
+		rc.mu.Unlock()
+		code := rc.statuses[min(n, len(rc.statuses)-1)]
+		w.WriteHeader(code)
+		io.WriteString(w, "internal details of the receiver")
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+// sent returns the requests received so far
+func (rc *receiver) sent() ([]*http.Request, [][]byte, []time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.requests, rc.bodies, rc.times
+}
+
+// newTestSender returns a sender with a fresh job store holding a finished
+// job that calls back to callback
+func newTestSender(t *testing.T, allowPrivate bool, retry retryPolicy, callback string) (*webhookSender, *jobRecord) {
+	t.Helper()
+	store, err := openJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.close() })
+	created := time.Now().Add(-time.Minute).UTC()
+	r := &jobRecord{
+		ID:            "8c4d3f0e-1a2b-4c5d-8e9f-0a1b2c3d4e5f",
+		ImageID:       "573339b8-a202-47ba-b3b2-0f2982caaf0a",
+		Filters:       []string{"blur"},
+		Owner:         "alice",
+		Callback:      callback,
+		State:         "JOB_STATE_SUCCEEDED",
+		Percent:       100,
+		ResultImageID: "0d9c1e2f-3a4b-4c5d-9e8f-7a6b5c4d3e2f",
+		CreatedAt:     created,
+		UpdatedAt:     created,
+	}
+	if err := store.put(r); err != nil {
+		t.Fatal(err)
+	}
+	w := newWebhookSender(testWebhookSecret, nil, allowPrivate, 5*time.Second, retry, store, zap.NewNop().Sugar())
+	return w, r
+}
+
+func TestWebhookSignature(t *testing.T) {
+	rc := newReceiver(t, http.StatusNoContent)
+	w, r := newTestSender(t, true, retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}, rc.URL+"/hook")
+
+	w.deliver(context.Background(), r)
+
+	if rc.count() != 1 {
+		t.Fatalf("receiver got %d requests, want 1", rc.count())
+	}
+	requests, bodies, _ := rc.sent()
+	req, body := requests[0], bodies[0]
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	io.WriteString(mac, req.Header.Get(webhookTimestampHeader)+".")
+	mac.Write(body)
+	if got, want := req.Header.Get(webhookSignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := req.Header.Get(webhookEventHeader); got != "job.succeeded" {
+		t.Errorf("event header = %q, want job.succeeded", got)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.JobID != r.ID || payload.Owner != "alice" || len(payload.Outputs) != 1 || payload.Outputs[0].ImageID != r.ResultImageID {
+		t.Errorf("payload = %+v, does not describe the job", payload)
+	}
+
+	deliveries, err := w.store.deliveries(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || !deliveries[0].Succeeded || deliveries[0].StatusCode != http.StatusNoContent {
+		t.Errorf("deliveries = %+v, want one successful 204", deliveries)
+	}
+	if deliveries[0].DeliveryID != req.Header.Get(webhookDeliveryHeader) {
+		t.Errorf("recorded delivery ID %q, sent %q", deliveries[0].DeliveryID, req.Header.Get(webhookDeliveryHeader))
+	}
+	stored, err := w.store.get(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.CallbackDone {
+		t.Error("callback not marked done after a successful delivery")
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	retry := retryPolicy{maxAttempts: 5, initialBackoff: 20 * time.Millisecond, maxBackoff: 40 * time.Millisecond}
+	w, r := newTestSender(t, true, retry, rc.URL)
+
+	w.deliver(context.Background(), r)
+
+	if rc.count() != 3 {
+		t.Fatalf("receiver got %d requests, want 3", rc.count())
+	}
+	_, _, times := rc.sent()
+	for i := 1; i < 3; i++ {
+		if gap, want := times[i].Sub(times[i-1]), retry.backoff(i); gap < want {
+			t.Errorf("attempt %d came %s after the previous one, want at least %s", i+1, gap, want)
+		}
+	}
+	deliveries, err := w.store.deliveries(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("recorded %d deliveries, want 3", len(deliveries))
+	}
+	for i, d := range deliveries {
+		if d.Attempt != int32(i+1) || d.DeliveryID != deliveries[0].DeliveryID {
+			t.Errorf("delivery %d = attempt %d of %s, want attempt %d of one delivery", i, d.Attempt, d.DeliveryID, i+1)
+		}
+	}
+	if d := deliveries[0]; d.Succeeded || d.StatusCode != 500 || d.Error != "receiver answered 500" {
+		t.Errorf("first delivery = %+v, want a failed 500 with only the status recorded", d)
+	}
+	if d := deliveries[2]; !d.Succeeded || d.StatusCode != 200 {
+		t.Errorf("last delivery = %+v, want a successful 200", d)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	rc := newReceiver(t, http.StatusServiceUnavailable)
+	w, r := newTestSender(t, true, retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: 2 * time.Millisecond}, rc.URL)
+
+	w.deliver(context.Background(), r)
+
+	if rc.count() != 3 {
+		t.Fatalf("receiver got %d requests, want 3", rc.count())
+	}
+	deliveries, err := w.store.deliveries(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("recorded %d deliveries, want 3", len(deliveries))
+	}
+	for _, d := range deliveries {
+		if d.Succeeded || strings.Contains(d.Error, "internal details") {
+			t.Errorf("delivery %+v: want a failure without the response body", d)
+		}
+	}
+	stored, err := w.store.get(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.CallbackDone {
+		t.Error("callback not marked done after giving up")
+	}
+}
+
+func TestWebhookStopsWithContext(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError)
+	w, r := newTestSender(t, true, retryPolicy{maxAttempts: 5, initialBackoff: time.Hour, maxBackoff: time.Hour}, rc.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.deliver(ctx, r)
+		close(done)
+	}()
+	for rc.count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	stored, err := w.store.get(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.CallbackDone {
+		t.Error("callback marked done although the delivery was cut short")
+	}
+}
+
+func TestWebhookRefusesPrivateAddresses(t *testing.T) {
+	rc := newReceiver(t, http.StatusOK)
+	// the receiver listens on loopback, reached through a name so only the
+	// dial-time check can catch it
+	callback := strings.Replace(rc.URL, "127.0.0.1", "localhost", 1)
+	w, r := newTestSender(t, false, retryPolicy{maxAttempts: 1}, callback)
+
+	if err := w.validate(callback); err != nil {
+		t.Fatalf("validate(%q) = %v, want names to pass until dialed", callback, err)
+	}
+	w.deliver(context.Background(), r)
+	if rc.count() != 0 {
+		t.Fatalf("receiver on loopback got %d requests, want none", rc.count())
+	}
+	deliveries, err := w.store.deliveries(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Succeeded || !strings.Contains(deliveries[0].Error, "private address") {
+		t.Errorf("deliveries = %+v, want one refused attempt", deliveries)
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowed      []string
+		allowPrivate bool
+		want         codes.Code
+	}{
+		{url: "https://hooks.example.com/done", want: codes.OK},
+		{url: "ftp://hooks.example.com/done", want: codes.InvalidArgument},
+		{url: "/relative", want: codes.InvalidArgument},
+		{url: "http://127.0.0.1:8080/", want: codes.InvalidArgument},
+		{url: "http://10.1.2.3/", want: codes.InvalidArgument},
+		{url: "http://192.168.0.10/", want: codes.InvalidArgument},
+		{url: "http://169.254.169.254/latest/meta-data/", want: codes.InvalidArgument},
+		{url: "http://[::1]/", want: codes.InvalidArgument},
+		{url: "http://[fe80::1]/", want: codes.InvalidArgument},
+		{url: "http://[::ffff:127.0.0.1]/", want: codes.InvalidArgument},
+		{url: "http://0.0.0.0/", want: codes.InvalidArgument},
+		{url: "http://127.0.0.1:8080/", allowPrivate: true, want: codes.OK},
+		{url: "https://a.hooks.example.com/", allowed: []string{"*.hooks.example.com"}, want: codes.OK},
+		{url: "https://evil.example.org/", allowed: []string{"*.hooks.example.com"}, want: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		w := newWebhookSender(testWebhookSecret, tt.allowed, tt.allowPrivate, time.Second, retryPolicy{maxAttempts: 1}, nil, zap.NewNop().Sugar())
+		if got := status.Code(w.validate(tt.url)); got != tt.want {
+			t.Errorf("validate(%q) allowed=%v private=%v = %s, want %s", tt.url, tt.allowed, tt.allowPrivate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "image-proc/proto"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errPoolDraining is returned by acquire once the server is shutting down.
+var errPoolDraining = errors.New("worker pool is draining")
+
+// positionInterval bounds how often a waiting job reports its position
+const positionInterval = 500 * time.Millisecond
+
+// priorityLevels orders priorities from the highest down; unset requests
+// are treated as PRIORITY_NORMAL
+var priorityLevels = []pb.Priority{pb.Priority_PRIORITY_HIGH, pb.Priority_PRIORITY_NORMAL, pb.Priority_PRIORITY_LOW}
+
+// normalizePriority maps an unset or unknown priority to NORMAL
+func normalizePriority(p pb.Priority) pb.Priority {
+	switch p {
+	case pb.Priority_PRIORITY_LOW, pb.Priority_PRIORITY_HIGH:
+		return p
+	}
+	return pb.Priority_PRIORITY_NORMAL
+}
+
+// schedulingPolicy holds the per-principal scheduling settings
+type schedulingPolicy struct {
+	weights        map[string]int // share of workers relative to other principals
+	defaultWeight  int
+	maxConcurrency int            // jobs one principal may run at once, 0 = no limit
+	concurrency    map[string]int // per-principal overrides of maxConcurrency
+}
+
+func (sp schedulingPolicy) weight(principal string) int {
+	if w, ok := sp.weights[principal]; ok {
+		return w
+	}
+	return sp.defaultWeight
+}
+
+func (sp schedulingPolicy) limit(principal string) int {
+	if n, ok := sp.concurrency[principal]; ok {
+		return n
+	}
+	return sp.maxConcurrency
+}
+
+// workTicket describes who is asking for a worker and how urgently
+type workTicket struct {
+	principal string
+	priority  pb.Priority
+}
+
+// waiter is one acquire call waiting in a priority queue
+type waiter struct {
+	workTicket
+	tag     float64 // virtual finish time; smaller is served first
+	seq     uint64  // breaks ties in arrival order
+	granted chan struct{}
+}
+
+func (w *waiter) before(o *waiter) bool {
+	if w.tag != o.tag {
+		return w.tag < o.tag
+	}
+	return w.seq < o.seq
+}
+
+// priorityQueue holds the waiters of one priority, sorted by tag. Tags
+// implement weighted fair queueing: each principal's next job is stamped
+// 1/weight later than its previous one, so a principal with many queued
+// jobs interleaves with newcomers instead of going first in bulk.
+type priorityQueue struct {
+	waiting []*waiter
+	vtime   float64            // tag of the last job started
+	finish  map[string]float64 // last tag handed to each principal
+}
+
+// push assigns w its tag and inserts it in order
+func (q *priorityQueue) push(w *waiter, weight int) {
+	start := max(q.vtime, q.finish[w.principal])
+	w.tag = start + 1/float64(weight)
+	q.finish[w.principal] = w.tag
+	i := sort.Search(len(q.waiting), func(i int) bool { return w.before(q.waiting[i]) })
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[i+1:], q.waiting[i:])
+	q.waiting[i] = w
+}
+
+// index returns w's place in the queue, or -1
+func (q *priorityQueue) index(w *waiter) int {
+	i := sort.Search(len(q.waiting), func(i int) bool { return !q.waiting[i].before(w) })
+	if i < len(q.waiting) && q.waiting[i] == w {
+		return i
+	}
+	return -1
+}
+
+func (q *priorityQueue) remove(i int) {
+	q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+}
+
+// forget drops finish tags that can no longer delay anyone, so the map
+// does not grow with every principal ever seen
+func (q *priorityQueue) forget() {
+	if len(q.finish) < 1024 {
+		return
+	}
+	for p, tag := range q.finish {
+		if tag <= q.vtime {
+			delete(q.finish, p)
+		}
+	}
+}
+
+// workerPool bounds how many jobs run at the same time and decides which
+// waiting job gets the next free worker: strictly by priority, then by
+// weighted fair queueing across principals, skipping principals already
+// at their concurrency limit.
+type workerPool struct {
+	size    int
+	policy  schedulingPolicy
+	metrics *serverMetrics
+
+	mu       sync.Mutex
+	busy     int
+	running  map[string]int // running jobs per principal
+	queues   map[pb.Priority]*priorityQueue
+	waiting  int
+	seq      uint64
+	changed  chan struct{} // closed and replaced whenever the queue moves
+	draining chan struct{}
+	drained  bool
+	progress time.Time // last time a job started, finished or moved on
+}
+
+// newWorkerPool creates a pool with n concurrent workers.
+func newWorkerPool(n int, policy schedulingPolicy, metrics *serverMetrics) *workerPool {
+	if n < 1 {
+		n = 1
+	}
+	if policy.defaultWeight < 1 {
+		policy.defaultWeight = 1
+	}
+	metrics.workers.Set(float64(n))
+	p := &workerPool{
+		size:     n,
+		policy:   policy,
+		metrics:  metrics,
+		running:  make(map[string]int),
+		queues:   make(map[pb.Priority]*priorityQueue),
+		changed:  make(chan struct{}),
+		draining: make(chan struct{}),
+		progress: time.Now(),
+	}
+	for _, level := range priorityLevels {
+		p.queues[level] = &priorityQueue{finish: make(map[string]float64)}
+	}
+	return p
+}
+
+// acquire blocks until the scheduler grants t a worker, ctx is done or the
+// pool drains. While waiting, onPosition is called with the job's 1-based
+// queue position whenever it changes. The returned release func must be
+// called exactly once when the work has finished.
+func (p *workerPool) acquire(ctx context.Context, t workTicket, onPosition func(int)) (release func(), err error) {
+	t.priority = normalizePriority(t.priority)
+	w := &waiter{workTicket: t, granted: make(chan struct{})}
+
+	p.mu.Lock()
+	if p.drained {
+		p.mu.Unlock()
+		return nil, errPoolDraining
+	}
+	p.seq++
+	w.seq = p.seq
+	p.queues[t.priority].push(w, p.policy.weight(t.principal))
+	p.dispatchLocked()
+	p.mu.Unlock()
+
+	release = func() { p.release(t.principal) }
+	reported := 0
+	var throttle <-chan time.Time
+	for {
+		p.mu.Lock()
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-w.granted:
+			return release, nil
+		default:
+		}
+		if throttle == nil && onPosition != nil {
+			if pos := p.position(w); pos > 0 && pos != reported {
+				reported = pos
+				onPosition(pos)
+			}
+		}
+
+		select {
+		case <-w.granted:
+			return release, nil
+		case <-changed:
+			if throttle == nil {
+				throttle = time.After(positionInterval)
+			}
+		case <-throttle:
+			throttle = nil
+		case <-ctx.Done():
+			if p.abandon(w) {
+				return nil, ctx.Err()
+			}
+			// granted while being cancelled; hand the worker back
+			release()
+			return nil, ctx.Err()
+		case <-p.draining:
+			if p.abandon(w) {
+				return nil, errPoolDraining
+			}
+			release()
+			return nil, errPoolDraining
+		}
+	}
+}
+
+// position returns w's 1-based place among all waiters, 0 once granted
+func (p *workerPool) position(w *waiter) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ahead := 0
+	for _, level := range priorityLevels {
+		q := p.queues[level]
+		if level == w.priority {
+			if i := q.index(w); i >= 0 {
+				return ahead + i + 1
+			}
+			return 0
+		}
+		ahead += len(q.waiting)
+	}
+	return 0
+}
+
+// abandon removes w from its queue and reports whether it was still
+// waiting; false means it was granted a worker in the meantime
+func (p *workerPool) abandon(w *waiter) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q := p.queues[w.priority]
+	i := q.index(w)
+	if i < 0 {
+		return false
+	}
+	q.remove(i)
+	p.notifyLocked()
+	return true
+}
+
+func (p *workerPool) release(principal string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy--
+	p.progress = time.Now()
+	if p.running[principal]--; p.running[principal] <= 0 {
+		delete(p.running, principal)
+	}
+	p.metrics.workersBusy.Dec()
+	p.dispatchLocked()
+}
+
+// dispatchLocked starts waiting jobs while workers are free
+func (p *workerPool) dispatchLocked() {
+	for p.busy < p.size {
+		q, i := p.nextLocked()
+		if q == nil {
+			break
+		}
+		w := q.waiting[i]
+		q.remove(i)
+		q.vtime = max(q.vtime, w.tag)
+		q.forget()
+		p.busy++
+		p.progress = time.Now()
+		p.running[w.principal]++
+		p.metrics.workersBusy.Inc()
+		close(w.granted)
+	}
+	p.notifyLocked()
+}
+
+// nextLocked finds the waiter to start next: the first in tag order of the
+// highest non-empty priority whose principal is below its limit
+func (p *workerPool) nextLocked() (*priorityQueue, int) {
+	for _, level := range priorityLevels {
+		q := p.queues[level]
+		for i, w := range q.waiting {
+			if limit := p.policy.limit(w.principal); limit > 0 && p.running[w.principal] >= limit {
+				continue
+			}
+			return q, i
+		}
+	}
+	return nil, 0
+}
+
+// notifyLocked wakes waiters so they can report their new positions
+func (p *workerPool) notifyLocked() {
+	n := 0
+	for _, q := range p.queues {
+		n += len(q.waiting)
+	}
+	p.waiting = n
+	p.metrics.jobQueueDepth.Set(float64(n))
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// drain makes queued and future acquire calls fail with errPoolDraining.
+// Work that already holds a worker is left to finish.
+func (p *workerPool) drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.drained {
+		p.drained = true
+		close(p.draining)
+	}
+}
+
+// isDraining reports whether drain has been called.
+func (p *workerPool) isDraining() bool {
+	select {
+	case <-p.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// advance records that a running job made progress
+func (p *workerPool) advance() {
+	p.mu.Lock()
+	p.progress = time.Now()
+	p.mu.Unlock()
+}
+
+// queueDepth returns the number of jobs waiting for a worker
+func (p *workerPool) queueDepth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.waiting
+}
+
+// checkProgress fails when jobs hold workers but none has made progress
+// for longer than timeout, as a stuck filter or a deadlock would
+func (p *workerPool) checkProgress(timeout time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if idle := time.Since(p.progress); p.busy > 0 && idle > timeout {
+		return fmt.Errorf("no progress for %s with %d jobs running", idle.Round(time.Millisecond), p.busy)
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	pb "image-proc/proto"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	low    = pb.Priority_PRIORITY_LOW
+	normal = pb.Priority_PRIORITY_NORMAL
+	high   = pb.Priority_PRIORITY_HIGH
+)
+
+// grant is the outcome of one acquire call
+type grant struct {
+	name    string
+	release func()
+	err     error
+}
+
+// startAcquire calls acquire for t in the background, sending the outcome
+// to grants, and returns once the pool has queued or granted it
+func startAcquire(ctx context.Context, t *testing.T, p *workerPool, name string, ticket workTicket, onPosition func(int), grants chan<- grant) {
+	t.Helper()
+	p.mu.Lock()
+	seq := p.seq
+	p.mu.Unlock()
+	go func() {
+		release, err := p.acquire(ctx, ticket, onPosition)
+		grants <- grant{name: name, release: release, err: err}
+	}()
+	waitFor(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.seq > seq
+	})
+}
+
+// hold takes a worker for principal, which must be free
+func hold(t *testing.T, p *workerPool, principal string) func() {
+	t.Helper()
+	release, err := p.acquire(context.Background(), workTicket{principal: principal}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return release
+}
+
+// nextGrant waits for the next acquire call to return
+func nextGrant(t *testing.T, grants <-chan grant) grant {
+	t.Helper()
+	select {
+	case g := <-grants:
+		return g
+	case <-time.After(5 * time.Second):
+		t.Fatal("no acquire call returned")
+		return grant{}
+	}
+}
+
+// noGrant fails if an acquire call returns
+func noGrant(t *testing.T, grants <-chan grant) {
+	t.Helper()
+	select {
+	case g := <-grants:
+		t.Fatalf("%s returned (err %v) while it should still wait", g.name, g.err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+type queued struct {
+	name   string
+	ticket workTicket
+}
+
+// grantOrder queues each ticket behind a held worker, then frees one
+// worker at a time and returns the names in the order they were granted
+func grantOrder(t *testing.T, policy schedulingPolicy, queue []queued) []string {
+	t.Helper()
+	p := newWorkerPool(1, policy, newServerMetrics(t.TempDir()))
+	release := hold(t, p, "holder")
+	grants := make(chan grant, len(queue))
+	for _, q := range queue {
+		startAcquire(context.Background(), t, p, q.name, q.ticket, nil, grants)
+	}
+	noGrant(t, grants)
+
+	release()
+	var order []string
+	for range queue {
+		g := nextGrant(t, grants)
+		if g.err != nil {
+			t.Fatalf("%s: %v", g.name, g.err)
+		}
+		order = append(order, g.name)
+		g.release()
+	}
+	return order
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy schedulingPolicy
+		queue  []queued
+		want   []string
+	}{
+		{
+			name: "priority before arrival",
+			queue: []queued{
+				{"low", workTicket{principal: "alice", priority: low}},
+				{"normal", workTicket{principal: "alice", priority: normal}},
+				{"high", workTicket{principal: "alice", priority: high}},
+				{"unset", workTicket{principal: "alice"}},
+			},
+			want: []string{"high", "normal", "unset", "low"},
+		},
+		{
+			name: "arrival order within a principal",
+			queue: []queued{
+				{"a1", workTicket{principal: "alice"}},
+				{"a2", workTicket{principal: "alice"}},
+				{"a3", workTicket{principal: "alice"}},
+			},
+			want: []string{"a1", "a2", "a3"},
+		},
+		{
+			name: "equal weights interleave",
+			queue: []queued{
+				{"a1", workTicket{principal: "alice"}},
+				{"a2", workTicket{principal: "alice"}},
+				{"a3", workTicket{principal: "alice"}},
+				{"b1", workTicket{principal: "bob"}},
+				{"b2", workTicket{principal: "bob"}},
+				{"b3", workTicket{principal: "bob"}},
+			},
+			want: []string{"a1", "b1", "a2", "b2", "a3", "b3"},
+		},
+		{
+			name:   "weights do not cross priorities",
+			policy: schedulingPolicy{weights: map[string]int{"alice": 10}},
+			queue: []queued{
+				{"a1", workTicket{principal: "alice", priority: low}},
+				{"a2", workTicket{principal: "alice", priority: low}},
+				{"b1", workTicket{principal: "bob", priority: high}},
+				{"b2", workTicket{principal: "bob", priority: high}},
+			},
+			want: []string{"b1", "b2", "a1", "a2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := grantOrder(t, tt.policy, tt.queue)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("granted %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerWeights(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy schedulingPolicy
+		want   int // of the first 8 grants, how many go to alice
+	}{
+		{name: "equal", want: 4},
+		{name: "3:1", policy: schedulingPolicy{weights: map[string]int{"alice": 3}}, want: 6},
+		{name: "1:3", policy: schedulingPolicy{weights: map[string]int{"bob": 3}}, want: 2},
+		{name: "3:1 by default weight", policy: schedulingPolicy{defaultWeight: 3, weights: map[string]int{"bob": 1}}, want: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// alice queues all her jobs before bob arrives, and still
+			// only gets her share
+			var queue []queued
+			for range 8 {
+				queue = append(queue, queued{"alice", workTicket{principal: "alice"}})
+			}
+			for range 8 {
+				queue = append(queue, queued{"bob", workTicket{principal: "bob"}})
+			}
+			order := grantOrder(t, tt.policy, queue)
+			alice := 0
+			for _, name := range order[:8] {
+				if name == "alice" {
+					alice++
+				}
+			}
+			if alice != tt.want {
+				t.Errorf("alice got %d of the first 8 workers, want %d; order %v", alice, tt.want, order)
+			}
+		})
+	}
+}
+
+func TestSchedulerConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy schedulingPolicy
+		capped bool // whether alice's second job waits for her first
+	}{
+		{name: "no limit", policy: schedulingPolicy{}, capped: false},
+		{name: "limit", policy: schedulingPolicy{maxConcurrency: 1}, capped: true},
+		{name: "override lifts the limit", policy: schedulingPolicy{maxConcurrency: 1, concurrency: map[string]int{"alice": 2}}, capped: false},
+		{name: "override sets a limit", policy: schedulingPolicy{concurrency: map[string]int{"alice": 1}}, capped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newWorkerPool(3, tt.policy, newServerMetrics(t.TempDir()))
+			grants := make(chan grant, 3)
+			startAcquire(context.Background(), t, p, "a1", workTicket{principal: "alice"}, nil, grants)
+			a1 := nextGrant(t, grants)
+			startAcquire(context.Background(), t, p, "a2", workTicket{principal: "alice"}, nil, grants)
+			if !tt.capped {
+				if g := nextGrant(t, grants); g.name != "a2" {
+					t.Fatalf("granted %s, want a2", g.name)
+				}
+				return
+			}
+			// bob is served although alice's job was queued first
+			startAcquire(context.Background(), t, p, "b1", workTicket{principal: "bob"}, nil, grants)
+			if g := nextGrant(t, grants); g.name != "b1" {
+				t.Fatalf("granted %s, want b1 while alice is at her limit", g.name)
+			}
+			noGrant(t, grants)
+			if d := p.queueDepth(); d != 1 {
+				t.Errorf("queue depth = %d, want alice's second job", d)
+			}
+			a1.release()
+			if g := nextGrant(t, grants); g.name != "a2" {
+				t.Fatalf("granted %s, want a2 once alice's first job finished", g.name)
+			}
+		})
+	}
+}
+
+func TestSchedulerAbandon(t *testing.T) {
+	p := newWorkerPool(1, schedulingPolicy{}, newServerMetrics(t.TempDir()))
+	release := hold(t, p, "holder")
+	grants := make(chan grant, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	startAcquire(ctx, t, p, "cancelled", workTicket{principal: "alice"}, nil, grants)
+	startAcquire(context.Background(), t, p, "next", workTicket{principal: "bob"}, nil, grants)
+
+	cancel()
+	g := nextGrant(t, grants)
+	if g.name != "cancelled" || !errors.Is(g.err, context.Canceled) {
+		t.Fatalf("%s returned %v, want the cancelled call to fail", g.name, g.err)
+	}
+	if d := p.queueDepth(); d != 1 {
+		t.Errorf("queue depth = %d after abandoning, want 1", d)
+	}
+	release()
+	if g := nextGrant(t, grants); g.name != "next" || g.err != nil {
+		t.Fatalf("%s returned %v, want the worker to pass to the next job", g.name, g.err)
+	}
+
+	// a waiter that was granted before it could be abandoned keeps its
+	// worker, and acquire hands it back
+	if p.abandon(&waiter{workTicket: workTicket{principal: "alice", priority: normal}}) {
+		t.Error("abandon reported a waiter that is not queued as removed")
+	}
+}
+
+func TestSchedulerDrain(t *testing.T) {
+	p := newWorkerPool(1, schedulingPolicy{}, newServerMetrics(t.TempDir()))
+	release := hold(t, p, "holder")
+	grants := make(chan grant, 1)
+	startAcquire(context.Background(), t, p, "queued", workTicket{principal: "alice"}, nil, grants)
+
+	p.drain()
+	if g := nextGrant(t, grants); !errors.Is(g.err, errPoolDraining) {
+		t.Fatalf("queued call returned %v, want %v", g.err, errPoolDraining)
+	}
+	if _, err := p.acquire(context.Background(), workTicket{principal: "alice"}, nil); !errors.Is(err, errPoolDraining) {
+		t.Errorf("acquire after drain = %v, want %v", err, errPoolDraining)
+	}
+	release()
+}
+
+// positions records the last position each waiter reported
+type positions struct {
+	mu   sync.Mutex
+	last map[string]int
+}
+
+func (ps *positions) report(name string) func(int) {
+	return func(pos int) {
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		ps.last[name] = pos
+	}
+}
+
+func (ps *positions) are(want map[string]int) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for name, pos := range want {
+		if ps.last[name] != pos {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSchedulerPositions(t *testing.T) {
+	p := newWorkerPool(1, schedulingPolicy{}, newServerMetrics(t.TempDir()))
+	release := hold(t, p, "holder")
+	ps := &positions{last: map[string]int{}}
+	grants := make(chan grant, 4)
+	queue := []queued{
+		{"low", workTicket{principal: "alice", priority: low}},
+		{"normal1", workTicket{principal: "alice", priority: normal}},
+		{"normal2", workTicket{principal: "bob", priority: normal}},
+		{"high", workTicket{principal: "carol", priority: high}},
+	}
+	// each reports its place on arrival
+	arrival := map[string]int{"low": 1, "normal1": 1, "normal2": 2, "high": 1}
+	for _, q := range queue {
+		startAcquire(context.Background(), t, p, q.name, q.ticket, ps.report(q.name), grants)
+		waitFor(t, func() bool { return ps.are(map[string]int{q.name: arrival[q.name]}) })
+	}
+
+	// and its new place once jobs queued ahead of it, at most every
+	// positionInterval
+	waitFor(t, func() bool { return ps.are(map[string]int{"low": 4, "normal1": 2, "normal2": 3, "high": 1}) })
+
+	release()
+	if g := nextGrant(t, grants); g.name != "high" {
+		t.Fatalf("granted %s, want high", g.name)
+	}
+	waitFor(t, func() bool { return ps.are(map[string]int{"low": 3, "normal1": 1, "normal2": 2}) })
+}
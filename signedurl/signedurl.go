@@ -0,0 +1,161 @@
+// Package signedurl issues and checks signed URLs: time-limited links
+// that let a holder without credentials make one call, such as
+// downloading one image, on behalf of the principal the link was issued
+// to. The server signs them and the gateway and server both check them,
+// so both are configured with the same keys.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// query parameters of a signed URL
+const (
+	ParamExpires   = "expires"   // Unix time after which the URL is refused
+	ParamPrincipal = "principal" // whom the call is made for
+	ParamMaxBytes  = "max_bytes" // largest upload accepted, if limited
+	ParamKeyID     = "kid"       // key the URL was signed with
+	ParamSignature = "sig"
+)
+
+// MetadataKey is the gRPC metadata the gateway forwards a signed URL's
+// query in, so the server can check it too
+const MetadataKey = "x-signed-url"
+
+var (
+	// ErrUnsigned means a URL carries no signature
+	ErrUnsigned = errors.New("URL is not signed")
+	// ErrInvalid means a URL was tampered with, signed for another call,
+	// or signed with an unknown key
+	ErrInvalid = errors.New("invalid URL signature")
+	// ErrExpired means a URL was valid but is no longer
+	ErrExpired = errors.New("URL has expired")
+	// ErrNoActiveKey means Sign was called on keys that only verify
+	ErrNoActiveKey = errors.New("no active signing key")
+)
+
+// Grant is what a signed URL allows. The method and image ID are not in
+// the query but follow from the URL's route; they are signed all the same.
+type Grant struct {
+	Method    string // full gRPC method of the call
+	ImageID   string // image the call is about; empty for uploads
+	Principal string
+	Expires   time.Time
+	MaxBytes  int64      // 0 leaves the server's upload limit alone
+	Params    url.Values // the call's own query parameters, such as a render's size
+}
+
+// Keys signs with its active key and checks with any of them. To rotate,
+// add a new key and make it active, then drop the old one once the URLs
+// it signed have expired.
+type Keys struct {
+	active string
+	keys   map[string][]byte
+}
+
+// NewKeys returns the keys in keys, by ID, signing with active. With no
+// keys it returns nil, which accepts nothing. Keys with no active key
+// only verify; Sign refuses to use them.
+func NewKeys(keys map[string]string, active string) (*Keys, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if _, ok := keys[active]; active != "" && !ok {
+		return nil, fmt.Errorf("active key %q is not one of the configured keys", active)
+	}
+	k := &Keys{active: active, keys: make(map[string][]byte, len(keys))}
+	for id, secret := range keys {
+		if secret == "" {
+			return nil, fmt.Errorf("key %q is empty", id)
+		}
+		k.keys[id] = []byte(secret)
+	}
+	return k, nil
+}
+
+// CanSign reports whether k has an active key to sign with
+func (k *Keys) CanSign() bool {
+	return k != nil && k.active != ""
+}
+
+// Sign returns the query that grants g, or ErrNoActiveKey if k only
+// verifies
+func (k *Keys) Sign(g Grant) (url.Values, error) {
+	if !k.CanSign() {
+		return nil, ErrNoActiveKey
+	}
+	query := url.Values{}
+	for name, values := range g.Params {
+		query[name] = values
+	}
+	query.Set(ParamExpires, strconv.FormatInt(g.Expires.Unix(), 10))
+	query.Set(ParamPrincipal, g.Principal)
+	if g.MaxBytes > 0 {
+		query.Set(ParamMaxBytes, strconv.FormatInt(g.MaxBytes, 10))
+	}
+	query.Set(ParamKeyID, k.active)
+	query.Set(ParamSignature, signature(k.keys[k.active], g.Method, g.ImageID, query))
+	return query, nil
+}
+
+// Verify checks that query grants a call of method on imageID at now
+// and returns the grant. Every parameter is signed, so a URL cannot be
+// changed or extended; those of the call itself come back in Params.
+func (k *Keys) Verify(method, imageID string, query url.Values, now time.Time) (Grant, error) {
+	sig := query.Get(ParamSignature)
+	if sig == "" {
+		return Grant{}, ErrUnsigned
+	}
+	var secret []byte
+	if k != nil {
+		secret = k.keys[query.Get(ParamKeyID)]
+	}
+	if secret == nil {
+		return Grant{}, ErrInvalid
+	}
+	signed := url.Values{}
+	params := url.Values{}
+	for name, values := range query {
+		switch name {
+		case ParamSignature:
+		case ParamExpires, ParamPrincipal, ParamMaxBytes, ParamKeyID:
+			signed[name] = values
+		default:
+			signed[name], params[name] = values, values
+		}
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, method, imageID, signed))) {
+		return Grant{}, ErrInvalid
+	}
+
+	g := Grant{Method: method, ImageID: imageID, Principal: query.Get(ParamPrincipal), Params: params}
+	unix, err := strconv.ParseInt(query.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return Grant{}, ErrInvalid
+	}
+	if g.Expires = time.Unix(unix, 0); !now.Before(g.Expires) {
+		return Grant{}, ErrExpired
+	}
+	if v := query.Get(ParamMaxBytes); v != "" {
+		if g.MaxBytes, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return Grant{}, ErrInvalid
+		}
+	}
+	return g, nil
+}
+
+// signature is the unpadded base64url HMAC-SHA256 of the method, image ID
+// and the sorted, encoded query, one per line
+func signature(secret []byte, method, imageID string, query url.Values) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{method, imageID, query.Encode()}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
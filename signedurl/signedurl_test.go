@@ -0,0 +1,211 @@
+package signedurl
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	download = "/imageproc.ImageProcessor/Download"
+	upload   = "/imageproc.ImageProcessor/Upload"
+	imageID  = "573339b8-a202-47ba-b3b2-0f2982caaf0a"
+)
+
+var now = time.Unix(1_800_000_000, 0)
+
+func mustKeys(t *testing.T, keys map[string]string, active string) *Keys {
+	t.Helper()
+	k, err := NewKeys(keys, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func mustSign(t *testing.T, k *Keys, g Grant) url.Values {
+	t.Helper()
+	query, err := k.Sign(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+func TestVerify(t *testing.T) {
+	keys := mustKeys(t, map[string]string{"k1": "secret1"}, "k1")
+	signed := mustSign(t, keys, Grant{Method: download, ImageID: imageID, Principal: "alice", Expires: now.Add(time.Minute)})
+	with := func(name, value string) url.Values {
+		q := url.Values{}
+		for k, v := range signed {
+			q[k] = v
+		}
+		q.Set(name, value)
+		return q
+	}
+	without := func(name string) url.Values {
+		q := with(name, "")
+		q.Del(name)
+		return q
+	}
+
+	tests := []struct {
+		name    string
+		keys    *Keys // default: the signing keys
+		noKeys  bool
+		method  string
+		imageID string
+		query   url.Values
+		now     time.Time
+		want    error
+	}{
+		{name: "valid", query: signed, want: nil},
+		{name: "unsigned", query: without(ParamSignature), want: ErrUnsigned},
+		{name: "other principal", query: with(ParamPrincipal, "bob"), want: ErrInvalid},
+		{name: "later expiry", query: with(ParamExpires, "1900000000"), want: ErrInvalid},
+		{name: "added parameter", query: with("w", "4000"), want: ErrInvalid},
+		{name: "added max_bytes", query: with(ParamMaxBytes, "1"), want: ErrInvalid},
+		{name: "forged signature", query: with(ParamSignature, "AAAA"), want: ErrInvalid},
+		{name: "other method", method: upload, query: signed, want: ErrInvalid},
+		{name: "other image", imageID: "0d9c1e2f-3a4b-4c5d-9e8f-7a6b5c4d3e2f", query: signed, want: ErrInvalid},
+		{name: "unknown kid", query: with(ParamKeyID, "k9"), want: ErrInvalid},
+		{name: "no kid", query: without(ParamKeyID), want: ErrInvalid},
+		{name: "other secret under the same kid", keys: mustKeys(t, map[string]string{"k1": "other"}, ""), query: signed, want: ErrInvalid},
+		{name: "no keys", noKeys: true, query: signed, want: ErrInvalid},
+		{name: "at expiry", query: signed, now: now.Add(time.Minute), want: ErrExpired},
+		{name: "expired", query: signed, now: now.Add(time.Hour), want: ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := keys
+			if tt.keys != nil || tt.noKeys {
+				k = tt.keys
+			}
+			method := download
+			if tt.method != "" {
+				method = tt.method
+			}
+			id := imageID
+			if tt.imageID != "" {
+				id = tt.imageID
+			}
+			at := now
+			if !tt.now.IsZero() {
+				at = tt.now
+			}
+			g, err := k.Verify(method, id, tt.query, at)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+			if err == nil && (g.Principal != "alice" || !g.Expires.Equal(now.Add(time.Minute)) || g.Method != download || g.ImageID != imageID) {
+				t.Errorf("Verify = %+v, does not match the signed grant", g)
+			}
+		})
+	}
+}
+
+func TestVerifyMaxBytes(t *testing.T) {
+	keys := mustKeys(t, map[string]string{"k1": "secret1"}, "k1")
+	query := mustSign(t, keys, Grant{Method: upload, Principal: "alice", Expires: now.Add(time.Minute), MaxBytes: 1 << 20})
+	if got := query.Get(ParamMaxBytes); got != "1048576" {
+		t.Fatalf("%s = %q, want 1048576", ParamMaxBytes, got)
+	}
+	g, err := keys.Verify(upload, "", query, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.MaxBytes != 1<<20 {
+		t.Errorf("MaxBytes = %d, want %d", g.MaxBytes, 1<<20)
+	}
+
+	unlimited := mustSign(t, keys, Grant{Method: upload, Principal: "alice", Expires: now.Add(time.Minute)})
+	if unlimited.Has(ParamMaxBytes) {
+		t.Errorf("unlimited grant carries %s=%s", ParamMaxBytes, unlimited.Get(ParamMaxBytes))
+	}
+	// raising the limit of a signed URL breaks it
+	unlimited.Set(ParamMaxBytes, "1073741824")
+	if _, err := keys.Verify(upload, "", unlimited, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify with an added %s = %v, want %v", ParamMaxBytes, err, ErrInvalid)
+	}
+}
+
+func TestVerifyParams(t *testing.T) {
+	keys := mustKeys(t, map[string]string{"k1": "secret1"}, "k1")
+	params := url.Values{"w": {"400"}, "fmt": {"png"}}
+	query := mustSign(t, keys, Grant{Method: download, ImageID: imageID, Principal: "alice", Expires: now.Add(time.Minute), Params: params})
+	g, err := keys.Verify(download, imageID, query, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Params.Encode() != params.Encode() {
+		t.Errorf("Params = %v, want %v", g.Params, params)
+	}
+	query.Set("w", "4000")
+	if _, err := keys.Verify(download, imageID, query, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify with a changed parameter = %v, want %v", err, ErrInvalid)
+	}
+	query.Del("w")
+	if _, err := keys.Verify(download, imageID, query, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify with a dropped parameter = %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	grant := Grant{Method: download, ImageID: imageID, Principal: "alice", Expires: now.Add(time.Minute)}
+	before := mustKeys(t, map[string]string{"k1": "secret1"}, "k1")
+	old := mustSign(t, before, grant)
+
+	// k2 is added and made active; k1 still verifies what it signed
+	during := mustKeys(t, map[string]string{"k1": "secret1", "k2": "secret2"}, "k2")
+	fresh := mustSign(t, during, grant)
+	if got := fresh.Get(ParamKeyID); got != "k2" {
+		t.Fatalf("signed with %q, want the active key k2", got)
+	}
+	for name, q := range map[string]url.Values{"old": old, "fresh": fresh} {
+		if _, err := during.Verify(download, imageID, q, now); err != nil {
+			t.Errorf("%s URL during rotation: %v", name, err)
+		}
+	}
+	if _, err := before.Verify(download, imageID, fresh, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("k2 URL on a verifier without k2 = %v, want %v", err, ErrInvalid)
+	}
+
+	// once k1 is dropped, its URLs stop working
+	after := mustKeys(t, map[string]string{"k2": "secret2"}, "k2")
+	if _, err := after.Verify(download, imageID, old, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("k1 URL after k1 was dropped = %v, want %v", err, ErrInvalid)
+	}
+	if _, err := after.Verify(download, imageID, fresh, now); err != nil {
+		t.Errorf("k2 URL after rotation: %v", err)
+	}
+}
+
+func TestNewKeys(t *testing.T) {
+	if k, err := NewKeys(nil, ""); k != nil || err != nil {
+		t.Errorf("NewKeys(nil) = %v, %v; want nil, nil", k, err)
+	}
+	if _, err := NewKeys(map[string]string{"k1": "secret1"}, "k2"); err == nil {
+		t.Error("NewKeys accepted an active key that is not configured")
+	}
+	if _, err := NewKeys(map[string]string{"k1": ""}, "k1"); err == nil {
+		t.Error("NewKeys accepted an empty secret")
+	}
+}
+
+func TestSignWithoutActiveKey(t *testing.T) {
+	grant := Grant{Method: download, ImageID: imageID, Principal: "alice", Expires: now.Add(time.Minute)}
+	// a gateway's keys only verify
+	verifyOnly := mustKeys(t, map[string]string{"k1": "secret1"}, "")
+	for name, k := range map[string]*Keys{"verify only": verifyOnly, "no keys": nil} {
+		if k.CanSign() {
+			t.Errorf("%s: CanSign = true", name)
+		}
+		if q, err := k.Sign(grant); !errors.Is(err, ErrNoActiveKey) || q != nil {
+			t.Errorf("%s: Sign = %v, %v; want %v", name, q, err, ErrNoActiveKey)
+		}
+	}
+	if k := mustKeys(t, map[string]string{"k1": "secret1"}, "k1"); !k.CanSign() {
+		t.Error("CanSign = false with an active key")
+	}
+}
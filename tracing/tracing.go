@@ -0,0 +1,161 @@
+// Package tracing configures OpenTelemetry for the server and gateway binaries.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporter names accepted by Config.Exporter.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// Config selects where spans are sent.
+type Config struct {
+	Exporter     string  `yaml:"exporter" toml:"exporter" flag:"trace-exporter" usage:"span exporter: none, stdout, file or otlp"`
+	File         string  `yaml:"file" toml:"file" flag:"trace-file" usage:"output file for the file span exporter"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" toml:"otlp_endpoint" flag:"otlp-endpoint" usage:"OTLP/gRPC collector address"`
+	OTLPInsecure bool    `yaml:"otlp_insecure" toml:"otlp_insecure" flag:"otlp-insecure" usage:"connect to the OTLP collector without TLS"`
+	SampleRatio  float64 `yaml:"sample_ratio" toml:"sample_ratio" flag:"trace-sample-ratio" usage:"fraction of new traces to sample (0..1)"`
+}
+
+// DefaultConfig disables exporting but keeps the other options ready.
+func DefaultConfig() Config {
+	return Config{
+		Exporter:     ExporterNone,
+		File:         "traces.json",
+		OTLPEndpoint: "localhost:4317",
+		OTLPInsecure: true,
+		SampleRatio:  1,
+	}
+}
+
+// Validate reports an unknown exporter or an out-of-range sample ratio.
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case ExporterNone, ExporterStdout, ExporterOTLP:
+	case ExporterFile:
+		if c.File == "" {
+			return fmt.Errorf("trace-file: required for the file exporter")
+		}
+	default:
+		return fmt.Errorf("trace-exporter: unknown exporter %q", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("trace-sample-ratio: %v is outside 0..1", c.SampleRatio)
+	}
+	return nil
+}
+
+// Setup installs a global TracerProvider and the W3C trace-context
+// propagator for service. The returned func flushes and stops the
+// exporter and must be called before the process exits.
+func Setup(ctx context.Context, service string, cfg Config) (func(context.Context) error, error) {
+	// propagation is always enabled so traces pass through even when
+	// this process does not export anything itself
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporter, closer, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", service),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing resource: %w", err)
+	}
+
+	// local exporters write synchronously so spans are on disk even if the
+	// process is killed; OTLP batches to keep network round-trips down
+	var processor sdktrace.SpanProcessor
+	if cfg.Exporter == ExporterOTLP {
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	} else {
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// newExporter builds the span exporter named by cfg.Exporter. A nil
+// exporter means tracing is disabled.
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return nil, nil, nil
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exp, nil, err
+	case ExporterFile:
+		if cfg.File == "" {
+			return nil, nil, fmt.Errorf("tracing: file exporter needs a file path")
+		}
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tracing: open %s: %w", cfg.File, err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exp, f, nil
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.OTLPEndpoint)}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exp, err := otlptracegrpc.New(ctx, opts...)
+		return exp, nil, err
+	default:
+		return nil, nil, fmt.Errorf("tracing: unknown exporter %q", cfg.Exporter)
+	}
+}
+
+// LogFields returns trace_id and span_id key/value pairs for the span in
+// ctx, ready to pass to a zap SugaredLogger's *w methods. It returns nil
+// when ctx carries no valid span.
+func LogFields(ctx context.Context) []interface{} {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []interface{}{"trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String()}
+}